@@ -1,7 +1,10 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -13,8 +16,13 @@ import (
 	"tiny11-builder/internal/app"
 	"tiny11-builder/internal/cli"
 	"tiny11-builder/internal/config"
+	"tiny11-builder/internal/history"
 	"tiny11-builder/internal/logger"
+	"tiny11-builder/internal/plan"
+	"tiny11-builder/internal/registry"
+	"tiny11-builder/internal/types"
 	"tiny11-builder/internal/utils"
+	"tiny11-builder/internal/webhook"
 )
 
 func main() {
@@ -24,22 +32,66 @@ func main() {
 	}
 	utils.SetConsoleTitle("Tiny11 Builder - Miku Edition 🎀")
 
+	//  子命令
+	if len(os.Args) > 1 && os.Args[1] == "profile" {
+		if err := cli.RunProfileCommand(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, utils.Colorize("错误: "+err.Error(), utils.MikuRed))
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "tweaks" {
+		if err := cli.RunTweaksCommand(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, utils.Colorize("错误: "+err.Error(), utils.MikuRed))
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "api-token" {
+		if err := cli.RunAPITokenCommand(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, utils.Colorize("错误: "+err.Error(), utils.MikuRed))
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "history" {
+		if err := cli.RunHistoryCommand(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, utils.Colorize("错误: "+err.Error(), utils.MikuRed))
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "webhook" {
+		if err := cli.RunWebhookCommand(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, utils.Colorize("错误: "+err.Error(), utils.MikuRed))
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "regdiff" {
+		if err := cli.RunRegDiffCommand(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, utils.Colorize("错误: "+err.Error(), utils.MikuRed))
+			os.Exit(1)
+		}
+		return
+	}
+
 	//  手动检测 API 模式 
 	apiMode := false
-	apiPort := 8080
-
-	for i, arg := range os.Args[1:] {
+	for _, arg := range os.Args[1:] {
 		if arg == "-api" || arg == "--api" {
 			apiMode = true
 		}
-		if (arg == "-port" || arg == "--port") && i+1 < len(os.Args)-1 {
-			fmt.Sscanf(os.Args[i+2], "%d", &apiPort)
-		}
 	}
 
 	//  API 模式 
 	if apiMode {
-		runAPIMode(apiPort)
+		opts, err := cli.ParseAPIArgs(os.Args[1:])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, utils.Colorize("错误: "+err.Error(), utils.MikuRed))
+			os.Exit(1)
+		}
+		runAPIMode(opts)
 		return
 	}
 
@@ -60,8 +112,19 @@ func runCommandLineMode() {
 	log := logger.NewLogger("tiny11builder")
 	defer log.Close()
 
+	// 使用 cli.ParseArgsUnified() 解析参数
+	cfg, buildMode, themeName, err := cli.ParseArgsUnified(os.Args[1:])
+	if err != nil {
+		log.Error("参数解析错误: %v", err)
+		cli.PrintUsageUnified()
+		os.Exit(1)
+	}
+
+	// 回放和模拟模式不会真正执行系统命令，无需管理员权限
+	offline := utils.IsOffline(cfg.Runner)
+
 	// 验证管理员权限
-	if !cli.IsAdmin() {
+	if !offline && !cli.IsAdmin() {
 		log.Error("需要管理员权限运行此程序")
 		fmt.Println()
 		fmt.Println(utils.Colorize("请以管理员身份运行此程序:", utils.MikuYellow))
@@ -71,23 +134,22 @@ func runCommandLineMode() {
 		os.Exit(1)
 	}
 
-	// 使用 cli.ParseArgsUnified() 解析参数
-	cfg, buildMode, themeName, err := cli.ParseArgsUnified(os.Args[1:])
-	if err != nil {
-		log.Error("参数解析错误: %v", err)
-		cli.PrintUsageUnified()
-		os.Exit(1)
+	// 清理旧目录 (继续构建和预演时保留)
+	if !cfg.Resume && !cfg.Plan {
+		cleanupOldBuild(cfg, log)
 	}
 
-	// 清理旧目录
-	cleanupOldBuild(cfg, log)
-
 	// 创建目录
 	if err := cfg.EnsureDirectories(); err != nil {
 		log.Error("创建工作目录失败: %v", err)
 		os.Exit(1)
 	}
 
+	if err := cli.PrepareSimulation(cfg); err != nil {
+		log.Error("%v", err)
+		os.Exit(1)
+	}
+
 	// 应用主题名称
 	if themeName != "" && themeName != "default" {
 		cfg.ThemeName = themeName
@@ -100,8 +162,16 @@ func runCommandLineMode() {
 		buildMode = "standard"
 	}
 
-	//  预装软件选择 
-	selectPreinstallApps(cfg, log)
+	// 预演: 只分析镜像，不执行构建
+	if cfg.Plan {
+		runPlan(cfg, buildMode, log)
+		return
+	}
+
+	//  预装软件选择 (继续构建时使用检查点中记录的选择，-preinstall 指定时不再询问)
+	if !cfg.Resume && !cfg.PreinstallSet {
+		selectPreinstallApps(cfg, log)
+	}
 
 	runtime.GOMAXPROCS(runtime.NumCPU())
 
@@ -172,12 +242,12 @@ func runInteractiveMode() {
 }
 
 // API 模式
-func runAPIMode(port int) {
+func runAPIMode(opts api.Options) {
 	log := logger.NewLogger("api-server")
 	defer log.Close()
 
-	log.Info("启动 API 服务器模式 (端口: %d)", port)
-	server := api.NewServer(port, log)
+	log.Info("启动 API 服务器模式 (%s 端口: %d)", opts.Bind, opts.Port)
+	server := api.NewServer(opts, log)
 	if err := server.Start(); err != nil {
 		log.Error("API服务器启动失败: %v", err)
 		os.Exit(1)
@@ -193,7 +263,7 @@ func cleanupOldBuild(cfg *config.Config, log *logger.Logger) {
 		spinner.Start()
 
 		// 先尝试卸载可能挂载的镜像
-		utils.RunCommand("dism", "/English", "/Unmount-Image",
+		utils.RunWith(cfg.CommandRunner(), "dism", "/English", "/Unmount-Image",
 			fmt.Sprintf("/MountDir:%s", cfg.ScratchDir), "/Discard")
 		time.Sleep(1 * time.Second)
 
@@ -212,38 +282,74 @@ func cleanupOldBuild(cfg *config.Config, log *logger.Logger) {
 	}
 }
 
+// modeWarnings 需要确认才能构建的模式
+var modeWarnings = map[types.BuildMode]func() bool{
+	types.ModeCore: showCoreWarning,
+	types.ModeNano: showNanoWarning,
+}
+
+// webhookCloseTimeout 构建结束后等待 webhook 投递的最长时间
+const webhookCloseTimeout = time.Minute
+
 // 执行构建
 func executeBuild(cfg *config.Config, buildMode string, log *logger.Logger) {
-	var builder app.Builder
-
-	switch buildMode {
-	case "standard":
-		cfg.CoreMode = false
-		builder = app.NewTiny11Builder(cfg, log)
-	case "core":
-		cfg.CoreMode = true
-		if !showCoreWarning() {
-			fmt.Println(utils.Colorize("\n操作已取消。", utils.MikuCyan))
-			os.Exit(0)
-		}
-		builder = app.NewTiny11CoreBuilder(cfg, log)
-	case "nano":
-		cfg.CoreMode = true
-		if !showNanoWarning() {
-			fmt.Println(utils.Colorize("\n操作已取消。", utils.MikuCyan))
-			os.Exit(0)
-		}
-		builder = app.NewTiny11NanoBuilder(cfg, log)
-	default:
-		log.Error("无效的构建模式: %s", buildMode)
+	mode, err := app.ParseMode(buildMode)
+	if err != nil {
+		log.Error("%v", err)
+		os.Exit(1)
+	}
+
+	if confirm := modeWarnings[mode]; confirm != nil && !confirm() {
+		fmt.Println(utils.Colorize("\n操作已取消。", utils.MikuCyan))
+		os.Exit(0)
+	}
+
+	builder, err := app.NewBuilder(mode, cfg, log)
+	if err != nil {
+		log.Error("%v", err)
 		os.Exit(1)
 	}
 
 	log.Info("工作目录: %s", cfg.WorkDir)
 	log.Info("输出路径: %s", cfg.OutputISO)
 
-	if err := builder.Build(); err != nil {
-		log.Error("构建失败: %v", err)
+	ctx, stop := cli.InterruptContext(log)
+	defer stop()
+
+	// 记录步骤耗时，构建结束后写入构建历史；发送 webhook 通知 (模拟和回放不记录)
+	var steps *history.Recorder
+	var hooks *webhook.Notifier
+	id := history.NewID()
+	started := time.Now()
+	job := webhook.RunningJob(id, history.SourceCLI, cfg, mode, types.JobRunning, started, &started)
+	if !utils.IsOffline(cfg.Runner) {
+		steps = history.NewRecorder()
+		hooks = loadWebhooks(cfg, log)
+		log.SetEventSink(func(e logger.Event) {
+			steps.Observe(e)
+			if e.Type == logger.EventStep && e.Status == logger.StepFinished && hooks.Enabled() {
+				if t, ok := steps.Step(e.Step); ok {
+					hooks.Notify(webhook.EventStepCompleted, job, webhook.Step(t, e.Steps))
+				}
+			}
+		})
+		hooks.Notify(webhook.EventStarted, job, nil)
+	}
+	err = builder.Build(ctx)
+	if steps != nil {
+		rec := recordBuild(cfg, mode, id, steps, started, builder, log, err)
+		hooks.Notify(webhook.FinishEvent(rec.State), webhook.RecordJob(rec), nil)
+		closeWebhooks(hooks, log)
+	}
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			log.Warn("构建已取消")
+		} else {
+			log.Error("构建失败: %v", err)
+		}
+		if utils.FileExists(cfg.CheckpointFile) {
+			log.Info("构建进度已保存，解决问题后可使用 -resume 从中断的步骤继续")
+		}
 		fmt.Println()
 		fmt.Print(utils.Colorize("按Enter键退出...", utils.MikuGray))
 		fmt.Scanln()
@@ -253,9 +359,86 @@ func executeBuild(cfg *config.Config, buildMode string, log *logger.Logger) {
 	showSuccessInfo(builder, log)
 }
 
+// 写入构建历史
+func recordBuild(cfg *config.Config, mode types.BuildMode, id string, steps *history.Recorder, started time.Time, builder app.Builder, log *logger.Logger, err error) types.BuildRecord {
+	rec := steps.Record(cfg, mode, started, &started, err)
+	rec.ID = id
+	rec.Source = history.SourceCLI
+	if path := log.Path(); path != "" {
+		rec.LogFile, _ = filepath.Abs(path)
+	}
+	if err == nil {
+		rec.OutputISO = builder.GetOutputISO()
+		spinner := utils.NewSpinner("正在计算 ISO 校验和...")
+		spinner.Start()
+		sum, hashErr := utils.FileSHA256(rec.OutputISO)
+		spinner.Stop(hashErr == nil)
+		if hashErr != nil {
+			log.Warn("计算 ISO 校验和失败: %v", hashErr)
+		} else {
+			rec.SHA256 = sum
+			log.Info("ISO SHA-256: %s", sum)
+		}
+	}
+	if err := history.NewStore(cfg.HistoryFile).Append(rec); err != nil {
+		log.Warn("写入构建历史失败: %v", err)
+	}
+	return rec
+}
+
+// 读取程序目录中的 webhook 配置，配置无效时只警告
+func loadWebhooks(cfg *config.Config, log *logger.Logger) *webhook.Notifier {
+	hooks, err := webhook.LoadConfig(cfg.WebhooksFile)
+	if err != nil {
+		log.Warn("%v，不发送 webhook 通知", err)
+	}
+	return webhook.NewNotifier(hooks, log)
+}
+
+// 等待 webhook 通知投递完成 (包括重试)
+func closeWebhooks(hooks *webhook.Notifier, log *logger.Logger) {
+	if !hooks.Enabled() {
+		return
+	}
+	spinner := utils.NewSpinner("正在发送 webhook 通知...")
+	spinner.Start()
+	ok := hooks.Close(webhookCloseTimeout)
+	spinner.Stop(ok)
+	if !ok {
+		log.Warn("webhook 通知在 %s 内未全部投递完成，已放弃", webhookCloseTimeout)
+	}
+}
+
+// 构建预演
+func runPlan(cfg *config.Config, buildMode string, log *logger.Logger) {
+	result, err := plan.NewPlanner(cfg, log, buildMode).Run()
+	if err != nil {
+		log.Error("预演失败: %v", err)
+		os.Exit(1)
+	}
+
+	result.Print()
+
+	if cfg.PlanFile != "" {
+		if err := result.WriteJSON(cfg.PlanFile); err != nil {
+			log.Error("写入预演结果失败: %v", err)
+			os.Exit(1)
+		}
+		log.Success("预演结果已写入: %s", cfg.PlanFile)
+	}
+
+	if cfg.ExportReg != "" {
+		if err := registry.WriteRegFile(cfg.ExportReg, result.Registry); err != nil {
+			log.Error("导出 .reg 文件失败: %v", err)
+			os.Exit(1)
+		}
+		log.Success("注册表优化已导出: %s", cfg.ExportReg)
+	}
+}
+
 // 预装软件选择
 func selectPreinstallApps(cfg *config.Config, log *logger.Logger) {
-	preinstallDir := filepath.Join(cfg.WorkDir, "preinstall")
+	preinstallDir := cfg.PreinstallDir
 	configFile := filepath.Join(preinstallDir, "preinstall.json")
 
 	if !utils.FileExists(configFile) {
@@ -479,10 +662,10 @@ func showNanoWarning() bool {
 	fmt.Println()
 	fmt.Print(utils.Colorize("确认继续? 请输入 'I UNDERSTAND' (大写): ", utils.MikuPink+utils.Bold))
 
-	var confirm string
-	fmt.Scanln(&confirm)
+	// 确认语包含空格，需读取整行 (Scanln 只读取第一个单词)
+	confirm, _ := bufio.NewReader(os.Stdin).ReadString('\n')
 
-	return confirm == "I UNDERSTAND"
+	return strings.TrimSpace(confirm) == "I UNDERSTAND"
 }
 
 func showSuccessInfo(builder app.Builder, log *logger.Logger) {
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"tiny11-builder/internal/app"
@@ -79,9 +81,16 @@ func main() {
 	// 创建应用实例
 	builder := app.NewTiny11CoreBuilder(config, log)
 
-	// 执行构建
-	if err := builder.Build(); err != nil {
-		log.Error("构建失败: %v", err)
+	// 执行构建 (Ctrl+C 取消构建并卸载镜像)
+	ctx, stop := cli.InterruptContext(log)
+	defer stop()
+
+	if err := builder.Build(ctx); err != nil {
+		if errors.Is(err, context.Canceled) {
+			log.Warn("构建已取消")
+		} else {
+			log.Error("构建失败: %v", err)
+		}
 		fmt.Println()
 		fmt.Print(utils.Colorize("按Enter键退出...", utils.MikuGray))
 		fmt.Scanln()
@@ -0,0 +1,235 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"tiny11-builder/internal/types"
+)
+
+// 产物类型
+const (
+	artifactISO    = "iso"
+	artifactLog    = "log"
+	artifactReport = "report"
+)
+
+// regDiffExts 注册表差异报告的文件 (见 registry.RegDiff.WriteFiles)
+var regDiffExts = []string{".regdiff.txt", ".regdiff.json", ".regdiff.reg"}
+
+// artifactFile 任务产生的一个文件
+type artifactFile struct {
+	kind string
+	path string
+	info os.FileInfo
+}
+
+func (f artifactFile) name() string {
+	return filepath.Base(f.path)
+}
+
+// artifactFiles 任务留下的文件 (调用时持有队列的锁)
+//
+// 报告和默认的输出 ISO 按工作目录存放，之后同一目录中的任务会覆盖它们，
+// 因此只列出在本任务运行期间写入的文件。
+func (j *job) artifactFiles() []artifactFile {
+	if j.StartedAt == nil || j.FinishedAt == nil {
+		return nil
+	}
+
+	iso := j.OutputISO
+	if iso == "" {
+		iso = j.cfg.OutputISO
+	}
+	candidates := []artifactFile{{kind: artifactISO, path: iso}}
+	prefix := strings.TrimSuffix(iso, filepath.Ext(iso))
+	for _, ext := range regDiffExts {
+		candidates = append(candidates, artifactFile{kind: artifactReport, path: prefix + ext})
+	}
+	candidates = append(candidates,
+		artifactFile{kind: artifactReport, path: j.cfg.TweakReport},
+		artifactFile{kind: artifactReport, path: j.cfg.ExportReg},
+		artifactFile{kind: artifactLog, path: j.logFile},
+	)
+
+	// 文件系统的时间精度可能低于一秒
+	from := j.StartedAt.Add(-time.Second)
+	to := j.FinishedAt.Add(time.Second)
+
+	var files []artifactFile
+	seen := make(map[string]bool)
+	for _, f := range candidates {
+		if f.path == "" {
+			continue
+		}
+		info, err := os.Stat(f.path)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		if info.ModTime().Before(from) || info.ModTime().After(to) {
+			continue
+		}
+		f.info = info
+		if seen[f.name()] {
+			continue
+		}
+		seen[f.name()] = true
+		files = append(files, f)
+	}
+	return files
+}
+
+// artifacts 返回已结束任务的产物
+func (q *jobQueue) artifacts(id string) ([]artifactFile, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	j, ok := q.jobs[id]
+	if !ok {
+		return nil, errJobNotFound
+	}
+	if !j.Finished() {
+		return nil, errJobNotFinished
+	}
+	return j.artifactFiles(), nil
+}
+
+// checksums 文件的 SHA-256 (按路径缓存，文件大小或修改时间变化后重新计算)
+type checksums struct {
+	mu   sync.Mutex
+	sums map[string]checksum
+}
+
+type checksum struct {
+	size    int64
+	modTime time.Time
+	sum     string
+}
+
+func newChecksums() *checksums {
+	return &checksums{sums: make(map[string]checksum)}
+}
+
+// cached 返回已计算的校验和
+func (c *checksums) cached(path string, info os.FileInfo) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.sums[path]
+	if !ok || s.size != info.Size() || !s.modTime.Equal(info.ModTime()) {
+		return "", false
+	}
+	return s.sum, true
+}
+
+// compute 返回文件的校验和，没有缓存时读取整个文件计算
+func (c *checksums) compute(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	if sum, ok := c.cached(path, info); ok {
+		return sum, nil
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+
+	c.mu.Lock()
+	c.sums[path] = checksum{size: info.Size(), modTime: info.ModTime(), sum: sum}
+	c.mu.Unlock()
+	return sum, nil
+}
+
+// handleListArtifacts 列出已结束任务的产物: 输出 ISO、注册表报告和任务日志
+func (s *Server) handleListArtifacts(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	files, ok := s.jobArtifacts(w, id)
+	if !ok {
+		return
+	}
+
+	artifacts := make([]types.Artifact, 0, len(files))
+	for _, f := range files {
+		sum, err := s.sums.compute(f.path)
+		if err != nil {
+			s.log.Warn("计算校验和失败 %s: %v", f.path, err)
+			continue
+		}
+		artifacts = append(artifacts, types.Artifact{
+			Name:    f.name(),
+			Kind:    f.kind,
+			Size:    f.info.Size(),
+			SHA256:  sum,
+			ModTime: f.info.ModTime(),
+			URL:     "/api/jobs/" + url.PathEscape(id) + "/artifacts/" + url.PathEscape(f.name()),
+		})
+	}
+	s.sendJSON(w, artifacts)
+}
+
+// handleDownloadArtifact 下载任务产物，支持 Range 分段下载和断点续传
+func (s *Server) handleDownloadArtifact(w http.ResponseWriter, r *http.Request) {
+	files, ok := s.jobArtifacts(w, r.PathValue("id"))
+	if !ok {
+		return
+	}
+
+	name := r.PathValue("name")
+	for _, f := range files {
+		if f.name() != name {
+			continue
+		}
+		file, err := os.Open(f.path)
+		if err != nil {
+			s.sendErrorStatus(w, http.StatusNotFound, "文件不存在", err)
+			return
+		}
+		defer file.Close()
+		info, err := file.Stat()
+		if err != nil {
+			s.sendErrorStatus(w, http.StatusInternalServerError, "读取文件失败", err)
+			return
+		}
+
+		// 已计算过校验和时用作 ETag，客户端续传时可用 If-Range 确认文件未变
+		if sum, ok := s.sums.cached(f.path, info); ok {
+			w.Header().Set("ETag", `"`+sum+`"`)
+		}
+		w.Header().Set("Content-Disposition",
+			mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+		http.ServeContent(w, r, name, info.ModTime(), file)
+		return
+	}
+	s.sendErrorStatus(w, http.StatusNotFound, "文件不存在", errors.New(name))
+}
+
+// jobArtifacts 返回任务的产物，失败时已写入错误响应
+func (s *Server) jobArtifacts(w http.ResponseWriter, id string) ([]artifactFile, bool) {
+	files, err := s.queue.artifacts(id)
+	switch {
+	case errors.Is(err, errJobNotFound):
+		s.sendErrorStatus(w, http.StatusNotFound, "任务不存在", err)
+		return nil, false
+	case err != nil:
+		s.sendErrorStatus(w, http.StatusConflict, "任务尚未结束", err)
+		return nil, false
+	}
+	return files, true
+}
@@ -0,0 +1,250 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Permission 令牌的权限
+type Permission string
+
+const (
+	// PermRead 只读: 查询任务、状态、事件流和产物，以及主题等列表
+	PermRead Permission = "read"
+	// PermBuild 在只读的基础上提交和取消构建，上传主题和安装包
+	PermBuild Permission = "build"
+)
+
+// ParsePermission 解析权限名称
+func ParsePermission(name string) (Permission, error) {
+	switch p := Permission(strings.ToLower(name)); p {
+	case PermRead, PermBuild:
+		return p, nil
+	}
+	return "", fmt.Errorf("无效的权限: %s (应为 read 或 build)", name)
+}
+
+// allows 是否包含所需的权限
+func (p Permission) allows(need Permission) bool {
+	return p == PermBuild || p == need
+}
+
+// tokenPrefix 生成的令牌的前缀，便于在配置和日志中识别
+const tokenPrefix = "t11_"
+
+// Token 令牌文件中的一项 (只保存令牌的 SHA-256)
+type Token struct {
+	Name       string     `json:"name"`
+	Hash       string     `json:"hash"`
+	Permission Permission `json:"permission"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+// TokenStore API 令牌文件
+//
+// 令牌为 32 字节随机数，文件中只保存其 SHA-256；令牌本身只在创建时显示一次。
+type TokenStore struct {
+	Version int      `json:"version"`
+	Tokens  []*Token `json:"tokens"`
+
+	path string
+	mu   sync.RWMutex
+}
+
+const tokenStoreVersion = 1
+
+// LoadTokens 读取令牌文件，文件不存在时返回空的令牌文件
+func LoadTokens(path string) (*TokenStore, error) {
+	s := &TokenStore{Version: tokenStoreVersion, path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取令牌文件失败: %w", err)
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("解析令牌文件 %s 失败: %w", path, err)
+	}
+	for _, t := range s.Tokens {
+		if _, err := ParsePermission(string(t.Permission)); err != nil {
+			return nil, fmt.Errorf("令牌文件 %s 中的令牌 %s: %w", path, t.Name, err)
+		}
+	}
+	return s, nil
+}
+
+// Path 令牌文件路径
+func (s *TokenStore) Path() string {
+	return s.path
+}
+
+// Empty 是否没有令牌 (不启用认证)
+func (s *TokenStore) Empty() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.Tokens) == 0
+}
+
+// List 按名称排序的令牌
+func (s *TokenStore) List() []Token {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	tokens := make([]Token, 0, len(s.Tokens))
+	for _, t := range s.Tokens {
+		tokens = append(tokens, *t)
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].Name < tokens[j].Name })
+	return tokens
+}
+
+// Add 生成新令牌并保存，返回令牌明文 (之后无法再次获取)
+func (s *TokenStore) Add(name string, perm Permission) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("令牌名称不能为空")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range s.Tokens {
+		if t.Name == name {
+			return "", fmt.Errorf("令牌 %s 已存在", name)
+		}
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("生成令牌失败: %w", err)
+	}
+	raw := tokenPrefix + hex.EncodeToString(b)
+	s.Tokens = append(s.Tokens, &Token{
+		Name:       name,
+		Hash:       hashToken(raw),
+		Permission: perm,
+		CreatedAt:  time.Now(),
+	})
+	if err := s.save(); err != nil {
+		s.Tokens = s.Tokens[:len(s.Tokens)-1]
+		return "", err
+	}
+	return raw, nil
+}
+
+// Remove 删除令牌并保存
+func (s *TokenStore) Remove(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, t := range s.Tokens {
+		if t.Name == name {
+			s.Tokens = append(s.Tokens[:i], s.Tokens[i+1:]...)
+			return s.save()
+		}
+	}
+	return fmt.Errorf("令牌不存在: %s", name)
+}
+
+// save 写入令牌文件 (调用时持有锁)
+func (s *TokenStore) save() error {
+	s.Version = tokenStoreVersion
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	// 文件只包含哈希，仍然只允许当前用户读写
+	if err := os.WriteFile(s.path, data, 0600); err != nil {
+		return fmt.Errorf("写入令牌文件失败: %w", err)
+	}
+	return nil
+}
+
+// lookup 查找与令牌明文匹配的令牌
+func (s *TokenStore) lookup(raw string) (*Token, bool) {
+	if raw == "" {
+		return nil, false
+	}
+	hash := []byte(hashToken(raw))
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, t := range s.Tokens {
+		if subtle.ConstantTimeCompare(hash, []byte(t.Hash)) == 1 {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// requestToken 请求中的令牌
+//
+// 支持 Authorization: Bearer <token> 和 X-API-Key 请求头；浏览器的 EventSource
+// 无法设置请求头，GET 请求也可以使用 access_token 查询参数。
+func requestToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		if scheme, token, ok := strings.Cut(auth, " "); ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+		return ""
+	}
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if r.Method == http.MethodGet {
+		return r.URL.Query().Get("access_token")
+	}
+	return ""
+}
+
+// requiredPermission 请求需要的权限: 查询为 read，其余 (提交、取消) 为 build
+func requiredPermission(r *http.Request) Permission {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return PermRead
+	}
+	return PermBuild
+}
+
+// authenticate 校验令牌和权限的中间件
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := s.tokens.lookup(requestToken(r))
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="tiny11builder"`)
+			s.sendErrorStatus(w, http.StatusUnauthorized, "需要有效的 API 令牌", errUnauthorized)
+			return
+		}
+		if need := requiredPermission(r); !token.Permission.allows(need) {
+			s.sendErrorStatus(w, http.StatusForbidden, "令牌权限不足",
+				fmt.Errorf("令牌 %s 的权限为 %s，该操作需要 %s", token.Name, token.Permission, need))
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), tokenKey{}, token.Name)))
+	})
+}
+
+var errUnauthorized = errors.New("未提供令牌或令牌无效")
+
+type tokenKey struct{}
+
+// tokenName 请求使用的令牌名称 (未启用认证时为空)
+func tokenName(r *http.Request) string {
+	name, _ := r.Context().Value(tokenKey{}).(string)
+	return name
+}
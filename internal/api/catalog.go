@@ -0,0 +1,258 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"tiny11-builder/internal/config"
+	"tiny11-builder/internal/preinstall"
+	"tiny11-builder/internal/theme"
+	"tiny11-builder/internal/types"
+	"tiny11-builder/internal/utils"
+)
+
+// 上传大小限制
+const (
+	maxThemeUpload     = 512 << 20
+	maxInstallerUpload = 8 << 30
+	maxFormField       = 64 << 10
+)
+
+// handleListThemes 列出主题目录中已安装的主题
+func (s *Server) handleListThemes(w http.ResponseWriter, r *http.Request) {
+	cfg := config.NewConfig()
+	themes := []types.ThemeInfo{}
+	if !utils.DirExists(cfg.ThemesDir) {
+		s.sendJSON(w, themes)
+		return
+	}
+
+	mgr := theme.NewManager(cfg, s.log)
+	names, err := mgr.ListThemes()
+	if err != nil {
+		s.sendErrorStatus(w, http.StatusInternalServerError, "读取主题目录失败", err)
+		return
+	}
+	for _, name := range names {
+		themes = append(themes, themeInfo(mgr, name))
+	}
+	s.sendJSON(w, themes)
+}
+
+// handleUploadTheme 上传 zip 格式的主题
+//
+// multipart/form-data: file 为压缩包，name 为主题名称 (默认为压缩包中的顶层目录名)，
+// replace=true 时覆盖同名主题。
+func (s *Server) handleUploadTheme(w http.ResponseWriter, r *http.Request) {
+	cfg := config.NewConfig()
+	if err := os.MkdirAll(cfg.ThemesDir, 0755); err != nil {
+		s.sendErrorStatus(w, http.StatusInternalServerError, "创建主题目录失败", err)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxThemeUpload)
+	up, err := receiveUpload(r, cfg.ThemesDir)
+	defer up.remove()
+	if err != nil {
+		s.sendUploadError(w, err)
+		return
+	}
+	replace, _ := strconv.ParseBool(up.fields["replace"])
+
+	mgr := theme.NewManager(cfg, s.log)
+	t, err := mgr.Install(up.fields["name"], up.path, replace)
+	switch {
+	case errors.Is(err, os.ErrExist):
+		s.sendErrorStatus(w, http.StatusConflict, "主题已存在", err)
+		return
+	case err != nil:
+		s.sendError(w, "安装主题失败", err)
+		return
+	}
+	s.sendJSONStatus(w, http.StatusCreated, themeInfo(mgr, filepath.Base(t.ThemePath)))
+}
+
+// themeInfo 读取主题的信息和校验警告
+func themeInfo(mgr *theme.Manager, name string) types.ThemeInfo {
+	info := types.ThemeInfo{ID: name, Sections: []string{}}
+	t, err := mgr.ReadTheme(name)
+	if err != nil {
+		info.Error = err.Error()
+		return info
+	}
+	info.Name = t.Name
+	info.Version = t.Version
+	info.Author = t.Author
+	info.Description = t.Description
+	info.Enabled = t.Enabled
+	info.Sections = t.Sections()
+	info.Warnings = mgr.ValidateTheme(t)
+	return info
+}
+
+// handleListPreinstall 列出 preinstall.json 中的软件及其安装包是否存在
+func (s *Server) handleListPreinstall(w http.ResponseWriter, r *http.Request) {
+	cfg := config.NewConfig()
+	pc, err := preinstall.ReadConfig(cfg.PreinstallDir)
+	if err != nil {
+		s.sendErrorStatus(w, http.StatusInternalServerError, "读取预装配置失败", err)
+		return
+	}
+
+	catalog := types.PreinstallCatalog{Enabled: pc.Enabled, Apps: []types.PreinstallApp{}}
+	for _, app := range pc.Apps {
+		catalog.Apps = append(catalog.Apps, preinstallApp(cfg.PreinstallDir, app))
+	}
+	s.sendJSON(w, catalog)
+}
+
+// handleUploadInstaller 上传安装包并添加到预装软件列表
+//
+// multipart/form-data: file 为安装包，id 必填；name、description、version、
+// installCmd (默认为文件名)、silent 和 fileName (默认为上传的文件名) 可选。
+// id 已存在时替换其配置。
+func (s *Server) handleUploadInstaller(w http.ResponseWriter, r *http.Request) {
+	cfg := config.NewConfig()
+	dir := filepath.Join(cfg.PreinstallDir, preinstall.InstallersDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		s.sendErrorStatus(w, http.StatusInternalServerError, "创建安装包目录失败", err)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxInstallerUpload)
+	up, err := receiveUpload(r, dir)
+	defer up.remove()
+	if err != nil {
+		s.sendUploadError(w, err)
+		return
+	}
+
+	silent, _ := strconv.ParseBool(up.fields["silent"])
+	fileName := up.fields["fileName"]
+	if fileName == "" {
+		fileName = up.fileName
+	}
+	app, err := preinstall.AddApp(cfg.PreinstallDir, preinstall.AppPackage{
+		ID:          up.fields["id"],
+		Name:        up.fields["name"],
+		Description: up.fields["description"],
+		Version:     up.fields["version"],
+		InstallCmd:  up.fields["installCmd"],
+		Silent:      silent,
+	}, fileName, up.path)
+	switch {
+	case errors.Is(err, os.ErrExist):
+		s.sendErrorStatus(w, http.StatusConflict, "安装包文件名冲突", err)
+		return
+	case err != nil:
+		s.sendError(w, "添加预装软件失败", err)
+		return
+	}
+
+	s.log.Success("已添加预装软件: %s (%s)", app.ID, app.Source)
+	s.sendJSONStatus(w, http.StatusCreated, preinstallApp(cfg.PreinstallDir, app))
+}
+
+// preinstallApp 预装软件及其安装包的大小
+func preinstallApp(dir string, app preinstall.AppPackage) types.PreinstallApp {
+	info := types.PreinstallApp{
+		ID:          app.ID,
+		Name:        app.Name,
+		Description: app.Description,
+		Version:     app.Version,
+		Source:      app.Source,
+		InstallCmd:  app.InstallCmd,
+		Silent:      app.Silent,
+	}
+	if fi, err := os.Stat(preinstall.InstallerPath(dir, app)); err == nil && fi.Mode().IsRegular() {
+		info.Present = true
+		info.Size = fi.Size()
+	}
+	return info
+}
+
+// upload 上传请求中的表单字段和文件
+type upload struct {
+	fields   map[string]string
+	fileName string // 客户端提供的文件名
+	path     string // 保存上传内容的临时文件
+}
+
+// remove 删除临时文件 (文件已被移走时不执行任何操作)
+func (u *upload) remove() {
+	if u.path != "" {
+		os.Remove(u.path)
+	}
+}
+
+// receiveUpload 读取 multipart/form-data 请求
+//
+// file 字段的内容直接写入 dir 中的临时文件 (与目标位置在同一磁盘，之后只需移动)，
+// 不在内存中缓存；字段可以出现在文件之前或之后。
+func receiveUpload(r *http.Request, dir string) (*upload, error) {
+	u := &upload{fields: make(map[string]string)}
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return u, fmt.Errorf("需要 multipart/form-data 请求: %w", err)
+	}
+
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return u, err
+		}
+
+		if part.FormName() == "file" {
+			if u.path != "" {
+				return u, fmt.Errorf("只能上传一个文件")
+			}
+			f, err := os.CreateTemp(dir, ".upload-*")
+			if err != nil {
+				return u, err
+			}
+			u.path = f.Name()
+			u.fileName = part.FileName()
+			_, err = io.Copy(f, part)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				return u, err
+			}
+			continue
+		}
+
+		value, err := io.ReadAll(io.LimitReader(part, maxFormField+1))
+		if err != nil {
+			return u, err
+		}
+		if len(value) > maxFormField {
+			return u, fmt.Errorf("字段 %s 过长", part.FormName())
+		}
+		u.fields[part.FormName()] = string(value)
+	}
+
+	if u.path == "" {
+		return u, fmt.Errorf("缺少 file 字段")
+	}
+	return u, nil
+}
+
+// sendUploadError 上传失败: 超过大小限制时返回 413
+func (s *Server) sendUploadError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		s.sendErrorStatus(w, http.StatusRequestEntityTooLarge,
+			fmt.Sprintf("上传的文件超过 %d MB", tooLarge.Limit>>20), err)
+		return
+	}
+	s.sendError(w, "读取上传内容失败", err)
+}
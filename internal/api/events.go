@@ -0,0 +1,183 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"tiny11-builder/internal/logger"
+)
+
+// eventState 任务状态变化 (事件数据为任务快照)
+const eventState = "state"
+
+// maxEventHistory 每个任务保留的事件数，新连接的客户端先收到这些事件
+const maxEventHistory = 2000
+
+// sseHeartbeat 没有事件时发送注释行的间隔，避免代理断开空闲连接
+const sseHeartbeat = 15 * time.Second
+
+// streamEvent 事件流中的一条，seq 用作 SSE 的事件 id
+type streamEvent struct {
+	seq  int
+	typ  string
+	data interface{}
+}
+
+// eventStream 一个任务的事件流
+//
+// 事件保存在历史中，订阅者只收到"有新事件"的通知，再按序号读取，
+// 读得慢的客户端不会阻塞构建。同一进度条的连续进度事件只保留最后一条。
+type eventStream struct {
+	mu      sync.Mutex
+	seq     int
+	history []streamEvent
+	subs    map[chan struct{}]struct{}
+	closed  bool
+}
+
+func newEventStream() *eventStream {
+	return &eventStream{subs: make(map[chan struct{}]struct{})}
+}
+
+// publish 追加事件并通知订阅者 (事件流关闭后忽略)
+func (s *eventStream) publish(typ string, data interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+
+	s.seq++
+	e := streamEvent{seq: s.seq, typ: typ, data: data}
+	if n := len(s.history); n > 0 && sameProgress(s.history[n-1], e) {
+		s.history[n-1] = e
+	} else {
+		s.history = append(s.history, e)
+	}
+	if len(s.history) > maxEventHistory {
+		s.history = s.history[len(s.history)-maxEventHistory:]
+	}
+	s.notify()
+}
+
+// close 结束事件流 (任务结束)
+func (s *eventStream) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	s.notify()
+}
+
+// notify 通知订阅者 (调用时持有锁)
+func (s *eventStream) notify() {
+	for ch := range s.subs {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// subscribe 订阅新事件通知，返回取消订阅的函数
+func (s *eventStream) subscribe() (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+	s.mu.Lock()
+	s.subs[ch] = struct{}{}
+	s.mu.Unlock()
+	return ch, func() {
+		s.mu.Lock()
+		delete(s.subs, ch)
+		s.mu.Unlock()
+	}
+}
+
+// since 返回序号大于 seq 的事件，以及事件流是否已关闭
+func (s *eventStream) since(seq int) ([]streamEvent, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var events []streamEvent
+	for _, e := range s.history {
+		if e.seq > seq {
+			events = append(events, e)
+		}
+	}
+	return events, s.closed
+}
+
+// sameProgress 两个事件是否为同一进度条的进行中进度
+func sameProgress(prev, next streamEvent) bool {
+	a, ok1 := prev.data.(logger.Event)
+	b, ok2 := next.data.(logger.Event)
+	if !ok1 || !ok2 || a.Type != logger.EventProgress || b.Type != logger.EventProgress {
+		return false
+	}
+	return a.Progress.Label == b.Progress.Label && !a.Progress.Done && a.Progress.Total > 0
+}
+
+// handleJobEvents 以 Server-Sent Events 推送任务事件
+//
+// 先发送已有的事件，再实时推送新事件，任务结束后关闭连接。
+// 断线重连时浏览器会带上 Last-Event-ID，只补发之后的事件；
+// 任务已结束且没有新事件时返回 204，EventSource 不再重连。
+func (s *Server) handleJobEvents(w http.ResponseWriter, r *http.Request) {
+	stream, ok := s.queue.events(r.PathValue("id"))
+	if !ok {
+		s.sendErrorStatus(w, http.StatusNotFound, "任务不存在", errJobNotFound)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "不支持事件流", http.StatusInternalServerError)
+		return
+	}
+
+	last := 0
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		last, _ = strconv.Atoi(id)
+	}
+
+	notify, unsubscribe := stream.subscribe()
+	defer unsubscribe()
+
+	events, closed := stream.since(last)
+	if closed && len(events) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		for _, e := range events {
+			data, err := json.Marshal(e.data)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.seq, e.typ, data)
+			last = e.seq
+		}
+		flusher.Flush()
+		if closed {
+			return
+		}
+
+		select {
+		case <-notify:
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case <-r.Context().Done():
+			return
+		}
+		events, closed = stream.since(last)
+	}
+}
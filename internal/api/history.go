@@ -0,0 +1,128 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"tiny11-builder/internal/history"
+	"tiny11-builder/internal/types"
+)
+
+// historyParams GET /api/history 的查询参数
+var historyParams = []struct {
+	name        string
+	description string
+	enum        func() []string
+}{
+	{"mode", "构建模式", modeNames},
+	{"theme", "主题 (none 表示没有应用主题的构建)", nil},
+	{"state", "任务结果", history.States},
+	{"since", "创建时间不早于: 日期 (2006-01-02)、日期时间、RFC 3339 或相对时间 (如 12h、7d)", nil},
+	{"until", "创建时间早于: 格式同 since，只有日期时包含当天", nil},
+	{"limit", "最多返回的条数", nil},
+}
+
+// recordJob 把结束的任务写入构建历史
+func (s *Server) recordJob(j *job, err error) types.BuildRecord {
+	rec := j.steps.Record(j.cfg, j.mode, j.CreatedAt, j.StartedAt, err)
+	rec.ID = j.ID
+	rec.Source = history.SourceAPI
+	req := j.Request
+	rec.Request = &req
+	rec.LogFile = j.logFile
+	if rec.State == types.JobComplete {
+		rec.OutputISO = j.OutputISO
+		// runJob 结束前已计算过校验和
+		if info, err := os.Stat(j.OutputISO); err == nil {
+			rec.SHA256, _ = s.sums.cached(j.OutputISO, info)
+		}
+	}
+	if err := s.history.Append(rec); err != nil {
+		s.log.Warn("任务 %s 写入构建历史失败: %v", j.ID, err)
+	}
+	return rec
+}
+
+// handleListHistory 构建历史 (最近的在前)，可按模式、主题、结果和时间筛选
+func (s *Server) handleListHistory(w http.ResponseWriter, r *http.Request) {
+	filter, err := historyFilter(r.URL.Query())
+	if err != nil {
+		s.sendError(w, "无效的查询参数", err)
+		return
+	}
+	records, err := s.history.List(filter)
+	if err != nil {
+		s.sendErrorStatus(w, http.StatusInternalServerError, "读取构建历史失败", err)
+		return
+	}
+	s.sendJSON(w, records)
+}
+
+// handleGetHistory 单条构建记录
+func (s *Server) handleGetHistory(w http.ResponseWriter, r *http.Request) {
+	rec, err := s.history.Get(r.PathValue("id"))
+	switch {
+	case errors.Is(err, history.ErrNotFound):
+		s.sendErrorStatus(w, http.StatusNotFound, "构建记录不存在", err)
+	case err != nil:
+		s.sendErrorStatus(w, http.StatusInternalServerError, "读取构建历史失败", err)
+	default:
+		s.sendJSON(w, rec)
+	}
+}
+
+// historyFilter 解析查询参数，错误按参数名列出
+func historyFilter(query url.Values) (history.Filter, error) {
+	var filter history.Filter
+	var errs fieldErrors
+	for _, p := range historyParams {
+		value := query.Get(p.name)
+		if value == "" {
+			continue
+		}
+		if p.enum != nil && !containsFold(p.enum(), value) {
+			errs.add(p.name, fmt.Sprintf("无效的值 %q (可选: %s)", value, strings.Join(p.enum(), ", ")))
+			continue
+		}
+
+		var err error
+		switch p.name {
+		case "mode":
+			filter.Mode = types.BuildMode(strings.ToLower(value))
+		case "theme":
+			filter.Theme = value
+		case "state":
+			filter.State = types.JobState(strings.ToLower(value))
+		case "since":
+			filter.Since, err = history.ParseTime(value, false)
+		case "until":
+			filter.Until, err = history.ParseTime(value, true)
+		case "limit":
+			filter.Limit, err = strconv.Atoi(value)
+			if err != nil || filter.Limit < 0 {
+				err = fmt.Errorf("应为非负整数")
+			}
+		}
+		if err != nil {
+			errs.add(p.name, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return filter, errs
+	}
+	return filter, nil
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
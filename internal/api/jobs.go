@@ -0,0 +1,314 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"tiny11-builder/internal/config"
+	"tiny11-builder/internal/history"
+	"tiny11-builder/internal/logger"
+	"tiny11-builder/internal/types"
+	"tiny11-builder/internal/webhook"
+)
+
+var (
+	errJobNotFound    = errors.New("任务不存在")
+	errJobFinished    = errors.New("任务已结束")
+	errJobNotFinished = errors.New("任务尚未结束")
+)
+
+// job 队列中的构建任务
+type job struct {
+	types.Job
+
+	cfg    *config.Config
+	mode   types.BuildMode
+	key    string // 工作目录 (比较用)
+	events *eventStream
+	steps  *history.Recorder // 步骤耗时 (写入构建历史)
+
+	cancelRun context.CancelFunc // 取消运行中的构建
+	canceling bool
+	logFile   string // 任务日志 (runJob 中设置，任务结束后读取)
+}
+
+// jobQueue 构建任务队列
+//
+// 工作目录相同的任务共用 build 目录，按提交顺序依次执行；
+// 工作目录不同的任务并行执行。
+type jobQueue struct {
+	mu    sync.Mutex
+	jobs  map[string]*job
+	order []*job          // 提交顺序
+	busy  map[string]bool // 正在构建的工作目录
+
+	// run 执行任务 (在新的 goroutine 中调用)，返回输出 ISO 路径；
+	// 任务被取消时 ctx 取消
+	run func(ctx context.Context, j *job) (string, error)
+	// notify 任务加入队列和开始构建时调用 (持有锁，不能阻塞)
+	notify func(j *job, event string)
+	// finished 任务结束后调用 (不持有锁)，err 为构建的结果
+	finished func(j *job, err error)
+}
+
+func newJobQueue(run func(ctx context.Context, j *job) (string, error)) *jobQueue {
+	return &jobQueue{
+		jobs: make(map[string]*job),
+		busy: make(map[string]bool),
+		run:  run,
+	}
+}
+
+// submit 加入任务，工作目录空闲时立即开始
+func (q *jobQueue) submit(req types.BuildRequest, cfg *config.Config, mode types.BuildMode) types.Job {
+	j := &job{
+		Job: types.Job{
+			ID:        newJobID(),
+			State:     types.JobQueued,
+			Request:   req,
+			WorkDir:   cfg.WorkDir,
+			Phase:     "queued",
+			Message:   "等待构建",
+			CreatedAt: time.Now(),
+		},
+		cfg:    cfg,
+		mode:   mode,
+		key:    workDirKey(cfg.WorkDir),
+		events: newEventStream(),
+		steps:  history.NewRecorder(),
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.jobs[j.ID] = j
+	q.order = append(q.order, j)
+	if q.busy[j.key] {
+		j.Message = "等待同一工作目录中的构建完成"
+	}
+	j.publishState()
+	q.emit(j, webhook.EventQueued)
+	q.schedule()
+	return j.Job
+}
+
+// schedule 按提交顺序启动工作目录空闲的任务 (调用时持有锁)
+func (q *jobQueue) schedule() {
+	waiting := make(map[string]bool)
+	for _, j := range q.order {
+		if j.State != types.JobQueued {
+			continue
+		}
+		// 同一工作目录中先提交的任务仍在等待时，后面的任务不能越过它
+		if q.busy[j.key] || waiting[j.key] {
+			waiting[j.key] = true
+			continue
+		}
+
+		now := time.Now()
+		j.State = types.JobRunning
+		j.StartedAt = &now
+		j.Phase = "preparing"
+		j.Message = "准备构建环境"
+		q.busy[j.key] = true
+		j.publishState()
+		q.emit(j, webhook.EventStarted)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		j.cancelRun = cancel
+		go q.execute(ctx, j)
+	}
+}
+
+// execute 执行任务，结束后释放工作目录并启动排队的任务
+func (q *jobQueue) execute(ctx context.Context, j *job) {
+	var (
+		output string
+		err    error
+	)
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("构建异常: %v", r)
+			}
+		}()
+		output, err = q.run(ctx, j)
+	}()
+	j.cancelRun()
+
+	q.mu.Lock()
+	now := time.Now()
+	j.FinishedAt = &now
+	switch {
+	case err != nil && errors.Is(err, context.Canceled):
+		j.State = types.JobCanceled
+		j.Phase = "canceled"
+		j.Message = "任务已取消"
+	case err != nil:
+		j.State = types.JobFailed
+		j.Phase = "error"
+		j.Message = err.Error()
+		j.Error = err.Error()
+	default:
+		j.State = types.JobComplete
+		j.Phase = "complete"
+		j.Progress = 100
+		j.Message = "构建完成"
+		j.OutputISO = output
+	}
+	j.publishState()
+	j.events.close()
+	delete(q.busy, j.key)
+	q.schedule()
+	q.mu.Unlock()
+
+	if q.finished != nil {
+		q.finished(j, err)
+	}
+}
+
+// update 更新运行中任务的进度
+func (q *jobQueue) update(j *job, phase string, progress float64, message string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	j.Phase = phase
+	j.Progress = progress
+	j.Message = message
+}
+
+// updateStep 根据构建步骤事件更新运行中任务的进度
+func (q *jobQueue) updateStep(j *job, e logger.Event) {
+	if e.Steps <= 0 {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if j.canceling {
+		return
+	}
+
+	done := e.Step - 1
+	if e.Status != logger.StepStarted {
+		done = e.Step
+	}
+	j.Phase = "building"
+	j.Step = e.Step
+	j.Steps = e.Steps
+	j.Progress = float64(done) * 100 / float64(e.Steps)
+	j.Message = fmt.Sprintf("[步骤 %d/%d] %s", e.Step, e.Steps, e.Message)
+}
+
+// events 返回任务的事件流
+func (q *jobQueue) events(id string) (*eventStream, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	j, ok := q.jobs[id]
+	if !ok {
+		return nil, false
+	}
+	return j.events, true
+}
+
+// get 返回任务的副本
+func (q *jobQueue) get(id string) (types.Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	j, ok := q.jobs[id]
+	if !ok {
+		return types.Job{}, false
+	}
+	return j.Job, true
+}
+
+// list 返回全部任务 (最近提交的在前)
+func (q *jobQueue) list() []types.Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	jobs := make([]types.Job, 0, len(q.order))
+	for i := len(q.order) - 1; i >= 0; i-- {
+		jobs = append(jobs, q.order[i].Job)
+	}
+	return jobs
+}
+
+// latest 返回最近提交的任务
+func (q *jobQueue) latest() (types.Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.order) == 0 {
+		return types.Job{}, false
+	}
+	return q.order[len(q.order)-1].Job, true
+}
+
+// cancel 取消任务
+//
+// 排队中的任务直接取消；运行中的任务取消构建的上下文，构建在当前命令
+// 结束后卸载注册表和镜像，之后任务状态变为 canceled。
+func (q *jobQueue) cancel(id string) (types.Job, error) {
+	var canceled *job
+	defer func() {
+		// 在释放锁之后调用
+		if canceled != nil && q.finished != nil {
+			q.finished(canceled, context.Canceled)
+		}
+	}()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	j, ok := q.jobs[id]
+	if !ok {
+		return types.Job{}, errJobNotFound
+	}
+	switch {
+	case j.Finished():
+		return j.Job, errJobFinished
+	case j.State == types.JobRunning:
+		if !j.canceling {
+			j.canceling = true
+			j.Phase = "canceling"
+			j.Message = "正在取消: 等待当前命令结束并卸载镜像"
+			j.publishState()
+			j.cancelRun()
+		}
+		return j.Job, nil
+	}
+
+	now := time.Now()
+	j.State = types.JobCanceled
+	j.Phase = "canceled"
+	j.Message = "任务已取消"
+	j.FinishedAt = &now
+	j.publishState()
+	j.events.close()
+	q.schedule()
+	canceled = j
+	return j.Job, nil
+}
+
+func (q *jobQueue) emit(j *job, event string) {
+	if q.notify != nil {
+		q.notify(j, event)
+	}
+}
+
+// publishState 发送任务状态事件 (调用时持有队列的锁)
+func (j *job) publishState() {
+	j.events.publish(eventState, j.Job)
+}
+
+// newJobID 生成任务 id: 提交时间 + 随机后缀 (同时用作构建历史的记录 id)
+func newJobID() string {
+	return history.NewID()
+}
+
+// workDirKey 比较用的工作目录 (Windows 路径不区分大小写)
+func workDirKey(dir string) string {
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	return strings.ToLower(filepath.Clean(dir))
+}
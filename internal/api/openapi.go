@@ -0,0 +1,367 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"tiny11-builder/internal/logger"
+	"tiny11-builder/internal/preinstall"
+	"tiny11-builder/internal/profile"
+	"tiny11-builder/internal/types"
+)
+
+// apiVersion OpenAPI 文档中的接口版本
+const apiVersion = "1.0.0"
+
+// obj OpenAPI 文档中的对象
+type obj = map[string]interface{}
+
+// handleOpenAPI 返回 OpenAPI 3 文档
+//
+// 文档中的结构由 types 包中的类型生成，构建请求字段的说明和约束来自
+// requestFields (与请求校验相同)；主题的可选值为当前已安装的主题。
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	s.sendJSON(w, s.openAPIDocument())
+}
+
+// openAPIDocument 生成 OpenAPI 3 文档
+func (s *Server) openAPIDocument() obj {
+	g := newSchemaGen()
+	ref := func(v interface{}) obj { return g.schema(reflect.TypeOf(v)) }
+	errResp := response("错误 (字段校验失败时 fields 列出各字段的错误)", jsonBody(ref(types.BuildResponse{})))
+	jobID := obj{"name": "id", "in": "path", "required": true, "schema": obj{"type": "string"}}
+
+	paths := obj{
+		"/api/jobs": obj{
+			"get": operation("listJobs", "全部任务 (最近提交的在前)", nil,
+				ok(jsonBody(array(ref(types.Job{}))))),
+			"post": operation("createJob", "提交构建任务", nil, obj{
+				"202": response("已加入队列", jsonBody(ref(types.Job{}))),
+				"400": errResp,
+			}).with("requestBody", obj{
+				"required": true,
+				"content":  jsonBody(ref(types.BuildRequest{})),
+			}),
+		},
+		"/api/jobs/{id}": obj{
+			"get": operation("getJob", "单个任务", []obj{jobID}, obj{
+				"200": response("任务", jsonBody(ref(types.Job{}))),
+				"404": errResp,
+			}),
+			"delete": operation("cancelJob", "取消任务: 排队中的任务立即取消，运行中的任务开始停止", []obj{jobID}, obj{
+				"200": response("已取消", jsonBody(ref(types.Job{}))),
+				"202": response("正在停止，结束后状态变为 canceled", jsonBody(ref(types.Job{}))),
+				"404": errResp,
+				"409": errResp,
+			}),
+		},
+		"/api/jobs/{id}/events": obj{
+			"get": operation("jobEvents", "任务事件流 (Server-Sent Events)",
+				[]obj{jobID, {"name": "Last-Event-ID", "in": "header", "schema": obj{"type": "integer"}}},
+				obj{
+					"200": response("事件流: state 事件的数据为 Job，step、progress、log 事件的数据为 Event",
+						obj{"text/event-stream": obj{"schema": obj{"type": "string"}}}),
+					"204": obj{"description": "任务已结束且没有新事件"},
+					"404": errResp,
+				}).with("x-event-schemas", obj{
+				"state": ref(types.Job{}), "step": ref(logger.Event{}),
+				"progress": ref(logger.Event{}), "log": ref(logger.Event{}),
+			}),
+		},
+		"/api/jobs/{id}/artifacts": obj{
+			"get": operation("listArtifacts", "已结束任务的产物", []obj{jobID}, obj{
+				"200": response("产物", jsonBody(array(ref(types.Artifact{})))),
+				"404": errResp,
+				"409": errResp,
+			}),
+		},
+		"/api/jobs/{id}/artifacts/{name}": obj{
+			"get": operation("downloadArtifact", "下载产物 (支持 Range)",
+				[]obj{jobID, {"name": "name", "in": "path", "required": true, "schema": obj{"type": "string"}}},
+				obj{
+					"200": response("文件", binaryBody),
+					"206": response("部分内容", binaryBody),
+					"404": errResp,
+					"409": errResp,
+				}),
+		},
+		"/api/build": obj{
+			"post": operation("build", "提交构建任务 (旧接口，同 POST /api/jobs)", nil, obj{
+				"200": response("已加入队列", jsonBody(ref(types.BuildResponse{}))),
+				"400": errResp,
+			}).with("deprecated", true).with("requestBody", obj{
+				"required": true,
+				"content":  jsonBody(ref(types.BuildRequest{})),
+			}),
+		},
+		"/api/status": obj{
+			"get": operation("status", "最近一个任务的状态 (旧接口)", nil,
+				ok(jsonBody(ref(types.BuildStatus{})))).with("deprecated", true),
+		},
+		"/api/themes": obj{
+			"get": operation("listThemes", "已安装的主题", nil,
+				ok(jsonBody(array(ref(types.ThemeInfo{}))))),
+			"post": operation("uploadTheme", "上传 zip 格式的主题", nil, obj{
+				"201": response("已安装", jsonBody(ref(types.ThemeInfo{}))),
+				"400": errResp,
+				"409": errResp,
+				"413": errResp,
+			}).with("requestBody", uploadBody(obj{
+				"file":    obj{"type": "string", "format": "binary"},
+				"name":    obj{"type": "string", "description": "主题名称 (默认为压缩包中的顶层目录名)"},
+				"replace": obj{"type": "boolean", "description": "覆盖同名主题"},
+			})),
+		},
+		"/api/preinstall": obj{
+			"get": operation("listPreinstall", "预装软件列表", nil,
+				ok(jsonBody(ref(types.PreinstallCatalog{})))),
+			"post": operation("uploadInstaller", "上传安装包并添加到预装软件列表", nil, obj{
+				"201": response("已添加", jsonBody(ref(types.PreinstallApp{}))),
+				"400": errResp,
+				"409": errResp,
+				"413": errResp,
+			}).with("requestBody", uploadBody(obj{
+				"file":        obj{"type": "string", "format": "binary"},
+				"id":          obj{"type": "string", "pattern": preinstall.IDPattern.String()},
+				"name":        obj{"type": "string"},
+				"description": obj{"type": "string"},
+				"version":     obj{"type": "string"},
+				"installCmd":  obj{"type": "string", "description": "安装命令 (默认为文件名)"},
+				"silent":      obj{"type": "boolean"},
+				"fileName":    obj{"type": "string", "description": "保存的文件名 (默认为上传的文件名)"},
+			}, "file", "id")),
+		},
+		"/api/history": obj{
+			"get": operation("listHistory", "构建历史 (最近的在前)", historyQuery(),
+				obj{
+					"200": response("构建记录", jsonBody(array(ref(types.BuildRecord{})))),
+					"400": errResp,
+				}),
+		},
+		"/api/history/{id}": obj{
+			"get": operation("getHistory", "单条构建记录 (id 与任务 id 相同)", []obj{jobID}, obj{
+				"200": response("构建记录", jsonBody(ref(types.BuildRecord{}))),
+				"404": errResp,
+			}),
+		},
+		"/api/tweaks": obj{
+			"get": operation("listTweaks", "内置的注册表优化", nil,
+				ok(jsonBody(array(ref(profile.TweakInfo{}))))),
+		},
+		"/api/openapi.json": obj{
+			"get": operation("openAPI", "本文档", nil, ok(jsonBody(obj{"type": "object"}))),
+		},
+	}
+
+	doc := obj{
+		"openapi": "3.0.3",
+		"info": obj{
+			"title":   "Tiny11 Builder API",
+			"version": apiVersion,
+		},
+		"paths": paths,
+		"components": obj{
+			"schemas": g.schemas,
+		},
+	}
+
+	// 启用认证时所有接口都需要令牌
+	if s.tokens != nil {
+		doc["components"].(obj)["securitySchemes"] = obj{
+			"bearer": obj{"type": "http", "scheme": "bearer"},
+			"apiKey": obj{"type": "apiKey", "in": "header", "name": "X-API-Key"},
+			"query":  obj{"type": "apiKey", "in": "query", "name": "access_token"},
+		}
+		doc["security"] = []obj{{"bearer": []string{}}, {"apiKey": []string{}}, {"query": []string{}}}
+	}
+	return doc
+}
+
+// op 一个接口操作
+type op obj
+
+func (o op) with(key string, value interface{}) op {
+	o[key] = value
+	return o
+}
+
+func operation(id, summary string, params []obj, responses obj) op {
+	o := op{"operationId": id, "summary": summary, "responses": responses}
+	if len(params) > 0 {
+		o["parameters"] = params
+	}
+	return o
+}
+
+var binaryBody = obj{"application/octet-stream": obj{"schema": obj{"type": "string", "format": "binary"}}}
+
+func ok(content obj) obj {
+	return obj{"200": response("成功", content)}
+}
+
+func response(description string, content obj) obj {
+	return obj{"description": description, "content": content}
+}
+
+func jsonBody(schema obj) obj {
+	return obj{"application/json": obj{"schema": schema}}
+}
+
+func array(items obj) obj {
+	return obj{"type": "array", "items": items}
+}
+
+// historyQuery GET /api/history 的查询参数
+func historyQuery() []obj {
+	var params []obj
+	for _, p := range historyParams {
+		schema := obj{"type": "string"}
+		if p.enum != nil {
+			schema["enum"] = p.enum()
+		}
+		if p.name == "limit" {
+			schema = obj{"type": "integer", "minimum": 0}
+		}
+		params = append(params, obj{"name": p.name, "in": "query", "description": p.description, "schema": schema})
+	}
+	return params
+}
+
+func uploadBody(props obj, required ...string) obj {
+	if len(required) == 0 {
+		required = []string{"file"}
+	}
+	return obj{
+		"required": true,
+		"content": obj{"multipart/form-data": obj{"schema": obj{
+			"type": "object", "properties": props, "required": required,
+		}}},
+	}
+}
+
+// schemaGen 由 Go 类型生成 JSON Schema
+//
+// 结构体放入 components.schemas 并用 $ref 引用；带可选值的字符串类型 (JobState)
+// 生成 enum；BuildRequest 的字段合并 requestFields 中的说明和约束。
+type schemaGen struct {
+	schemas obj
+	enums   map[reflect.Type]func() []string
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	rawType  = reflect.TypeOf(json.RawMessage{})
+)
+
+func newSchemaGen() *schemaGen {
+	return &schemaGen{
+		schemas: obj{},
+		enums: map[reflect.Type]func() []string{
+			reflect.TypeOf(types.JobState("")): func() []string {
+				return []string{string(types.JobQueued), string(types.JobRunning),
+					string(types.JobComplete), string(types.JobFailed), string(types.JobCanceled)}
+			},
+			reflect.TypeOf(types.BuildMode("")): modeNames,
+		},
+	}
+}
+
+func (g *schemaGen) schema(t reflect.Type) obj {
+	if t == timeType {
+		return obj{"type": "string", "format": "date-time"}
+	}
+	if t == rawType {
+		return obj{"type": "object"}
+	}
+	if enum, ok := g.enums[t]; ok {
+		return obj{"type": "string", "enum": enum()}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		s := g.schema(t.Elem())
+		if _, isRef := s["$ref"]; isRef {
+			return obj{"allOf": []obj{s}, "nullable": true}
+		}
+		s["nullable"] = true
+		return s
+	case reflect.Struct:
+		name := t.Name()
+		if _, ok := g.schemas[name]; !ok {
+			g.schemas[name] = obj{} // 先占位，结构体引用自身时不会无限递归
+			g.schemas[name] = g.object(t)
+		}
+		return obj{"$ref": "#/components/schemas/" + name}
+	case reflect.Slice, reflect.Array:
+		return array(g.schema(t.Elem()))
+	case reflect.Map:
+		return obj{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Interface:
+		return obj{}
+	case reflect.Int64, reflect.Uint64:
+		return obj{"type": "integer", "format": "int64"}
+	}
+	return obj{"type": jsonType(t)}
+}
+
+// object 结构体的 schema: 没有 omitempty 的字段在响应中总是存在，列为 required
+func (g *schemaGen) object(t reflect.Type) obj {
+	props := obj{}
+	var required []string
+	request := t == reflect.TypeOf(types.BuildRequest{})
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() || f.Tag.Get("json") == "-" {
+			continue
+		}
+		name := jsonName(f)
+		s := g.schema(f.Type)
+		if rule, ok := requestFields[name]; request && ok {
+			s = rule.apply(s)
+		} else if !request && !isOmitEmpty(f) {
+			required = append(required, name)
+		}
+		props[name] = s
+	}
+
+	s := obj{"type": "object", "properties": props}
+	if len(required) > 0 {
+		sort.Strings(required)
+		s["required"] = required
+	}
+	return s
+}
+
+// apply 把字段的说明和约束加入 schema (数组字段作用于元素)
+func (f requestField) apply(s obj) obj {
+	s["description"] = f.description
+	target := s
+	if items, ok := s["items"].(obj); ok {
+		target = items
+	}
+	if f.pattern != nil {
+		target["pattern"] = f.pattern.String()
+	}
+	if f.enum != nil {
+		target["enum"] = f.enum()
+	}
+	if f.nonNegative {
+		target["minimum"] = 0
+	}
+	return s
+}
+
+func isOmitEmpty(f reflect.StructField) bool {
+	_, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+	for _, o := range strings.Split(opts, ",") {
+		if o == "omitempty" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,194 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+
+	"tiny11-builder/internal/logger"
+	"tiny11-builder/internal/types"
+)
+
+// TestOpenAPISchemas 文档中的属性与 types 中结构体的 JSON 字段一致
+func TestOpenAPISchemas(t *testing.T) {
+	data, err := json.Marshal((&Server{}).openAPIDocument())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]struct {
+					Description string `json:"description"`
+				} `json:"properties"`
+				Required []string `json:"required"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range []any{types.BuildRequest{}, types.BuildStatus{}, types.BuildResponse{}, types.FieldError{}} {
+		typ := reflect.TypeOf(v)
+		t.Run(typ.Name(), func(t *testing.T) {
+			schema, ok := doc.Components.Schemas[typ.Name()]
+			if !ok {
+				t.Fatalf("components.schemas 中没有 %s", typ.Name())
+			}
+
+			var fields, required, props []string
+			for i := 0; i < typ.NumField(); i++ {
+				f := typ.Field(i)
+				if !f.IsExported() || f.Tag.Get("json") == "-" {
+					continue
+				}
+				name := jsonName(f)
+				fields = append(fields, name)
+				if !isOmitEmpty(f) {
+					required = append(required, name)
+				}
+			}
+			for name := range schema.Properties {
+				props = append(props, name)
+			}
+			sort.Strings(fields)
+			sort.Strings(props)
+			if !slices.Equal(props, fields) {
+				t.Errorf("properties = %v, JSON 字段 = %v", props, fields)
+			}
+
+			// 请求的字段都可省略，说明来自 requestFields；响应中没有 omitempty 的字段总是存在
+			if typ == reflect.TypeOf(types.BuildRequest{}) {
+				if len(schema.Required) != 0 {
+					t.Errorf("BuildRequest required = %v", schema.Required)
+				}
+				for _, name := range fields {
+					if schema.Properties[name].Description == "" {
+						t.Errorf("请求字段 %s 没有说明 (requestFields 中缺少定义)", name)
+					}
+				}
+				return
+			}
+			sort.Strings(required)
+			if !slices.Equal(schema.Required, required) {
+				t.Errorf("required = %v, want %v", schema.Required, required)
+			}
+		})
+	}
+
+	// requestFields 中不应有 BuildRequest 已经没有的字段
+	reqType := reflect.TypeOf(types.BuildRequest{})
+	for name := range requestFields {
+		found := false
+		for i := 0; i < reqType.NumField(); i++ {
+			if jsonName(reqType.Field(i)) == name {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("requestFields 中的 %s 不是 BuildRequest 的字段", name)
+		}
+	}
+}
+
+func TestSubmitDecodeErrors(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	log := logger.NewLogger("test")
+	defer log.Close()
+	s := NewServer(Options{HistoryFile: filepath.Join(dir, "history.jsonl")}, log)
+
+	tests := []struct {
+		name, body string
+		field      string
+	}{
+		{"unknown field", `{"isoDrive":"E:","isoDriver":"F:"}`, "isoDriver"},
+		{"wrong type", `{"isoDrive":"E:","imageIndex":"2"}`, "imageIndex"},
+		{"malformed", `{"isoDrive":`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/api/jobs", strings.NewReader(tt.body))
+			s.Handler().ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("状态码 %d, want 400: %s", rec.Code, rec.Body)
+			}
+			var resp types.BuildResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Success || resp.Error == "" {
+				t.Errorf("响应: %+v", resp)
+			}
+			if tt.field == "" {
+				if len(resp.Fields) != 0 {
+					t.Errorf("fields = %+v", resp.Fields)
+				}
+				return
+			}
+			if len(resp.Fields) != 1 || resp.Fields[0].Field != tt.field {
+				t.Errorf("fields = %+v, want %s", resp.Fields, tt.field)
+			}
+		})
+	}
+}
+
+// TestRequestPaths 请求中的路径只能是配置目录中的相对路径
+func TestRequestPaths(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	log := logger.NewLogger("test")
+	defer log.Close()
+	root, media := filepath.Join(dir, "work"), filepath.Join(dir, "media")
+	os.MkdirAll(media, 0755)
+	os.WriteFile(filepath.Join(media, "Win11.iso"), []byte("iso"), 0644)
+	s := NewServer(Options{HistoryFile: filepath.Join(dir, "history.jsonl"), WorkRoot: root, MediaDir: media}, log)
+
+	for _, body := range []string{
+		`{"isoFile":"/tmp/Win11.iso"}`,
+		`{"isoFile":"../Win11.iso"}`,
+		`{"isoDrive":"E","workDir":"/etc"}`,
+		`{"isoDrive":"E","workDir":"builds/../../x"}`,
+		`{"isoDrive":"E","outputIso":"/tmp/out.iso"}`,
+		`{"isoDrive":"E","exportReg":"../export.reg"}`,
+		`{"isoDrive":"E","regFiles":["ok.reg","/etc/tweaks.reg"]}`,
+		`{"isoFile":"missing.iso"}`,
+	} {
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/jobs", strings.NewReader(body)))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: 状态码 %d, want 400", body, rec.Code)
+		}
+	}
+
+	cfg, _, err := s.buildConfig(&types.BuildRequest{
+		ISOFile:   "Win11.iso",
+		WorkDir:   "builds/core",
+		OutputISO: "out/core.iso",
+		ExportReg: "core.reg",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	work := filepath.Join(root, "builds", "core")
+	for _, p := range []struct{ got, want string }{
+		{cfg.WorkDir, work},
+		{cfg.ISOFile, filepath.Join(media, "Win11.iso")},
+		{cfg.OutputISO, filepath.Join(work, "out", "core.iso")},
+		{cfg.ExportReg, filepath.Join(work, "core.reg")},
+	} {
+		if p.got != p.want {
+			t.Errorf("路径 = %s, want %s", p.got, p.want)
+		}
+	}
+}
@@ -1,110 +1,414 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
-	"sync"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"tiny11-builder/internal/app"
 	"tiny11-builder/internal/config"
+	"tiny11-builder/internal/history"
 	"tiny11-builder/internal/logger"
+	"tiny11-builder/internal/preinstall"
+	"tiny11-builder/internal/profile"
+	"tiny11-builder/internal/registry"
 	"tiny11-builder/internal/types"
+	"tiny11-builder/internal/utils"
+	"tiny11-builder/internal/webhook"
 )
 
+// DefaultBind 默认只监听本机
+const DefaultBind = "127.0.0.1"
+
+// Options API 服务器选项
+type Options struct {
+	Bind    string // 监听地址 (默认 127.0.0.1)
+	Port    int
+	TLSCert string // 证书和私钥 (PEM)，同时指定时启用 HTTPS
+	TLSKey  string
+	Tokens  *TokenStore // 没有令牌时不启用认证 (只允许监听本机地址)
+
+	HistoryFile string         // 构建历史 (默认为程序目录中的 history.jsonl)
+	Webhooks    []webhook.Hook // 任务事件的通知
+
+	// 请求中的路径只能指向这两个目录之内: workDir 相对于 WorkRoot (默认为程序目录)，
+	// isoFile 和 regFiles 相对于 MediaDir (默认为程序目录中的 media)；
+	// outputIso 和 exportReg 相对于任务的工作目录
+	WorkRoot string
+	MediaDir string
+}
+
 type Server struct {
-	port   int
-	log    *logger.Logger
-	mu     sync.RWMutex
-	status *types.BuildStatus
+	opts    Options
+	log     *logger.Logger
+	queue   *jobQueue
+	runner  utils.CommandRunner
+	sums    *checksums
+	tokens  *TokenStore
+	history *history.Store
+	hooks   *webhook.Notifier
 }
 
-func NewServer(port int, log *logger.Logger) *Server {
-	return &Server{
-		port: port, log: log, status: &types.BuildStatus{
-			Phase: "idle", Progress: 0}}
+func NewServer(opts Options, log *logger.Logger) *Server {
+	if opts.Bind == "" {
+		opts.Bind = DefaultBind
+	}
+	s := &Server{
+		opts: opts, log: log,
+		// 所有任务共用一个离线执行器: 加载的配置单元以挂载路径 (HKLM\zSOFTWARE 等) 区分，
+		// 必须在任务之间共享同一份，各任务加载注册表的步骤由 registry.LockHives 依次执行
+		runner: registry.NewOfflineRunner(nil),
+		sums:   newChecksums()}
+	if opts.Tokens != nil && !opts.Tokens.Empty() {
+		s.tokens = opts.Tokens
+	}
+	if opts.HistoryFile == "" {
+		opts.HistoryFile = config.NewConfig().HistoryFile
+	}
+	if opts.WorkRoot == "" {
+		opts.WorkRoot = config.NewConfig().WorkDir
+	}
+	if opts.MediaDir == "" {
+		opts.MediaDir = filepath.Join(config.NewConfig().WorkDir, "media")
+	}
+	s.opts = opts
+	s.history = history.NewStore(opts.HistoryFile)
+	s.hooks = webhook.NewNotifier(opts.Webhooks, log)
+	s.queue = newJobQueue(s.runJob)
+	s.queue.notify = s.notifyJob
+	s.queue.finished = s.jobFinished
+	return s
 }
+
+// Start 开始监听
+//
+// 没有配置令牌时拒绝监听非本机地址: 构建以管理员权限运行，不能让局域网中
+// 的任何人提交。
 func (s *Server) Start() error {
-	http.HandleFunc("/api/build", s.handleBuild)
-	http.HandleFunc("/api/status", s.handleStatus)
-	http.HandleFunc("/api/themes", s.handleThemes)
-	http.HandleFunc("/api/preinstall", s.handlePreinstall)
-	addr := fmt.Sprintf(":%d", s.port)
-	s.log.Info("API服务器启动在 http://localhost%s", addr)
-	return http.ListenAndServe(addr, nil)
+	if (s.opts.TLSCert == "") != (s.opts.TLSKey == "") {
+		return fmt.Errorf("启用 TLS 需要同时指定证书和私钥")
+	}
+	if s.tokens == nil && !isLoopback(s.opts.Bind) {
+		return fmt.Errorf("监听 %s 需要先创建 API 令牌 (api-token add)", s.opts.Bind)
+	}
+
+	addr := net.JoinHostPort(s.opts.Bind, strconv.Itoa(s.opts.Port))
+	scheme := "http"
+	if s.opts.TLSCert != "" {
+		scheme = "https"
+	}
+	s.log.Info("API服务器启动在 %s://%s", scheme, addr)
+	if s.tokens != nil {
+		s.log.Info("已启用令牌认证 (%d 个令牌，%s)", len(s.tokens.List()), s.tokens.Path())
+	} else {
+		s.log.Warn("未配置 API 令牌，不启用认证 (仅限本机访问)")
+	}
+	if s.hooks.Enabled() {
+		s.log.Info("已启用 %d 个 webhook", len(s.opts.Webhooks))
+	}
+
+	server := &http.Server{Addr: addr, Handler: s.Handler()}
+	if s.opts.TLSCert != "" {
+		return server.ListenAndServeTLS(s.opts.TLSCert, s.opts.TLSKey)
+	}
+	return server.ListenAndServe()
 }
+
+// isLoopback 监听地址是否只能从本机访问
+func isLoopback(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Handler 返回 API 的路由 (配置了令牌时需要认证)
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/build", s.handleBuild)
+	mux.HandleFunc("/api/status", s.handleStatus)
+	mux.HandleFunc("POST /api/jobs", s.handleCreateJob)
+	mux.HandleFunc("GET /api/jobs", s.handleListJobs)
+	mux.HandleFunc("GET /api/jobs/{id}", s.handleGetJob)
+	mux.HandleFunc("DELETE /api/jobs/{id}", s.handleCancelJob)
+	mux.HandleFunc("GET /api/jobs/{id}/events", s.handleJobEvents)
+	mux.HandleFunc("GET /api/jobs/{id}/artifacts", s.handleListArtifacts)
+	mux.HandleFunc("GET /api/jobs/{id}/artifacts/{name}", s.handleDownloadArtifact)
+	mux.HandleFunc("GET /api/themes", s.handleListThemes)
+	mux.HandleFunc("POST /api/themes", s.handleUploadTheme)
+	mux.HandleFunc("GET /api/preinstall", s.handleListPreinstall)
+	mux.HandleFunc("POST /api/preinstall", s.handleUploadInstaller)
+	mux.HandleFunc("GET /api/history", s.handleListHistory)
+	mux.HandleFunc("GET /api/history/{id}", s.handleGetHistory)
+	mux.HandleFunc("/api/tweaks", s.handleTweaks)
+	mux.HandleFunc("GET /api/openapi.json", s.handleOpenAPI)
+	if s.tokens != nil {
+		return s.authenticate(mux)
+	}
+	return mux
+}
+
+// handleBuild 提交构建任务 (兼容旧接口，新代码使用 POST /api/jobs)
 func (s *Server) handleBuild(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "仅支持 POST", http.StatusMethodNotAllowed)
 		return
 	}
-	var req types.BuildRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		s.sendError(w, "无效的请求", err)
+	job, ok := s.submit(w, r)
+	if !ok {
 		return
 	}
-	go s.executeBuild(&req)
 	s.sendJSON(w, types.BuildResponse{
-		Success: true, Message: "构建已启动"})
+		Success: true, Message: "构建已加入队列", JobID: job.ID})
+}
+func (s *Server) handleCreateJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.submit(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Location", "/api/jobs/"+job.ID)
+	s.sendJSONStatus(w, http.StatusAccepted, job)
+}
+func (s *Server) handleListJobs(w http.ResponseWriter, r *http.Request) {
+	s.sendJSON(w, s.queue.list())
+}
+func (s *Server) handleGetJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.queue.get(r.PathValue("id"))
+	if !ok {
+		s.sendErrorStatus(w, http.StatusNotFound, "任务不存在", errJobNotFound)
+		return
+	}
+	s.sendJSON(w, job)
+}
+func (s *Server) handleCancelJob(w http.ResponseWriter, r *http.Request) {
+	job, err := s.queue.cancel(r.PathValue("id"))
+	switch {
+	case errors.Is(err, errJobNotFound):
+		s.sendErrorStatus(w, http.StatusNotFound, "任务不存在", err)
+	case err != nil:
+		s.sendErrorStatus(w, http.StatusConflict, "无法取消任务", err)
+	case job.State == types.JobRunning:
+		// 构建正在停止，结束后状态变为 canceled
+		s.sendJSONStatus(w, http.StatusAccepted, job)
+	default:
+		s.sendJSON(w, job)
+	}
+}
+
+// submit 解析构建请求并加入队列，失败时已写入错误响应
+func (s *Server) submit(w http.ResponseWriter, r *http.Request) (types.Job, bool) {
+	var req types.BuildRequest
+	dec := json.NewDecoder(r.Body)
+	// 拼错的字段名 (如 isoDriver) 直接报错，而不是被忽略后按默认值构建
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		s.sendError(w, "无效的请求", decodeError(err))
+		return types.Job{}, false
+	}
+	if errs := validateRequest(&req); len(errs) > 0 {
+		s.sendError(w, "无效的构建参数", errs)
+		return types.Job{}, false
+	}
+	cfg, mode, err := s.buildConfig(&req)
+	if err != nil {
+		s.sendError(w, "无效的构建参数", err)
+		return types.Job{}, false
+	}
+	job := s.queue.submit(req, cfg, mode)
+	if name := tokenName(r); name != "" {
+		s.log.Info("任务 %s 已加入队列 (%s, 工作目录 %s, 令牌 %s)", job.ID, mode, job.WorkDir, name)
+	} else {
+		s.log.Info("任务 %s 已加入队列 (%s, 工作目录 %s)", job.ID, mode, job.WorkDir)
+	}
+	return job, true
 }
-func (s *Server) executeBuild(req *types.BuildRequest) {
-	s.updateStatus("preparing", 0, "准备构建环境")
+
+// buildConfig 根据构建请求生成构建配置
+func (s *Server) buildConfig(req *types.BuildRequest) (*config.Config, types.BuildMode, error) {
 	cfg := config.NewConfig()
-	cfg.ISODrive = req.ISODrive
+	cfg.Runner = s.runner
+	// 路径已由 validateRequest 检查为相对路径 (filepath.IsLocal)，只能指向配置的目录之内
+	if req.WorkDir != "" {
+		cfg.SetWorkDir(filepath.Join(s.opts.WorkRoot, req.WorkDir))
+	}
+	cfg.ISODrive = normalizeDrive(req.ISODrive)
+	if req.ISOFile != "" {
+		cfg.ISOFile = filepath.Join(s.opts.MediaDir, req.ISOFile)
+		if !utils.FileExists(cfg.ISOFile) {
+			return nil, "", invalidField("isoFile", fmt.Errorf("介质目录中没有 ISO 镜像文件 %s", req.ISOFile))
+		}
+	}
 	cfg.ThemeName = req.Theme
-	cfg.PreinstallApps = req.PreinstallApps
+	if strings.EqualFold(req.Theme, "default") {
+		cfg.ThemeName = ""
+	}
+	if len(req.PreinstallApps) > 0 {
+		pc, err := preinstall.ReadConfig(cfg.PreinstallDir)
+		if err != nil {
+			return nil, "", err
+		}
+		apps, err := pc.SelectApps(req.PreinstallApps)
+		if err != nil {
+			return nil, "", invalidField("preinstallApps", err)
+		}
+		cfg.PreinstallApps = apps
+		cfg.PreinstallSet = true
+	}
+	if req.OutputISO != "" {
+		cfg.OutputISO = filepath.Join(cfg.WorkDir, req.OutputISO)
+	}
+	cfg.Verbose = req.Verbose
 	cfg.ImageIndex = req.ImageIndex
+	if req.ExportReg != "" {
+		cfg.ExportReg = filepath.Join(cfg.WorkDir, req.ExportReg)
+	}
+	cfg.StrictTweaks = req.StrictTweaks
+	cfg.RegDiff = req.RegDiff
+	if len(req.RegFiles) > 0 {
+		files := make([]string, len(req.RegFiles))
+		for i, f := range req.RegFiles {
+			files[i] = filepath.Join(s.opts.MediaDir, f)
+		}
+		tweaks, err := registry.LoadRegFiles(files)
+		if err != nil {
+			return nil, "", invalidField("regFiles", err)
+		}
+		cfg.RegFiles = files
+		cfg.RegTweaks = tweaks
+	}
 	if req.ScratchDrive != "" {
-		cfg.ScratchDrive = req.ScratchDrive
+		cfg.ScratchDrive = normalizeDrive(req.ScratchDrive)
+	}
+	mode := req.Mode
+	if req.Profile != "" {
+		p, err := profile.Resolve(req.Profile, cfg.ProfilesDir)
+		if err != nil {
+			return nil, "", invalidField("profile", err)
+		}
+		cfg.Profile = p
+		if mode == "" {
+			mode = types.BuildMode(p.Mode)
+		}
 	}
-	log := logger.NewLogger("api-build")
+	if mode == "" {
+		mode = types.ModeStandard
+	}
+	mode, err := app.ParseMode(string(mode))
+	if err != nil {
+		return nil, "", invalidField("mode", err)
+	}
+	if len(req.EnableTweaks) > 0 || len(req.DisableTweaks) > 0 {
+		if cfg.Profile == nil {
+			cfg.Profile = profile.Default(string(mode))
+		}
+		var errs fieldErrors
+		for _, list := range []struct {
+			field string
+			ids   []string
+		}{{"enableTweaks", req.EnableTweaks}, {"disableTweaks", req.DisableTweaks}} {
+			for i, id := range list.ids {
+				if !cfg.Profile.KnownTweak(id) {
+					errs.add(fmt.Sprintf("%s[%d]", list.field, i), fmt.Sprintf("未知的注册表优化: %s (见 GET /api/tweaks)", id))
+				}
+			}
+		}
+		if len(errs) > 0 {
+			return nil, "", errs
+		}
+		if err := cfg.Profile.SelectTweaks(req.EnableTweaks, req.DisableTweaks); err != nil {
+			return nil, "", invalidField("enableTweaks", err)
+		}
+		cfg.EnableTweaks = req.EnableTweaks
+		cfg.DisableTweaks = req.DisableTweaks
+	}
+	return cfg, mode, nil
+}
+
+// runJob 执行构建任务，返回输出 ISO 路径
+func (s *Server) runJob(ctx context.Context, j *job) (string, error) {
+	log := logger.NewLogger("job-" + j.ID)
 	defer log.Close()
-	var builder app.Builder
-	if req.Mode == types.ModeCore {
-		cfg.CoreMode = true
-		builder = app.NewTiny11CoreBuilder(cfg, log)
-	} else {
-		builder = app.NewTiny11Builder(cfg, log)
+	if path := log.Path(); path != "" {
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+		j.logFile = path
 	}
-	s.updateStatus("building", 10, "开始构建")
-	if err := builder.Build(); err != nil {
-		s.updateStatus("error", 0, err.Error())
-		return
+	log.SetEventSink(func(e logger.Event) {
+		j.events.publish(e.Type, e)
+		j.steps.Observe(e)
+		if e.Type == logger.EventStep {
+			s.queue.updateStep(j, e)
+			if e.Status == logger.StepFinished {
+				s.notifyStep(j, e)
+			}
+		}
+	})
+	if err := j.cfg.EnsureDirectories(); err != nil {
+		return "", fmt.Errorf("创建工作目录失败: %w", err)
+	}
+	builder, err := app.NewBuilder(j.mode, j.cfg, log)
+	if err != nil {
+		return "", err
+	}
+	s.queue.update(j, "building", 0, "开始构建")
+	if err := builder.Build(ctx); err != nil {
+		return "", err
+	}
+
+	// 预先计算 ISO 的校验和，列出产物时不必等待
+	iso := builder.GetOutputISO()
+	s.queue.update(j, "checksum", 100, "计算 ISO 校验和")
+	if sum, err := s.sums.compute(iso); err != nil {
+		log.Warn("计算 ISO 校验和失败: %v", err)
+	} else {
+		log.Info("ISO SHA-256: %s", sum)
 	}
-	s.updateStatus("complete", 100, "构建完成")
-	s.mu.Lock()
-	s.status.OutputISO = builder.GetOutputISO()
-	s.mu.Unlock()
+	return iso, nil
 }
+
+// handleStatus 最近一个任务的状态 (兼容旧接口)
 func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	s.sendJSON(w, s.status)
-}
-func (s *Server) handleThemes(w http.ResponseWriter, r *http.Request) {
-	themes := []string{"default", "miku"}
-	s.sendJSON(w, themes)
-}
-func (s *Server) handlePreinstall(w http.ResponseWriter, r *http.Request) {
-	apps := []map[string]string{{"id": "chrome", "name": "Google Chrome"}, {"id": "7zip", "name": "7-Zip"}}
-	s.sendJSON(w, apps)
-}
-func (s *Server) updateStatus(phase string, progress float64, message string) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.status.Phase = phase
-	s.status.Progress = progress
-	s.status.Message = message
-	s.status.IsComplete = phase == "complete"
-	if phase == "error" {
-		s.status.Error = message
+	job, ok := s.queue.latest()
+	if !ok {
+		s.sendJSON(w, types.BuildStatus{Phase: "idle"})
+		return
 	}
+	s.sendJSON(w, types.BuildStatus{
+		Phase:      job.Phase,
+		Progress:   job.Progress,
+		Message:    job.Message,
+		IsComplete: job.State == types.JobComplete,
+		Error:      job.Error,
+		OutputISO:  job.OutputISO,
+	})
+}
+func (s *Server) handleTweaks(w http.ResponseWriter, r *http.Request) {
+	s.sendJSON(w, profile.Catalog())
 }
 func (s *Server) sendJSON(w http.ResponseWriter, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(data)
 }
+func (s *Server) sendJSONStatus(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
 func (s *Server) sendError(w http.ResponseWriter, message string, err error) {
-	w.WriteHeader(http.StatusBadRequest)
-	s.sendJSON(w, types.BuildResponse{
-		Success: false, Message: message, Error: err.Error()})
+	s.sendErrorStatus(w, http.StatusBadRequest, message, err)
+}
+func (s *Server) sendErrorStatus(w http.ResponseWriter, status int, message string, err error) {
+	resp := types.BuildResponse{Success: false, Message: message, Error: err.Error()}
+	var fields fieldErrors
+	if errors.As(err, &fields) {
+		resp.Fields = fields
+	}
+	s.sendJSONStatus(w, status, resp)
 }
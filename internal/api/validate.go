@@ -0,0 +1,244 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"tiny11-builder/internal/app"
+	"tiny11-builder/internal/config"
+	"tiny11-builder/internal/theme"
+	"tiny11-builder/internal/types"
+	"tiny11-builder/internal/utils"
+)
+
+// requestField 构建请求字段的说明和约束
+//
+// 同一份定义用于生成 OpenAPI 文档 (description、pattern、enum、minimum)
+// 和校验提交的请求；数组字段的约束作用于每个元素。
+type requestField struct {
+	description string
+	pattern     *regexp.Regexp
+	patternHint string          // 不匹配 pattern 时的错误信息
+	enum        func() []string // 可选值，校验时不区分大小写
+	nonNegative bool
+	local       bool // 服务器路径: 相对于服务器配置的目录，不能是绝对路径或包含 ..
+}
+
+var drivePattern = regexp.MustCompile(`^[C-Zc-z]:?$`)
+
+// requestFields BuildRequest 的字段 (按 JSON 字段名)
+var requestFields = map[string]requestField{
+	"isoDrive": {
+		description: "挂载了 Windows 11 ISO 的盘符 (C-Z)，如 E 或 E:；与 isoFile 二选一",
+		pattern:     drivePattern, patternHint: "应为 C 到 Z 的盘符，如 E 或 E:",
+	},
+	"isoFile": {
+		description: "Windows 11 ISO 文件，相对于服务器的介质目录 (-media-dir)；与 isoDrive 二选一",
+		local:       true,
+	},
+	"scratchDrive": {
+		description: "存放临时文件的盘符 (C-Z)",
+		pattern:     drivePattern, patternHint: "应为 C 到 Z 的盘符，如 D 或 D:",
+	},
+	"workDir": {
+		description: "工作目录，相对于服务器的工作根目录 (-work-root，默认为程序目录): build 目录、日志和输出文件所在位置，工作目录相同的任务依次构建",
+		local:       true,
+	},
+	"mode": {
+		description: "构建模式 (为空时为 standard；指定配置文件时为配置文件的模式)",
+		enum:        func() []string { return append([]string{""}, modeNames()...) },
+	},
+	"theme": {
+		description: "主题 (GET /api/themes 中的 id)，为空或 default 时不应用主题",
+		enum:        themeNames,
+	},
+	"profile":    {description: "构建配置文件: 内置配置名、profiles 目录中的名称或服务器上的文件路径"},
+	"imageIndex": {description: "install.wim 中的映像索引", nonNegative: true},
+	"outputIso": {
+		description: "输出 ISO，相对于工作目录 (默认为 tiny11.iso)",
+		local:       true,
+		pattern:     regexp.MustCompile(`(?i)\.iso$`), patternHint: "应为 .iso 文件",
+	},
+	"preinstallApps": {description: "预装软件 id (GET /api/preinstall)，all 表示全部"},
+	"regFiles": {
+		description: "要导入的 .reg 文件，相对于服务器的介质目录 (-media-dir)",
+		local:       true,
+		pattern:     regexp.MustCompile(`(?i)\.reg$`), patternHint: "应为 .reg 文件",
+	},
+	"enableTweaks":  {description: "额外启用的注册表优化 id (GET /api/tweaks)"},
+	"disableTweaks": {description: "禁用的注册表优化 id (GET /api/tweaks)"},
+	"exportReg": {
+		description: "把成功应用的注册表修改导出为 .reg 文件，相对于工作目录",
+		local:       true,
+		pattern:     regexp.MustCompile(`(?i)\.reg$`), patternHint: "应为 .reg 文件",
+	},
+	"strictTweaks": {description: "注册表优化校验失败时构建失败"},
+	"regDiff":      {description: "生成注册表差异报告"},
+	"useEsd":       {description: "保留，目前不起作用"},
+	"verbose":      {description: "输出详细日志"},
+}
+
+func modeNames() []string {
+	var names []string
+	for _, m := range app.Modes() {
+		names = append(names, string(m))
+	}
+	return names
+}
+
+// themeNames 可用的主题: 不应用主题 ("" 和 default) 和主题目录中已安装的主题
+func themeNames() []string {
+	names := []string{"", "default"}
+	cfg := config.NewConfig()
+	if !utils.DirExists(cfg.ThemesDir) {
+		return names
+	}
+	installed, _ := theme.NewManager(cfg, nil).ListThemes()
+	return append(names, installed...)
+}
+
+// check 校验一个值，返回错误信息
+func (f requestField) check(value string) string {
+	if f.local && !filepath.IsLocal(value) {
+		return "应为相对路径 (不能是绝对路径或包含 ..)"
+	}
+	if f.pattern != nil && !f.pattern.MatchString(value) {
+		return f.patternHint
+	}
+	if f.enum != nil {
+		values := f.enum()
+		for _, v := range values {
+			if strings.EqualFold(v, value) {
+				return ""
+			}
+		}
+		var names []string
+		for _, v := range values {
+			if v != "" {
+				names = append(names, v)
+			}
+		}
+		return fmt.Sprintf("无效的值 %q (可选: %s)", value, strings.Join(names, ", "))
+	}
+	return ""
+}
+
+// fieldErrors 校验失败的字段
+type fieldErrors []types.FieldError
+
+func (e fieldErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, f := range e {
+		msgs[i] = f.Field + ": " + f.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e *fieldErrors) add(field, message string) {
+	*e = append(*e, types.FieldError{Field: field, Message: message})
+}
+
+// invalidField 把构建参数的错误归到请求字段
+func invalidField(field string, err error) error {
+	return fieldErrors{{Field: field, Message: err.Error()}}
+}
+
+// validateRequest 按 requestFields 校验构建请求，返回所有不符合的字段
+//
+// ISO 文件、配置文件、预装软件和注册表优化等需要读取文件的校验在 buildConfig 中进行。
+func validateRequest(req *types.BuildRequest) fieldErrors {
+	var errs fieldErrors
+	v := reflect.ValueOf(req).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		name := jsonName(v.Type().Field(i))
+		rule, ok := requestFields[name]
+		if !ok {
+			continue
+		}
+		switch f := v.Field(i); f.Kind() {
+		case reflect.String:
+			if f.Len() == 0 {
+				continue
+			}
+			if msg := rule.check(f.String()); msg != "" {
+				errs.add(name, msg)
+			}
+		case reflect.Slice:
+			for j := 0; j < f.Len(); j++ {
+				if msg := rule.check(f.Index(j).String()); msg != "" {
+					errs.add(fmt.Sprintf("%s[%d]", name, j), msg)
+				}
+			}
+		case reflect.Int:
+			if rule.nonNegative && f.Int() < 0 {
+				errs.add(name, "不能为负数")
+			}
+		}
+	}
+
+	switch {
+	case req.ISODrive == "" && req.ISOFile == "":
+		errs.add("isoDrive", "需要指定 isoDrive 或 isoFile")
+	case req.ISODrive != "" && req.ISOFile != "":
+		errs.add("isoFile", "不能与 isoDrive 同时指定")
+	}
+	return errs
+}
+
+// decodeError 把请求体的解析错误转换为字段错误 (类型不匹配或未知字段时)
+func decodeError(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return invalidField(typeErr.Field, fmt.Errorf("应为 %s", jsonType(typeErr.Type)))
+	}
+	// encoding/json 没有未知字段的错误类型，只能从错误信息中取出字段名
+	if quoted, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		if name, uerr := strconv.Unquote(quoted); uerr == nil {
+			return invalidField(name, errors.New("未知字段"))
+		}
+	}
+	return err
+}
+
+// normalizeDrive 统一盘符格式为 E:
+func normalizeDrive(drive string) string {
+	if drive == "" {
+		return ""
+	}
+	return strings.ToUpper(strings.TrimSuffix(drive, ":")) + ":"
+}
+
+// jsonName 结构体字段的 JSON 名称
+func jsonName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "" {
+		return f.Name
+	}
+	return name
+}
+
+// jsonType Go 类型对应的 JSON 类型名称
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Struct, reflect.Map:
+		return "object"
+	}
+	return t.String()
+}
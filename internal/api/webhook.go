@@ -0,0 +1,39 @@
+package api
+
+import (
+	"tiny11-builder/internal/history"
+	"tiny11-builder/internal/logger"
+	"tiny11-builder/internal/types"
+	"tiny11-builder/internal/webhook"
+)
+
+// notifyJob 发送任务加入队列和开始构建的事件 (调用时持有队列的锁)
+func (s *Server) notifyJob(j *job, event string) {
+	s.hooks.Notify(event, webhookJob(j), nil)
+}
+
+// notifyStep 发送步骤完成的事件
+func (s *Server) notifyStep(j *job, e logger.Event) {
+	if !s.hooks.Enabled() {
+		return
+	}
+	t, ok := j.steps.Step(e.Step)
+	if !ok {
+		return
+	}
+	s.queue.mu.Lock()
+	info := webhookJob(j)
+	s.queue.mu.Unlock()
+	s.hooks.Notify(webhook.EventStepCompleted, info, webhook.Step(t, e.Steps))
+}
+
+// jobFinished 任务结束: 写入构建历史并发送结果事件
+func (s *Server) jobFinished(j *job, err error) {
+	rec := s.recordJob(j, err)
+	s.hooks.Notify(webhook.FinishEvent(rec.State), webhook.RecordJob(rec), nil)
+}
+
+// webhookJob 运行中任务的信息 (调用时持有队列的锁)
+func webhookJob(j *job) *types.WebhookJob {
+	return webhook.RunningJob(j.ID, history.SourceAPI, j.cfg, j.mode, j.State, j.CreatedAt, j.StartedAt)
+}
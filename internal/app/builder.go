@@ -1,13 +1,18 @@
 package app
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"path/filepath"
+	"strings"
 
+	"tiny11-builder/internal/checkpoint"
 	"tiny11-builder/internal/config"
 	"tiny11-builder/internal/image"
 	"tiny11-builder/internal/logger"
 	"tiny11-builder/internal/preinstall"
+	"tiny11-builder/internal/profile"
 	"tiny11-builder/internal/registry"
 	"tiny11-builder/internal/remover"
 	"tiny11-builder/internal/theme"
@@ -20,13 +25,27 @@ type Tiny11Builder struct {
 	imgMgr       *image.Manager
 	regMgr       *registry.Manager
 	remover      *remover.AppRemover
+	nanoRemover  *remover.NanoRemover
 	themeMgr     *theme.Manager
 	themeApplier *theme.Applier
 	preinstallMgr *preinstall.Manager
+	runner       utils.CommandRunner // 外部命令执行器 (录制/回放/模拟)
 	outputISO    string
+
+	// 检查点日志和当前执行的步骤
+	journal *checkpoint.Journal
+	current int
+
+	// ctx 本次构建的上下文 (Build 开始时设置)
+	ctx context.Context
 }
 
 func NewTiny11Builder(cfg *config.Config, log *logger.Logger) *Tiny11Builder {
+	// 未指定配置文件时使用标准版内置配置
+	if cfg.Profile == nil {
+		cfg.Profile = profile.Default(profile.ModeStandard)
+	}
+
 	themeMgr := theme.NewManager(cfg, log)
 	builder := &Tiny11Builder{
 		config:        cfg,
@@ -34,85 +53,105 @@ func NewTiny11Builder(cfg *config.Config, log *logger.Logger) *Tiny11Builder {
 		imgMgr:        image.NewManager(cfg, log),
 		regMgr:        registry.NewManager(cfg, log),
 		remover:       remover.NewAppRemover(cfg, log),
+		nanoRemover:   remover.NewNanoRemover(cfg, log),
 		themeMgr:      themeMgr,
 		preinstallMgr: preinstall.NewManager(cfg, log),
+		runner:        cfg.CommandRunner(),
 	}
 	builder.themeApplier = theme.NewApplier(cfg, log, themeMgr)
 	return builder
 }
 
-func (b *Tiny11Builder) Build() error {
+func (b *Tiny11Builder) Build(ctx context.Context) error {
+	b.ctx = ctx
 	b.log.Header("Tiny11 Builder - 标准版")
+	b.logProfile()
 
-	var imageUnmounted = false
+	if err := b.openJournal(profile.ModeStandard, 14); err != nil {
+		return err
+	}
 
 	if err := b.executeBasicSteps(); err != nil {
 		return err
 	}
 
-	b.log.Step(3, "获取镜像信息")
-	imageInfo, err := b.imgMgr.GetImageInfo()
+	imageInfo, err := b.loadImageInfo(3)
 	if err != nil {
-		return fmt.Errorf("获取镜像信息失败: %w", err)
-	}
-	b.log.Info("架构: %s, 语言: %s, 索引: %d", imageInfo.Architecture, imageInfo.Language, imageInfo.Index)
-
-	b.log.Step(4, "挂载install.wim")
-	if err := b.imgMgr.MountInstallWim(imageInfo.Index); err != nil {
-		return fmt.Errorf("挂载失败: %w", err)
+		return err
 	}
 
-	defer func() {
-		if !imageUnmounted {
-			b.log.Info("执行紧急清理...")
-			b.regMgr.UnloadHives()
-			b.imgMgr.UnmountImage(false)
-		}
-	}()
+	// 挂载步骤中途取消时同样需要卸载 (没有挂载时不执行任何操作)
+	defer b.emergencyCleanup()
 
-	if err := b.executeRemovalSteps(); err != nil {
+	if err := b.mountInstallWim(4, 11, "挂载install.wim", imageInfo.Index); err != nil {
 		return err
 	}
 
-	b.log.Step(7, "应用注册表优化")
-	if err := b.regMgr.LoadHives(); err != nil {
-		return fmt.Errorf("加载注册表失败: %w", err)
+	if err := b.executeRemovalSteps(imageInfo.Language); err != nil {
+		return err
 	}
-	if err := b.regMgr.ApplyTweaks(); err != nil {
-		b.log.Warn("应用优化失败: %v", err)
+
+	if err := b.step(7, "应用注册表优化", func() error {
+		b.snapshotHives(registry.SnapshotBefore)
+		if err := b.regMgr.LoadHives(); err != nil {
+			return fmt.Errorf("加载注册表失败: %w", err)
+		}
+		// 严格模式下必需的优化未生效时中止构建
+		err := b.regMgr.ApplyTweaks()
+		b.unloadHives()
+		return err
+	}); err != nil {
+		return err
 	}
 
+	themeTitle := "跳过主题自定义 (未指定主题)"
 	if b.config.ThemeName != "" {
-		b.log.Step(8, "应用自定义主题: "+b.config.ThemeName)
+		themeTitle = "应用自定义主题: " + b.config.ThemeName
+	}
+	if err := b.step(8, themeTitle, func() error {
+		if b.config.ThemeName == "" {
+			return nil
+		}
+		if err := b.regMgr.LoadHives(); err != nil {
+			return fmt.Errorf("加载注册表失败: %w", err)
+		}
 		if err := b.applyTheme(imageInfo.Name); err != nil {
 			b.log.Warn("主题应用失败: %v", err)
 		}
-	} else {
-		b.log.Step(8, "跳过主题自定义 (未指定主题)")
-	}
-
-	b.log.Info("卸载注册表Hive...")
-	if err := b.regMgr.UnloadHives(); err != nil {
-		b.log.Warn("卸载注册表失败: %v", err)
+		return b.unloadHives()
+	}); err != nil {
+		return err
 	}
 
 	//  预装软件安装 
+	preinstallTitle := "跳过预装软件 (未选择)"
 	if len(b.config.PreinstallApps) > 0 {
-		b.log.Step(9, "预装软件到系统")
-		if err := b.installPreinstallApps(); err != nil {
-			b.log.Warn("预装软件安装失败: %v", err)
+		preinstallTitle = "预装软件到系统"
+	}
+	if err := b.step(9, preinstallTitle, func() error {
+		if len(b.config.PreinstallApps) > 0 {
+			if err := b.installPreinstallApps(); err != nil {
+				b.log.Warn("预装软件安装失败: %v", err)
+			}
 		}
-	} else {
-		b.log.Info("跳过预装软件 (未选择)")
+		return nil
+	}); err != nil {
+		return err
 	}
 
-	b.copyAutounattend()
-
 	if err := b.executeFinalSteps(imageInfo); err != nil {
 		return err
 	}
 
-	imageUnmounted = true
+	b.finishJournal()
+	return nil
+}
+
+// unloadHives 卸载注册表Hive，失败时仅记录警告
+func (b *Tiny11Builder) unloadHives() error {
+	if err := b.regMgr.UnloadHives(); err != nil {
+		b.log.Warn("卸载注册表失败: %v", err)
+	}
 	return nil
 }
 
@@ -156,74 +195,160 @@ func (b *Tiny11Builder) applyTheme(originalEditionName string) error {
 }
 
 func (b *Tiny11Builder) executeBasicSteps() error {
-	b.log.Step(1, "验证ISO镜像")
-	if err := b.imgMgr.ValidateISO(); err != nil {
-		return fmt.Errorf("ISO验证失败: %w", err)
+	if err := b.step(1, "验证ISO镜像", func() error {
+		if err := b.imgMgr.ValidateISO(); err != nil {
+			return fmt.Errorf("ISO验证失败: %w", err)
+		}
+		return nil
+	}); err != nil {
+		return err
 	}
 
-	b.log.Step(2, "复制Windows镜像文件")
-	if err := b.imgMgr.CopyImageFiles(); err != nil {
-		return fmt.Errorf("复制文件失败: %w", err)
+	return b.step(2, "复制Windows镜像文件", func() error {
+		if err := b.imgMgr.CopyImageFiles(b.ctx); err != nil {
+			return fmt.Errorf("复制文件失败: %w", err)
+		}
+		return nil
+	})
+}
+
+func (b *Tiny11Builder) executeRemovalSteps(language string) error {
+	if err := b.step(5, "移除预装应用", func() error {
+		if err := b.remover.RemoveProvisionedApps(b.ctx); err != nil {
+			return fmt.Errorf("移除应用失败: %w", err)
+		}
+
+		if len(b.config.Profile.Packages) > 0 {
+			if err := b.remover.RemoveSystemPackages(b.ctx, language); err != nil {
+				if errors.Is(err, context.Canceled) {
+					return err
+				}
+				b.log.Warn("移除系统包失败: %v", err)
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
 	}
 
-	return nil
+	return b.step(6, "移除Edge和OneDrive", func() error {
+		if err := b.remover.RemoveEdge(); err != nil {
+			b.log.Warn("移除Edge失败: %v", err)
+		}
+
+		if err := b.remover.RemoveOneDrive(); err != nil {
+			b.log.Warn("移除OneDrive失败: %v", err)
+		}
+
+		if err := b.remover.RemoveScheduledTasks(); err != nil {
+			b.log.Warn("移除计划任务失败: %v", err)
+		}
+
+		return b.removeProfileExtras()
+	})
 }
 
-func (b *Tiny11Builder) executeRemovalSteps() error {
-	b.log.Step(5, "移除预装应用")
-	if err := b.remover.RemoveProvisionedApps(); err != nil {
-		return fmt.Errorf("移除应用失败: %w", err)
+// logProfile 输出本次构建使用的配置文件
+func (b *Tiny11Builder) logProfile() {
+	p := b.config.Profile
+	b.log.Info("构建配置: %s (%s)", p.Name, p.Source)
+	if len(p.Chain) > 1 {
+		b.log.Info("继承链: %s", strings.Join(p.Chain, " -> "))
 	}
-
-	b.log.Step(6, "移除Edge和OneDrive")
-	if err := b.remover.RemoveEdge(); err != nil {
-		b.log.Warn("移除Edge失败: %v", err)
+	for _, w := range p.Warnings {
+		b.log.Warn("配置文件: %s", w)
 	}
-
-	if err := b.remover.RemoveOneDrive(); err != nil {
-		b.log.Warn("移除OneDrive失败: %v", err)
+	if len(b.config.EnableTweaks) > 0 {
+		b.log.Info("单独启用的注册表优化: %s", strings.Join(b.config.EnableTweaks, ", "))
 	}
-
-	if err := b.remover.RemoveScheduledTasks(); err != nil {
-		b.log.Warn("移除计划任务失败: %v", err)
+	if len(b.config.DisableTweaks) > 0 {
+		b.log.Info("单独禁用的注册表优化: %s", strings.Join(b.config.DisableTweaks, ", "))
 	}
+}
 
+// removeProfileExtras 执行配置文件中的驱动、字体、文件夹和服务移除
+// (Nano 流程中这些项有各自的步骤，标准版和 Core 版在配置文件包含时才执行)
+//
+// 各项失败时只记录警告，构建被取消时返回错误。
+func (b *Tiny11Builder) removeProfileExtras() error {
+	p := b.config.Profile
+
+	extras := []struct {
+		enabled bool
+		run     func(context.Context) error
+		warn    string
+	}{
+		{len(p.Drivers) > 0, b.nanoRemover.SlimDriverStore, "精简 DriverStore 失败: %v"},
+		{p.Fonts != nil, b.nanoRemover.SlimFonts, "精简字体失败: %v"},
+		{len(p.Folders) > 0, b.nanoRemover.RemoveSystemFolders, "移除系统文件夹失败: %v"},
+		// 服务移除会自行加载 SYSTEM hive，需在 LoadHives 之前执行
+		{len(p.Services) > 0, b.nanoRemover.RemoveSystemServices, "移除服务失败: %v"},
+	}
+	for _, extra := range extras {
+		if !extra.enabled {
+			continue
+		}
+		if err := extra.run(b.ctx); err != nil {
+			if errors.Is(err, context.Canceled) {
+				return err
+			}
+			b.log.Warn(extra.warn, err)
+		}
+	}
 	return nil
 }
 
 func (b *Tiny11Builder) executeFinalSteps(imageInfo *image.ImageInfo) error {
-	b.log.Step(10, "清理和优化镜像")
-	if err := b.imgMgr.CleanupImage(); err != nil {
-		b.log.Warn("清理镜像失败（跳过）: %v", err)
+	if err := b.step(10, "清理和优化镜像", func() error {
+		if err := b.imgMgr.CleanupImage(); err != nil {
+			b.log.Warn("清理镜像失败（跳过）: %v", err)
+		}
+		return nil
+	}); err != nil {
+		return err
 	}
 
-	b.log.Step(11, "导出优化后的镜像")
-	if err := b.imgMgr.UnmountImage(true); err != nil {
-		return fmt.Errorf("卸载失败: %w", err)
-	}
+	if err := b.step(11, "导出优化后的镜像", func() error {
+		b.copyAutounattend()
 
-	if err := b.imgMgr.ExportImage(imageInfo.Index); err != nil {
-		return fmt.Errorf("导出失败: %w", err)
-	}
+		if err := b.unmountInstallWim(); err != nil {
+			return err
+		}
 
-	b.log.Step(12, "处理boot.wim")
-	if err := b.processBootWim(); err != nil {
-		return fmt.Errorf("处理boot.wim失败: %w", err)
+		if err := b.imgMgr.ExportImage(imageInfo.Index); err != nil {
+			return fmt.Errorf("导出失败: %w", err)
+		}
+		return nil
+	}); err != nil {
+		return err
 	}
 
-	b.log.Step(13, "创建ISO镜像")
-	isoPath, err := b.imgMgr.CreateISO()
-	if err != nil {
-		return fmt.Errorf("创建ISO失败: %w", err)
+	if err := b.step(12, "处理boot.wim", func() error {
+		if err := b.processBootWim(); err != nil {
+			return fmt.Errorf("处理boot.wim失败: %w", err)
+		}
+		return nil
+	}); err != nil {
+		return err
 	}
-	b.outputISO = isoPath
 
-	b.log.Step(14, "清理临时文件")
-	if err := b.imgMgr.Cleanup(); err != nil {
-		b.log.Warn("清理临时文件失败: %v", err)
+	if err := b.step(13, "创建ISO镜像", func() error {
+		isoPath, err := b.imgMgr.CreateISO()
+		if err != nil {
+			return fmt.Errorf("创建ISO失败: %w", err)
+		}
+		b.outputISO = isoPath
+		return nil
+	}); err != nil {
+		return err
 	}
 
-	return nil
+	return b.step(14, "清理临时文件", func() error {
+		if err := b.imgMgr.Cleanup(); err != nil {
+			b.log.Warn("清理临时文件失败: %v", err)
+		}
+		return nil
+	})
 }
 
 func (b *Tiny11Builder) copyAutounattend() error {
@@ -237,7 +362,7 @@ func (b *Tiny11Builder) copyAutounattend() error {
 		b.log.Info("尝试从主题或默认位置获取...")
 
 		if b.config.ThemeName != "default" && b.config.ThemeName != "" {
-			themePath := filepath.Join(b.config.WorkDir, "themes", b.config.ThemeName, "autounattend.xml")
+			themePath := filepath.Join(b.config.ThemesDir, b.config.ThemeName, "autounattend.xml")
 			if utils.FileExists(themePath) {
 				autoUnattendSrc = themePath
 				b.log.Success("使用主题中的autounattend.xml")
@@ -339,7 +464,7 @@ func (b *Tiny11Builder) createDefaultAutounattend(path string) error {
 func (b *Tiny11Builder) processBootWim() error {
 	var bootUnmounted = false
 
-	if err := b.imgMgr.MountBootWim(); err != nil {
+	if err := b.mountBootWim(); err != nil {
 		return err
 	}
 
@@ -348,6 +473,7 @@ func (b *Tiny11Builder) processBootWim() error {
 			b.log.Info("执行boot.wim紧急清理...")
 			b.regMgr.UnloadHives()
 			b.imgMgr.UnmountImage(false)
+			b.record(b.journal.ClearMount())
 		}
 	}()
 
@@ -356,7 +482,7 @@ func (b *Tiny11Builder) processBootWim() error {
 	}
 
 	if err := b.regMgr.ApplyBootTweaks(); err != nil {
-		b.log.Warn("应用Boot优化失败: %v", err)
+		return fmt.Errorf("应用Boot优化失败: %w", err)
 	}
 
 	b.regMgr.UnloadHives()
@@ -366,6 +492,7 @@ func (b *Tiny11Builder) processBootWim() error {
 	}
 
 	bootUnmounted = true
+	b.record(b.journal.ClearMount())
 	return nil
 }
 
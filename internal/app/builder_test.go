@@ -0,0 +1,84 @@
+package app
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"tiny11-builder/internal/config"
+	"tiny11-builder/internal/dismsim"
+	"tiny11-builder/internal/iso"
+	"tiny11-builder/internal/logger"
+)
+
+// TestBuildFromISOFile 指定 ISO 文件时直接从镜像中读取安装介质，无需挂载 (以 Nano 构建为例)
+func TestBuildFromISOFile(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+
+	media := filepath.Join(dir, "media")
+	if err := dismsim.WriteISOFixture(media); err != nil {
+		t.Fatal(err)
+	}
+	source := filepath.Join(dir, "Win11.iso")
+	if _, err := iso.Create(media, source, iso.Options{
+		VolumeID: "CCCOMA_X64FRE",
+		BIOSBoot: "boot/etfsboot.com",
+		EFIBoot:  "efi/microsoft/boot/efisys.bin",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	sim := dismsim.New()
+	sim.MinWimSize = 0
+	cfg := config.NewConfig()
+	cfg.SetWorkDir(filepath.Join(dir, "work"))
+	cfg.ResourcesDir = filepath.Join(dir, "resources")
+	cfg.ThemesDir = filepath.Join(dir, "themes")
+	cfg.PreinstallDir = filepath.Join(dir, "preinstall")
+	cfg.ISOFile = source
+	cfg.ImageIndex = 2
+	cfg.PreinstallSet = true
+	cfg.Runner = sim
+	if err := cfg.EnsureDirectories(); err != nil {
+		t.Fatal(err)
+	}
+
+	log := logger.NewLogger("test")
+	defer log.Close()
+	if err := NewTiny11NanoBuilder(cfg, log).Build(context.Background()); err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	out, err := iso.OpenImage(cfg.OutputISO)
+	if err != nil {
+		t.Fatalf("打开输出 ISO: %v", err)
+	}
+	defer out.Close()
+
+	// 安装介质中的文件从源 ISO 复制到输出 ISO
+	for _, name := range []string{"setup.exe", "boot/etfsboot.com", "efi/microsoft/boot/efisys.bin", "sources/boot.wim"} {
+		want, err := fs.ReadFile(os.DirFS(media), name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := fs.ReadFile(out, name)
+		if err != nil {
+			t.Errorf("输出 ISO 中缺少 %s: %v", name, err)
+			continue
+		}
+		if name != "sources/boot.wim" && string(got) != string(want) {
+			t.Errorf("%s 内容 = %q, want %q", name, got, want)
+		}
+	}
+
+	img := readOutputImage(t, cfg.OutputISO, dir)
+	if img.Name != "Windows 11 Pro" {
+		t.Errorf("输出镜像 = %s, want Windows 11 Pro", img.Name)
+	}
+	if img.HasAppx("Clipchamp.Clipchamp") {
+		t.Error("应用未移除: Clipchamp.Clipchamp")
+	}
+}
@@ -0,0 +1,333 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"tiny11-builder/internal/checkpoint"
+	"tiny11-builder/internal/image"
+	"tiny11-builder/internal/registry"
+	"tiny11-builder/internal/utils"
+)
+
+// openJournal 开始新的检查点日志；恢复构建 (-resume) 时加载已有日志并校验磁盘状态
+func (b *Tiny11Builder) openJournal(mode string, steps int) error {
+	b.log.SetSteps(steps)
+	if !b.config.Resume {
+		// 报告按镜像合并 (继续构建时保留另一镜像的结果)，新的构建不能沿用上次构建的结果
+		if b.config.TweakReport != "" {
+			if err := os.Remove(b.config.TweakReport); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("删除上次的注册表优化报告失败: %w", err)
+			}
+		}
+
+		b.journal = checkpoint.New(b.config.CheckpointFile, mode, steps)
+		b.journal.Options = checkpoint.Options{
+			ISODrive:   b.config.ISODrive,
+			ISOFile:    b.config.ISOFile,
+			ImageIndex: b.config.ImageIndex,
+			OutputISO:  b.config.OutputISO,
+			Profile:    b.config.Profile.Source,
+			Theme:      b.config.ThemeName,
+			Preinstall: b.config.PreinstallApps,
+			RegFiles:   b.config.RegFiles,
+			ExportReg:  b.config.ExportReg,
+
+			EnableTweaks:  b.config.EnableTweaks,
+			DisableTweaks: b.config.DisableTweaks,
+
+			TweakReport:  b.config.TweakReport,
+			StrictTweaks: b.config.StrictTweaks,
+			RegDiff:      b.config.RegDiff,
+			KeepChanges:  b.config.KeepChanges,
+		}
+		b.record(b.journal.Save())
+		return nil
+	}
+
+	j, err := checkpoint.Load(b.config.CheckpointFile)
+	if err != nil {
+		return fmt.Errorf("无法继续构建: %w", err)
+	}
+	if j.Mode != mode || j.Steps != steps {
+		return fmt.Errorf("无法继续构建: 检查点记录的是 %s 模式 (%d 个步骤)，当前为 %s 模式 (%d 个步骤)",
+			j.Mode, j.Steps, mode, steps)
+	}
+	b.journal = j
+
+	if err := b.verifyJournal(); err != nil {
+		return fmt.Errorf("无法继续构建: %w", err)
+	}
+	if err := b.restoreMount(); err != nil {
+		return fmt.Errorf("无法继续构建: %w", err)
+	}
+
+	next := j.Next()
+	if next > j.Steps {
+		b.log.Info("检查点中所有步骤均已完成")
+	} else {
+		b.log.Info("从检查点继续构建: 已完成 %d/%d 个步骤，从步骤 %d 开始", len(j.Completed), j.Steps, next)
+	}
+	return nil
+}
+
+// verifyJournal 校验检查点记录的进度与构建目录中的文件一致
+func (b *Tiny11Builder) verifyJournal() error {
+	j := b.journal
+
+	if j.Done(2) {
+		sources := filepath.Join(b.config.Tiny11Dir, "sources")
+		if !utils.DirExists(sources) {
+			return fmt.Errorf("镜像文件目录不存在: %s", sources)
+		}
+		if !utils.FileExists(filepath.Join(sources, "install.wim")) &&
+			!utils.FileExists(filepath.Join(sources, "install.esd")) {
+			return fmt.Errorf("%s 中缺少 install.wim 或 install.esd", sources)
+		}
+	}
+
+	if j.Done(3) && j.Image == nil {
+		return fmt.Errorf("检查点缺少镜像信息")
+	}
+
+	return nil
+}
+
+// restoreMount 检查上次记录的挂载状态
+//
+// install.wim 仍处于挂载状态时直接沿用 (需要时重新装载)；挂载已丢失时
+// 未提交的更改也随之丢失，从挂载步骤重新执行。boot.wim 的处理步骤会
+// 整体重新执行，残留的挂载直接放弃。
+func (b *Tiny11Builder) restoreMount() error {
+	m := b.journal.Mount
+	if m == nil {
+		return nil
+	}
+
+	mounted := b.imgMgr.MountedImage()
+	status := ""
+	if mounted != nil {
+		status = strings.ToLower(mounted.Status)
+	}
+
+	if m.Image != checkpoint.MountInstall || strings.Contains(status, "invalid") {
+		if mounted != nil {
+			b.log.Info("放弃上次残留的挂载...")
+			b.imgMgr.UnmountImage(false)
+		}
+		if m.Image == checkpoint.MountInstall {
+			b.log.Warn("install.wim 挂载已失效，将从步骤 %d 重新执行", m.Step)
+			return b.journal.Rollback(m.Step)
+		}
+		return b.journal.ClearMount()
+	}
+
+	if mounted == nil {
+		b.log.Warn("install.wim 已不在挂载状态，未提交的更改已丢失，将从步骤 %d 重新执行", m.Step)
+		return b.journal.Rollback(m.Step)
+	}
+
+	if strings.Contains(status, "remount") {
+		b.log.Info("挂载目录需要重新装载...")
+		if err := b.imgMgr.RemountImage(); err != nil {
+			return err
+		}
+	}
+
+	b.log.Success("沿用已挂载的 install.wim (%s)", m.Dir)
+	return nil
+}
+
+// step 执行一个构建步骤并记录到检查点，恢复构建时跳过已完成的步骤
+//
+// 构建已取消时不再开始新的步骤；执行中的步骤因取消返回错误时不记为完成，
+// 恢复构建时重新执行。
+func (b *Tiny11Builder) step(n int, title string, fn func() error) error {
+	if b.journal.Done(n) {
+		b.log.StepSkipped(n, title)
+		return nil
+	}
+	if err := b.canceled(); err != nil {
+		return err
+	}
+
+	b.log.Step(n, title)
+	b.current = n
+	if err := fn(); err != nil {
+		if canceled := b.canceled(); canceled != nil {
+			b.log.Warn("步骤 %d 被中断: %v", n, err)
+			return canceled
+		}
+		return err
+	}
+
+	b.record(b.journal.Complete(n))
+	b.log.StepDone(n, title)
+	return nil
+}
+
+// canceled 构建已取消时返回 "构建已取消" 错误
+func (b *Tiny11Builder) canceled() error {
+	if b.ctx == nil {
+		return nil
+	}
+	if err := b.ctx.Err(); err != nil {
+		return fmt.Errorf("构建已取消: %w", err)
+	}
+	return nil
+}
+
+// buildStep 构建步骤
+type buildStep struct {
+	n     int
+	title string
+	fn    func() error
+}
+
+// runSteps 依次执行构建步骤
+func (b *Tiny11Builder) runSteps(steps []buildStep) error {
+	for _, s := range steps {
+		if err := b.step(s.n, s.title, s.fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// record 检查点写入失败不影响构建，仅记录警告
+func (b *Tiny11Builder) record(err error) {
+	if err != nil {
+		b.log.Warn("写入检查点失败: %v", err)
+	}
+}
+
+// loadImageInfo 获取镜像信息，恢复构建时使用检查点中记录的结果
+func (b *Tiny11Builder) loadImageInfo(n int) (*image.ImageInfo, error) {
+	err := b.step(n, "获取镜像信息", func() error {
+		info, err := b.imgMgr.GetImageInfo()
+		if err != nil {
+			return fmt.Errorf("获取镜像信息失败: %w", err)
+		}
+		b.journal.Image = &checkpoint.Image{
+			Index:        info.Index,
+			Name:         info.Name,
+			Architecture: info.Architecture,
+			Language:     info.Language,
+			Build:        info.Build,
+			Size:         info.Size,
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	img := b.journal.Image
+	b.log.Info("架构: %s, 语言: %s, 索引: %d", img.Architecture, img.Language, img.Index)
+
+	return &image.ImageInfo{
+		Index:        img.Index,
+		Name:         img.Name,
+		Architecture: img.Architecture,
+		Language:     img.Language,
+		Build:        img.Build,
+		Size:         img.Size,
+	}, nil
+}
+
+// mountInstallWim 挂载 install.wim (步骤 n) 并记录到检查点
+//
+// 恢复构建时，卸载步骤 unmountStep 已完成则无需挂载；镜像仍处于挂载状态
+// 则直接沿用；挂载步骤已完成但镜像已卸载 (上次失败时按 -keep-changes 提交了更改)
+// 则重新挂载。
+func (b *Tiny11Builder) mountInstallWim(n, unmountStep int, title string, index int) error {
+	if b.journal.Done(unmountStep) || b.journal.Mount != nil {
+		return nil
+	}
+
+	mount := func() error {
+		if err := b.imgMgr.MountInstallWim(index); err != nil {
+			return fmt.Errorf("挂载失败: %w", err)
+		}
+		b.record(b.journal.SetMount(&checkpoint.Mount{
+			Image: checkpoint.MountInstall,
+			Index: index,
+			Dir:   b.config.ScratchDir,
+			Step:  n,
+		}))
+		return nil
+	}
+
+	if b.journal.Done(n) {
+		b.log.Info("重新挂载 install.wim 以继续构建...")
+		return mount()
+	}
+	return b.step(n, title, mount)
+}
+
+// unmountInstallWim 提交更改并卸载 install.wim
+func (b *Tiny11Builder) unmountInstallWim() error {
+	b.snapshotHives(registry.SnapshotAfter)
+	if err := b.imgMgr.UnmountImage(true); err != nil {
+		return fmt.Errorf("卸载失败: %w", err)
+	}
+	b.record(b.journal.ClearMount())
+	return nil
+}
+
+// mountBootWim 挂载 boot.wim 并记录到检查点
+func (b *Tiny11Builder) mountBootWim() error {
+	if err := b.imgMgr.MountBootWim(); err != nil {
+		return err
+	}
+	b.record(b.journal.SetMount(&checkpoint.Mount{
+		Image: checkpoint.MountBoot,
+		Index: 2,
+		Dir:   b.config.ScratchDir,
+		Step:  b.current,
+	}))
+	return nil
+}
+
+// emergencyCleanup 构建失败时卸载注册表并卸载 install.wim
+//
+// 默认放弃未提交的更改并将检查点回退到挂载步骤，-resume 时从挂载步骤重新执行。
+// 指定 -keep-changes 时先提交已完成步骤的更改，-resume 时重新挂载后从失败的
+// 步骤继续；提交失败时同样放弃更改并回退检查点。构建被取消时不提交:
+// 中断的步骤只完成了一半，提交整个镜像也会让取消等待很久。
+func (b *Tiny11Builder) emergencyCleanup() {
+	m := b.journal.Mount
+	if m == nil || m.Image != checkpoint.MountInstall {
+		return
+	}
+
+	b.log.Info("执行紧急清理...")
+	b.regMgr.UnloadHives()
+
+	if b.config.KeepChanges && b.canceled() == nil {
+		err := b.imgMgr.UnmountImage(true)
+		if err == nil {
+			b.record(b.journal.ClearMount())
+			b.log.Info("已保存已完成步骤的更改，可使用 -resume 继续构建")
+			return
+		}
+		b.log.Warn("保存挂载镜像失败，放弃更改: %v", err)
+	}
+
+	b.imgMgr.UnmountImage(false)
+	b.record(b.journal.Rollback(m.Step))
+	b.log.Info("已放弃挂载镜像的更改，使用 -resume 时从步骤 %d 重新执行", m.Step)
+}
+
+// finishJournal 构建完成后删除检查点
+func (b *Tiny11Builder) finishJournal() {
+	if b.outputISO == "" {
+		b.outputISO = b.config.OutputISO
+	}
+	b.writeRegDiff()
+	if err := b.journal.Remove(); err != nil {
+		b.log.Warn("删除检查点失败: %v", err)
+	}
+}
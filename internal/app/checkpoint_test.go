@@ -0,0 +1,124 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"tiny11-builder/internal/checkpoint"
+	"tiny11-builder/internal/config"
+	"tiny11-builder/internal/dismsim"
+	"tiny11-builder/internal/logger"
+	"tiny11-builder/internal/utils"
+)
+
+// cleanupRunner 在获取应用列表时让构建失败或取消构建，并记录卸载镜像的方式
+type cleanupRunner struct {
+	inner   utils.CommandRunner
+	fail    bool
+	cancel  context.CancelFunc
+	unmount []string
+}
+
+func (r *cleanupRunner) Run(name string, args ...string) (*utils.CommandResult, error) {
+	switch {
+	case slices.Contains(args, "/Get-ProvisionedAppxPackages"):
+		if r.fail {
+			return &utils.CommandResult{Name: name, Args: args, ExitCode: 1}, errors.New("exit status 1")
+		}
+		r.cancel()
+	case slices.Contains(args, "/Unmount-Image"):
+		r.unmount = append(r.unmount, args[len(args)-1])
+	}
+	return r.inner.Run(name, args...)
+}
+
+func (r *cleanupRunner) Offline() bool { return true }
+
+// TestEmergencyCleanup 构建失败时默认放弃更改，-keep-changes 时提交；取消构建时总是放弃
+func TestEmergencyCleanup(t *testing.T) {
+	tests := []struct {
+		name        string
+		fail        bool
+		keepChanges bool
+		want        string
+		mountDone   bool // 检查点中挂载步骤仍记为完成
+	}{
+		{"failure", true, false, "/Discard", false},
+		{"failure keep-changes", true, true, "/Commit", true},
+		{"cancel", false, false, "/Discard", false},
+		{"cancel keep-changes", false, true, "/Discard", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Chdir(dir)
+
+			media := filepath.Join(dir, "media")
+			if err := dismsim.WriteISOFixture(media); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			sim := dismsim.New()
+			sim.MinWimSize = 0
+			runner := &cleanupRunner{inner: sim, fail: tt.fail, cancel: cancel}
+
+			cfg := config.NewConfig()
+			cfg.SetWorkDir(filepath.Join(dir, "work"))
+			cfg.ResourcesDir = filepath.Join(dir, "resources")
+			cfg.ThemesDir = filepath.Join(dir, "themes")
+			cfg.PreinstallDir = filepath.Join(dir, "preinstall")
+			cfg.ISODrive = media
+			cfg.ImageIndex = 1
+			cfg.PreinstallSet = true
+			cfg.KeepChanges = tt.keepChanges
+			cfg.Runner = runner
+			if err := cfg.EnsureDirectories(); err != nil {
+				t.Fatal(err)
+			}
+
+			// 上次构建留下的报告不能出现在这次失败的构建中
+			if err := os.WriteFile(cfg.TweakReport, []byte(`{"tweaks":[{"id":"stale","image":"boot"}]}`), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			log := logger.NewLogger("test")
+			defer log.Close()
+			if err := NewTiny11Builder(cfg, log).Build(ctx); err == nil {
+				t.Fatal("构建应失败")
+			}
+
+			// 挂载前清理残留挂载时也会以 /Discard 卸载，只检查最后一次
+			n := len(runner.unmount)
+			if n == 0 || runner.unmount[n-1] != tt.want {
+				t.Errorf("卸载 install.wim: %v, want %s", runner.unmount, tt.want)
+			}
+			if tt.want != "/Commit" && slices.Contains(runner.unmount, "/Commit") {
+				t.Errorf("不应提交更改: %v", runner.unmount)
+			}
+
+			if utils.FileExists(cfg.TweakReport) {
+				t.Error("上次构建的注册表优化报告未删除")
+			}
+
+			j, err := checkpoint.Load(cfg.CheckpointFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if j.Mount != nil {
+				t.Errorf("检查点仍记录挂载: %+v", j.Mount)
+			}
+			if j.Done(4) != tt.mountDone {
+				t.Errorf("挂载步骤完成 = %v, want %v", j.Done(4), tt.mountDone)
+			}
+			if j.Done(5) {
+				t.Error("失败的步骤不应记为完成")
+			}
+		})
+	}
+}
@@ -1,9 +1,14 @@
 package app
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"path/filepath"
 	"tiny11-builder/internal/config"
 	"tiny11-builder/internal/logger"
+	"tiny11-builder/internal/profile"
+	"tiny11-builder/internal/registry"
 	"tiny11-builder/internal/remover"
 	"tiny11-builder/internal/utils"
 )
@@ -16,6 +21,9 @@ type Tiny11CoreBuilder struct {
 
 // NewTiny11CoreBuilder 创建Core版构建器
 func NewTiny11CoreBuilder(cfg *config.Config, log *logger.Logger) *Tiny11CoreBuilder {
+	if cfg.Profile == nil {
+		cfg.Profile = profile.Default(profile.ModeCore)
+	}
 	return &Tiny11CoreBuilder{
 		Tiny11Builder: NewTiny11Builder(cfg, log),
 		coreRemover:   remover.NewCoreRemover(cfg, log),
@@ -23,115 +31,123 @@ func NewTiny11CoreBuilder(cfg *config.Config, log *logger.Logger) *Tiny11CoreBui
 }
 
 // Build 执行Core版构建流程
-func (b *Tiny11CoreBuilder) Build() error {
+func (b *Tiny11CoreBuilder) Build(ctx context.Context) error {
+	b.ctx = ctx
 	b.log.Header("Tiny11 Core Builder - 不可服务版本")
+	b.logProfile()
 	
-	var imageUnmounted = false
-	
-	// 步骤 1-4: 基础准备
-	b.log.Step(1, "验证ISO镜像")
-	if err := b.imgMgr.ValidateISO(); err != nil {
-		return fmt.Errorf("ISO验证失败: %w", err)
+	if err := b.openJournal(profile.ModeCore, 16); err != nil {
+		return err
 	}
 	
-	b.log.Step(2, "复制Windows镜像文件")
-	if err := b.imgMgr.CopyImageFiles(); err != nil {
-		return fmt.Errorf("复制文件失败: %w", err)
+	// 步骤 1-4: 基础准备
+	if err := b.executeBasicSteps(); err != nil {
+		return err
 	}
 	
-	b.log.Step(3, "获取镜像信息")
-	imageInfo, err := b.imgMgr.GetImageInfo()
+	imageInfo, err := b.loadImageInfo(3)
 	if err != nil {
-		return fmt.Errorf("获取镜像信息失败: %w", err)
+		return err
 	}
 	
-	b.log.Step(4, "挂载install.wim")
-	if err := b.imgMgr.MountInstallWim(imageInfo.Index); err != nil {
-		return fmt.Errorf("挂载失败: %w", err)
-	}
-	
-	defer func() {
-		if !imageUnmounted {
-			b.log.Info("执行紧急清理...")
+	// 挂载步骤中途取消时同样需要卸载 (没有挂载时不执行任何操作)
+	defer b.emergencyCleanup()
+
+	if err := b.mountInstallWim(4, 13, "挂载install.wim", imageInfo.Index); err != nil {
+		return err
+	}
+	
+	err = b.runSteps([]buildStep{
+		// 步骤 5: 移除应用
+		{5, "移除预装应用", func() error {
+			if err := b.remover.RemoveProvisionedApps(b.ctx); err != nil {
+				return fmt.Errorf("移除应用失败: %w", err)
+			}
+			return nil
+		}},
+		{6, "移除系统组件", func() error {
+			if err := b.remover.RemoveSystemPackages(b.ctx, imageInfo.Language); err != nil {
+				if errors.Is(err, context.Canceled) {
+					return err
+				}
+				b.log.Warn("移除系统包失败: %v", err)
+			}
+			return nil
+		}},
+		// 询问是否启用 .NET 3.5
+		{7, "配置.NET Framework 3.5", func() error {
+			if err := b.configureNET35(); err != nil {
+				b.log.Warn(".NET 3.5配置失败: %v", err)
+			}
+			return nil
+		}},
+		// 后续步骤
+		{8, "移除Edge和OneDrive", func() error {
+			b.remover.RemoveEdge()
+			b.remover.RemoveOneDrive()
+			return nil
+		}},
+		{9, "移除WinSxS组件存储 (保留必要组件)", func() error {
+			if err := b.coreRemover.RemoveWinSxS(b.ctx); err != nil {
+				return fmt.Errorf("移除WinSxS失败: %w", err)
+			}
+			return nil
+		}},
+		{10, "移除WinRE恢复环境", func() error {
+			if err := b.coreRemover.RemoveWinRE(); err != nil {
+				b.log.Warn("移除WinRE失败: %v", err)
+			}
+			return nil
+		}},
+		{11, "移除遥测计划任务", func() error {
+			b.remover.RemoveScheduledTasks()
+			return b.removeProfileExtras()
+		}},
+		// 注册表优化
+		{12, "应用注册表优化", func() error {
+			b.snapshotHives(registry.SnapshotBefore)
+			if err := b.regMgr.LoadHives(); err != nil {
+				return fmt.Errorf("加载注册表失败: %w", err)
+			}
+			err := b.regMgr.ApplyTweaks()
 			b.regMgr.UnloadHives()
-			b.imgMgr.UnmountImage(false)
-		}
-	}()
-	
-	// 步骤 5: 移除应用
-	b.log.Step(5, "移除预装应用")
-	if err := b.remover.RemoveProvisionedApps(); err != nil {
-		return fmt.Errorf("移除应用失败: %w", err)
-	}
-	
-	b.log.Step(6, "移除系统组件")
-	if err := b.remover.RemoveSystemPackages(imageInfo.Language); err != nil {
-		b.log.Warn("移除系统包失败: %v", err)
-	}
-	
-	// 询问是否启用 .NET 3.5
-	b.log.Step(7, "配置.NET Framework 3.5")
-	if err := b.configureNET35(); err != nil {
-		b.log.Warn(".NET 3.5配置失败: %v", err)
-	}
-	
-	// 后续步骤
-	b.log.Step(8, "移除Edge和OneDrive")
-	b.remover.RemoveEdge()
-	b.remover.RemoveOneDrive()
-	
-	b.log.Step(9, "移除WinSxS组件存储 (保留必要组件)")
-	if err := b.coreRemover.RemoveWinSxS(); err != nil {
-		return fmt.Errorf("移除WinSxS失败: %w", err)
-	}
-	
-	b.log.Step(10, "移除WinRE恢复环境")
-	if err := b.coreRemover.RemoveWinRE(); err != nil {
-		b.log.Warn("移除WinRE失败: %v", err)
-	}
-	
-	b.log.Step(11, "移除遥测计划任务")
-	b.remover.RemoveScheduledTasks()
-	
-	// 注册表优化
-	b.log.Step(12, "应用注册表优化")
-	if err := b.regMgr.LoadHives(); err != nil {
-		return fmt.Errorf("加载注册表失败: %w", err)
-	}
-	
-	b.regMgr.ApplyTweaks()
-	b.regMgr.ApplyCoreTweaks()
-	b.regMgr.UnloadHives()
-	
-	// 复制 autounattend.xml
-	b.copyAutounattend()
-	
-	// 卸载和导出
-	b.log.Step(13, "导出优化后的镜像")
-	if err := b.imgMgr.UnmountImage(true); err != nil {
-		return fmt.Errorf("卸载失败: %w", err)
-	}
-	imageUnmounted = true
-	
-	if err := b.imgMgr.ExportImage(imageInfo.Index); err != nil {
-		return fmt.Errorf("导出失败: %w", err)
-	}
-	
-	b.log.Step(14, "处理boot.wim")
-	if err := b.processBootWim(); err != nil {
-		return fmt.Errorf("处理boot.wim失败: %w", err)
-	}
-	
-	b.log.Step(15, "创建ISO镜像")
-	isoPath, err := b.imgMgr.CreateISO()
+			return err
+		}},
+		// 复制 autounattend.xml，卸载和导出
+		{13, "导出优化后的镜像", func() error {
+			b.copyAutounattend()
+			if err := b.unmountInstallWim(); err != nil {
+				return err
+			}
+			if err := b.imgMgr.ExportImage(imageInfo.Index); err != nil {
+				return fmt.Errorf("导出失败: %w", err)
+			}
+			return nil
+		}},
+		{14, "处理boot.wim", func() error {
+			if err := b.processBootWim(); err != nil {
+				return fmt.Errorf("处理boot.wim失败: %w", err)
+			}
+			return nil
+		}},
+		{15, "创建ISO镜像", func() error {
+			isoPath, err := b.imgMgr.CreateISO()
+			if err != nil {
+				return fmt.Errorf("创建ISO失败: %w", err)
+			}
+			b.outputISO = isoPath
+			return nil
+		}},
+		{16, "清理临时文件", func() error {
+			b.imgMgr.Cleanup()
+			return nil
+		}},
+	})
 	if err != nil {
-		return fmt.Errorf("创建ISO失败: %w", err)
+		return err
 	}
-	b.outputISO = isoPath
-	
-	b.log.Step(16, "清理临时文件")
-	b.imgMgr.Cleanup()
 	
+	b.finishJournal()
 	return nil
 }
 
@@ -147,11 +163,15 @@ func (b *Tiny11CoreBuilder) configureNET35() error {
 		
 		mountPath := b.config.ScratchDir
 		sxsPath := b.config.ISODrive + "\\sources\\sxs"
+		if b.config.ISOFile != "" {
+			// 直接读取ISO文件时使用已复制到工作目录的sxs
+			sxsPath = filepath.Join(b.config.Tiny11Dir, "sources", "sxs")
+		}
 		
-		spinner := utils.NewSpinner("安装.NET Framework 3.5 (这可能需要几分钟)...")
+		spinner := b.log.NewSpinner("安装.NET Framework 3.5 (这可能需要几分钟)...")
 		spinner.Start()
 		
-		_, err := utils.RunCommand("dism",
+		_, err := utils.RunWith(b.runner, "dism",
 			fmt.Sprintf("/Image:%s", mountPath),
 			"/Enable-Feature",
 			"/FeatureName:NetFX3",
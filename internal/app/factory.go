@@ -0,0 +1,67 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+
+	"tiny11-builder/internal/config"
+	"tiny11-builder/internal/logger"
+	"tiny11-builder/internal/types"
+)
+
+// modeBuilders 构建模式 -> 构建器 (命令行、交互模式和 API 共用，按菜单顺序排列)
+var modeBuilders = []struct {
+	mode     types.BuildMode
+	coreMode bool // 不可服务的精简流程 (Core 及以上)
+	new      func(cfg *config.Config, log *logger.Logger) Builder
+}{
+	{types.ModeStandard, false, func(cfg *config.Config, log *logger.Logger) Builder {
+		return NewTiny11Builder(cfg, log)
+	}},
+	{types.ModeCore, true, func(cfg *config.Config, log *logger.Logger) Builder {
+		return NewTiny11CoreBuilder(cfg, log)
+	}},
+	{types.ModeNano, true, func(cfg *config.Config, log *logger.Logger) Builder {
+		return NewTiny11NanoBuilder(cfg, log)
+	}},
+}
+
+// Modes 返回支持的构建模式
+func Modes() []types.BuildMode {
+	modes := make([]types.BuildMode, 0, len(modeBuilders))
+	for _, m := range modeBuilders {
+		modes = append(modes, m.mode)
+	}
+	return modes
+}
+
+// ParseMode 解析构建模式名称 (不区分大小写)
+func ParseMode(name string) (types.BuildMode, error) {
+	for _, m := range modeBuilders {
+		if strings.EqualFold(name, string(m.mode)) {
+			return m.mode, nil
+		}
+	}
+	return "", fmt.Errorf("无效的构建模式: %s (应为 %s)", name, modeNames())
+}
+
+// NewBuilder 创建构建模式对应的构建器
+//
+// 未指定配置文件时使用该模式的内置配置。
+func NewBuilder(mode types.BuildMode, cfg *config.Config, log *logger.Logger) (Builder, error) {
+	for _, m := range modeBuilders {
+		if m.mode == mode {
+			cfg.CoreMode = m.coreMode
+			return m.new(cfg, log), nil
+		}
+	}
+	return nil, fmt.Errorf("无效的构建模式: %s (应为 %s)", mode, modeNames())
+}
+
+func modeNames() string {
+	names := make([]string, 0, len(modeBuilders))
+	for _, m := range modeBuilders {
+		names = append(names, string(m.mode))
+	}
+	return strings.Join(names, "、")
+}
@@ -1,9 +1,14 @@
 package app
 
+import "context"
+
 // Builder 构建器接口
 type Builder interface {
 	// Build 执行构建流程
-	Build() error
+	//
+	// ctx 取消后，当前的外部命令执行完即停止构建，并与构建失败时一样
+	// 卸载注册表和镜像；返回的错误满足 errors.Is(err, context.Canceled)。
+	Build(ctx context.Context) error
 
 	// GetOutputISO 获取输出ISO路径
 	GetOutputISO() string
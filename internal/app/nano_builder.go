@@ -1,194 +1,226 @@
 package app
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
 
+	"tiny11-builder/internal/checkpoint"
 	"tiny11-builder/internal/config"
 	"tiny11-builder/internal/logger"
-	"tiny11-builder/internal/remover"
+	"tiny11-builder/internal/profile"
+	"tiny11-builder/internal/registry"
 	"tiny11-builder/internal/utils"
 )
 
 type Tiny11NanoBuilder struct {
 	*Tiny11CoreBuilder
-	nanoRemover *remover.NanoRemover
 }
 
 func NewTiny11NanoBuilder(cfg *config.Config, log *logger.Logger) *Tiny11NanoBuilder {
+	if cfg.Profile == nil {
+		cfg.Profile = profile.Default(profile.ModeNano)
+	}
 	return &Tiny11NanoBuilder{
 		Tiny11CoreBuilder: NewTiny11CoreBuilder(cfg, log),
-		nanoRemover:       remover.NewNanoRemover(cfg, log),
 	}
 }
 
-func (b *Tiny11NanoBuilder) Build() error {
+func (b *Tiny11NanoBuilder) Build(ctx context.Context) error {
+	b.ctx = ctx
 	b.log.Header("Tiny11 Nano Builder - 终极精简版本")
 	b.log.Warn("⚠️  警告：此版本将移除几乎所有可移除组件，仅用于极端测试场景！")
+	b.logProfile()
 
-	var imageUnmounted = false
-
-	// 步骤 1-2: 基础验证
-	b.log.Step(1, "验证 ISO 镜像")
-	if err := b.imgMgr.ValidateISO(); err != nil {
-		return fmt.Errorf("ISO 验证失败: %w", err)
+	if err := b.openJournal(profile.ModeNano, 24); err != nil {
+		return err
 	}
 
-	b.log.Step(2, "复制 Windows 镜像文件")
-	if err := b.imgMgr.CopyImageFiles(); err != nil {
-		return fmt.Errorf("复制文件失败: %w", err)
+	// 步骤 1-2: 基础验证
+	if err := b.executeBasicSteps(); err != nil {
+		return err
 	}
 
 	// 步骤 3: 获取镜像信息
-	b.log.Step(3, "获取镜像信息")
-	imageInfo, err := b.imgMgr.GetImageInfo()
+	imageInfo, err := b.loadImageInfo(3)
 	if err != nil {
-		return fmt.Errorf("获取镜像信息失败: %w", err)
+		return err
 	}
 
-	b.log.Info("架构: %s, 语言: %s, 索引: %d",
-		imageInfo.Architecture, imageInfo.Language, imageInfo.Index)
+	// 挂载步骤中途取消时同样需要卸载 (没有挂载时不执行任何操作)
+	defer b.emergencyCleanup()
 
 	// 步骤 4: 挂载镜像
-	b.log.Step(4, "挂载 install.wim")
-	if err := b.imgMgr.MountInstallWim(imageInfo.Index); err != nil {
-		return fmt.Errorf("挂载失败: %w", err)
+	if err := b.mountInstallWim(4, 19, "挂载 install.wim", imageInfo.Index); err != nil {
+		return err
 	}
 
-	defer func() {
-		if !imageUnmounted {
-			b.log.Info("执行紧急清理...")
+	err = b.runSteps([]buildStep{
+		// 步骤 5: 主动获取文件夹所有权（预防性措施）
+		{5, "预防性获取关键文件夹所有权", func() error {
+			if err := b.proactivelyTakeOwnership(); err != nil {
+				b.log.Warn("获取所有权失败（部分）: %v", err)
+			}
+			return nil
+		}},
+		// 步骤 6: 移除预装应用
+		{6, "移除预装应用", func() error {
+			if err := b.remover.RemoveProvisionedApps(b.ctx); err != nil {
+				return fmt.Errorf("移除应用失败: %w", err)
+			}
+			return nil
+		}},
+		// 步骤 7: 清理已移除应用的残留文件夹
+		{7, "清理 WindowsApps 残留文件夹", func() error {
+			if err := b.nanoRemover.CleanupWindowsAppsLeftovers(); err != nil {
+				b.log.Warn("清理残留文件夹失败: %v", err)
+			}
+			return nil
+		}},
+		// 步骤 8: 移除系统包
+		{8, "移除系统组件包 (Nano)", func() error {
+			if err := b.remover.RemoveSystemPackages(b.ctx, imageInfo.Language); err != nil {
+				if errors.Is(err, context.Canceled) {
+					return err
+				}
+				b.log.Warn("移除系统包失败: %v", err)
+			}
+			return nil
+		}},
+		// 步骤 9: 移除 .NET Native Images
+		{9, "移除预编译 .NET 程序集", func() error {
+			if err := b.nanoRemover.RemoveNativeImages(b.ctx); err != nil {
+				if errors.Is(err, context.Canceled) {
+					return err
+				}
+				b.log.Warn("移除 Native Images 失败: %v", err)
+			}
+			return nil
+		}},
+		// 步骤 10: 精简 DriverStore
+		{10, "精简驱动程序存储", func() error {
+			if err := b.nanoRemover.SlimDriverStore(b.ctx); err != nil {
+				if errors.Is(err, context.Canceled) {
+					return err
+				}
+				b.log.Warn("精简 DriverStore 失败: %v", err)
+			}
+			return nil
+		}},
+		// 步骤 11: 精简字体
+		{11, "精简系统字体", func() error {
+			if err := b.nanoRemover.SlimFonts(b.ctx); err != nil {
+				if errors.Is(err, context.Canceled) {
+					return err
+				}
+				b.log.Warn("精简字体失败: %v", err)
+			}
+			return nil
+		}},
+		// 步骤 12: 移除系统文件夹
+		{12, "移除非必需系统文件夹", func() error {
+			if err := b.nanoRemover.RemoveSystemFolders(b.ctx); err != nil {
+				if errors.Is(err, context.Canceled) {
+					return err
+				}
+				b.log.Warn("移除系统文件夹失败: %v", err)
+			}
+			return nil
+		}},
+		// 步骤 13: 移除 Edge、OneDrive、WinRE 和计划任务
+		{13, "移除 Edge、OneDrive、WinRE 和计划任务", func() error {
+			b.remover.RemoveEdge()
+			b.remover.RemoveOneDrive()
+			b.coreRemover.RemoveWinRE()
+			b.remover.RemoveScheduledTasks()
+			return nil
+		}},
+		// 步骤 14: 组件清理
+		{14, "清理镜像组件", func() error {
+			if err := b.imgMgr.CleanupImage(); err != nil {
+				b.log.Warn("清理失败（继续）: %v", err)
+			}
+			return nil
+		}},
+		// 步骤 15: WinSxS 精简
+		{15, "精简 WinSxS 组件存储", func() error {
+			if err := b.coreRemover.RemoveWinSxS(b.ctx); err != nil {
+				return fmt.Errorf("精简 WinSxS 失败: %w", err)
+			}
+			return nil
+		}},
+		// 步骤 16: 应用注册表优化
+		{16, "应用注册表优化", func() error {
+			b.snapshotHives(registry.SnapshotBefore)
+			if err := b.regMgr.LoadHives(); err != nil {
+				return fmt.Errorf("加载注册表失败: %w", err)
+			}
+			err := b.regMgr.ApplyTweaks()
 			b.regMgr.UnloadHives()
-			b.imgMgr.UnmountImage(false)
-		}
-	}()
-
-	// 步骤 5: 主动获取文件夹所有权（预防性措施）
-	b.log.Step(5, "预防性获取关键文件夹所有权")
-	if err := b.proactivelyTakeOwnership(); err != nil {
-		b.log.Warn("获取所有权失败（部分）: %v", err)
-	}
-
-	// 步骤 6: 移除预装应用
-	b.log.Step(6, "移除预装应用")
-	if err := b.remover.RemoveProvisionedApps(); err != nil {
-		return fmt.Errorf("移除应用失败: %w", err)
-	}
-
-	// 步骤 7: 移除扩展应用 (Nano 特有)
-	b.log.Step(7, "移除扩展应用列表 (Nano)")
-	if err := b.nanoRemover.RemoveAggressiveApps(); err != nil {
-		b.log.Warn("移除扩展应用失败: %v", err)
-	}
-
-	// 步骤 8: 移除系统包
-	b.log.Step(8, "移除系统组件包 (Nano)")
-	if err := b.nanoRemover.RemoveAggressivePackages(imageInfo.Language); err != nil {
-		b.log.Warn("移除系统包失败: %v", err)
-	}
-
-	// 步骤 9: 移除 .NET Native Images
-	b.log.Step(9, "移除预编译 .NET 程序集")
-	if err := b.nanoRemover.RemoveNativeImages(); err != nil {
-		b.log.Warn("移除 Native Images 失败: %v", err)
-	}
-
-	// 步骤 10: 精简 DriverStore
-	b.log.Step(10, "精简驱动程序存储")
-	if err := b.nanoRemover.SlimDriverStore(); err != nil {
-		b.log.Warn("精简 DriverStore 失败: %v", err)
-	}
-
-	// 步骤 11: 精简字体
-	b.log.Step(11, "精简系统字体")
-	if err := b.nanoRemover.SlimFonts(); err != nil {
-		b.log.Warn("精简字体失败: %v", err)
-	}
-
-	// 步骤 12: 移除系统文件夹
-	b.log.Step(12, "移除非必需系统文件夹")
-	if err := b.nanoRemover.RemoveSystemFolders(); err != nil {
-		b.log.Warn("移除系统文件夹失败: %v", err)
-	}
-
-	// 步骤 13: 移除 Edge、OneDrive 和 WinRE
-	b.log.Step(13, "移除 Edge、OneDrive 和 WinRE")
-	b.remover.RemoveEdge()
-	b.remover.RemoveOneDrive()
-	b.coreRemover.RemoveWinRE()
-
-	// 步骤 14: 组件清理
-	b.log.Step(14, "清理镜像组件")
-	if err := b.imgMgr.CleanupImage(); err != nil {
-		b.log.Warn("清理失败（继续）: %v", err)
-	}
-
-	// 步骤 15: WinSxS 精简
-	b.log.Step(15, "精简 WinSxS 组件存储")
-	if err := b.coreRemover.RemoveWinSxS(); err != nil {
-		return fmt.Errorf("精简 WinSxS 失败: %w", err)
-	}
-
-	// 步骤 16: 应用注册表优化
-	b.log.Step(16, "应用注册表优化")
-	if err := b.regMgr.LoadHives(); err != nil {
-		return fmt.Errorf("加载注册表失败: %w", err)
-	}
-
-	b.regMgr.ApplyTweaks()
-	b.regMgr.ApplyCoreTweaks()
-	b.regMgr.ApplyNanoTweaks() // Nano 特有优化
-
-	b.regMgr.UnloadHives()
-
-	// 步骤 17: 移除系统服务
-	b.log.Step(17, "移除非必需系统服务")
-	if err := b.nanoRemover.RemoveSystemServices(); err != nil {
-		b.log.Warn("移除服务失败: %v", err)
-	}
-
-	// 步骤 18: 复制 autounattend.xml
-	b.copyAutounattend()
-
-	// 步骤 19: 卸载镜像
-	b.log.Step(19, "卸载并提交更改")
-	if err := b.imgMgr.UnmountImage(true); err != nil {
-		return fmt.Errorf("卸载失败: %w", err)
-	}
-	imageUnmounted = true
-
-	// 步骤 20: 导出为 ESD 格式
-	b.log.Step(20, "导出为 ESD 格式 (超高压缩)")
-	if err := b.exportImageToESD(imageInfo.Index); err != nil {
-		return fmt.Errorf("导出 ESD 失败: %w", err)
-	}
-
-	// 步骤 21: 处理 boot.wim
-	b.log.Step(21, "精简 boot.wim")
-	if err := b.processNanoBootWim(); err != nil {
-		return fmt.Errorf("处理 boot.wim 失败: %w", err)
-	}
-
-	// 步骤 22: 清理 ISO 根目录
-	b.log.Step(22, "清理 ISO 根目录")
-	if err := b.cleanupISORoot(); err != nil {
-		b.log.Warn("清理 ISO 根目录失败: %v", err)
-	}
-
-	// 步骤 23: 创建 ISO
-	b.log.Step(23, "创建 ISO 镜像")
-	isoPath, err := b.imgMgr.CreateISO()
+			return err
+		}},
+		// 步骤 17: 移除系统服务
+		{17, "移除非必需系统服务", func() error {
+			if err := b.nanoRemover.RemoveSystemServices(b.ctx); err != nil {
+				if errors.Is(err, context.Canceled) {
+					return err
+				}
+				b.log.Warn("移除服务失败: %v", err)
+			}
+			return nil
+		}},
+		// 步骤 18: 复制 autounattend.xml
+		{18, "复制自动应答文件", func() error {
+			b.copyAutounattend()
+			return nil
+		}},
+		// 步骤 19: 卸载镜像
+		{19, "卸载并提交更改", b.unmountInstallWim},
+		// 步骤 20: 导出为 ESD 格式
+		{20, "导出为 ESD 格式 (超高压缩)", func() error {
+			if err := b.exportImageToESD(imageInfo.Index); err != nil {
+				return fmt.Errorf("导出 ESD 失败: %w", err)
+			}
+			return nil
+		}},
+		// 步骤 21: 处理 boot.wim
+		{21, "精简 boot.wim", func() error {
+			if err := b.processNanoBootWim(); err != nil {
+				return fmt.Errorf("处理 boot.wim 失败: %w", err)
+			}
+			return nil
+		}},
+		// 步骤 22: 清理 ISO 根目录
+		{22, "清理 ISO 根目录", func() error {
+			if err := b.cleanupISORoot(); err != nil {
+				b.log.Warn("清理 ISO 根目录失败: %v", err)
+			}
+			return nil
+		}},
+		// 步骤 23: 创建 ISO
+		{23, "创建 ISO 镜像", func() error {
+			isoPath, err := b.imgMgr.CreateISO()
+			if err != nil {
+				return fmt.Errorf("创建 ISO 失败: %w", err)
+			}
+			b.outputISO = isoPath
+			return nil
+		}},
+		// 步骤 24: 清理临时文件
+		{24, "清理临时文件", func() error {
+			b.imgMgr.Cleanup()
+			return nil
+		}},
+	})
 	if err != nil {
-		return fmt.Errorf("创建 ISO 失败: %w", err)
+		return err
 	}
-	b.outputISO = isoPath
 
-	// 步骤 24: 清理临时文件
-	b.log.Step(24, "清理临时文件")
-	b.imgMgr.Cleanup()
+	b.finishJournal()
 
 	// 强制 GC
 	runtime.GC()
@@ -234,13 +266,13 @@ func (b *Tiny11NanoBuilder) proactivelyTakeOwnership() error {
 		b.log.Info("  获取所有权: %s", filepath.Base(folder))
 
 		// 递归获取所有权
-		if err := utils.TakeownRecursive(folder); err != nil {
+		if err := utils.TakeownRecursive(b.runner, folder); err != nil {
 			b.log.Warn("  ✗ takeown 失败: %v", err)
 			continue
 		}
 
 		// 授予完全控制权限
-		if err := utils.GrantPermissionRecursive(folder); err != nil {
+		if err := utils.GrantPermissionRecursive(b.runner, folder); err != nil {
 			b.log.Warn("  ✗ icacls 失败: %v", err)
 			continue
 		}
@@ -256,12 +288,12 @@ func (b *Tiny11NanoBuilder) proactivelyTakeOwnership() error {
 
 		b.log.Info("  获取文件所有权: %s", filepath.Base(file))
 
-		if err := utils.Takeown(file); err != nil {
+		if err := utils.Takeown(b.runner, file); err != nil {
 			b.log.Warn("  ✗ takeown 失败: %v", err)
 			continue
 		}
 
-		if err := utils.GrantPermission(file); err != nil {
+		if err := utils.GrantPermission(b.runner, file); err != nil {
 			b.log.Warn("  ✗ icacls 失败: %v", err)
 			continue
 		}
@@ -289,13 +321,13 @@ func (b *Tiny11NanoBuilder) exportImageToESD(index int) error {
 		os.Remove(destEsd)
 	}
 
-	spinner := utils.NewSpinner("导出为 ESD 格式 (这将花费较长时间但文件更小)")
+	spinner := b.log.NewSpinner("导出为 ESD 格式 (这将花费较长时间但文件更小)")
 	spinner.Start()
 
-	_, err := utils.RunCommand("dism", "/English",
+	_, err := utils.RunWith(b.runner, "dism", "/English",
 		"/Export-Image",
 		fmt.Sprintf("/SourceImageFile:%s", sourceWim),
-		"/SourceIndex:1",
+		fmt.Sprintf("/SourceIndex:%d", index),
 		fmt.Sprintf("/DestinationImageFile:%s", destEsd),
 		"/Compress:recovery")
 
@@ -341,17 +373,59 @@ func (b *Tiny11NanoBuilder) processNanoBootWim() error {
 	newBootWimPath := filepath.Join(b.config.Tiny11Dir, "sources", "boot_new.wim")
 	finalBootWimPath := filepath.Join(b.config.Tiny11Dir, "sources", "boot_final.wim")
 
+	// 清理上次中断留下的中间文件；原始 boot.wim 已删除时说明上次已完成
+	// 导出和优化，直接从最终压缩继续
+	os.Remove(finalBootWimPath)
+	if utils.FileExists(bootWimPath) {
+		os.Remove(newBootWimPath)
+		if err := b.slimBootWim(bootWimPath, newBootWimPath); err != nil {
+			return err
+		}
+	} else if utils.FileExists(newBootWimPath) {
+		b.log.Info("继续上次中断的 boot.wim 压缩...")
+	} else {
+		return fmt.Errorf("boot.wim 和中间文件均不存在")
+	}
+
+	// 压缩导出最终版本
+	b.log.Info("压缩 boot.wim...")
+	spinner := b.log.NewSpinner("最终压缩 boot.wim")
+	spinner.Start()
+
+	_, err := utils.RunWith(b.runner, "dism", "/English",
+		"/Export-Image",
+		fmt.Sprintf("/SourceImageFile:%s", newBootWimPath),
+		"/SourceIndex:1",
+		fmt.Sprintf("/DestinationImageFile:%s", finalBootWimPath),
+		"/Compress:max")
+
+	spinner.Stop(err == nil)
+
+	if err != nil {
+		return fmt.Errorf("压缩 boot.wim 失败: %w", err)
+	}
+
+	// 清理中间文件并重命名
+	os.Remove(newBootWimPath)
+	os.Rename(finalBootWimPath, bootWimPath)
+
+	b.log.Success("boot.wim 处理完成")
+	return nil
+}
+
+// slimBootWim 导出 boot.wim 索引 2 并应用优化，完成后删除原始 boot.wim
+func (b *Tiny11NanoBuilder) slimBootWim(bootWimPath, newBootWimPath string) error {
 	b.log.Info("获取 boot.wim 所有权...")
-	utils.Takeown(bootWimPath)
-	utils.GrantPermission(bootWimPath)
+	utils.Takeown(b.runner, bootWimPath)
+	utils.GrantPermission(b.runner, bootWimPath)
 	os.Chmod(bootWimPath, 0666)
 
 	// 导出索引 2 (Setup)
 	b.log.Info("导出 boot.wim 索引 2...")
-	spinner := utils.NewSpinner("导出 boot.wim")
+	spinner := b.log.NewSpinner("导出 boot.wim")
 	spinner.Start()
 
-	_, err := utils.RunCommand("dism", "/English",
+	_, err := utils.RunWith(b.runner, "dism", "/English",
 		"/Export-Image",
 		fmt.Sprintf("/SourceImageFile:%s", bootWimPath),
 		"/SourceIndex:2",
@@ -365,10 +439,10 @@ func (b *Tiny11NanoBuilder) processNanoBootWim() error {
 
 	// 挂载导出的镜像
 	b.log.Info("挂载 boot.wim...")
-	if err := b.imgMgr.MountBootWim(); err != nil {
+	if err := b.mountBootWim(); err != nil {
 		// 使用新导出的 WIM
 		mountPath := b.config.ScratchDir
-		_, err = utils.RunCommand("dism", "/English",
+		_, err = utils.RunWith(b.runner, "dism", "/English",
 			"/Mount-Image",
 			fmt.Sprintf("/ImageFile:%s", newBootWimPath),
 			"/Index:1",
@@ -377,20 +451,33 @@ func (b *Tiny11NanoBuilder) processNanoBootWim() error {
 		if err != nil {
 			return fmt.Errorf("挂载 boot.wim 失败: %w", err)
 		}
+		b.record(b.journal.SetMount(&checkpoint.Mount{
+			Image: checkpoint.MountBoot,
+			Index: 1,
+			Dir:   mountPath,
+			Step:  b.current,
+		}))
 	}
 
 	// 应用注册表优化
 	if err := b.regMgr.LoadHives(); err != nil {
 		b.log.Warn("加载 boot.wim 注册表失败: %v", err)
 	} else {
-		b.regMgr.ApplyBootTweaks()
+		err := b.regMgr.ApplyBootTweaks()
 		b.regMgr.UnloadHives()
+		if err != nil {
+			b.imgMgr.UnmountImage(false)
+			b.record(b.journal.ClearMount())
+			return fmt.Errorf("应用Boot优化失败: %w", err)
+		}
 	}
 
 	// 卸载
 	b.log.Info("卸载 boot.wim...")
 	if err := b.imgMgr.UnmountImage(true); err != nil {
 		b.log.Warn("卸载 boot.wim 失败: %v", err)
+	} else {
+		b.record(b.journal.ClearMount())
 	}
 
 	// 等待系统释放文件
@@ -398,34 +485,11 @@ func (b *Tiny11NanoBuilder) processNanoBootWim() error {
 	utils.Sleep(5)
 
 	// 删除原始 boot.wim
-	utils.Takeown(bootWimPath)
-	utils.GrantPermission(bootWimPath)
+	utils.Takeown(b.runner, bootWimPath)
+	utils.GrantPermission(b.runner, bootWimPath)
 	os.Chmod(bootWimPath, 0666)
 	os.Remove(bootWimPath)
 
-	// 压缩导出最终版本
-	b.log.Info("压缩 boot.wim...")
-	spinner = utils.NewSpinner("最终压缩 boot.wim")
-	spinner.Start()
-
-	_, err = utils.RunCommand("dism", "/English",
-		"/Export-Image",
-		fmt.Sprintf("/SourceImageFile:%s", newBootWimPath),
-		"/SourceIndex:1",
-		fmt.Sprintf("/DestinationImageFile:%s", finalBootWimPath),
-		"/Compress:max")
-
-	spinner.Stop(err == nil)
-
-	if err != nil {
-		return fmt.Errorf("压缩 boot.wim 失败: %w", err)
-	}
-
-	// 清理中间文件并重命名
-	os.Remove(newBootWimPath)
-	os.Rename(finalBootWimPath, bootWimPath)
-
-	b.log.Success("boot.wim 处理完成")
 	return nil
 }
 
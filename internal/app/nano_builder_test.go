@@ -0,0 +1,137 @@
+package app
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"tiny11-builder/internal/config"
+	"tiny11-builder/internal/dismsim"
+	"tiny11-builder/internal/iso"
+	"tiny11-builder/internal/logger"
+)
+
+// TestNanoBuildSimulated 在模拟安装介质上完整运行 Nano 构建，检查输出 ISO 中 install.esd 的内容
+func TestNanoBuildSimulated(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir) // 日志写在当前目录的 log 中
+
+	media := filepath.Join(dir, "media")
+	if err := dismsim.WriteISOFixture(media); err != nil {
+		t.Fatal(err)
+	}
+
+	sim := dismsim.New()
+	sim.MinWimSize = 0
+	cfg := config.NewConfig()
+	cfg.SetWorkDir(filepath.Join(dir, "work"))
+	cfg.ResourcesDir = filepath.Join(dir, "resources")
+	cfg.ThemesDir = filepath.Join(dir, "themes")
+	cfg.PreinstallDir = filepath.Join(dir, "preinstall")
+	cfg.ISODrive = media
+	cfg.ImageIndex = 2
+	cfg.PreinstallSet = true
+	cfg.Runner = sim
+	if err := cfg.EnsureDirectories(); err != nil {
+		t.Fatal(err)
+	}
+
+	log := logger.NewLogger("test")
+	defer log.Close()
+	if err := NewTiny11NanoBuilder(cfg, log).Build(context.Background()); err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	img := readOutputImage(t, cfg.OutputISO, dir)
+
+	for _, app := range []string{"Clipchamp.Clipchamp", "Microsoft.BingNews", "Microsoft.GamingApp", "Microsoft.Copilot"} {
+		if img.HasAppx(app) {
+			t.Errorf("应用未移除: %s", app)
+		}
+	}
+	for _, pkg := range []string{"Microsoft-Windows-InternetExplorer-Optional-Package", "Microsoft-Windows-MediaPlayer-Package", "Windows-Defender-Client-Package"} {
+		if img.HasPackage(pkg) {
+			t.Errorf("系统包未移除: %s", pkg)
+		}
+	}
+	if !img.HasPackage("Microsoft-Windows-Foundation-Package") {
+		t.Error("Foundation 包不应被移除")
+	}
+
+	for _, file := range []string{
+		"Program Files (x86)/Microsoft/Edge/Application/msedge.exe",
+		"Windows/System32/OneDriveSetup.exe",
+		"Windows/Fonts/comic.ttf",
+		"Windows/assembly/NativeImages_v4.0.30319_64/mscorlib/mscorlib.ni.dll",
+		"Windows/System32/DriverStore/FileRepository/prnms001.inf_amd64_1/prnms001.inf",
+	} {
+		if img.HasFile(file) {
+			t.Errorf("文件未移除: %s", file)
+		}
+	}
+	for _, file := range []string{"Windows/explorer.exe", "Windows/System32/ntoskrnl.exe", "Windows/Fonts/segoeui.ttf"} {
+		if !img.HasFile(file) {
+			t.Errorf("必需的文件被删除: %s", file)
+		}
+	}
+
+	// WinRE 替换为空的占位文件
+	if winre, ok := img.Files["Windows/System32/Recovery/winre.wim"]; ok && winre != "" {
+		t.Error("winre.wim 未清空")
+	}
+
+	system := filepath.Join(dir, "SYSTEM")
+	if err := os.WriteFile(system, []byte(img.Files["Windows/System32/config/SYSTEM"]), 0644); err != nil {
+		t.Fatal(err)
+	}
+	hive, err := dismsim.ReadHive(system)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, svc := range []string{"Spooler", "Fax", "wuauserv", "WaaSMedicSvc", "WerSvc"} {
+		if _, ok := hive[`ControlSet001\Services\`+svc]; ok {
+			t.Errorf("服务未移除: %s", svc)
+		}
+	}
+	for _, svc := range []string{"Audiosrv", "EventLog", "DiagTrack"} {
+		if _, ok := hive[`ControlSet001\Services\`+svc]; !ok {
+			t.Errorf("不在配置文件中的服务被删除: %s", svc)
+		}
+	}
+}
+
+// readOutputImage 从输出 ISO 中取出 install.esd 并读取第一个镜像
+func readOutputImage(t *testing.T, isoPath, dir string) *dismsim.Image {
+	t.Helper()
+	src, err := iso.OpenImage(isoPath)
+	if err != nil {
+		t.Fatalf("打开输出 ISO: %v", err)
+	}
+	defer src.Close()
+	f, err := src.Open("sources/install.esd")
+	if err != nil {
+		t.Fatalf("输出 ISO 中没有 install.esd: %v", err)
+	}
+	defer f.Close()
+
+	esd := filepath.Join(dir, "install.esd")
+	out, err := os.Create(esd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(out, f); err != nil {
+		t.Fatal(err)
+	}
+	out.Close()
+
+	w, err := dismsim.ReadWim(esd)
+	if err != nil {
+		t.Fatalf("读取 install.esd: %v", err)
+	}
+	if len(w.Images) != 1 {
+		t.Fatalf("install.esd 中有 %d 个镜像，应只导出 1 个", len(w.Images))
+	}
+	return w.Images[0]
+}
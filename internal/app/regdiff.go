@@ -0,0 +1,58 @@
+package app
+
+import (
+	"path/filepath"
+	"strings"
+
+	"tiny11-builder/internal/registry"
+	"tiny11-builder/internal/utils"
+)
+
+// snapshotHives 启用 -regdiff 时复制配置单元快照 (配置单元需已卸载)
+//
+// 恢复构建时保留第一次保存的 before 快照，after 快照每次卸载镜像前重新保存。
+func (b *Tiny11Builder) snapshotHives(stage string) {
+	if !b.config.RegDiff {
+		return
+	}
+	dir := filepath.Join(b.config.RegDiffDir, stage)
+	if stage == registry.SnapshotBefore && utils.DirExists(dir) {
+		return
+	}
+	b.log.Info("保存注册表快照 (%s)...", stage)
+	if err := b.regMgr.SnapshotHives(dir); err != nil {
+		b.log.Warn("保存注册表快照失败: %v", err)
+	}
+}
+
+// writeRegDiff 比较前后快照，差异报告写在输出 ISO 旁边
+func (b *Tiny11Builder) writeRegDiff() {
+	if !b.config.RegDiff {
+		return
+	}
+	before := filepath.Join(b.config.RegDiffDir, registry.SnapshotBefore)
+	after := filepath.Join(b.config.RegDiffDir, registry.SnapshotAfter)
+	if !utils.DirExists(before) || !utils.DirExists(after) {
+		b.log.Warn("缺少注册表快照，跳过注册表差异报告")
+		return
+	}
+
+	b.log.Info("比较注册表快照...")
+	diff, err := registry.DiffHives(before, after)
+	if err != nil {
+		b.log.Warn("生成注册表差异失败: %v", err)
+		return
+	}
+
+	prefix := strings.TrimSuffix(b.outputISO, filepath.Ext(b.outputISO)) + ".regdiff"
+	files, err := diff.WriteFiles(prefix)
+	if err != nil {
+		b.log.Warn("写入注册表差异失败: %v", err)
+		return
+	}
+	b.log.Success("注册表差异: %s", diff.SummaryLine())
+	for _, f := range files {
+		b.log.Info("  %s", f)
+	}
+	utils.RemoveIfExists(b.config.RegDiffDir)
+}
@@ -0,0 +1,208 @@
+// Package checkpoint 构建检查点日志
+//
+// 构建器在每个步骤完成后把进度写入 build/checkpoint.json (已完成的步骤、
+// 挂载状态、镜像信息以及开始构建时的选项)。构建中断后可以通过 -resume
+// 校验磁盘上的状态并从第一个未完成的步骤继续。
+package checkpoint
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// FileName 检查点文件名 (位于 build 目录下)
+const FileName = "checkpoint.json"
+
+// CurrentVersion 当前检查点文件格式版本
+const CurrentVersion = 1
+
+// 挂载在 scratch 目录中的镜像
+const (
+	MountInstall = "install"
+	MountBoot    = "boot"
+)
+
+// Journal 检查点日志
+type Journal struct {
+	Version   int       `json:"version"`
+	Mode      string    `json:"mode"`
+	Steps     int       `json:"steps"`
+	Options   Options   `json:"options"`
+	Image     *Image    `json:"image,omitempty"`
+	Completed []int     `json:"completed"`
+	Mount     *Mount    `json:"mount,omitempty"`
+	StartedAt time.Time `json:"startedAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	path string
+}
+
+// Options 开始构建时的选项，恢复构建时原样还原
+type Options struct {
+	ISODrive   string   `json:"isoDrive,omitempty"`
+	ISOFile    string   `json:"isoFile,omitempty"`
+	ImageIndex int      `json:"imageIndex,omitempty"`
+	OutputISO  string   `json:"outputIso"`
+	Profile    string   `json:"profile"`
+	Theme      string   `json:"theme,omitempty"`
+	Preinstall []string `json:"preinstall,omitempty"`
+	RegFiles   []string `json:"regFiles,omitempty"`
+	ExportReg  string   `json:"exportReg,omitempty"`
+
+	EnableTweaks  []string `json:"enableTweaks,omitempty"`
+	DisableTweaks []string `json:"disableTweaks,omitempty"`
+
+	TweakReport  string `json:"tweakReport,omitempty"`
+	StrictTweaks bool   `json:"strictTweaks,omitempty"`
+	RegDiff      bool   `json:"regDiff,omitempty"`
+	KeepChanges  bool   `json:"keepChanges,omitempty"`
+}
+
+// Image 获取镜像信息步骤的结果
+type Image struct {
+	Index        int    `json:"index"`
+	Name         string `json:"name"`
+	Architecture string `json:"architecture"`
+	Language     string `json:"language"`
+	Build        string `json:"build,omitempty"`
+	Size         int64  `json:"size"`
+}
+
+// Mount 当前挂载的镜像
+type Mount struct {
+	Image string `json:"image"` // install 或 boot
+	Index int    `json:"index"`
+	Dir   string `json:"dir"`
+
+	// Step 挂载时所在的步骤，挂载丢失 (未提交的更改丢失) 时从该步骤重新执行
+	Step int `json:"step"`
+}
+
+// New 创建新的检查点日志 (调用 Save 后写入磁盘)
+func New(path, mode string, steps int) *Journal {
+	now := time.Now()
+	return &Journal{
+		Version:   CurrentVersion,
+		Mode:      mode,
+		Steps:     steps,
+		Completed: []int{},
+		StartedAt: now,
+		UpdatedAt: now,
+		path:      path,
+	}
+}
+
+// Load 读取检查点日志
+func Load(path string) (*Journal, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("未找到检查点文件: %s", path)
+		}
+		return nil, fmt.Errorf("读取检查点失败: %w", err)
+	}
+
+	var j Journal
+	if err := json.Unmarshal(data, &j); err != nil {
+		return nil, fmt.Errorf("检查点文件 %s 无效: %w", path, err)
+	}
+	if j.Version == 0 || j.Version > CurrentVersion {
+		return nil, fmt.Errorf("不支持的检查点版本 %d", j.Version)
+	}
+	if j.Mode == "" || j.Steps <= 0 {
+		return nil, fmt.Errorf("检查点文件 %s 缺少构建模式或步骤数", path)
+	}
+
+	j.path = path
+	return &j, nil
+}
+
+// Path 检查点文件路径
+func (j *Journal) Path() string {
+	return j.path
+}
+
+// Save 写入检查点 (先写临时文件再替换，避免中断时留下不完整的文件)
+func (j *Journal) Save() error {
+	j.UpdatedAt = time.Now()
+	sort.Ints(j.Completed)
+
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(j.path), 0755); err != nil {
+		return err
+	}
+	tmp := j.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, j.path)
+}
+
+// Remove 删除检查点文件 (构建完成后调用)
+func (j *Journal) Remove() error {
+	if err := os.Remove(j.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Done 判断步骤是否已完成
+func (j *Journal) Done(step int) bool {
+	for _, s := range j.Completed {
+		if s == step {
+			return true
+		}
+	}
+	return false
+}
+
+// Next 返回第一个未完成的步骤 (全部完成时返回 Steps+1)
+func (j *Journal) Next() int {
+	for step := 1; step <= j.Steps; step++ {
+		if !j.Done(step) {
+			return step
+		}
+	}
+	return j.Steps + 1
+}
+
+// Complete 标记步骤已完成并保存
+func (j *Journal) Complete(step int) error {
+	if !j.Done(step) {
+		j.Completed = append(j.Completed, step)
+	}
+	return j.Save()
+}
+
+// SetMount 记录挂载的镜像并保存
+func (j *Journal) SetMount(m *Mount) error {
+	j.Mount = m
+	return j.Save()
+}
+
+// ClearMount 记录镜像已卸载并保存
+func (j *Journal) ClearMount() error {
+	j.Mount = nil
+	return j.Save()
+}
+
+// Rollback 将 step 及之后的步骤标记为未完成，清除挂载记录并保存
+func (j *Journal) Rollback(step int) error {
+	kept := j.Completed[:0]
+	for _, s := range j.Completed {
+		if s < step {
+			kept = append(kept, s)
+		}
+	}
+	j.Completed = kept
+	j.Mount = nil
+	return j.Save()
+}
@@ -0,0 +1,10 @@
+//go:build !windows
+
+package cli
+
+import "os"
+
+// IsAdmin 检查是否具有root权限
+func IsAdmin() bool {
+	return os.Geteuid() == 0
+}
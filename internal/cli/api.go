@@ -0,0 +1,203 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"tiny11-builder/internal/api"
+	"tiny11-builder/internal/config"
+	"tiny11-builder/internal/utils"
+	"tiny11-builder/internal/webhook"
+)
+
+// ParseAPIArgs 解析 API 模式的参数
+//
+//	-api [-bind <addr>] [-port <n>] [-tls-cert <file> -tls-key <file>] [-tokens <file>] [-webhooks <file>]
+//	     [-work-root <dir>] [-media-dir <dir>]
+func ParseAPIArgs(args []string) (api.Options, error) {
+	opts := api.Options{Bind: api.DefaultBind, Port: 8080}
+
+	fs := flag.NewFlagSet("api", flag.ContinueOnError)
+	fs.Bool("api", true, "API 服务器模式")
+	fs.StringVar(&opts.Bind, "bind", opts.Bind, "监听地址 (0.0.0.0 监听所有网卡，需要 API 令牌)")
+	fs.IntVar(&opts.Port, "port", opts.Port, "监听端口")
+	fs.StringVar(&opts.TLSCert, "tls-cert", "", "TLS 证书 (PEM)，与 -tls-key 一起启用 HTTPS")
+	fs.StringVar(&opts.TLSKey, "tls-key", "", "TLS 私钥 (PEM)")
+	tokensFile := fs.String("tokens", "", "API 令牌文件 (默认为程序目录中的 api-tokens.json)")
+	webhooksFile := fs.String("webhooks", "", "webhook 配置文件 (默认为程序目录中的 webhooks.json)")
+	fs.StringVar(&opts.WorkRoot, "work-root", "", "请求中 workDir 的根目录 (默认为程序目录)")
+	fs.StringVar(&opts.MediaDir, "media-dir", "", "请求中 isoFile 和 regFiles 所在的目录 (默认为程序目录中的 media)")
+	fs.Usage = printAPIUsage
+	if err := fs.Parse(args); err != nil {
+		return opts, err
+	}
+	if fs.NArg() > 0 {
+		return opts, fmt.Errorf("未知的参数: %s", fs.Arg(0))
+	}
+	if (opts.TLSCert == "") != (opts.TLSKey == "") {
+		return opts, fmt.Errorf("-tls-cert 和 -tls-key 需要同时指定")
+	}
+	for _, dir := range []*string{&opts.WorkRoot, &opts.MediaDir} {
+		if *dir == "" {
+			continue
+		}
+		abs, err := filepath.Abs(*dir)
+		if err != nil {
+			return opts, err
+		}
+		*dir = abs
+	}
+
+	path := *tokensFile
+	if path == "" {
+		path = config.NewConfig().APITokensFile
+	} else if !utils.FileExists(path) {
+		return opts, fmt.Errorf("令牌文件不存在: %s", path)
+	}
+	tokens, err := api.LoadTokens(path)
+	if err != nil {
+		return opts, err
+	}
+	opts.Tokens = tokens
+
+	path = *webhooksFile
+	if path == "" {
+		path = config.NewConfig().WebhooksFile
+	} else if !utils.FileExists(path) {
+		return opts, fmt.Errorf("webhook 配置文件不存在: %s", path)
+	}
+	if opts.Webhooks, err = webhook.LoadConfig(path); err != nil {
+		return opts, err
+	}
+	return opts, nil
+}
+
+// RunAPITokenCommand 处理 api-token 子命令
+//
+//	api-token add <name> [-perm read|build]  创建令牌 (明文只显示一次)
+//	api-token list                            列出令牌
+//	api-token remove <name>                   删除令牌
+func RunAPITokenCommand(args []string) error {
+	if len(args) == 0 {
+		printAPITokenUsage()
+		return fmt.Errorf("缺少子命令")
+	}
+
+	fs := flag.NewFlagSet("api-token "+args[0], flag.ContinueOnError)
+	file := fs.String("tokens", config.NewConfig().APITokensFile, "API 令牌文件")
+	perm := fs.String("perm", string(api.PermRead), "权限: read (只读) 或 build (提交和取消构建)")
+	fs.Usage = printAPITokenUsage
+
+	// 允许选项写在名称之后
+	var names []string
+	rest := args[1:]
+	for {
+		if err := fs.Parse(rest); err != nil {
+			return err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		names = append(names, fs.Arg(0))
+		rest = fs.Args()[1:]
+	}
+
+	store, err := api.LoadTokens(*file)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "add":
+		if len(names) != 1 {
+			return fmt.Errorf("需要指定一个令牌名称")
+		}
+		p, err := api.ParsePermission(*perm)
+		if err != nil {
+			return err
+		}
+		token, err := store.Add(names[0], p)
+		if err != nil {
+			return err
+		}
+		fmt.Println(utils.Colorize(fmt.Sprintf("已创建令牌 %s (%s)，保存在 %s", names[0], p, store.Path()), utils.MikuGreen))
+		fmt.Println()
+		fmt.Println("  " + utils.Colorize(token, utils.MikuPink))
+		fmt.Println()
+		fmt.Println(utils.Colorize("令牌只显示这一次，文件中只保存其哈希。请求时使用:", utils.MikuYellow))
+		fmt.Println("  Authorization: Bearer <令牌>   或   X-API-Key: <令牌>")
+		return nil
+
+	case "list":
+		tokens := store.List()
+		if len(tokens) == 0 {
+			fmt.Printf("没有 API 令牌 (%s)\n", store.Path())
+			return nil
+		}
+		for _, t := range tokens {
+			fmt.Printf("  %s %-6s %s\n",
+				utils.Colorize(fmt.Sprintf("%-20s", t.Name), utils.MikuPink),
+				t.Permission,
+				utils.Colorize(t.CreatedAt.Format(time.DateTime), utils.MikuGray))
+		}
+		return nil
+
+	case "remove":
+		if len(names) != 1 {
+			return fmt.Errorf("需要指定一个令牌名称")
+		}
+		if err := store.Remove(names[0]); err != nil {
+			return err
+		}
+		fmt.Println(utils.Colorize("已删除令牌 "+names[0], utils.MikuGreen))
+		return nil
+
+	case "-h", "--help", "help":
+		printAPITokenUsage()
+		return nil
+	}
+
+	printAPITokenUsage()
+	return fmt.Errorf("未知的子命令: %s", args[0])
+}
+
+func printAPIUsage() {
+	fmt.Fprint(os.Stderr, `
+用法:
+  tiny11builder.exe -api [-bind <addr>] [-port <n>] [-tls-cert <file> -tls-key <file>] [-tokens <file>]
+                         [-webhooks <file>] [-work-root <dir>] [-media-dir <dir>]
+
+  -bind       监听地址，默认 127.0.0.1 (仅本机)；监听其他地址需要先创建 API 令牌
+  -port       监听端口，默认 8080
+  -tls-cert   TLS 证书 (PEM)，与 -tls-key 一起指定时使用 HTTPS
+  -tls-key    TLS 私钥 (PEM)
+  -tokens     API 令牌文件，默认为程序目录中的 api-tokens.json
+  -webhooks   webhook 配置文件，默认为程序目录中的 webhooks.json (见 webhook 子命令)
+  -work-root  构建请求中 workDir 的根目录，默认为程序目录
+  -media-dir  构建请求中 isoFile 和 regFiles 所在的目录，默认为程序目录中的 media
+
+构建请求中的路径都是相对路径，不能是绝对路径或包含 ..: workDir 相对于 -work-root，
+isoFile 和 regFiles 相对于 -media-dir，outputIso 和 exportReg 相对于任务的工作目录。
+
+令牌文件中有令牌时所有接口都需要认证，用 api-token 子命令管理令牌。
+`)
+}
+
+func printAPITokenUsage() {
+	fmt.Print(`
+用法:
+  tiny11builder.exe api-token add <name> [-perm read|build] [-tokens <file>]
+  tiny11builder.exe api-token list [-tokens <file>]
+  tiny11builder.exe api-token remove <name> [-tokens <file>]
+
+  add         创建令牌并显示明文 (只显示一次)。read 只能查询任务、状态、事件和产物，
+              build 还可以提交和取消构建、上传主题和安装包
+  list        列出令牌的名称、权限和创建时间
+  remove      删除令牌
+
+API 服务器启动时读取令牌文件，添加或删除令牌后需重启服务器。
+`)
+}
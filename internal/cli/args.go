@@ -3,8 +3,16 @@ package cli
 import (
 	"flag"
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
+	"tiny11-builder/internal/app"
 	"tiny11-builder/internal/config"
+	"tiny11-builder/internal/dismsim"
+	"tiny11-builder/internal/preinstall"
+	"tiny11-builder/internal/profile"
+	"tiny11-builder/internal/registry"
+	"tiny11-builder/internal/utils"
 )
 
 // ParseArgsUnified 解析统一版本的命令行参数
@@ -12,11 +20,40 @@ func ParseArgsUnified(args []string) (*config.Config, string, string, error) {
 	fs := flag.NewFlagSet("tiny11-builder", flag.ContinueOnError)
 
 	iso := fs.String("iso", "", "ISO挂载的驱动器号 (例: E)")
+	isoFile := fs.String("iso-file", "", "直接读取的ISO镜像文件 (无需挂载)")
 	scratch := fs.String("scratch", "", "临时文件驱动器号 (例: D)")
 	index := fs.Int("index", 0, "镜像索引 (0=自动选择)")
 	output := fs.String("output", "", "输出ISO路径")
-	mode := fs.String("mode", "", "构建模式: standard 或 core")
+	mode := fs.String("mode", "", "构建模式: standard、core 或 nano")
 	theme := fs.String("theme", "default", "主题名称: default, miku 或自定义")
+	preinstallIDs := fs.String("preinstall", "", "预装软件 id (逗号分隔，all=全部，none=不预装)，指定后不再询问")
+	profileRef := fs.String("profile", "", "构建配置文件: 内置名称 (standard/core/nano)、profiles 目录中的名称或 JSON 文件路径")
+	record := fs.String("record", "", "录制所有外部命令及输出到指定文件")
+	replay := fs.String("replay", "", "从录制文件回放外部命令 (离线测试)")
+	simulate := fs.String("simulate", "", "使用模拟DISM后端和指定目录中的模拟安装介质 (离线测试)")
+	regExe := fs.Bool("reg-exe", false, "使用系统 reg.exe 加载和修改注册表配置单元 (默认直接读写配置单元文件)")
+	var regFiles []string
+	fs.Func("import-reg", "导入 .reg 文件中的注册表修改 (可多次指定)", func(path string) error {
+		regFiles = append(regFiles, path)
+		return nil
+	})
+	var enableTweaks, disableTweaks []string
+	fs.Func("enable-tweak", "启用注册表优化 (id，可用逗号分隔或多次指定)", func(s string) error {
+		enableTweaks = append(enableTweaks, profile.SplitTweakIDs(s)...)
+		return nil
+	})
+	fs.Func("disable-tweak", "禁用注册表优化 (id，可用逗号分隔或多次指定)", func(s string) error {
+		disableTweaks = append(disableTweaks, profile.SplitTweakIDs(s)...)
+		return nil
+	})
+	exportReg := fs.String("export-reg", "", "将实际应用的注册表优化导出为 .reg 文件")
+	tweakReport := fs.String("tweak-report", "", "注册表优化报告路径 (默认 logs\\tweak-report.json)")
+	strictTweaks := fs.Bool("strict-tweaks", false, "严格模式: 必需的注册表优化未生效时中止构建")
+	regDiff := fs.Bool("regdiff", false, "比较应用优化前后的注册表，差异报告写在输出 ISO 旁边")
+	resume := fs.Bool("resume", false, "从检查点继续上次中断的构建")
+	keepChanges := fs.Bool("keep-changes", false, "构建失败时提交 install.wim 中已完成步骤的更改，-resume 时从失败的步骤继续 (取消构建时不提交)")
+	plan := fs.Bool("plan", false, "只预演构建: 列出将移除的项和注册表修改，不修改镜像")
+	planJSON := fs.String("plan-json", "", "将预演结果写入 JSON 文件 (隐含 -plan)")
 	verbose := fs.Bool("v", false, "详细日志")
 	help := fs.Bool("h", false, "显示帮助")
 
@@ -32,8 +69,81 @@ func ParseArgsUnified(args []string) (*config.Config, string, string, error) {
 	cfg := config.NewConfig()
 	cfg.Verbose = *verbose
 
+	// 设置命令执行器
+	if *record != "" && *replay != "" {
+		return nil, "", "", fmt.Errorf("-record 和 -replay 不能同时使用")
+	}
+	if *simulate != "" {
+		cfg.Runner = dismsim.New()
+	}
+	if !*regExe {
+		// 直接读写配置单元文件，不经过 reg load/unload
+		cfg.Runner = registry.NewOfflineRunner(cfg.Runner)
+	}
+	if *record != "" {
+		inner := cfg.Runner
+		if inner == nil {
+			inner = utils.NewExecRunner()
+		}
+		cfg.Runner = utils.NewRecordingRunner(inner, *record)
+	}
+	if *replay != "" {
+		runner, err := utils.NewReplayRunner(*replay)
+		if err != nil {
+			return nil, "", "", err
+		}
+		if *simulate != "" {
+			// 在模拟介质上重现 DISM 的挂载、导出等副作用
+			runner.WithEffects(cfg.Runner)
+		}
+		cfg.Runner = runner
+	}
+
+	cfg.Plan = *plan || *planJSON != ""
+	cfg.PlanFile = *planJSON
+	if cfg.Plan && *resume {
+		return nil, "", "", fmt.Errorf("-plan 和 -resume 不能同时使用")
+	}
+
+	// 从检查点继续构建，构建选项全部使用检查点中记录的值
+	if *resume {
+		if len(regFiles) > 0 || len(enableTweaks) > 0 || len(disableTweaks) > 0 ||
+			*preinstallIDs != "" || *exportReg != "" || *tweakReport != "" || *strictTweaks || *regDiff || *keepChanges {
+			return nil, "", "", fmt.Errorf("-resume 时不能指定 -preinstall、-import-reg、-enable-tweak、-disable-tweak、-export-reg、-tweak-report、-strict-tweaks、-regdiff 或 -keep-changes (沿用检查点中的设置)")
+		}
+		buildMode, themeName, err := restoreCheckpoint(cfg)
+		if err != nil {
+			return nil, "", "", fmt.Errorf("无法继续构建: %w", err)
+		}
+		if *mode != "" && !strings.EqualFold(*mode, buildMode) {
+			return nil, "", "", fmt.Errorf("检查点记录的构建模式为 %s，与 -mode %s 不一致", buildMode, *mode)
+		}
+		return cfg, buildMode, themeName, nil
+	}
+
+	// 直接读取ISO文件
+	if *isoFile != "" {
+		if *iso != "" {
+			return nil, "", "", fmt.Errorf("-iso 和 -iso-file 不能同时使用")
+		}
+		path, err := filepath.Abs(*isoFile)
+		if err != nil || !utils.FileExists(path) {
+			return nil, "", "", fmt.Errorf("ISO镜像文件不存在: %s", *isoFile)
+		}
+		cfg.ISOFile = path
+	}
+
 	// 验证ISO驱动器
-	if *iso != "" {
+	if *simulate != "" {
+		// 模拟模式下ISO源为本地目录
+		path, err := filepath.Abs(*simulate)
+		if err != nil {
+			return nil, "", "", fmt.Errorf("无效的模拟介质目录: %w", err)
+		}
+		cfg.ISODrive = path
+	} else if *isoFile != "" {
+		// 直接读取ISO文件，不需要驱动器号
+	} else if *iso != "" {
 		*iso = strings.ToUpper(strings.TrimSuffix(*iso, ":"))
 		if len(*iso) != 1 || (*iso)[0] < 'C' || (*iso)[0] > 'Z' {
 			return nil, "", "", fmt.Errorf("无效的驱动器号: %s", *iso)
@@ -64,15 +174,118 @@ func ParseArgsUnified(args []string) (*config.Config, string, string, error) {
 
 	cfg.ThemeName = *theme
 
+	// 预装软件 (按 preinstall\preinstall.json 校验)
+	if *preinstallIDs != "" {
+		pc, err := preinstall.ReadConfig(cfg.PreinstallDir)
+		if err != nil {
+			return nil, "", "", err
+		}
+		apps, err := pc.SelectApps(strings.Split(*preinstallIDs, ","))
+		if err != nil {
+			return nil, "", "", err
+		}
+		cfg.PreinstallApps = apps
+		cfg.PreinstallSet = true
+	}
+
+	// 导入 .reg 文件 (检查点中记录绝对路径，继续构建时重新读取)
+	for _, path := range regFiles {
+		abs, err := filepath.Abs(path)
+		if err != nil || !utils.FileExists(abs) {
+			return nil, "", "", fmt.Errorf(".reg 文件不存在: %s", path)
+		}
+		cfg.RegFiles = append(cfg.RegFiles, abs)
+	}
+	if len(cfg.RegFiles) > 0 {
+		tweaks, err := registry.LoadRegFiles(cfg.RegFiles)
+		if err != nil {
+			return nil, "", "", fmt.Errorf("导入 .reg 文件失败: %w", err)
+		}
+		cfg.RegTweaks = tweaks
+	}
+	if *exportReg != "" {
+		path, err := filepath.Abs(*exportReg)
+		if err != nil {
+			return nil, "", "", fmt.Errorf("无效的导出路径: %s", *exportReg)
+		}
+		cfg.ExportReg = path
+	}
+	if *tweakReport != "" {
+		path, err := filepath.Abs(*tweakReport)
+		if err != nil {
+			return nil, "", "", fmt.Errorf("无效的报告路径: %s", *tweakReport)
+		}
+		cfg.TweakReport = path
+	}
+	cfg.StrictTweaks = *strictTweaks
+	cfg.RegDiff = *regDiff
+	cfg.KeepChanges = *keepChanges
+
 	// 验证模式参数
-	buildMode := strings.ToLower(*mode)
-	if buildMode != "" && buildMode != "standard" && buildMode != "core" {
-		return nil, "", "", fmt.Errorf("无效的模式: %s (应为 standard 或 core)", *mode)
+	buildMode := ""
+	if *mode != "" {
+		m, err := app.ParseMode(*mode)
+		if err != nil {
+			return nil, "", "", err
+		}
+		buildMode = string(m)
+	}
+
+	// 加载构建配置文件，未指定 -mode 时使用配置文件中的模式
+	if *profileRef != "" {
+		p, err := profile.Resolve(*profileRef, cfg.ProfilesDir)
+		if err != nil {
+			return nil, "", "", fmt.Errorf("加载配置文件失败: %w", err)
+		}
+		cfg.Profile = p
+		if buildMode == "" {
+			buildMode = p.Mode
+		}
+	}
+
+	// 单独启用/禁用注册表优化，未指定配置文件时基于构建模式对应的内置配置
+	if len(enableTweaks) > 0 || len(disableTweaks) > 0 {
+		if cfg.Profile == nil {
+			cfg.Profile = profile.Default(buildMode)
+		}
+		if err := cfg.Profile.SelectTweaks(enableTweaks, disableTweaks); err != nil {
+			return nil, "", "", err
+		}
+		cfg.EnableTweaks = enableTweaks
+		cfg.DisableTweaks = disableTweaks
 	}
 
 	return cfg, buildMode, *theme, nil
 }
 
+// PrepareSimulation 为模拟模式准备安装介质
+// 需在清理旧构建目录并创建工作目录之后调用
+func PrepareSimulation(cfg *config.Config) error {
+	runner := cfg.Runner
+	for {
+		wrapper, ok := runner.(interface{ Inner() utils.CommandRunner })
+		if !ok {
+			break
+		}
+		runner = wrapper.Inner()
+	}
+	if _, ok := runner.(*dismsim.Simulator); !ok {
+		return nil
+	}
+
+	if cfg.ISOFile == "" && !utils.FileExists(filepath.Join(cfg.ISODrive, "sources", "install.wim")) {
+		fmt.Println(utils.Colorize("生成模拟安装介质: "+cfg.ISODrive, utils.MikuGray))
+		if err := os.MkdirAll(cfg.ISODrive, 0755); err != nil {
+			return err
+		}
+		if err := dismsim.WriteISOFixture(cfg.ISODrive); err != nil {
+			return fmt.Errorf("生成模拟安装介质失败: %w", err)
+		}
+	}
+
+	return nil
+}
+
 // ParseArgs 保留兼容性（旧版）
 func ParseArgs(args []string) (*config.Config, error) {
 	cfg, _, _, err := ParseArgsUnified(args)
@@ -89,11 +302,31 @@ Tiny11 Builder - Windows 11精简镜像构建工具 (统一版)
 
 选项:
   -iso <drive>      ISO挂载的驱动器号 (例: -iso E)
+  -iso-file <path>  直接读取ISO镜像文件，无需挂载 (例: -iso-file D:\Win11.iso)
   -scratch <drive>  临时文件驱动器号 (例: -scratch D)
-  -mode <mode>      构建模式: standard (标准版) 或 core (极限精简)
+  -mode <mode>      构建模式: standard (标准版)、core (极限精简) 或 nano (终极精简)
   -theme <name>     主题名称: default, miku 或自定义主题名
+  -preinstall <ids> 预装软件 id，逗号分隔 (all=全部，none=不预装)，指定后不再询问 (见 preinstall\preinstall.json)
+  -profile <name>   构建配置文件: 内置 standard/core/nano、profiles\<name>.json 或 JSON 文件路径
   -index <number>   镜像索引 (默认自动选择)
   -output <path>    输出ISO路径 (默认: ./tiny11.iso)
+  -resume           从 build\checkpoint.json 继续上次中断的构建 (沿用上次的全部构建选项)
+  -keep-changes     构建失败时提交 install.wim 中已完成步骤的更改 (默认放弃)，-resume 时无需从挂载步骤重新执行；
+                    Ctrl+C 取消时总是放弃，且要等正在执行的 DISM/reg 命令结束 (不会被中断)
+  -plan             只预演构建: 只读挂载镜像，列出将移除的项、注册表修改和预计节省空间
+  -plan-json <file> 将预演结果写入 JSON 文件 (隐含 -plan)
+  -import-reg <file> 导入 .reg 文件中的注册表修改，可多次指定 (HKEY_LOCAL_MACHINE\SOFTWARE 等自动映射到挂载的配置单元)
+  -enable-tweak <id>  启用单项注册表优化，可用逗号分隔或多次指定 (tweaks list 查看可用 id)
+  -disable-tweak <id> 禁用单项注册表优化，可用逗号分隔或多次指定
+  -export-reg <file> 将实际应用的注册表优化导出为 .reg 文件 (与 -plan 一起使用时导出将要应用的优化)
+  -tweak-report <file> 注册表优化报告: 每组优化的应用和读回校验结果 (默认 logs\tweak-report.json)
+  -strict-tweaks    严格模式: 标记为 required 的注册表优化未生效时中止构建
+  -regdiff          比较应用优化前后的五个配置单元，差异写入输出 ISO 旁的 .regdiff.txt/.json/.reg
+  -record <file>    录制所有外部命令 (dism/reg 等) 及其输出到文件
+  -replay <file>    从录制文件回放外部命令，不修改系统 (离线测试)；与 -simulate 一起使用时
+                    由模拟DISM重现挂载、导出等文件修改，可回放整个构建
+  -simulate <dir>   使用模拟DISM后端，以 <dir> 中的模拟介质为源 (不存在时自动生成)
+  -reg-exe          使用系统 reg.exe 加载和修改注册表 (默认直接读写配置单元文件，无需 reg load/unload)
   -v                详细日志输出
   -h                显示此帮助
 
@@ -109,6 +342,32 @@ Tiny11 Builder - Windows 11精简镜像构建工具 (统一版)
                     • 仅用于测试环境
                     • 大小: 约4-5 GB
 
+  nano              Nano版 - 终极精简，仅用于极端测试场景
+                    • 在 Core 基础上精简驱动、字体、系统文件夹和服务
+                    • 使用 ESD 格式导出
+                    • 大小: 约2.5-3.5 GB
+
+构建配置文件:
+  每种构建模式对应一个内置配置文件，列出要移除的应用、系统包、服务、驱动、
+  字体、计划任务、文件夹以及要应用的注册表优化。自定义配置文件通过 "extends"
+  继承已有配置，顶层各部分在父配置基础上追加 (同 id 的注册表优化会被替换)，
+  "override" 整体替换某部分，"import" 追加其他配置文件的某部分，"remove"
+  删除父配置中的项:
+
+    {
+      "version": 1,
+      "name": "team",
+      "extends": "standard",
+      "import": { "services": "nano" },
+      "remove": { "apps": ["Microsoft.WindowsTerminal", "Microsoft.Paint"] }
+    }
+
+  tiny11builder.exe profile list                      列出可用配置文件
+  tiny11builder.exe profile show team --resolved      输出展开继承后的最终配置
+  tiny11builder.exe tweaks list                       列出全部注册表优化 (分类、风险等级、所属模式)
+  tiny11builder.exe history -mode core -since 7d      查看构建历史 (history show <id> 查看步骤耗时)
+  tiny11builder.exe webhook test -event job.failed   向 webhooks.json 中的 webhook 发送测试事件
+
 主题:
   default           默认 - 保持Windows原样
   miku              Miku主题 - 青色和粉色配色，自定义品牌
@@ -121,6 +380,19 @@ Tiny11 Builder - Windows 11精简镜像构建工具 (统一版)
   tiny11builder.exe -iso E -mode standard
   tiny11builder.exe -iso E -mode standard -theme miku
   tiny11builder.exe -iso E -scratch D -mode core -v
+  tiny11builder.exe -iso E -mode nano -preinstall 7zip,chrome
+  tiny11builder.exe -iso-file D:\Win11_24H2.iso -mode standard
+  tiny11builder.exe -iso E -profile D:\profiles\office.json
+
+  # 标准版基础上不禁用遥测，额外禁用 Windows Update
+  tiny11builder.exe -iso E -mode standard -disable-tweak disable-telemetry -enable-tweak disable-windows-update
+
+  # 构建中断后从第一个未完成的步骤继续
+  tiny11builder.exe -resume
+
+  # 预演: 查看所选模式和配置文件会对镜像做哪些修改
+  tiny11builder.exe -iso E -mode core -plan
+  tiny11builder.exe -iso-file D:\Win11.iso -profile team -plan-json plan.json
 
   # 自动化构建
   tiny11builder.exe -iso E -mode standard -theme miku -index 3 -output "D:\miku_tiny11.iso"
@@ -0,0 +1,288 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"tiny11-builder/internal/app"
+	"tiny11-builder/internal/config"
+	"tiny11-builder/internal/history"
+	"tiny11-builder/internal/logger"
+	"tiny11-builder/internal/types"
+	"tiny11-builder/internal/utils"
+)
+
+// RunHistoryCommand 处理 history 子命令
+//
+//	history [list] [-mode m] [-theme t] [-status s] [-since t] [-until t] [-limit n] [--json]
+//	history show <id> [--json]
+func RunHistoryCommand(args []string) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") && !isHelp(args[0]) {
+		return listHistory(args)
+	}
+
+	switch args[0] {
+	case "list":
+		return listHistory(args[1:])
+	case "show":
+		return showHistory(args[1:])
+	case "-h", "--help", "help":
+		printHistoryUsage()
+		return nil
+	}
+
+	printHistoryUsage()
+	return fmt.Errorf("未知的子命令: %s", args[0])
+}
+
+func isHelp(arg string) bool {
+	return arg == "-h" || arg == "--help"
+}
+
+func listHistory(args []string) error {
+	fs := flag.NewFlagSet("history list", flag.ContinueOnError)
+	file := fs.String("file", config.NewConfig().HistoryFile, "构建历史文件")
+	mode := fs.String("mode", "", "构建模式")
+	themeName := fs.String("theme", "", "主题 (none 表示没有应用主题的构建)")
+	status := fs.String("status", "", "结果: complete、failed 或 canceled")
+	since := fs.String("since", "", "开始日期 (如 2024-05-01、2024-05-01 08:00、7d)")
+	until := fs.String("until", "", "结束日期 (只有日期时包含当天)")
+	limit := fs.Int("limit", 20, "最多显示的条数 (0 为全部)")
+	asJSON := fs.Bool("json", false, "以 JSON 输出")
+	fs.Usage = printHistoryUsage
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("未知的参数: %s", fs.Arg(0))
+	}
+
+	filter := history.Filter{Theme: *themeName, Limit: *limit}
+	var err error
+	if *mode != "" {
+		if filter.Mode, err = app.ParseMode(*mode); err != nil {
+			return err
+		}
+	}
+	if *status != "" {
+		if filter.State, err = history.ParseState(*status); err != nil {
+			return err
+		}
+	}
+	if *since != "" {
+		if filter.Since, err = history.ParseTime(*since, false); err != nil {
+			return err
+		}
+	}
+	if *until != "" {
+		if filter.Until, err = history.ParseTime(*until, true); err != nil {
+			return err
+		}
+	}
+
+	records, err := history.NewStore(*file).List(filter)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return writeJSON(records)
+	}
+	if len(records) == 0 {
+		fmt.Printf("没有构建记录 (%s)\n", *file)
+		return nil
+	}
+
+	for _, rec := range records {
+		themeLabel := rec.Theme
+		if themeLabel == "" {
+			themeLabel = "-"
+		}
+		output := rec.OutputISO
+		if rec.State == types.JobFailed {
+			output = utils.Colorize(firstLine(rec.Error), utils.MikuRed)
+		}
+		fmt.Printf("  %s %s %-4s %-8s %-10s %s %8s  %s\n",
+			utils.Colorize(fmt.Sprintf("%-22s", rec.ID), utils.MikuPink),
+			stateLabel(rec.State),
+			rec.Source,
+			rec.Mode,
+			themeLabel,
+			utils.Colorize(rec.CreatedAt.Local().Format("2006-01-02 15:04"), utils.MikuGray),
+			formatSeconds(rec.Duration),
+			output)
+	}
+	return nil
+}
+
+func showHistory(args []string) error {
+	fs := flag.NewFlagSet("history show", flag.ContinueOnError)
+	file := fs.String("file", config.NewConfig().HistoryFile, "构建历史文件")
+	asJSON := fs.Bool("json", false, "以 JSON 输出完整记录 (包含请求和构建配置文件)")
+	fs.Usage = printHistoryUsage
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("用法: history show <id> [--json]")
+	}
+	id := fs.Arg(0)
+	// 允许选项写在 id 之后
+	if err := fs.Parse(fs.Args()[1:]); err != nil {
+		return err
+	}
+
+	rec, err := history.NewStore(*file).Get(id)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return writeJSON(rec)
+	}
+
+	field := func(name, value string) {
+		if value != "" {
+			fmt.Printf("  %s %s\n", utils.Colorize(padLabel(name, 10), utils.MikuCyan), value)
+		}
+	}
+	field("ID", rec.ID)
+	field("结果", stateLabel(rec.State))
+	field("来源", rec.Source)
+	field("模式", string(rec.Mode))
+	field("主题", rec.Theme)
+	if name := profileName(rec.Profile); name != "" {
+		field("配置文件", name)
+	}
+	field("创建时间", rec.CreatedAt.Local().Format(time.DateTime))
+	if rec.StartedAt != nil {
+		field("开始时间", rec.StartedAt.Local().Format(time.DateTime))
+	}
+	field("结束时间", rec.FinishedAt.Local().Format(time.DateTime))
+	field("耗时", formatSeconds(rec.Duration))
+	if rec.ErrorCode != 0 {
+		field("错误码", fmt.Sprint(rec.ErrorCode))
+	}
+	field("错误", rec.Error)
+	field("工作目录", rec.WorkDir)
+	field("输出 ISO", rec.OutputISO)
+	field("SHA-256", rec.SHA256)
+	field("日志", rec.LogFile)
+
+	if len(rec.Steps) > 0 {
+		fmt.Println()
+		for _, s := range rec.Steps {
+			fmt.Printf("  %s %s %8s  %s\n",
+				utils.Colorize(fmt.Sprintf("%3d", s.Step), utils.MikuPink),
+				stepLabel(s.Status),
+				formatSeconds(s.Duration),
+				s.Title)
+		}
+	}
+	return nil
+}
+
+// stateLabel 按结果着色的固定宽度标签
+func stateLabel(state types.JobState) string {
+	label := fmt.Sprintf("%-8s", state)
+	switch state {
+	case types.JobComplete:
+		return utils.Colorize(label, utils.MikuGreen)
+	case types.JobFailed:
+		return utils.Colorize(label, utils.MikuRed)
+	case types.JobCanceled:
+		return utils.Colorize(label, utils.MikuYellow)
+	}
+	return label
+}
+
+func stepLabel(status string) string {
+	label := fmt.Sprintf("%-8s", status)
+	switch status {
+	case logger.StepFinished:
+		return utils.Colorize(label, utils.MikuGreen)
+	case logger.StepSkipped:
+		return utils.Colorize(label, utils.MikuGray)
+	case history.StepFailed:
+		return utils.Colorize(label, utils.MikuRed)
+	case history.StepCanceled:
+		return utils.Colorize(label, utils.MikuYellow)
+	}
+	return label
+}
+
+// formatSeconds 把秒数显示为 1h2m3s (不足一秒时保留一位小数)
+func formatSeconds(sec float64) string {
+	d := time.Duration(sec * float64(time.Second))
+	if d < time.Second {
+		return d.Round(100 * time.Millisecond).String()
+	}
+	return d.Round(time.Second).String()
+}
+
+// profileName 记录中构建配置文件的名称
+func profileName(data json.RawMessage) string {
+	var p struct {
+		Name string `json:"name"`
+	}
+	if json.Unmarshal(data, &p) != nil {
+		return ""
+	}
+	return p.Name
+}
+
+// padLabel 按显示宽度补齐标签 (中文字符占两列)
+func padLabel(label string, width int) string {
+	w := 0
+	for _, r := range label {
+		if r < 0x80 {
+			w++
+		} else {
+			w += 2
+		}
+	}
+	if w >= width {
+		return label
+	}
+	return label + strings.Repeat(" ", width-w)
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
+
+func writeJSON(v interface{}) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	_, err := os.Stdout.Write(buf.Bytes())
+	return err
+}
+
+func printHistoryUsage() {
+	fmt.Print(`
+用法:
+  tiny11builder.exe history [list] [-mode <mode>] [-theme <name>] [-status <s>]
+                            [-since <time>] [-until <time>] [-limit <n>] [--json] [-file <file>]
+  tiny11builder.exe history show <id> [--json] [-file <file>]
+
+  list        列出构建记录 (最近的在前，默认 20 条): id、结果、来源 (cli/api)、模式、主题、
+              创建时间、耗时和输出 ISO (失败时为错误)
+              -mode       standard、core 或 nano
+              -theme      主题名称，none 表示没有应用主题的构建
+              -status     complete、failed 或 canceled
+              -since      不早于: 2024-05-01、"2024-05-01 08:00"、RFC 3339 或相对时间 (12h、7d)
+              -until      早于: 格式同 -since，只有日期时包含当天
+  show        显示一条记录和每个步骤的耗时；--json 输出完整记录 (包含请求和实际使用的构建配置文件)
+
+命令行和 API 服务器的构建都记录在程序目录的 history.jsonl 中 (模拟和回放不记录)。
+`)
+}
@@ -0,0 +1,48 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"tiny11-builder/internal/logger"
+)
+
+// InterruptContext 返回按下 Ctrl+C (或关闭控制台) 时取消的上下文
+//
+// 第一次中断取消构建，构建流程在当前命令结束后卸载注册表和镜像；
+// 清理期间再次按下 Ctrl+C 只提示等待，避免镜像保持挂载状态。
+// 构建结束后调用 stop 恢复默认的信号处理。
+func InterruptContext(log *logger.Logger) (ctx context.Context, stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+
+	go func() {
+		select {
+		case <-sig:
+		case <-done:
+			return
+		}
+		fmt.Println()
+		log.Warn("收到中断信号，正在取消构建: 当前命令结束后卸载注册表和镜像...")
+		cancel()
+		for {
+			select {
+			case <-sig:
+				log.Warn("正在清理，请稍候 (强行关闭会使镜像保持挂载状态)")
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(sig)
+		close(done)
+		cancel()
+	}
+}
@@ -0,0 +1,145 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"tiny11-builder/internal/config"
+	"tiny11-builder/internal/profile"
+	"tiny11-builder/internal/utils"
+)
+
+// RunProfileCommand 处理 profile 子命令
+//
+//	profile list                        列出内置和 profiles 目录中的配置文件
+//	profile show <name|path> [--resolved]  输出配置文件 (--resolved 输出展开继承后的结果)
+func RunProfileCommand(args []string) error {
+	if len(args) == 0 {
+		printProfileUsage()
+		return fmt.Errorf("缺少子命令")
+	}
+
+	cfg := config.NewConfig()
+
+	switch args[0] {
+	case "list":
+		return listProfiles(cfg.ProfilesDir)
+	case "show":
+		return showProfile(args[1:], cfg.ProfilesDir)
+	case "-h", "--help", "help":
+		printProfileUsage()
+		return nil
+	}
+
+	printProfileUsage()
+	return fmt.Errorf("未知的子命令: %s", args[0])
+}
+
+func listProfiles(dir string) error {
+	fmt.Println(utils.Colorize("内置配置文件:", utils.MikuCyan))
+	for _, name := range profile.Builtins() {
+		p, err := profile.Builtin(name)
+		if err != nil {
+			return err
+		}
+		printProfileLine(name, p)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	sort.Strings(files)
+
+	fmt.Println()
+	fmt.Println(utils.Colorize("自定义配置文件 ("+dir+"):", utils.MikuCyan))
+	if len(files) == 0 {
+		fmt.Println(utils.Colorize("  (无)", utils.MikuGray))
+		return nil
+	}
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".json")
+		p, err := profile.ReadFile(file)
+		if err != nil {
+			fmt.Printf("  %-14s %s\n", name, utils.Colorize(err.Error(), utils.MikuRed))
+			continue
+		}
+		printProfileLine(name, p)
+	}
+	return nil
+}
+
+func printProfileLine(name string, p *profile.Profile) {
+	info := p.Description
+	if p.Extends != "" {
+		info = fmt.Sprintf("%s (extends %s)", info, p.Extends)
+	}
+	mode := p.Mode
+	if mode == "" {
+		mode = "-"
+	}
+	fmt.Printf("  %s %-9s %s\n",
+		utils.Colorize(fmt.Sprintf("%-14s", name), utils.MikuPink), mode, utils.Colorize(info, utils.MikuGray))
+}
+
+func showProfile(args []string, dir string) error {
+	fs := flag.NewFlagSet("profile show", flag.ContinueOnError)
+	resolved := fs.Bool("resolved", false, "输出展开 extends/import/override/remove 后的最终配置")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("用法: profile show <name|path> [--resolved]")
+	}
+	ref := fs.Arg(0)
+	// 允许选项写在名称之后
+	if err := fs.Parse(fs.Args()[1:]); err != nil {
+		return err
+	}
+
+	var (
+		p   *profile.Profile
+		err error
+	)
+	if *resolved {
+		p, err = profile.Resolve(ref, dir)
+	} else {
+		p, err = profile.Open(ref, dir)
+	}
+	if err != nil {
+		return err
+	}
+
+	// 继承链和警告输出到 stderr，stdout 保持为有效的 JSON
+	if *resolved {
+		fmt.Fprintf(os.Stderr, "# 继承链: %s\n", strings.Join(p.Chain, " -> "))
+		for _, w := range p.Warnings {
+			fmt.Fprintf(os.Stderr, "# 警告: %s\n", w)
+		}
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(p); err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(buf.Bytes())
+	return err
+}
+
+func printProfileUsage() {
+	fmt.Print(`
+用法:
+  tiny11builder.exe profile list
+  tiny11builder.exe profile show <name|path> [--resolved]
+
+  list        列出内置配置文件和 profiles 目录中的自定义配置文件
+  show        输出配置文件内容，--resolved 输出展开继承后最终生效的配置
+`)
+}
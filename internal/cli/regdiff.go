@@ -0,0 +1,78 @@
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"tiny11-builder/internal/registry"
+	"tiny11-builder/internal/utils"
+)
+
+// RunRegDiffCommand 处理 regdiff 子命令
+//
+//	regdiff <before> <after> [-o <prefix>] [--json]
+//
+// before/after 为配置单元文件或包含配置单元的目录 (构建快照或镜像的
+// Windows\System32\config)。未指定 -o 时将文本差异输出到 stdout。
+func RunRegDiffCommand(args []string) error {
+	fs := flag.NewFlagSet("regdiff", flag.ContinueOnError)
+	output := fs.String("o", "", "写入 <prefix>.txt、<prefix>.json 和 <prefix>.reg")
+	asJSON := fs.Bool("json", false, "以 JSON 格式输出到 stdout")
+	fs.Usage = printRegDiffUsage
+
+	var paths []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		// 允许选项写在路径之后
+		paths = append(paths, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if len(paths) != 2 {
+		printRegDiffUsage()
+		return fmt.Errorf("需要指定两个注册表快照")
+	}
+
+	diff, err := registry.DiffHives(paths[0], paths[1])
+	if err != nil {
+		return err
+	}
+
+	if *output != "" {
+		files, err := diff.WriteFiles(*output)
+		if err != nil {
+			return err
+		}
+		fmt.Println(utils.Colorize("注册表差异: "+diff.SummaryLine(), utils.MikuCyan))
+		for _, f := range files {
+			fmt.Println("  " + f)
+		}
+		return nil
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		return enc.Encode(diff)
+	}
+	fmt.Print(diff.Text())
+	return nil
+}
+
+func printRegDiffUsage() {
+	fmt.Print(`
+用法:
+  tiny11builder.exe regdiff <before> <after> [-o <prefix>] [--json]
+
+  <before> <after>  配置单元文件 (SOFTWARE、SYSTEM、ntuser.dat 等)，或包含这些文件的目录
+  -o <prefix>       将差异写入 <prefix>.txt、<prefix>.json 和 <prefix>.reg
+  --json            以 JSON 格式输出到 stdout (默认输出文本)
+`)
+}
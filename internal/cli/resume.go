@@ -0,0 +1,69 @@
+package cli
+
+import (
+	"fmt"
+
+	"tiny11-builder/internal/checkpoint"
+	"tiny11-builder/internal/config"
+	"tiny11-builder/internal/profile"
+	"tiny11-builder/internal/registry"
+)
+
+// restoreCheckpoint 从检查点还原上次构建的选项，返回构建模式和主题
+func restoreCheckpoint(cfg *config.Config) (string, string, error) {
+	j, err := checkpoint.Load(cfg.CheckpointFile)
+	if err != nil {
+		return "", "", err
+	}
+
+	opts := j.Options
+	cfg.ISODrive = opts.ISODrive
+	cfg.ISOFile = opts.ISOFile
+	cfg.ImageIndex = opts.ImageIndex
+	if opts.OutputISO != "" {
+		cfg.OutputISO = opts.OutputISO
+	}
+	cfg.PreinstallApps = opts.Preinstall
+
+	if opts.Profile != "" {
+		p, err := profile.Resolve(opts.Profile, cfg.ProfilesDir)
+		if err != nil {
+			return "", "", fmt.Errorf("加载检查点中的配置文件失败: %w", err)
+		}
+		cfg.Profile = p
+	}
+	if len(opts.EnableTweaks) > 0 || len(opts.DisableTweaks) > 0 {
+		if cfg.Profile == nil {
+			cfg.Profile = profile.Default(j.Mode)
+		}
+		if err := cfg.Profile.SelectTweaks(opts.EnableTweaks, opts.DisableTweaks); err != nil {
+			return "", "", fmt.Errorf("还原检查点中的注册表优化选择失败: %w", err)
+		}
+		cfg.EnableTweaks = opts.EnableTweaks
+		cfg.DisableTweaks = opts.DisableTweaks
+	}
+
+	if len(opts.RegFiles) > 0 {
+		tweaks, err := registry.LoadRegFiles(opts.RegFiles)
+		if err != nil {
+			return "", "", fmt.Errorf("加载检查点中的 .reg 文件失败: %w", err)
+		}
+		cfg.RegFiles = opts.RegFiles
+		cfg.RegTweaks = tweaks
+	}
+	cfg.ExportReg = opts.ExportReg
+	if opts.TweakReport != "" {
+		cfg.TweakReport = opts.TweakReport
+	}
+	cfg.StrictTweaks = opts.StrictTweaks
+	cfg.RegDiff = opts.RegDiff
+	cfg.KeepChanges = opts.KeepChanges
+
+	theme := opts.Theme
+	if theme == "" {
+		theme = "default"
+	}
+
+	cfg.Resume = true
+	return j.Mode, theme, nil
+}
@@ -0,0 +1,154 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"tiny11-builder/internal/config"
+	"tiny11-builder/internal/profile"
+	"tiny11-builder/internal/utils"
+)
+
+// RunTweaksCommand 处理 tweaks 子命令
+//
+//	tweaks list [-profile <name|path>] [--json]  列出注册表优化 (指定配置文件时标记是否启用)
+func RunTweaksCommand(args []string) error {
+	if len(args) == 0 {
+		printTweaksUsage()
+		return fmt.Errorf("缺少子命令")
+	}
+
+	switch args[0] {
+	case "list":
+		return listTweaks(args[1:])
+	case "-h", "--help", "help":
+		printTweaksUsage()
+		return nil
+	}
+
+	printTweaksUsage()
+	return fmt.Errorf("未知的子命令: %s", args[0])
+}
+
+// tweakEntry tweaks list 的一行 (指定配置文件时带启用状态)
+type tweakEntry struct {
+	profile.TweakInfo
+	Enabled *bool `json:"enabled,omitempty"`
+}
+
+func listTweaks(args []string) error {
+	fs := flag.NewFlagSet("tweaks list", flag.ContinueOnError)
+	profileRef := fs.String("profile", "", "标记指定配置文件 (展开继承后) 中启用的优化")
+	asJSON := fs.Bool("json", false, "以 JSON 输出")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var entries []tweakEntry
+	for _, info := range profile.Catalog() {
+		entries = append(entries, tweakEntry{TweakInfo: info})
+	}
+
+	if *profileRef != "" {
+		p, err := profile.Resolve(*profileRef, config.NewConfig().ProfilesDir)
+		if err != nil {
+			return err
+		}
+		enabled := make(map[string]bool)
+		for _, t := range p.Tweaks {
+			enabled[t.ID] = true
+		}
+		for i := range entries {
+			on := enabled[entries[i].ID]
+			entries[i].Enabled = &on
+			delete(enabled, entries[i].ID)
+		}
+		// 配置文件中自定义的优化不在内置目录中，追加在最后
+		for _, t := range p.Tweaks {
+			if !enabled[t.ID] {
+				continue
+			}
+			on := true
+			entries = append(entries, tweakEntry{
+				TweakInfo: profile.TweakInfo{
+					ID:          t.ID,
+					Description: t.Description,
+					Category:    t.Category,
+					Risk:        t.Risk,
+					Boot:        t.Boot,
+					Required:    t.Required,
+				},
+				Enabled: &on,
+			})
+		}
+	}
+
+	if *asJSON {
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(entries); err != nil {
+			return err
+		}
+		_, err := os.Stdout.Write(buf.Bytes())
+		return err
+	}
+
+	for _, e := range entries {
+		mark := ""
+		if e.Enabled != nil {
+			mark = "  "
+			if *e.Enabled {
+				mark = utils.Colorize("✓ ", utils.MikuGreen)
+			}
+		}
+		modes := strings.Join(e.Modes, ",")
+		if modes == "" {
+			modes = "-"
+		}
+		category := e.Category
+		if category == "" {
+			category = "-"
+		}
+		fmt.Printf("  %s%s %-9s %s %-20s %s\n",
+			mark,
+			utils.Colorize(fmt.Sprintf("%-26s", e.ID), utils.MikuPink),
+			category,
+			riskLabel(e.Risk),
+			modes,
+			utils.Colorize(e.Description, utils.MikuGray))
+	}
+	return nil
+}
+
+// riskLabel 按风险等级着色的固定宽度标签
+func riskLabel(risk string) string {
+	if risk == "" {
+		risk = "-"
+	}
+	label := fmt.Sprintf("%-6s", risk)
+	switch risk {
+	case profile.RiskMedium:
+		return utils.Colorize(label, utils.MikuYellow)
+	case profile.RiskHigh:
+		return utils.Colorize(label, utils.MikuRed)
+	}
+	return label
+}
+
+func printTweaksUsage() {
+	fmt.Print(`
+用法:
+  tiny11builder.exe tweaks list [-profile <name|path>] [--json]
+
+  list        列出内置的注册表优化: id、分类、风险等级 (low/medium/high)、默认包含的构建模式
+              -profile 标记该配置文件中启用的优化 (✓)，并列出配置文件自定义的优化
+
+构建时用 -enable-tweak / -disable-tweak <id> 单独启用或禁用优化。
+`)
+}
@@ -0,0 +1,239 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"tiny11-builder/internal/config"
+	"tiny11-builder/internal/history"
+	"tiny11-builder/internal/types"
+	"tiny11-builder/internal/utils"
+	"tiny11-builder/internal/webhook"
+)
+
+// RunWebhookCommand 处理 webhook 子命令
+//
+//	webhook list                                    列出配置的 webhook
+//	webhook test [name] [-event e]                  向 webhook 发送一次测试事件
+//	webhook listen [-addr a] [-secret s] [-fail n]  启动本地测试接收端
+func RunWebhookCommand(args []string) error {
+	if len(args) == 0 {
+		printWebhookUsage()
+		return fmt.Errorf("缺少子命令")
+	}
+
+	fs := flag.NewFlagSet("webhook "+args[0], flag.ContinueOnError)
+	file := fs.String("file", config.NewConfig().WebhooksFile, "webhook 配置文件")
+	event := fs.String("event", webhook.EventPing, "test 发送的事件")
+	addr := fs.String("addr", "127.0.0.1:9090", "listen 的监听地址")
+	secret := fs.String("secret", "", "listen 校验签名的密钥 (为空时不校验)")
+	fail := fs.Int("fail", 0, "listen 对前 n 个请求返回 503 (观察重试)")
+	fs.Usage = printWebhookUsage
+
+	// 允许选项写在名称之后
+	var names []string
+	rest := args[1:]
+	for {
+		if err := fs.Parse(rest); err != nil {
+			return err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		names = append(names, fs.Arg(0))
+		rest = fs.Args()[1:]
+	}
+
+	switch args[0] {
+	case "list":
+		hooks, err := webhook.LoadConfig(*file)
+		if err != nil {
+			return err
+		}
+		if len(hooks) == 0 {
+			fmt.Printf("没有配置 webhook (%s)\n", *file)
+			return nil
+		}
+		for _, h := range hooks {
+			events := strings.Join(h.Events, ",")
+			if events == "" {
+				events = "全部事件"
+			}
+			signed := ""
+			if h.Secret != "" {
+				signed = utils.Colorize(" (签名)", utils.MikuGreen)
+			}
+			fmt.Printf("  %s %s%s\n      %s\n",
+				utils.Colorize(fmt.Sprintf("%-16s", h.Name), utils.MikuPink),
+				h.URL, signed,
+				utils.Colorize(events, utils.MikuGray))
+		}
+		return nil
+
+	case "test":
+		if *event != webhook.EventPing && !isWebhookEvent(*event) {
+			return fmt.Errorf("未知的事件: %s (可选: %s, %s)", *event, webhook.EventPing, strings.Join(webhook.Events(), ", "))
+		}
+		hooks, err := webhook.LoadConfig(*file)
+		if err != nil {
+			return err
+		}
+		return testWebhooks(hooks, names, *event, *file)
+
+	case "listen":
+		receiver := &webhook.Receiver{Secret: *secret, FailFirst: *fail, Out: os.Stdout}
+		fmt.Println(utils.Colorize(fmt.Sprintf("webhook 测试接收端: http://%s/ (Ctrl+C 退出)", *addr), utils.MikuCyan))
+		if *secret == "" {
+			fmt.Println(utils.Colorize("未指定 -secret，不校验签名", utils.MikuGray))
+		}
+		return http.ListenAndServe(*addr, receiver)
+
+	case "-h", "--help", "help":
+		printWebhookUsage()
+		return nil
+	}
+
+	printWebhookUsage()
+	return fmt.Errorf("未知的子命令: %s", args[0])
+}
+
+func isWebhookEvent(event string) bool {
+	for _, e := range webhook.Events() {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// testWebhooks 向指定 (默认全部) webhook 发送一次示例事件，不重试
+func testWebhooks(hooks []webhook.Hook, names []string, event, file string) error {
+	if len(hooks) == 0 {
+		return fmt.Errorf("没有配置 webhook (%s)", file)
+	}
+	selected := make(map[string]bool)
+	for _, name := range names {
+		found := false
+		for _, h := range hooks {
+			found = found || h.Name == name
+		}
+		if !found {
+			return fmt.Errorf("没有名为 %s 的 webhook", name)
+		}
+		selected[name] = true
+	}
+
+	job, step := sampleWebhookEvent(event)
+	failed := 0
+	sent := 0
+	for _, h := range hooks {
+		if len(selected) > 0 && !selected[h.Name] {
+			continue
+		}
+		sent++
+		if !h.Wants(event) {
+			fmt.Printf("  %s %s\n", utils.Colorize(fmt.Sprintf("%-16s", h.Name), utils.MikuPink),
+				utils.Colorize("未订阅 "+event+"，跳过", utils.MikuGray))
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err := webhook.Send(ctx, h, event, job, step)
+		cancel()
+		status := utils.Colorize("成功", utils.MikuGreen)
+		if err != nil {
+			failed++
+			status = utils.Colorize("失败: "+err.Error(), utils.MikuRed)
+		}
+		fmt.Printf("  %s %s %s\n", utils.Colorize(fmt.Sprintf("%-16s", h.Name), utils.MikuPink), h.URL, status)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d/%d 个 webhook 发送失败", failed, sent)
+	}
+	return nil
+}
+
+// sampleWebhookEvent 测试用的示例数据
+func sampleWebhookEvent(event string) (*types.WebhookJob, *types.WebhookStep) {
+	if event == webhook.EventPing {
+		return nil, nil
+	}
+	cfg := config.NewConfig()
+	now := time.Now()
+	started := now.Add(-25 * time.Minute)
+	job := &types.WebhookJob{
+		ID:        history.NewID(),
+		Source:    history.SourceCLI,
+		Mode:      types.ModeStandard,
+		State:     types.JobRunning,
+		WorkDir:   cfg.WorkDir,
+		CreatedAt: started,
+		StartedAt: &started,
+	}
+	var step *types.WebhookStep
+	switch event {
+	case webhook.EventQueued:
+		job.State = types.JobQueued
+		job.StartedAt = nil
+	case webhook.EventStepCompleted:
+		step = &types.WebhookStep{Step: 1, Steps: 20, Title: "验证ISO镜像", StartedAt: started, Duration: 3.2}
+	case webhook.EventSucceeded, webhook.EventFailed, webhook.EventCanceled:
+		job.FinishedAt = &now
+		job.Duration = now.Sub(started).Seconds()
+		job.LogFile = cfg.LogDir
+		switch event {
+		case webhook.EventSucceeded:
+			job.State = types.JobComplete
+			job.OutputISO = cfg.OutputISO
+			job.SHA256 = strings.Repeat("0", 64)
+		case webhook.EventFailed:
+			job.State = types.JobFailed
+			job.Error = "ISO验证失败: [1002] 未找到boot.wim"
+			job.ErrorCode = int(types.ErrCodeNotFound)
+			job.ErrorContext = map[string]interface{}{"path": `E:\sources\boot.wim`}
+		default:
+			job.State = types.JobCanceled
+		}
+	}
+	return job, step
+}
+
+func printWebhookUsage() {
+	fmt.Print(`
+用法:
+  tiny11builder.exe webhook list [-file <file>]
+  tiny11builder.exe webhook test [<name>...] [-event <event>] [-file <file>]
+  tiny11builder.exe webhook listen [-addr 127.0.0.1:9090] [-secret <secret>] [-fail <n>]
+
+  list        列出 webhooks.json 中的 webhook
+  test        向 webhook (默认全部) 发送一次示例事件 (默认 ping)，不重试，显示结果
+  listen      启动本地测试接收端: 打印收到的事件，指定 -secret 时校验签名 (无效时返回 401)，
+              -fail n 对前 n 个请求返回 503 以观察重试
+
+事件: job.queued、job.started、job.step_completed、job.succeeded、job.failed、job.canceled
+
+webhooks.json 位于程序目录 (API 模式可用 -webhooks 指定):
+
+  {
+    "webhooks": [
+      {
+        "name": "nightly",
+        "url": "http://127.0.0.1:9090/",
+        "secret": "change-me",
+        "events": ["job.succeeded", "job.failed"],
+        "headers": {"X-Team": "build"},
+        "maxAttempts": 5,
+        "timeout": 10
+      }
+    ]
+  }
+
+events 为空时发送全部事件。请求体为 JSON，X-Tiny11-Event 为事件名，X-Tiny11-Delivery 为投递 id，
+配置了 secret 时 X-Tiny11-Signature-256 为 sha256=<请求体的 HMAC-SHA256>。
+失败 (网络错误、408、429、5xx) 时按 1s、2s、4s... 重试，最多 maxAttempts 次。
+`)
+}
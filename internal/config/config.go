@@ -4,10 +4,15 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+
+	"tiny11-builder/internal/checkpoint"
+	"tiny11-builder/internal/profile"
+	"tiny11-builder/internal/utils"
 )
 
 type Config struct {
 	ISODrive      string
+	ISOFile       string // 源ISO镜像文件 (设置后直接读取，无需挂载)
 	ScratchDrive  string
 	ImageIndex    int
 	OutputISO     string
@@ -16,6 +21,40 @@ type Config struct {
 	ThemeName     string
 	PreinstallApps []string
 
+	// 已通过 -preinstall 或 API 指定预装软件 (不再交互式询问)
+	PreinstallSet bool
+
+	// 构建配置文件 (nil 时使用构建模式对应的内置配置)
+	Profile *profile.Profile
+
+	// 在配置文件基础上单独启用/禁用的注册表优化 (已应用到 Profile，记录在检查点中)
+	EnableTweaks  []string
+	DisableTweaks []string
+
+	// 从检查点继续上次中断的构建
+	Resume bool
+
+	// 只预演构建，不修改镜像 (PlanFile 非空时同时写入 JSON 报告)
+	Plan     bool
+	PlanFile string
+
+	// 导入的 .reg 文件及解析出的注册表优化 (在配置文件的优化之后应用)
+	RegFiles  []string
+	RegTweaks []profile.Tweak
+
+	// 将实际应用的注册表优化导出为 .reg 文件
+	ExportReg string
+
+	// 注册表优化报告 (每组优化的应用和校验结果)；严格模式下必需的优化未生效时中止构建
+	TweakReport  string
+	StrictTweaks bool
+
+	// 比较应用优化前后的配置单元，差异报告写在输出 ISO 旁边
+	RegDiff bool
+
+	// 构建失败时提交 install.wim 中已完成步骤的更改 (默认放弃)，-resume 时无需重新执行
+	KeepChanges bool
+
 	// 路径配置 - 全部基于程序目录
 	WorkDir      string
 	Tiny11Dir    string
@@ -23,8 +62,17 @@ type Config struct {
 	ResourcesDir string
 	ThemesDir    string
 	PreinstallDir string
+	ProfilesDir  string
+	APITokensFile string // API 令牌 (程序目录中)
+	HistoryFile  string // 构建历史 (程序目录中，所有工作目录的构建共用)
+	WebhooksFile string // webhook 配置 (程序目录中)
 	TempDir      string
 	LogDir       string
+	CheckpointFile string
+	RegDiffDir   string
+
+	// 外部命令执行器 (nil 表示使用默认的真实执行器)
+	Runner utils.CommandRunner
 }
 
 func NewConfig() *Config {
@@ -38,19 +86,20 @@ func NewConfig() *Config {
 	}
 
 	cfg := &Config{
-		WorkDir:   workDir,
 		ThemeName: "default",
 	}
 
-	// 所有路径基于工作目录
-	cfg.Tiny11Dir = filepath.Join(workDir, "build", "tiny11")
-	cfg.ScratchDir = filepath.Join(workDir, "build", "scratch")
-	cfg.TempDir = filepath.Join(workDir, "build", "temp")
+	// 资源路径基于程序目录
 	cfg.ResourcesDir = filepath.Join(workDir, "resources")
 	cfg.ThemesDir = filepath.Join(workDir, "themes")
 	cfg.PreinstallDir = filepath.Join(workDir, "preinstall")
-	cfg.LogDir = filepath.Join(workDir, "logs")
-	cfg.OutputISO = filepath.Join(workDir, "tiny11.iso")
+	cfg.ProfilesDir = filepath.Join(workDir, "profiles")
+	cfg.APITokensFile = filepath.Join(workDir, "api-tokens.json")
+	cfg.HistoryFile = filepath.Join(workDir, "history.jsonl")
+	cfg.WebhooksFile = filepath.Join(workDir, "webhooks.json")
+
+	// 构建路径基于工作目录
+	cfg.SetWorkDir(workDir)
 
 	// 自动检测系统盘作为默认临时盘
 	cfg.ScratchDrive = detectSystemDrive()
@@ -58,6 +107,22 @@ func NewConfig() *Config {
 	return cfg
 }
 
+// SetWorkDir 设置工作目录，构建目录、日志和默认输出路径随之改变
+// (资源、主题、预装软件和配置文件目录仍在程序目录中)
+//
+// 工作目录不同的构建互不影响，可以并行执行。
+func (c *Config) SetWorkDir(dir string) {
+	c.WorkDir = dir
+	c.Tiny11Dir = filepath.Join(dir, "build", "tiny11")
+	c.ScratchDir = filepath.Join(dir, "build", "scratch")
+	c.TempDir = filepath.Join(dir, "build", "temp")
+	c.CheckpointFile = filepath.Join(dir, "build", checkpoint.FileName)
+	c.RegDiffDir = filepath.Join(dir, "build", "regdiff")
+	c.LogDir = filepath.Join(dir, "logs")
+	c.TweakReport = filepath.Join(c.LogDir, "tweak-report.json")
+	c.OutputISO = filepath.Join(dir, "tiny11.iso")
+}
+
 func detectSystemDrive() string {
 	if drive := os.Getenv("SystemDrive"); drive != "" {
 		return drive
@@ -65,6 +130,14 @@ func detectSystemDrive() string {
 	return "C:"
 }
 
+// CommandRunner 构建使用的外部命令执行器 (未设置时为真实执行器)
+func (c *Config) CommandRunner() utils.CommandRunner {
+	if c.Runner == nil {
+		return utils.NewExecRunner()
+	}
+	return c.Runner
+}
+
 func (c *Config) GetArchitecture() string {
 	arch := runtime.GOARCH
 	switch arch {
@@ -0,0 +1,64 @@
+package dism
+
+import "strings"
+
+// IntlInfo /Get-Intl 输出中的国际化设置
+type IntlInfo struct {
+	UILanguage         string
+	SystemLocale       string
+	UserLocale         string
+	TimeZone           string
+	InstalledLanguages []string
+}
+
+// DefaultLanguage 当输出中缺少默认 UI 语言时使用的语言
+const DefaultLanguage = "en-US"
+
+// ParseIntl 解析 /Get-Intl 的输出
+func ParseIntl(output string) *IntlInfo {
+	info := &IntlInfo{}
+
+	records := parseRecords(output, "")
+	rec := records[0]
+
+	info.UILanguage = firstField(rec.get("uilanguage"))
+	info.SystemLocale = firstField(rec.get("systemlocale"))
+	info.UserLocale = firstField(rec.get("userlocale"))
+	info.TimeZone = rec.get("timezone")
+
+	// 每种语言一行 "Installed language(s): xx-XX"，也可能在同一标签下逐行列出
+	entries := append([]string{rec.get("installedlanguages")}, rec.dups["installedlanguages"]...)
+	entries = append(entries, rec.extra["installedlanguages"]...)
+	for _, entry := range entries {
+		lang := firstField(entry)
+		if isLanguageTag(lang) {
+			info.InstalledLanguages = append(info.InstalledLanguages, lang)
+		}
+	}
+
+	// 旧版本 DISM 只输出 "Default language"
+	if info.UILanguage == "" {
+		info.UILanguage = firstField(rec.get("defaultlanguage"))
+	}
+
+	return info
+}
+
+// Language 返回默认 UI 语言，无法识别时返回 en-US
+func (i *IntlInfo) Language() string {
+	if isLanguageTag(i.UILanguage) {
+		return i.UILanguage
+	}
+	if len(i.InstalledLanguages) > 0 {
+		return i.InstalledLanguages[0]
+	}
+	return DefaultLanguage
+}
+
+func firstField(s string) string {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
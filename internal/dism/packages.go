@@ -0,0 +1,176 @@
+package dism
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Package /Get-Packages 输出中的系统组件包
+type Package struct {
+	Identity    string
+	State       string
+	ReleaseType string
+	InstallTime string
+}
+
+// AppxPackage /Get-ProvisionedAppxPackages 输出中的预装应用
+type AppxPackage struct {
+	DisplayName  string
+	Version      string
+	Architecture string
+	ResourceID   string
+	PackageName  string
+	Regions      string
+}
+
+// Feature /Get-Features 输出中的可选功能
+type Feature struct {
+	Name  string
+	State string
+}
+
+// Capability /Get-Capabilities 输出中的按需功能
+type Capability struct {
+	Identity string
+	State    string
+}
+
+// MountedImage /Get-MountedImageInfo 输出中的已挂载镜像
+type MountedImage struct {
+	MountDir  string
+	ImageFile string
+	Index     int
+	ReadWrite bool
+	Status    string
+}
+
+// ParsePackages 解析 /Get-Packages 的输出 (支持列表和 /Format:Table 两种格式)
+func ParsePackages(output string) []Package {
+	var packages []Package
+
+	if isTable(output, "packageidentity") {
+		for _, row := range parseTable(output, "packageidentity") {
+			packages = append(packages, Package{
+				Identity:    row["packageidentity"],
+				State:       NormalizeState(row["state"]),
+				ReleaseType: row["releasetype"],
+				InstallTime: row["installtime"],
+			})
+		}
+		return packages
+	}
+
+	for _, rec := range parseRecords(output, "packageidentity") {
+		packages = append(packages, Package{
+			Identity:    rec.get("packageidentity"),
+			State:       NormalizeState(rec.get("state")),
+			ReleaseType: rec.get("releasetype"),
+			InstallTime: rec.get("installtime"),
+		})
+	}
+	return packages
+}
+
+// ParseProvisionedAppx 解析 /Get-ProvisionedAppxPackages 的输出
+// 被截断的包名 (包含 "...") 会被跳过
+func ParseProvisionedAppx(output string) []AppxPackage {
+	var packages []AppxPackage
+
+	for _, rec := range parseRecords(output, "displayname") {
+		name := rec.get("packagename")
+		if name == "" || strings.Contains(name, "...") {
+			continue
+		}
+		packages = append(packages, AppxPackage{
+			DisplayName:  rec.get("displayname"),
+			Version:      rec.get("version"),
+			Architecture: rec.get("architecture"),
+			ResourceID:   rec.get("resourceid"),
+			PackageName:  name,
+			Regions:      rec.get("regions"),
+		})
+	}
+	return packages
+}
+
+// ParseFeatures 解析 /Get-Features 的输出 (支持列表和 /Format:Table 两种格式)
+func ParseFeatures(output string) []Feature {
+	var features []Feature
+
+	if isTable(output, "featurename") {
+		for _, row := range parseTable(output, "featurename") {
+			features = append(features, Feature{
+				Name:  row["featurename"],
+				State: NormalizeState(row["state"]),
+			})
+		}
+		return features
+	}
+
+	for _, rec := range parseRecords(output, "featurename") {
+		features = append(features, Feature{
+			Name:  rec.get("featurename"),
+			State: NormalizeState(rec.get("state")),
+		})
+	}
+	return features
+}
+
+// ParseCapabilities 解析 /Get-Capabilities 的输出 (支持列表和 /Format:Table 两种格式)
+func ParseCapabilities(output string) []Capability {
+	var caps []Capability
+
+	if isTable(output, "capabilityidentity") {
+		for _, row := range parseTable(output, "capabilityidentity") {
+			caps = append(caps, Capability{
+				Identity: row["capabilityidentity"],
+				State:    NormalizeState(row["state"]),
+			})
+		}
+		return caps
+	}
+
+	for _, rec := range parseRecords(output, "capabilityidentity") {
+		caps = append(caps, Capability{
+			Identity: rec.get("capabilityidentity"),
+			State:    NormalizeState(rec.get("state")),
+		})
+	}
+	return caps
+}
+
+// ParseMountedImages 解析 /Get-MountedImageInfo 的输出
+func ParseMountedImages(output string) []MountedImage {
+	var mounts []MountedImage
+
+	for _, rec := range parseRecords(output, "mountdir") {
+		index, _ := strconv.Atoi(rec.get("imageindex"))
+		rw := strings.ToLower(rec.get("readwrite"))
+		mounts = append(mounts, MountedImage{
+			MountDir:  rec.get("mountdir"),
+			ImageFile: rec.get("imagefile"),
+			Index:     index,
+			ReadWrite: rw == "yes" || rw == "是",
+			Status:    rec.get("status"),
+		})
+	}
+	return mounts
+}
+
+// Identities 返回系统包标识列表
+func Identities(packages []Package) []string {
+	ids := make([]string, 0, len(packages))
+	for _, p := range packages {
+		ids = append(ids, p.Identity)
+	}
+	return ids
+}
+
+// PackageNames 返回预装应用的完整包名列表
+func PackageNames(packages []AppxPackage) []string {
+	names := make([]string, 0, len(packages))
+	for _, p := range packages {
+		names = append(names, p.PackageName)
+	}
+	return names
+}
@@ -0,0 +1,320 @@
+// Package dism 将 DISM 命令的文本输出解析为结构化数据
+//
+// 同时支持 /English 输出和中文系统下的本地化输出
+// (GBK 编码已由 utils.ExecRunner 解码为 UTF-8)。
+package dism
+
+import (
+	"strings"
+	"unicode"
+)
+
+// labels 字段标签 (去空格、小写) -> 规范键名
+var labels = map[string]string{
+	// Get-WimInfo
+	"index":            "index",
+	"索引":               "index",
+	"name":             "name",
+	"名称":               "name",
+	"description":      "description",
+	"描述":               "description",
+	"size":             "size",
+	"大小":               "size",
+	"wimbootable":      "bootable",
+	"wim可启动":           "bootable",
+	"architecture":     "architecture",
+	"体系结构":             "architecture",
+	"架构":               "architecture",
+	"hal":              "hal",
+	"version":          "version",
+	"版本":               "version",
+	"servicepackbuild": "spbuild",
+	"servicepack内部版本":  "spbuild",
+	"servicepacklevel": "splevel",
+	"servicepack级别":    "splevel",
+	"edition":          "edition",
+	"installation":     "installation",
+	"安装":               "installation",
+	"producttype":      "producttype",
+	"产品类型":             "producttype",
+	"productsuite":     "productsuite",
+	"产品套件":             "productsuite",
+	"systemroot":       "systemroot",
+	"系统根目录":            "systemroot",
+	"directories":      "directories",
+	"目录":               "directories",
+	"files":            "files",
+	"文件":               "files",
+	"created":          "created",
+	"创建时间":             "created",
+	"modified":         "modified",
+	"修改时间":             "modified",
+	"languages":        "languages",
+	"语言":               "languages",
+	"defaultlanguage":  "defaultlanguage",
+	"默认语言":             "defaultlanguage",
+
+	// Get-ProvisionedAppxPackages
+	"displayname":  "displayname",
+	"显示名称":         "displayname",
+	"resourceid":   "resourceid",
+	"资源id":         "resourceid",
+	"packagename":  "packagename",
+	"程序包名称":        "packagename",
+	"包名称":          "packagename",
+	"regions":      "regions",
+	"区域":           "regions",
+	"imageversion": "imageversion",
+	"映像版本":         "imageversion",
+
+	// Get-Packages / Get-Features / Get-Capabilities
+	"packageidentity":    "packageidentity",
+	"程序包标识":              "packageidentity",
+	"包标识":                "packageidentity",
+	"state":              "state",
+	"状态":                 "state",
+	"releasetype":        "releasetype",
+	"发布类型":               "releasetype",
+	"installtime":        "installtime",
+	"安装时间":               "installtime",
+	"featurename":        "featurename",
+	"功能名称":               "featurename",
+	"capabilityidentity": "capabilityidentity",
+	"功能标识":               "capabilityidentity",
+
+	// Get-Intl
+	"defaultsystemuilanguage":         "uilanguage",
+	"默认系统ui语言":                        "uilanguage",
+	"systemlocale":                    "systemlocale",
+	"系统区域设置":                          "systemlocale",
+	"defaulttimezone":                 "timezone",
+	"默认时区":                            "timezone",
+	"userlocalefordefaultuseraccount": "userlocale",
+	"默认用户帐户的用户区域设置":                   "userlocale",
+	"installedlanguage(s)":            "installedlanguages",
+	"已安装的语言":                          "installedlanguages",
+	"activekeyboard(s)":               "keyboards",
+	"活动键盘":                            "keyboards",
+
+	// Get-MountedImageInfo
+	"mountdir":          "mountdir",
+	"装载目录":              "mountdir",
+	"imagefile":         "imagefile",
+	"映像文件":              "imagefile",
+	"imageindex":        "imageindex",
+	"映像索引":              "imageindex",
+	"mountedread/write": "readwrite",
+	"已装载读/写":            "readwrite",
+	"status":            "status",
+}
+
+// states 本地化状态值 -> 英文状态
+var states = map[string]string{
+	"已安装":     "Installed",
+	"安装挂起":    "Install Pending",
+	"卸载挂起":    "Uninstall Pending",
+	"已取代":     "Superseded",
+	"已暂存":     "Staged",
+	"已启用":     "Enabled",
+	"已禁用":     "Disabled",
+	"启用挂起":    "Enable Pending",
+	"禁用挂起":    "Disable Pending",
+	"不存在":     "Not Present",
+	"已删除有效负载": "Disabled with Payload Removed",
+}
+
+// NormalizeState 将本地化的状态值统一为英文
+func NormalizeState(s string) string {
+	s = strings.TrimSpace(s)
+	if en, ok := states[s]; ok {
+		return en
+	}
+	return s
+}
+
+// canonical 返回标签的规范键名，未知标签返回空字符串
+func canonical(label string) string {
+	key := strings.ToLower(strings.Join(strings.Fields(label), ""))
+	return labels[key]
+}
+
+// splitKV 按第一个冒号 (半角或全角) 拆分 "键 : 值"
+func splitKV(line string) (string, string, bool) {
+	idx := strings.IndexAny(line, ":：")
+	if idx < 0 {
+		return "", "", false
+	}
+	sep := 1
+	if strings.HasPrefix(line[idx:], "：") {
+		sep = len("：")
+	}
+	return strings.TrimSpace(line[:idx]), strings.TrimSpace(line[idx+sep:]), true
+}
+
+// record 一组键值字段，extra 为紧跟在某个键后的无冒号续行
+type record struct {
+	fields map[string]string
+	extra  map[string][]string
+	// dups 同一标签重复出现时的后续值 (例: 中文输出中 Version 与 Edition 均为 "版本")
+	dups map[string][]string
+}
+
+func (r *record) get(key string) string {
+	return r.fields[key]
+}
+
+func newRecord() *record {
+	return &record{
+		fields: make(map[string]string),
+		extra:  make(map[string][]string),
+		dups:   make(map[string][]string),
+	}
+}
+
+// parseRecords 将 "键 : 值" 形式的输出拆分为记录
+// 遇到 startKey 时开始新记录，第一条 startKey 之前的内容 (工具版本等) 被忽略；
+// startKey 为空时整个输出作为一条记录
+func parseRecords(output, startKey string) []*record {
+	var records []*record
+	var cur *record
+	lastKey := ""
+
+	if startKey == "" {
+		cur = newRecord()
+		records = append(records, cur)
+	}
+
+	for _, line := range strings.Split(strings.ReplaceAll(output, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			lastKey = ""
+			continue
+		}
+
+		label, value, ok := splitKV(trimmed)
+		key := ""
+		if ok {
+			key = canonical(label)
+		}
+
+		if key == "" {
+			// 无法识别的行视为上一个键的续行 (例: Languages 下的语言列表)
+			if cur != nil && lastKey != "" {
+				cur.extra[lastKey] = append(cur.extra[lastKey], trimmed)
+			}
+			continue
+		}
+
+		if startKey != "" && key == startKey {
+			cur = newRecord()
+			records = append(records, cur)
+		}
+		if cur == nil {
+			continue
+		}
+
+		if _, exists := cur.fields[key]; exists {
+			cur.dups[key] = append(cur.dups[key], value)
+		} else {
+			cur.fields[key] = value
+		}
+		lastKey = key
+	}
+
+	return records
+}
+
+// parseTable 解析 /Format:Table 形式的输出
+// headerKey 为第一列的规范键名，用于定位表头
+func parseTable(output, headerKey string) []map[string]string {
+	var rows []map[string]string
+	var columns []string
+
+	for _, line := range strings.Split(strings.ReplaceAll(output, "\r\n", "\n"), "\n") {
+		if !strings.Contains(line, "|") {
+			continue
+		}
+
+		cells := strings.Split(line, "|")
+		for i := range cells {
+			cells[i] = strings.TrimSpace(cells[i])
+		}
+
+		if columns == nil {
+			if canonical(cells[0]) == headerKey {
+				columns = make([]string, len(cells))
+				for i, c := range cells {
+					columns[i] = canonical(c)
+				}
+			}
+			continue
+		}
+
+		// 跳过分隔行
+		if strings.Trim(cells[0], "-") == "" {
+			continue
+		}
+
+		row := make(map[string]string)
+		for i, c := range cells {
+			if i < len(columns) && columns[i] != "" {
+				row[columns[i]] = c
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	return rows
+}
+
+// isTable 判断输出是否为表格格式
+func isTable(output, headerKey string) bool {
+	for _, line := range strings.Split(output, "\n") {
+		if !strings.Contains(line, "|") {
+			continue
+		}
+		cells := strings.Split(line, "|")
+		if canonical(cells[0]) == headerKey {
+			return true
+		}
+	}
+	return false
+}
+
+// parseInt 解析带千位分隔符和单位的数字 (例: "16,479,089,025 bytes" / "16,479,089,025 个字节")
+func parseInt(s string) int64 {
+	var n int64
+	seen := false
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			n = n*10 + int64(r-'0')
+			seen = true
+		case r == ',' || r == ' ':
+		default:
+			if seen {
+				return n
+			}
+		}
+	}
+	return n
+}
+
+// isLanguageTag 判断字符串是否为语言标记 (例: en-US, zh-CN, sr-Latn-RS)
+func isLanguageTag(s string) bool {
+	parts := strings.Split(s, "-")
+	if len(parts) < 2 || len(parts[0]) < 2 || len(parts[0]) > 3 {
+		return false
+	}
+	for _, p := range parts {
+		if p == "" {
+			return false
+		}
+		for _, r := range p {
+			if !unicode.IsLetter(r) && !unicode.IsDigit(r) || r > unicode.MaxASCII {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,211 @@
+package dism
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"tiny11-builder/internal/utils"
+)
+
+// readFixture 读取 testdata 中的 DISM 输出，与 ExecRunner 一样解码 GBK
+func readFixture(t *testing.T, lang, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", lang, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return utils.TryDecodeGBK(data)
+}
+
+func TestParseWimInfo(t *testing.T) {
+	tests := []struct {
+		lang string
+		want []*WimImage
+	}{
+		{"en", []*WimImage{
+			{Index: 1, Name: "Windows 11 Home", Description: "Windows 11 Home", Size: 16263854181},
+			{Index: 6, Name: "Windows 11 Pro", Description: "Windows 11 Pro", Size: 16479089025},
+		}},
+		{"zh-gbk", []*WimImage{
+			{Index: 1, Name: "Windows 11 家庭版", Description: "Windows 11 家庭版", Size: 16263854181},
+			{Index: 6, Name: "Windows 11 专业版", Description: "Windows 11 专业版", Size: 16479089025},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.lang, func(t *testing.T) {
+			got, err := ParseWimInfo(readFixture(t, tt.lang, "wiminfo.txt"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseWimInfo:\n got %+v\nwant %+v", got, tt.want)
+			}
+			if idx := Indices(got); !reflect.DeepEqual(idx, []int{1, 6}) {
+				t.Errorf("Indices = %v", idx)
+			}
+		})
+	}
+}
+
+func TestParseWimInfoIndex(t *testing.T) {
+	tests := []struct {
+		lang string
+		want *WimImage
+	}{
+		{"en", &WimImage{
+			Index: 6, Name: "Windows 11 Pro", Description: "Windows 11 Pro", Size: 16479089025,
+			Architecture: "x64", Version: "10.0.22631", ServicePackBuild: 2861, Edition: "Professional",
+			Installation: "Client", ProductType: "WinNT", Directories: 22578, Files: 102497,
+			Languages: []string{"en-US", "de-DE"}, DefaultLanguage: "en-US",
+		}},
+		{"zh-gbk", &WimImage{
+			Index: 6, Name: "Windows 11 专业版", Description: "Windows 11 专业版", Size: 16479089025,
+			Architecture: "x64", Version: "10.0.22631", ServicePackBuild: 2861, Edition: "Professional",
+			Installation: "Client", ProductType: "WinNT", Directories: 22578, Files: 102497,
+			Languages: []string{"zh-CN", "en-US"}, DefaultLanguage: "zh-CN",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.lang, func(t *testing.T) {
+			got, err := ParseWimInfo(readFixture(t, tt.lang, "wiminfo-index.txt"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != 1 {
+				t.Fatalf("got %d images, want 1", len(got))
+			}
+			if !reflect.DeepEqual(got[0], tt.want) {
+				t.Errorf("ParseWimInfo:\n got %+v\nwant %+v", got[0], tt.want)
+			}
+			if b := got[0].Build(); b != "22631" {
+				t.Errorf("Build() = %q", b)
+			}
+		})
+	}
+}
+
+func TestParseWimInfoEmpty(t *testing.T) {
+	if _, err := ParseWimInfo("Error: 2\n\nThe system cannot find the file specified.\n"); err == nil {
+		t.Error("没有镜像信息时应返回错误")
+	}
+}
+
+func TestParseIntl(t *testing.T) {
+	tests := []struct {
+		lang string
+		want *IntlInfo
+	}{
+		{"en", &IntlInfo{
+			UILanguage: "en-US", SystemLocale: "en-US", UserLocale: "en-US",
+			TimeZone: "Pacific Standard Time", InstalledLanguages: []string{"en-US", "de-DE"},
+		}},
+		{"zh-gbk", &IntlInfo{
+			UILanguage: "zh-CN", SystemLocale: "zh-CN", UserLocale: "zh-CN",
+			TimeZone: "China Standard Time", InstalledLanguages: []string{"zh-CN"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.lang, func(t *testing.T) {
+			got := ParseIntl(readFixture(t, tt.lang, "intl.txt"))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseIntl:\n got %+v\nwant %+v", got, tt.want)
+			}
+			if got.Language() != tt.want.UILanguage {
+				t.Errorf("Language() = %q", got.Language())
+			}
+		})
+	}
+}
+
+func TestIntlLanguageFallback(t *testing.T) {
+	if lang := ParseIntl("").Language(); lang != DefaultLanguage {
+		t.Errorf("空输出 Language() = %q, want %q", lang, DefaultLanguage)
+	}
+}
+
+func TestParsePackages(t *testing.T) {
+	tests := []struct {
+		lang, file string
+		want       []Package
+	}{
+		{"en", "packages.txt", []Package{
+			{"Microsoft-Windows-Client-LanguagePack-Package~31bf3856ad364e35~amd64~en-US~10.0.22621.2861", "Installed", "Language Pack", "11/28/2023 4:20 AM"},
+			{"Microsoft-Windows-MediaPlayer-Package~31bf3856ad364e35~amd64~~10.0.22621.2861", "Install Pending", "OnDemand Pack", "11/28/2023 4:21 AM"},
+			{"Package_for_RollupFix~31bf3856ad364e35~amd64~~22621.2861.1.6", "Superseded", "Security Update", "11/28/2023 4:25 AM"},
+		}},
+		{"en", "packages-table.txt", []Package{
+			{"Microsoft-Windows-Client-LanguagePack-Package~31bf3856ad364e35~amd64~en-US~10.0.22621.2861", "Installed", "Language Pack", "11/28/2023 4:20 AM"},
+			{"Microsoft-Windows-MediaPlayer-Package~31bf3856ad364e35~amd64~~10.0.22621.2861", "Staged", "OnDemand Pack", ""},
+		}},
+		{"zh-gbk", "packages.txt", []Package{
+			{"Microsoft-Windows-Client-LanguagePack-Package~31bf3856ad364e35~amd64~zh-CN~10.0.22621.2861", "Installed", "语言包", "2023/11/28 4:20"},
+			{"Microsoft-Windows-MediaPlayer-Package~31bf3856ad364e35~amd64~~10.0.22621.2861", "Install Pending", "按需程序包", "2023/11/28 4:21"},
+			{"Package_for_RollupFix~31bf3856ad364e35~amd64~~22621.2861.1.6", "Superseded", "安全更新", "2023/11/28 4:25"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.lang+"/"+tt.file, func(t *testing.T) {
+			got := ParsePackages(readFixture(t, tt.lang, tt.file))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParsePackages:\n got %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseProvisionedAppx(t *testing.T) {
+	want := []AppxPackage{
+		{"Clipchamp.Clipchamp", "2.2.8.0", "neutral", "yxz26nhyzhsrt", "Clipchamp.Clipchamp_2.2.8.0_neutral_~_yxz26nhyzhsrt", "all"},
+		{"Microsoft.BingNews", "4.2.27001.0", "neutral", "~", "Microsoft.BingNews_4.2.27001.0_neutral_~_8wekyb3d8bbwe", "all"},
+	}
+	// 英文输出中第三个包名被截断，应跳过
+	for _, lang := range []string{"en", "zh-gbk"} {
+		t.Run(lang, func(t *testing.T) {
+			got := ParseProvisionedAppx(readFixture(t, lang, "appx.txt"))
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("ParseProvisionedAppx:\n got %+v\nwant %+v", got, want)
+			}
+			names := PackageNames(got)
+			if len(names) != 2 || names[1] != want[1].PackageName {
+				t.Errorf("PackageNames = %v", names)
+			}
+		})
+	}
+}
+
+func TestParseFeatures(t *testing.T) {
+	want := []Feature{
+		{"NetFx3", "Disabled with Payload Removed"},
+		{"Microsoft-Windows-Subsystem-Linux", "Disabled"},
+		{"Printing-PrintToPDFServices-Features", "Enabled"},
+	}
+	for _, tt := range []struct{ lang, file string }{
+		{"en", "features.txt"},
+		{"zh-gbk", "features.txt"},
+		{"zh-gbk", "features-table.txt"},
+	} {
+		t.Run(tt.lang+"/"+tt.file, func(t *testing.T) {
+			got := ParseFeatures(readFixture(t, tt.lang, tt.file))
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("ParseFeatures:\n got %+v\nwant %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestParseCapabilities(t *testing.T) {
+	want := []Capability{
+		{"Browser.InternetExplorer~~~~0.0.11.0", "Installed"},
+		{"Language.Basic~~~de-DE~0.0.1.0", "Not Present"},
+	}
+	for _, lang := range []string{"en", "zh-gbk"} {
+		t.Run(lang, func(t *testing.T) {
+			got := ParseCapabilities(readFixture(t, lang, "capabilities.txt"))
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("ParseCapabilities:\n got %+v\nwant %+v", got, want)
+			}
+		})
+	}
+}
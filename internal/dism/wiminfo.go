@@ -0,0 +1,122 @@
+package dism
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// WimImage /Get-WimInfo 输出中的一个镜像
+// 不带 /Index 时只有 Index、Name、Description、Size 有值
+type WimImage struct {
+	Index            int
+	Name             string
+	Description      string
+	Size             int64
+	Bootable         bool
+	Architecture     string
+	Version          string
+	ServicePackBuild int
+	ServicePackLevel int
+	Edition          string
+	Installation     string
+	ProductType      string
+	Directories      int
+	Files            int
+	Languages        []string
+	DefaultLanguage  string
+}
+
+// Build 返回内部版本号 (例: 10.0.22631 -> 22631)
+func (w *WimImage) Build() string {
+	parts := strings.Split(w.Version, ".")
+	if len(parts) >= 3 {
+		return parts[2]
+	}
+	return ""
+}
+
+// ParseWimInfo 解析 /Get-WimInfo 的输出
+func ParseWimInfo(output string) ([]*WimImage, error) {
+	var images []*WimImage
+
+	for _, rec := range parseRecords(output, "index") {
+		img := &WimImage{
+			Name:         rec.get("name"),
+			Description:  rec.get("description"),
+			Size:         parseInt(rec.get("size")),
+			Architecture: rec.get("architecture"),
+			Version:      rec.get("version"),
+			Edition:      rec.get("edition"),
+			Installation: rec.get("installation"),
+			ProductType:  rec.get("producttype"),
+		}
+
+		index, err := strconv.Atoi(rec.get("index"))
+		if err != nil {
+			return nil, fmt.Errorf("无效的镜像索引: %q", rec.get("index"))
+		}
+		img.Index = index
+
+		// 中文输出中 Edition 与 Version 的标签都是 "版本"，第二次出现的为 Edition
+		if img.Edition == "" && len(rec.dups["version"]) > 0 {
+			img.Edition = rec.dups["version"][0]
+		}
+
+		bootable := strings.ToLower(rec.get("bootable"))
+		img.Bootable = bootable == "yes" || bootable == "是"
+
+		img.ServicePackBuild = int(parseInt(rec.get("spbuild")))
+		img.ServicePackLevel = int(parseInt(rec.get("splevel")))
+		img.Directories = int(parseInt(rec.get("directories")))
+		img.Files = int(parseInt(rec.get("files")))
+
+		img.Languages, img.DefaultLanguage = parseLanguages(rec)
+
+		images = append(images, img)
+	}
+
+	if len(images) == 0 {
+		return nil, fmt.Errorf("DISM输出中没有镜像信息")
+	}
+
+	return images, nil
+}
+
+// parseLanguages 解析 Languages 下的语言列表
+// 形如 "en-US (Default)" 或 "zh-CN (默认)"
+func parseLanguages(rec *record) ([]string, string) {
+	var languages []string
+	defaultLang := ""
+
+	entries := rec.extra["languages"]
+	if v := rec.get("languages"); v != "" {
+		entries = append([]string{v}, entries...)
+	}
+
+	for _, entry := range entries {
+		fields := strings.Fields(entry)
+		if len(fields) == 0 || !isLanguageTag(fields[0]) {
+			continue
+		}
+		languages = append(languages, fields[0])
+		if len(fields) > 1 && (strings.Contains(strings.ToLower(entry), "default") || strings.Contains(entry, "默认")) {
+			defaultLang = fields[0]
+		}
+	}
+
+	if defaultLang == "" && len(languages) > 0 {
+		defaultLang = languages[0]
+	}
+
+	return languages, defaultLang
+}
+
+// Indices 返回所有镜像的索引
+func Indices(images []*WimImage) []int {
+	indices := make([]int, 0, len(images))
+	for _, img := range images {
+		indices = append(indices, img.Index)
+	}
+	return indices
+}
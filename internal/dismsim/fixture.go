@@ -0,0 +1,238 @@
+package dismsim
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// DefaultInstallImage 返回一个具有代表性的 Windows 11 安装镜像
+// 包含各精简步骤会处理的应用、系统包、文件夹、字体、驱动和服务
+func DefaultInstallImage(index int, name string) *Image {
+	img := &Image{
+		Index:           index,
+		Name:            name,
+		Description:     name,
+		Architecture:    "x64",
+		Version:         "10.0.22631",
+		Edition:         "Professional",
+		Languages:       []string{"en-US"},
+		DefaultLanguage: "en-US",
+		Size:            16479089025,
+		Dirs: []string{
+			"Windows/System32/Sysprep",
+			"Windows/Temp",
+			"Users/Public",
+		},
+		Files: map[string]string{
+			"Windows/explorer.exe":                          "MZ",
+			"Windows/System32/ntoskrnl.exe":                 "MZ",
+			"Windows/System32/OneDriveSetup.exe":            "MZ",
+			"Windows/System32/Recovery/winre.wim":           "WINRE",
+			"Windows/System32/Microsoft-Edge-Webview/x.dll": "MZ",
+			"Windows/System32/Tasks/Microsoft/Windows/Application Experience/Microsoft Compatibility Appraiser": "<Task/>",
+			"Windows/System32/Tasks/Microsoft/Windows/Customer Experience Improvement Program/Consolidator":     "<Task/>",
+			"Windows/System32/Tasks/Microsoft/Windows/Chkdsk/Proxy":                                             "<Task/>",
+			"Windows/System32/Tasks/Microsoft/Windows/Windows Error Reporting/QueueReporting":                   "<Task/>",
+
+			"Windows/WinSxS/Manifests/amd64_microsoft-windows-servicingstack_31bf3856ad364e35_10.0.22621.1_none.manifest": "<assembly/>",
+			"Windows/WinSxS/amd64_microsoft-windows-servicingstack_31bf3856ad364e35_10.0.22621.1_none/cbscore.dll":        "MZ",
+			"Windows/WinSxS/amd64_microsoft.windows.common-controls_6595b64144ccf1df_6.0.22621.1_none/comctl32.dll":       "MZ",
+			"Windows/WinSxS/amd64_microsoft-edge-webview_31bf3856ad364e35_10.0.22621.1_none/msedgewebview2.exe":           "MZ",
+			"Windows/WinSxS/amd64_microsoft-windows-mediaplayer_31bf3856ad364e35_10.0.22621.1_none/wmplayer.exe":          "MZ",
+			"Windows/WinSxS/Backup/old.manifest": "<assembly/>",
+
+			"Windows/assembly/NativeImages_v4.0.30319_64/mscorlib/mscorlib.ni.dll": "MZ",
+			"Windows/assembly/GAC_MSIL/System/System.dll":                          "MZ",
+
+			"Windows/System32/DriverStore/FileRepository/prnms001.inf_amd64_1/prnms001.inf": "[Version]",
+			"Windows/System32/DriverStore/FileRepository/scanner.inf_amd64_1/scanner.inf":   "[Version]",
+			"Windows/System32/DriverStore/FileRepository/usb.inf_amd64_1/usb.inf":           "[Version]",
+			"Windows/System32/DriverStore/FileRepository/netrtwlane.inf_amd64_1/net.inf":    "[Version]",
+
+			"Windows/Fonts/segoeui.ttf":  "FONT",
+			"Windows/Fonts/arial.ttf":    "FONT",
+			"Windows/Fonts/consola.ttf":  "FONT",
+			"Windows/Fonts/marlett.ttf":  "FONT",
+			"Windows/Fonts/comic.ttf":    "FONT",
+			"Windows/Fonts/msyh.ttc":     "FONT",
+			"Windows/Fonts/gadugi.ttf":   "FONT",
+			"Windows/Fonts/webdings.ttf": "FONT",
+
+			"Windows/Speech/Engines/TTS/en-US/voice.dat":                         "TTS",
+			"Windows/System32/InputMethod/CHS/ChsIME.exe":                        "MZ",
+			"Windows/System32/InputMethod/JPN/imjp.dll":                          "MZ",
+			"Windows/Web/Wallpaper/Windows/img0.jpg":                             "JPEG",
+			"Windows/Help/en-US/help.chm":                                        "CHM",
+			"Windows/Cursors/aero_arrow.cur":                                     "CUR",
+			"ProgramData/Microsoft/Windows Defender/Definition Updates/mpasbase": "VDM",
+
+			"Program Files (x86)/Microsoft/Edge/Application/msedge.exe":        "MZ",
+			"Program Files (x86)/Microsoft/EdgeUpdate/MicrosoftEdgeUpdate.exe": "MZ",
+			"Program Files (x86)/Microsoft/EdgeCore/120.0/msedge.dll":          "MZ",
+
+			"Program Files/WindowsApps/Microsoft.BingNews_4.2.27001.0_x64__8wekyb3d8bbwe/AppxManifest.xml":              "<Package/>",
+			"Program Files/WindowsApps/Microsoft.GamingApp_2021.427.138.0_x64__8wekyb3d8bbwe/AppxManifest.xml":          "<Package/>",
+			"Program Files/WindowsApps/Microsoft.Windows.Photos_2022.31070.26005.0_x64__8wekyb3d8bbwe/AppxManifest.xml": "<Package/>",
+			"Program Files/WindowsApps/Microsoft.WindowsStore_22204.1400.4.0_x64__8wekyb3d8bbwe/AppxManifest.xml":       "<Package/>",
+
+			"Windows/System32/config/SYSTEM":     mustHive(defaultSystemHive()),
+			"Windows/System32/config/SOFTWARE":   mustHive(Hive{"Microsoft\\Windows\\CurrentVersion": {}}),
+			"Windows/System32/config/DEFAULT":    mustHive(Hive{}),
+			"Windows/System32/config/COMPONENTS": mustHive(Hive{}),
+			"Users/Default/NTUSER.DAT":           mustHive(Hive{"Software\\Microsoft\\Windows\\CurrentVersion\\ContentDeliveryManager\\Subscriptions": {}}),
+		},
+		ProvisionedAppx: []string{
+			"Clipchamp.Clipchamp_2.2.8.0_neutral_~_yxz26nhyzhsrt",
+			"Microsoft.BingNews_4.2.27001.0_neutral_~_8wekyb3d8bbwe",
+			"Microsoft.BingWeather_4.53.33420.0_neutral_~_8wekyb3d8bbwe",
+			"Microsoft.Copilot_1.0.3.0_neutral_~_8wekyb3d8bbwe",
+			"Microsoft.GamingApp_2021.427.138.0_neutral_~_8wekyb3d8bbwe",
+			"Microsoft.GetHelp_10.2204.1222.0_neutral_~_8wekyb3d8bbwe",
+			"Microsoft.MicrosoftSolitaireCollection_4.12.3171.0_neutral_~_8wekyb3d8bbwe",
+			"Microsoft.OutlookForWindows_1.0.0.0_neutral_~_8wekyb3d8bbwe",
+			"Microsoft.Paint_11.2302.20.0_neutral_~_8wekyb3d8bbwe",
+			"Microsoft.Windows.Photos_2022.31070.26005.0_neutral_~_8wekyb3d8bbwe",
+			"Microsoft.WindowsCalculator_2020.2103.8.0_neutral_~_8wekyb3d8bbwe",
+			"Microsoft.WindowsNotepad_11.2302.26.0_neutral_~_8wekyb3d8bbwe",
+			"Microsoft.WindowsStore_22204.1400.4.0_neutral_~_8wekyb3d8bbwe",
+			"Microsoft.WindowsTerminal_3001.12.10983.0_neutral_~_8wekyb3d8bbwe",
+			"Microsoft.DesktopAppInstaller_2022.310.2333.0_neutral_~_8wekyb3d8bbwe",
+			"Microsoft.SecHealthUI_1000.22621.1.0_x64__8wekyb3d8bbwe",
+			"Microsoft.YourPhone_1.22022.147.0_neutral_~_8wekyb3d8bbwe",
+			"Microsoft.ZuneMusic_11.2202.46.0_neutral_~_8wekyb3d8bbwe",
+		},
+		Packages: []Package{
+			{"Microsoft-Windows-Foundation-Package~31bf3856ad364e35~amd64~~10.0.22621.1", "Installed", "Foundation"},
+			{"Microsoft-Windows-InternetExplorer-Optional-Package~31bf3856ad364e35~amd64~~11.0.22621.1", "Installed", "OnDemand Pack"},
+			{"Microsoft-Windows-Kernel-LA57-FoD-Package~31bf3856ad364e35~amd64~~10.0.22621.1", "Installed", "OnDemand Pack"},
+			{"Microsoft-Windows-LanguageFeatures-Handwriting-en-us-Package~31bf3856ad364e35~amd64~~10.0.22621.1", "Installed", "OnDemand Pack"},
+			{"Microsoft-Windows-LanguageFeatures-OCR-en-us-Package~31bf3856ad364e35~amd64~~10.0.22621.1", "Installed", "OnDemand Pack"},
+			{"Microsoft-Windows-LanguageFeatures-Speech-en-us-Package~31bf3856ad364e35~amd64~~10.0.22621.1", "Installed", "OnDemand Pack"},
+			{"Microsoft-Windows-MediaPlayer-Package~31bf3856ad364e35~amd64~~10.0.22621.1", "Installed", "OnDemand Pack"},
+			{"Microsoft-Windows-WordPad-FoD-Package~31bf3856ad364e35~amd64~~10.0.22621.1", "Installed", "OnDemand Pack"},
+			{"Windows-Defender-Client-Package~31bf3856ad364e35~amd64~~10.0.22621.1", "Installed", "Feature Pack"},
+			{"OpenSSH-Client-Package~31bf3856ad364e35~amd64~~10.0.22621.1", "Installed", "OnDemand Pack"},
+			{"Package_for_RollupFix~31bf3856ad364e35~amd64~~22621.2861.1.6", "Installed", "Security Update"},
+		},
+		Features: []Feature{
+			{"NetFx3", "Disabled"},
+			{"Microsoft-Windows-Subsystem-Linux", "Disabled"},
+			{"SMB1Protocol", "Disabled"},
+		},
+		Capabilities: []Feature{
+			{"Browser.InternetExplorer~~~~0.0.11.0", "Installed"},
+			{"Language.Basic~~~en-US~0.0.1.0", "Installed"},
+			{"OpenSSH.Client~~~~0.0.1.0", "Installed"},
+		},
+	}
+	return img
+}
+
+// DefaultBootImages 返回 boot.wim 的两个镜像 (WinPE 与 Windows Setup)
+func DefaultBootImages() []*Image {
+	pe := &Image{
+		Index:           1,
+		Name:            "Microsoft Windows PE (amd64)",
+		Description:     "Microsoft Windows PE (amd64)",
+		Architecture:    "x64",
+		Version:         "10.0.22621",
+		Edition:         "WindowsPE",
+		Languages:       []string{"en-US"},
+		DefaultLanguage: "en-US",
+		Size:            1824507852,
+		Files: map[string]string{
+			"Windows/System32/winpeshl.ini":      "[LaunchApps]",
+			"Windows/System32/config/SYSTEM":     mustHive(Hive{"Setup": {}}),
+			"Windows/System32/config/SOFTWARE":   mustHive(Hive{}),
+			"Windows/System32/config/DEFAULT":    mustHive(Hive{}),
+			"Windows/System32/config/COMPONENTS": mustHive(Hive{}),
+			"Users/Default/NTUSER.DAT":           mustHive(Hive{}),
+		},
+	}
+
+	setup := pe.Clone()
+	setup.Index = 2
+	setup.Name = "Microsoft Windows Setup (amd64)"
+	setup.Description = "Microsoft Windows Setup (amd64)"
+	setup.Files["sources/setup.exe"] = "MZ"
+
+	return []*Image{pe, setup}
+}
+
+// defaultSystemHive SYSTEM 配置单元中 Nano 模式会删除的服务
+func defaultSystemHive() Hive {
+	hive := Hive{"Setup": {}}
+	for _, svc := range []string{
+		"Spooler", "PrintNotify", "Fax", "RemoteRegistry", "diagsvc", "WerSvc",
+		"PcaSvc", "MapsBroker", "WalletService", "wuauserv", "UsoSvc", "WaaSMedicSvc",
+		"DiagTrack", "dmwappushservice", "Audiosrv", "EventLog",
+	} {
+		hive["ControlSet001\\Services\\"+svc] = map[string]RegValue{
+			"Start": {Type: "REG_DWORD", Data: "2"},
+		}
+	}
+	return hive
+}
+
+func mustHive(h Hive) string {
+	data, err := json.Marshal(h)
+	if err != nil {
+		panic(err)
+	}
+	return string(data)
+}
+
+// WriteISOFixture 在目录中生成模拟的 Windows 11 安装介质
+// 结构与真实 ISO 一致: boot/, efi/, sources/boot.wim, sources/install.wim
+func WriteISOFixture(dir string) error {
+	files := map[string]string{
+		"bootmgr":                       "BOOTMGR",
+		"bootmgr.efi":                   "MZ",
+		"setup.exe":                     "MZ",
+		"autorun.inf":                   "[AutoRun.Amd64]\nopen=setup.exe\n",
+		"boot/etfsboot.com":             "ETFSBOOT",
+		"boot/bcd":                      "BCD",
+		"efi/boot/bootx64.efi":          "MZ",
+		"efi/microsoft/boot/efisys.bin": "EFISYS",
+		"efi/microsoft/boot/bcd":        "BCD",
+		"sources/setup.exe":             "MZ",
+		"sources/lang.ini":              "[Available UI Languages]\nen-US = 3\n",
+		"support/logging/readme.txt":    "logging",
+	}
+
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			return err
+		}
+	}
+
+	boot := &WimFile{Images: DefaultBootImages()}
+	if err := boot.Write(filepath.Join(dir, "sources", "boot.wim"), 0); err != nil {
+		return err
+	}
+
+	install := &WimFile{Images: []*Image{
+		DefaultInstallImage(1, "Windows 11 Home"),
+		DefaultInstallImage(2, "Windows 11 Pro"),
+	}}
+	install.Images[0].Edition = "Core"
+	return install.Write(filepath.Join(dir, "sources", "install.wim"), 0)
+}
+
+// ReadHive 读取模拟的配置单元文件
+func ReadHive(path string) (Hive, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var h Hive
+	if err := json.Unmarshal(data, &h); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
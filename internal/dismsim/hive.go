@@ -0,0 +1,36 @@
+package dismsim
+
+import (
+	"bytes"
+	"encoding/json"
+
+	reg "tiny11-builder/internal/registry"
+)
+
+func init() {
+	reg.RegisterHiveDecoder(hiveDecoder{})
+}
+
+// hiveDecoder 让注册表差异 (regdiff) 读取模拟的配置单元文件
+type hiveDecoder struct{}
+
+// DecodeHive 解析 JSON 格式的 Hive，损坏的文件返回错误而不是空的配置单元
+func (hiveDecoder) DecodeHive(data []byte) (map[string]map[string]reg.HiveValue, bool, error) {
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		return nil, false, nil
+	}
+	var h Hive
+	if err := json.Unmarshal(data, &h); err != nil {
+		return nil, true, err
+	}
+
+	keys := make(map[string]map[string]reg.HiveValue, len(h))
+	for sub, values := range h {
+		k := make(map[string]reg.HiveValue, len(values))
+		for name, v := range values {
+			k[name] = reg.HiveValue{Type: v.Type, Data: v.Data}
+		}
+		keys[sub] = k
+	}
+	return keys, true, nil
+}
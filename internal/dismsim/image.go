@@ -0,0 +1,312 @@
+package dismsim
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"tiny11-builder/internal/wim"
+)
+
+// WimFile 模拟的 WIM 文件
+// 磁盘格式: 真实的 WIM 文件头 + XML 元数据，随后是 JSON 描述的镜像内容，
+// 因此 wim 包可以像读取真实文件一样读取模拟文件的元数据
+type WimFile struct {
+	Images []*Image `json:"images"`
+}
+
+// Image 模拟 WIM 中的一个镜像
+type Image struct {
+	Index           int               `json:"index"`
+	Name            string            `json:"name"`
+	Description     string            `json:"description"`
+	Architecture    string            `json:"architecture"`
+	Version         string            `json:"version"`
+	Edition         string            `json:"edition"`
+	Languages       []string          `json:"languages"`
+	DefaultLanguage string            `json:"defaultLanguage"`
+	Size            int64             `json:"size"`
+	Dirs            []string          `json:"dirs"`
+	Files           map[string]string `json:"files"`
+	ProvisionedAppx []string          `json:"provisionedAppx"`
+	Packages        []Package         `json:"packages"`
+	Features        []Feature         `json:"features"`
+	Capabilities    []Feature         `json:"capabilities"`
+}
+
+// Package 系统组件包
+type Package struct {
+	Identity    string `json:"identity"`
+	State       string `json:"state"`
+	ReleaseType string `json:"releaseType"`
+}
+
+// Feature 可选功能或按需功能 (Capability)
+type Feature struct {
+	Name  string `json:"name"`
+	State string `json:"state"`
+}
+
+// ReadWim 读取模拟 WIM 文件
+// 文件尾部可能有稀疏填充，只解析第一个 JSON 值
+func ReadWim(path string) (*WimFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := wim.Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("无效的WIM文件 %s: %w", path, err)
+	}
+
+	if _, err := f.Seek(info.Header.XMLData.Offset+info.Header.XMLData.Size, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	var w WimFile
+	if err := json.NewDecoder(f).Decode(&w); err != nil {
+		return nil, fmt.Errorf("无效的模拟WIM文件 %s: %w", path, err)
+	}
+	return &w, nil
+}
+
+// Write 写入模拟 WIM 文件，不足 minSize 时稀疏填充到 minSize
+func (w *WimFile) Write(path string, minSize int64) error {
+	payload, err := json.Marshal(w)
+	if err != nil {
+		return err
+	}
+
+	var meta []*wim.Image
+	for _, img := range w.Images {
+		meta = append(meta, img.metadata())
+	}
+	xmlData, err := wim.EncodeXML(meta)
+	if err != nil {
+		return err
+	}
+
+	header, err := wim.NewHeader(len(w.Images), int64(len(xmlData))).MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	for _, part := range [][]byte{header, xmlData, payload} {
+		if _, err := f.Write(part); err != nil {
+			return err
+		}
+	}
+
+	size := int64(len(header) + len(xmlData) + len(payload))
+	if size < minSize {
+		return f.Truncate(minSize)
+	}
+	return nil
+}
+
+// metadata 转换为 WIM XML 中的镜像元数据
+func (img *Image) metadata() *wim.Image {
+	build := ""
+	if parts := strings.Split(img.Version, "."); len(parts) >= 3 {
+		build = parts[2]
+	}
+	return &wim.Image{
+		Index:           img.Index,
+		Name:            img.Name,
+		Description:     img.Description,
+		DisplayName:     img.Name,
+		Flags:           img.Edition,
+		Edition:         img.Edition,
+		Architecture:    img.Architecture,
+		ProductType:     "WinNT",
+		Installation:    "Client",
+		Languages:       img.Languages,
+		DefaultLanguage: img.DefaultLanguage,
+		Version:         img.Version,
+		Build:           build,
+		DirCount:        len(img.Dirs),
+		FileCount:       len(img.Files),
+		TotalBytes:      img.Size,
+	}
+}
+
+// Image 按索引获取镜像
+func (w *WimFile) Image(index int) *Image {
+	for _, img := range w.Images {
+		if img.Index == index {
+			return img
+		}
+	}
+	return nil
+}
+
+// Clone 深拷贝镜像
+func (img *Image) Clone() *Image {
+	data, _ := json.Marshal(img)
+	var c Image
+	json.Unmarshal(data, &c)
+	return &c
+}
+
+// HasFile 检查镜像中是否存在文件 (路径使用 / 分隔，不区分大小写)
+func (img *Image) HasFile(rel string) bool {
+	rel = normalizePath(rel)
+	for name := range img.Files {
+		if strings.EqualFold(name, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasDir 检查镜像中是否存在目录或以该目录为前缀的文件
+func (img *Image) HasDir(rel string) bool {
+	prefix := strings.ToLower(normalizePath(rel)) + "/"
+	for _, d := range img.Dirs {
+		if strings.EqualFold(d, normalizePath(rel)) {
+			return true
+		}
+	}
+	for name := range img.Files {
+		if strings.HasPrefix(strings.ToLower(name), prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasAppx 检查是否存在匹配前缀的预装应用
+func (img *Image) HasAppx(prefix string) bool {
+	for _, pkg := range img.ProvisionedAppx {
+		if strings.HasPrefix(pkg, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasPackage 检查是否存在匹配前缀的系统包
+func (img *Image) HasPackage(prefix string) bool {
+	for _, pkg := range img.Packages {
+		if strings.HasPrefix(pkg.Identity, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// materialize 将镜像内容写入挂载目录
+func (img *Image) materialize(dir string) error {
+	for _, d := range img.Dirs {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.FromSlash(d)), 0755); err != nil {
+			return err
+		}
+	}
+
+	for name, content := range img.Files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// capture 从挂载目录重新读取镜像文件树
+func (img *Image) capture(dir string) error {
+	dirs := []string{}
+	files := map[string]string{}
+	var size int64
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		if rel == "." {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+
+		if info.IsDir() {
+			dirs = append(dirs, rel)
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		files[rel] = string(data)
+		size += info.Size()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.Strings(dirs)
+	img.Dirs = dirs
+	img.Files = files
+	img.Size = size
+	return nil
+}
+
+func normalizePath(p string) string {
+	p = strings.ReplaceAll(p, "\\", "/")
+	return strings.Trim(p, "/")
+}
+
+// hostPath 将 Windows 风格路径转换为本机路径
+// 非 Windows 平台上替换 \ 分隔符，并按不区分大小写的方式逐级匹配已存在的路径
+func hostPath(p string) string {
+	if filepath.Separator == '\\' || p == "" {
+		return p
+	}
+	p = filepath.Clean(strings.ReplaceAll(p, "\\", "/"))
+	if _, err := os.Stat(p); err == nil {
+		return p
+	}
+
+	parts := strings.Split(p, "/")
+	cur := parts[0]
+	if cur == "" {
+		cur = "/"
+	}
+	for i, part := range parts[1:] {
+		next := filepath.Join(cur, part)
+		if _, err := os.Stat(next); err != nil {
+			entries, _ := os.ReadDir(cur)
+			for _, e := range entries {
+				if strings.EqualFold(e.Name(), part) {
+					next = filepath.Join(cur, e.Name())
+					break
+				}
+			}
+		}
+		cur = next
+		if i == len(parts)-2 {
+			break
+		}
+	}
+	return cur
+}
@@ -0,0 +1,325 @@
+package dismsim
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"tiny11-builder/internal/utils"
+)
+
+// Hive 模拟的注册表配置单元文件内容
+// 键路径 (相对于配置单元根，\ 分隔) -> 值名称 -> 值
+type Hive map[string]map[string]RegValue
+
+// RegValue 注册表值
+type RegValue struct {
+	Type string `json:"type"`
+	Data string `json:"data"`
+}
+
+// registry 内存中的注册表，模拟 reg load/add/delete/query/unload
+type registry struct {
+	// keys 小写完整键路径 -> 值 (值名称小写)
+	keys map[string]*regKey
+	// hives 已加载配置单元的小写根路径 -> 文件路径
+	hives map[string]string
+}
+
+type regKey struct {
+	path   string
+	values map[string]*regEntry
+}
+
+type regEntry struct {
+	name string
+	RegValue
+}
+
+func newRegistry() *registry {
+	return &registry{
+		keys:  make(map[string]*regKey),
+		hives: make(map[string]string),
+	}
+}
+
+const (
+	regErrNotFound = "ERROR: The system was unable to find the specified registry key or value."
+	regSuccess     = "The operation completed successfully.\n"
+)
+
+func (r *registry) run(args []string) *utils.CommandResult {
+	if len(args) < 2 {
+		return fail(1, "ERROR: Invalid syntax.")
+	}
+
+	op := strings.ToLower(args[0])
+	key := normalizeKey(args[1])
+	opts := regArgs(args[2:])
+
+	switch op {
+	case "load":
+		if len(args) < 3 {
+			return fail(1, "ERROR: Invalid syntax.")
+		}
+		return r.load(key, hostPath(args[2]))
+	case "unload":
+		return r.unload(key)
+	case "add":
+		return r.add(key, opts)
+	case "delete":
+		return r.delete(key, opts)
+	case "query":
+		return r.query(key, opts)
+	}
+
+	return fail(1, "ERROR: Invalid syntax.")
+}
+
+// regArgs 解析 /v /t /d /f /ve 等参数
+func regArgs(args []string) map[string]string {
+	opts := make(map[string]string)
+	for i := 0; i < len(args); i++ {
+		arg := strings.ToLower(args[i])
+		switch arg {
+		case "/v", "/t", "/d":
+			if i+1 < len(args) {
+				opts[arg] = args[i+1]
+				i++
+			}
+		default:
+			opts[arg] = ""
+		}
+	}
+	return opts
+}
+
+// normalizeKey 统一根键缩写
+func normalizeKey(key string) string {
+	key = strings.Trim(key, "\\")
+	root, rest, _ := strings.Cut(key, "\\")
+	switch strings.ToUpper(root) {
+	case "HKEY_LOCAL_MACHINE":
+		root = "HKLM"
+	case "HKEY_CURRENT_USER":
+		root = "HKCU"
+	default:
+		root = strings.ToUpper(root)
+	}
+	if rest == "" {
+		return root
+	}
+	return root + "\\" + rest
+}
+
+func (r *registry) ensureKey(path string) *regKey {
+	// 创建键时同时创建所有父键
+	parts := strings.Split(path, "\\")
+	var k *regKey
+	for i := range parts {
+		p := strings.Join(parts[:i+1], "\\")
+		lower := strings.ToLower(p)
+		if k = r.keys[lower]; k == nil {
+			k = &regKey{path: p, values: make(map[string]*regEntry)}
+			r.keys[lower] = k
+		}
+	}
+	return k
+}
+
+func (r *registry) load(root, file string) *utils.CommandResult {
+	lower := strings.ToLower(root)
+	if _, loaded := r.hives[lower]; loaded {
+		return fail(1, "ERROR: The process cannot access the file because it is being used by another process.")
+	}
+	if !utils.FileExists(file) {
+		return fail(1, "ERROR: The system cannot find the file specified.")
+	}
+
+	r.hives[lower] = file
+	r.ensureKey(root)
+
+	// 配置单元文件为 JSON 时导入其中的键值，否则视为空配置单元
+	data, _ := os.ReadFile(file)
+	var hive Hive
+	if json.Unmarshal(data, &hive) == nil {
+		for sub, values := range hive {
+			k := r.ensureKey(root + "\\" + sub)
+			for name, v := range values {
+				k.values[strings.ToLower(name)] = &regEntry{name: name, RegValue: v}
+			}
+		}
+	}
+
+	return ok(regSuccess)
+}
+
+func (r *registry) unload(root string) *utils.CommandResult {
+	lower := strings.ToLower(root)
+	file, loaded := r.hives[lower]
+	if !loaded {
+		return fail(1, "ERROR: The parameter is incorrect.")
+	}
+
+	// 将配置单元下的键值写回文件并从内存中移除
+	hive := Hive{}
+	prefix := lower + "\\"
+	for k, key := range r.keys {
+		if k != lower && !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		if k != lower {
+			sub := key.path[len(root)+1:]
+			values := make(map[string]RegValue)
+			for _, e := range key.values {
+				values[e.name] = e.RegValue
+			}
+			hive[sub] = values
+		}
+		delete(r.keys, k)
+	}
+	delete(r.hives, lower)
+
+	data, err := json.MarshalIndent(hive, "", "  ")
+	if err != nil {
+		return fail(1, "ERROR: "+err.Error())
+	}
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		return fail(1, "ERROR: Access is denied.")
+	}
+
+	return ok(regSuccess)
+}
+
+func (r *registry) add(path string, opts map[string]string) *utils.CommandResult {
+	k := r.ensureKey(path)
+
+	name, hasName := opts["/v"]
+	if _, ve := opts["/ve"]; ve {
+		name, hasName = "", true
+	}
+	if !hasName {
+		return ok(regSuccess)
+	}
+
+	typ := opts["/t"]
+	if typ == "" {
+		typ = "REG_SZ"
+	}
+	k.values[strings.ToLower(name)] = &regEntry{
+		name:     name,
+		RegValue: RegValue{Type: strings.ToUpper(typ), Data: opts["/d"]},
+	}
+	return ok(regSuccess)
+}
+
+func (r *registry) delete(path string, opts map[string]string) *utils.CommandResult {
+	lower := strings.ToLower(path)
+	k := r.keys[lower]
+	if k == nil {
+		return fail(1, regErrNotFound)
+	}
+
+	name, hasName := opts["/v"]
+	if _, ve := opts["/ve"]; ve {
+		name, hasName = "", true
+	}
+	if hasName {
+		if _, found := k.values[strings.ToLower(name)]; !found {
+			return fail(1, regErrNotFound)
+		}
+		delete(k.values, strings.ToLower(name))
+		return ok(regSuccess)
+	}
+
+	prefix := lower + "\\"
+	for key := range r.keys {
+		if key == lower || strings.HasPrefix(key, prefix) {
+			delete(r.keys, key)
+		}
+	}
+	return ok(regSuccess)
+}
+
+func (r *registry) query(path string, opts map[string]string) *utils.CommandResult {
+	k := r.keys[strings.ToLower(path)]
+	if k == nil {
+		return fail(1, regErrNotFound)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n%s\n", k.path)
+
+	name, hasName := opts["/v"]
+	if _, ve := opts["/ve"]; ve {
+		name, hasName = "", true
+	}
+	if hasName {
+		e := k.values[strings.ToLower(name)]
+		if e == nil {
+			return fail(1, regErrNotFound)
+		}
+		fmt.Fprintf(&b, "    %s    %s    %s\n", e.name, e.Type, formatRegData(e.RegValue))
+		return ok(b.String() + "\n")
+	}
+
+	names := make([]string, 0, len(k.values))
+	for n := range k.values {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		e := k.values[n]
+		fmt.Fprintf(&b, "    %s    %s    %s\n", e.name, e.Type, formatRegData(e.RegValue))
+	}
+
+	// 与 reg 一致，值之后以完整路径列出直接子键
+	if subkeys := r.subkeys(k); len(subkeys) > 0 {
+		b.WriteString("\n")
+		for _, sub := range subkeys {
+			fmt.Fprintf(&b, "%s\n", sub)
+		}
+	}
+	return ok(b.String() + "\n")
+}
+
+// subkeys 返回键的直接子键路径 (已排序)
+func (r *registry) subkeys(k *regKey) []string {
+	prefix := strings.ToLower(k.path) + "\\"
+	var subkeys []string
+	for lower, sub := range r.keys {
+		if strings.HasPrefix(lower, prefix) && !strings.Contains(lower[len(prefix):], "\\") {
+			subkeys = append(subkeys, sub.path)
+		}
+	}
+	sort.Slice(subkeys, func(i, j int) bool {
+		return strings.ToLower(subkeys[i]) < strings.ToLower(subkeys[j])
+	})
+	return subkeys
+}
+
+// formatRegData 按 reg query 的格式输出数据 (DWORD 以十六进制显示)
+func formatRegData(v RegValue) string {
+	if v.Type == "REG_DWORD" || v.Type == "REG_QWORD" {
+		var n uint64
+		if _, err := fmt.Sscanf(v.Data, "0x%x", &n); err != nil {
+			fmt.Sscanf(v.Data, "%d", &n)
+		}
+		return fmt.Sprintf("0x%x", n)
+	}
+	return v.Data
+}
+
+func (r *registry) get(key, name string) (string, string, bool) {
+	k := r.keys[strings.ToLower(normalizeKey(key))]
+	if k == nil {
+		return "", "", false
+	}
+	e := k.values[strings.ToLower(name)]
+	if e == nil {
+		return "", "", false
+	}
+	return e.Type, e.Data, true
+}
@@ -0,0 +1,575 @@
+// Package dismsim 模拟 DISM 及相关系统命令，用于在非 Windows 环境下端到端运行构建流程
+//
+// WIM 文件以 JSON 描述 (见 WimFile)，挂载时展开为真实目录树，
+// 卸载提交时重新扫描目录树写回 WIM 文件。
+package dismsim
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"tiny11-builder/internal/utils"
+)
+
+// DefaultMinWimSize 导出 WIM 的默认最小体积，满足构建器对导出文件大小的校验
+const DefaultMinWimSize = 128 * 1024 * 1024
+
+// Simulator 模拟的命令执行器，实现 utils.CommandRunner
+type Simulator struct {
+	// MinWimSize 导出/提交 WIM 时稀疏填充到的最小体积
+	MinWimSize int64
+
+	mu       sync.Mutex
+	mounts   map[string]*mount
+	registry *registry
+	history  []*utils.CommandResult
+}
+
+type mount struct {
+	dir      string
+	wimPath  string
+	index    int
+	readOnly bool
+	image    *Image
+}
+
+// New 创建模拟执行器
+func New() *Simulator {
+	return &Simulator{
+		MinWimSize: DefaultMinWimSize,
+		mounts:     make(map[string]*mount),
+		registry:   newRegistry(),
+	}
+}
+
+// Offline 模拟执行器不会修改真实系统
+func (s *Simulator) Offline() bool {
+	return true
+}
+
+// History 返回已执行的命令记录
+func (s *Simulator) History() []*utils.CommandResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*utils.CommandResult(nil), s.history...)
+}
+
+// Mounted 返回挂载目录当前对应的镜像 (未挂载返回 nil)
+func (s *Simulator) Mounted(dir string) *Image {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if m := s.mounts[mountKey(dir)]; m != nil {
+		return m.image
+	}
+	return nil
+}
+
+// RegistryValue 查询模拟注册表中的值
+func (s *Simulator) RegistryValue(key, name string) (typ, data string, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.registry.get(key, name)
+}
+
+// Run 执行模拟命令
+func (s *Simulator) Run(name string, args ...string) (*utils.CommandResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var result *utils.CommandResult
+	switch commandName(name) {
+	case "dism":
+		result = s.runDISM(args)
+	case "reg":
+		result = s.registry.run(args)
+	case "takeown", "icacls":
+		result = ok("")
+	default:
+		result = fail(1, fmt.Sprintf("模拟器不支持的命令: %s", name))
+	}
+
+	result.Name = name
+	result.Args = args
+	s.history = append(s.history, result)
+
+	if result.ExitCode != 0 {
+		return result, fmt.Errorf("exit status %d", result.ExitCode)
+	}
+	return result, nil
+}
+
+// commandName 提取小写且不带扩展名的命令名
+func commandName(name string) string {
+	name = strings.ReplaceAll(name, "\\", "/")
+	name = strings.ToLower(filepath.Base(name))
+	return strings.TrimSuffix(name, ".exe")
+}
+
+func ok(stdout string) *utils.CommandResult {
+	return &utils.CommandResult{Stdout: stdout}
+}
+
+func fail(code int, msg string) *utils.CommandResult {
+	return &utils.CommandResult{
+		Stdout:   msg + "\n",
+		Stderr:   msg,
+		ExitCode: code,
+	}
+}
+
+// ==================== DISM ====================
+
+const (
+	dismHeader = "\nDeployment Image Servicing and Management tool\nVersion: 10.0.22621.2792\n\n"
+	dismFooter = "\nThe operation completed successfully.\n"
+
+	errInvalidParam  = 87
+	errNotMounted    = 0xc1420127
+	errAlreadyExists = 0xc1420116
+	errNotFound      = 0x800f080c
+)
+
+// dismArgs 解析 /Key:Value 形式的参数，键名小写
+func dismArgs(args []string) map[string]string {
+	opts := make(map[string]string)
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "/") {
+			continue
+		}
+		key, value, _ := strings.Cut(arg[1:], ":")
+		key = strings.ToLower(key)
+		switch key {
+		case "image", "imagefile", "wimfile", "mountdir", "sourceimagefile", "destinationimagefile":
+			value = hostPath(value)
+		}
+		opts[key] = value
+	}
+	return opts
+}
+
+func dismFail(code int, msg string) *utils.CommandResult {
+	errText := strconv.Itoa(code)
+	if code > 0xffff {
+		errText = fmt.Sprintf("0x%08x", code)
+	}
+	return fail(code&0xff, fmt.Sprintf("%sError: %s\n\n%s", dismHeader, errText, msg))
+}
+
+func (s *Simulator) runDISM(args []string) *utils.CommandResult {
+	opts := dismArgs(args)
+
+	has := func(key string) bool {
+		_, ok := opts[key]
+		return ok
+	}
+
+	switch {
+	case has("get-wiminfo"), has("get-imageinfo"):
+		return s.getWimInfo(opts)
+	case has("mount-image"), has("mount-wim"):
+		return s.mountImage(opts)
+	case has("unmount-image"), has("unmount-wim"):
+		return s.unmountImage(opts)
+	case has("get-mountedimageinfo"), has("get-mountedwiminfo"):
+		return s.getMountedInfo()
+	case has("remount-image"), has("remount-wim"):
+		if s.mounts[mountKey(opts["mountdir"])] == nil {
+			return dismFail(errNotMounted, "The specified mount directory is not mounted: "+opts["mountdir"])
+		}
+		return ok(dismHeader + "Remounting image" + dismFooter)
+	case has("export-image"):
+		return s.exportImage(opts)
+	}
+
+	m, res := s.imageMount(opts)
+	if res != nil {
+		return res
+	}
+
+	switch {
+	case has("get-provisionedappxpackages"):
+		return getProvisionedAppx(m.image)
+	case has("remove-provisionedappxpackage"):
+		return removeProvisionedAppx(m.image, opts["packagename"])
+	case has("get-packages"):
+		return getPackages(m.image)
+	case has("remove-package"):
+		return removePackage(m.image, opts["packagename"])
+	case has("get-features"):
+		return getFeatures(m.image.Features, "Feature Name")
+	case has("enable-feature"):
+		return setFeature(m.image, opts["featurename"], "Enabled")
+	case has("disable-feature"):
+		return setFeature(m.image, opts["featurename"], "Disabled")
+	case has("get-capabilities"):
+		return getFeatures(m.image.Capabilities, "Capability Identity")
+	case has("get-intl"):
+		return getIntl(m.image)
+	case has("cleanup-image"):
+		return cleanupImage(m, opts)
+	}
+
+	return dismFail(errInvalidParam, "The option is unknown.")
+}
+
+// imageMount 根据 /Image: 参数查找已挂载的镜像
+func (s *Simulator) imageMount(opts map[string]string) (*mount, *utils.CommandResult) {
+	dir, ok := opts["image"]
+	if !ok {
+		return nil, dismFail(errInvalidParam, "No image specified. Use /Image or /Online.")
+	}
+	m := s.mounts[mountKey(dir)]
+	if m == nil {
+		return nil, dismFail(errNotMounted, "The specified image is not mounted: "+dir)
+	}
+	return m, nil
+}
+
+func mountKey(dir string) string {
+	return strings.ToLower(filepath.Clean(dir))
+}
+
+func (s *Simulator) getWimInfo(opts map[string]string) *utils.CommandResult {
+	path := opts["wimfile"]
+	if path == "" {
+		path = opts["imagefile"]
+	}
+
+	wim, err := ReadWim(path)
+	if err != nil {
+		return dismFail(2, "The system cannot find the file specified: "+path)
+	}
+
+	var b strings.Builder
+	b.WriteString(dismHeader)
+	fmt.Fprintf(&b, "Details for image : %s\n\n", path)
+
+	if idx := opts["index"]; idx != "" {
+		n, _ := strconv.Atoi(idx)
+		img := wim.Image(n)
+		if img == nil {
+			return dismFail(errInvalidParam, "The specified image index does not exist.")
+		}
+		writeImageDetails(&b, img)
+	} else {
+		for _, img := range wim.Images {
+			fmt.Fprintf(&b, "Index : %d\n", img.Index)
+			fmt.Fprintf(&b, "Name : %s\n", img.Name)
+			fmt.Fprintf(&b, "Description : %s\n", img.Description)
+			fmt.Fprintf(&b, "Size : %s bytes\n\n", formatThousands(img.Size))
+		}
+	}
+
+	b.WriteString(dismFooter)
+	return ok(b.String())
+}
+
+func writeImageDetails(b *strings.Builder, img *Image) {
+	fmt.Fprintf(b, "Index : %d\n", img.Index)
+	fmt.Fprintf(b, "Name : %s\n", img.Name)
+	fmt.Fprintf(b, "Description : %s\n", img.Description)
+	fmt.Fprintf(b, "Size : %s bytes\n", formatThousands(img.Size))
+	b.WriteString("WIM Bootable : No\n")
+	fmt.Fprintf(b, "Architecture : %s\n", img.Architecture)
+	b.WriteString("Hal : <undefined>\n")
+	fmt.Fprintf(b, "Version : %s\n", img.Version)
+	b.WriteString("ServicePack Build : 1\n")
+	b.WriteString("ServicePack Level : 0\n")
+	fmt.Fprintf(b, "Edition : %s\n", img.Edition)
+	b.WriteString("Installation : Client\n")
+	b.WriteString("ProductType : WinNT\n")
+	b.WriteString("ProductSuite : Terminal Server\n")
+	b.WriteString("System Root : WINDOWS\n")
+	fmt.Fprintf(b, "Directories : %d\n", len(img.Dirs))
+	fmt.Fprintf(b, "Files : %d\n", len(img.Files))
+	b.WriteString("Languages :\n")
+	for _, lang := range img.Languages {
+		if lang == img.DefaultLanguage {
+			fmt.Fprintf(b, "        %s (Default)\n", lang)
+		} else {
+			fmt.Fprintf(b, "        %s\n", lang)
+		}
+	}
+}
+
+func (s *Simulator) mountImage(opts map[string]string) *utils.CommandResult {
+	path := opts["imagefile"]
+	if path == "" {
+		path = opts["wimfile"]
+	}
+	dir := opts["mountdir"]
+	index, _ := strconv.Atoi(opts["index"])
+
+	if dir == "" || path == "" {
+		return dismFail(errInvalidParam, "The /ImageFile and /MountDir options are required.")
+	}
+	if s.mounts[mountKey(dir)] != nil {
+		return dismFail(errAlreadyExists, "The specified mount directory is already in use.")
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) > 0 {
+		return dismFail(errAlreadyExists, "The specified mount directory is not empty.")
+	}
+
+	wim, err := ReadWim(path)
+	if err != nil {
+		return dismFail(2, "The system cannot find the file specified: "+path)
+	}
+	img := wim.Image(index)
+	if img == nil {
+		return dismFail(errInvalidParam, "The specified image index does not exist.")
+	}
+
+	img = img.Clone()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return dismFail(5, err.Error())
+	}
+	if err := img.materialize(dir); err != nil {
+		return dismFail(5, err.Error())
+	}
+
+	_, readOnly := opts["readonly"]
+	s.mounts[mountKey(dir)] = &mount{
+		dir:      dir,
+		wimPath:  path,
+		index:    index,
+		readOnly: readOnly,
+		image:    img,
+	}
+
+	return ok(dismHeader + "Mounting image\n[==========================100.0%==========================]" + dismFooter)
+}
+
+func (s *Simulator) unmountImage(opts map[string]string) *utils.CommandResult {
+	dir := opts["mountdir"]
+	m := s.mounts[mountKey(dir)]
+	if m == nil {
+		return dismFail(errNotMounted, "The specified mount directory is not mounted: "+dir)
+	}
+
+	_, commit := opts["commit"]
+	if commit && !m.readOnly {
+		if err := m.image.capture(m.dir); err != nil {
+			return dismFail(5, err.Error())
+		}
+
+		wim, err := ReadWim(m.wimPath)
+		if err != nil {
+			return dismFail(2, err.Error())
+		}
+		for i, img := range wim.Images {
+			if img.Index == m.index {
+				wim.Images[i] = m.image
+			}
+		}
+		if err := wim.Write(m.wimPath, 0); err != nil {
+			return dismFail(5, err.Error())
+		}
+	}
+
+	// 卸载后挂载目录保留为空目录
+	entries, _ := os.ReadDir(m.dir)
+	for _, e := range entries {
+		os.RemoveAll(filepath.Join(m.dir, e.Name()))
+	}
+	delete(s.mounts, mountKey(dir))
+
+	return ok(dismHeader + "Image File : " + m.wimPath + "\nImage Index : " + strconv.Itoa(m.index) +
+		"\nSaving image\n[==========================100.0%==========================]\nUnmounting image" + dismFooter)
+}
+
+func (s *Simulator) getMountedInfo() *utils.CommandResult {
+	var b strings.Builder
+	b.WriteString(dismHeader)
+	b.WriteString("Mounted images:\n\n")
+
+	keys := make([]string, 0, len(s.mounts))
+	for k := range s.mounts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	if len(keys) == 0 {
+		b.WriteString("No mounted images found.\n")
+	}
+	for _, k := range keys {
+		m := s.mounts[k]
+		rw := "Yes"
+		if m.readOnly {
+			rw = "No"
+		}
+		fmt.Fprintf(&b, "Mount Dir : %s\nImage File : %s\nImage Index : %d\nMounted Read/Write : %s\nStatus : Ok\n\n",
+			m.dir, m.wimPath, m.index, rw)
+	}
+
+	b.WriteString(dismFooter)
+	return ok(b.String())
+}
+
+func (s *Simulator) exportImage(opts map[string]string) *utils.CommandResult {
+	src := opts["sourceimagefile"]
+	dst := opts["destinationimagefile"]
+	index, _ := strconv.Atoi(opts["sourceindex"])
+
+	wim, err := ReadWim(src)
+	if err != nil {
+		return dismFail(2, "The system cannot find the file specified: "+src)
+	}
+	img := wim.Image(index)
+	if img == nil {
+		return dismFail(errInvalidParam, "The specified image index does not exist.")
+	}
+
+	out := &WimFile{}
+	if utils.FileExists(dst) {
+		if out, err = ReadWim(dst); err != nil {
+			return dismFail(5, err.Error())
+		}
+	}
+
+	exported := img.Clone()
+	exported.Index = len(out.Images) + 1
+	out.Images = append(out.Images, exported)
+
+	if err := out.Write(dst, s.MinWimSize); err != nil {
+		return dismFail(5, err.Error())
+	}
+
+	return ok(dismHeader + "Exporting image\n[==========================100.0%==========================]" + dismFooter)
+}
+
+func getProvisionedAppx(img *Image) *utils.CommandResult {
+	var b strings.Builder
+	b.WriteString(dismHeader)
+	b.WriteString("Image Version: " + img.Version + "\n\n")
+
+	for _, name := range img.ProvisionedAppx {
+		parts := strings.Split(name, "_")
+		display, version, arch, resource := parts[0], "", "neutral", "~"
+		if len(parts) >= 5 {
+			version, arch, resource = parts[1], parts[2], parts[3]
+		}
+		fmt.Fprintf(&b, "DisplayName : %s\nVersion : %s\nArchitecture : %s\nResourceId : %s\nPackageName : %s\nRegions : None\n\n",
+			display, version, arch, resource, name)
+	}
+
+	b.WriteString(dismFooter)
+	return ok(b.String())
+}
+
+func removeProvisionedAppx(img *Image, name string) *utils.CommandResult {
+	for i, pkg := range img.ProvisionedAppx {
+		if strings.EqualFold(pkg, name) {
+			img.ProvisionedAppx = append(img.ProvisionedAppx[:i], img.ProvisionedAppx[i+1:]...)
+			return ok(dismHeader + "Removing package " + name + dismFooter)
+		}
+	}
+	return dismFail(errNotFound, "The specified package is not provisioned: "+name)
+}
+
+func getPackages(img *Image) *utils.CommandResult {
+	width := len("Package Identity")
+	for _, pkg := range img.Packages {
+		if len(pkg.Identity) > width {
+			width = len(pkg.Identity)
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(dismHeader)
+	b.WriteString("Image Version: " + img.Version + "\n\n")
+	fmt.Fprintf(&b, "%-*s | %-9s | %-13s | %s\n", width, "Package Identity", "State", "Release Type", "Install Time")
+	fmt.Fprintf(&b, "%s | %s | %s | %s\n", strings.Repeat("-", width), strings.Repeat("-", 9), strings.Repeat("-", 13), strings.Repeat("-", 17))
+	for _, pkg := range img.Packages {
+		fmt.Fprintf(&b, "%-*s | %-9s | %-13s | %s\n", width, pkg.Identity, pkg.State, pkg.ReleaseType, "5/7/2022 7:59 AM")
+	}
+
+	b.WriteString(dismFooter)
+	return ok(b.String())
+}
+
+func removePackage(img *Image, name string) *utils.CommandResult {
+	for i, pkg := range img.Packages {
+		if strings.EqualFold(pkg.Identity, name) {
+			img.Packages = append(img.Packages[:i], img.Packages[i+1:]...)
+			return ok(dismHeader + "Processing 1 of 1 - Removing package " + name +
+				"\n[==========================100.0%==========================]" + dismFooter)
+		}
+	}
+	return dismFail(errNotFound, "The specified package is not valid Windows package: "+name)
+}
+
+func getFeatures(list []Feature, label string) *utils.CommandResult {
+	var b strings.Builder
+	b.WriteString(dismHeader)
+
+	for _, f := range list {
+		fmt.Fprintf(&b, "%s : %s\nState : %s\n\n", label, f.Name, f.State)
+	}
+
+	b.WriteString(dismFooter)
+	return ok(b.String())
+}
+
+func setFeature(img *Image, name, state string) *utils.CommandResult {
+	for i, f := range img.Features {
+		if strings.EqualFold(f.Name, name) {
+			img.Features[i].State = state
+			return ok(dismHeader + "[==========================100.0%==========================]" + dismFooter)
+		}
+	}
+	return dismFail(0x800f080c, "Feature name "+name+" is unknown.")
+}
+
+func getIntl(img *Image) *utils.CommandResult {
+	var b strings.Builder
+	b.WriteString(dismHeader)
+	b.WriteString("Reporting offline international settings.\n\n")
+	fmt.Fprintf(&b, "Default system UI language : %s\n", img.DefaultLanguage)
+	fmt.Fprintf(&b, "System locale : %s\n", img.DefaultLanguage)
+	b.WriteString("Installed language(s): ")
+	b.WriteString(strings.Join(img.Languages, ", "))
+	b.WriteString("\n")
+	b.WriteString(dismFooter)
+	return ok(b.String())
+}
+
+func cleanupImage(m *mount, opts map[string]string) *utils.CommandResult {
+	if m.readOnly {
+		return dismFail(0xc1510111, "You do not have permissions to mount and modify this image.")
+	}
+
+	// 组件清理会删除已被取代的组件备份
+	if _, found := opts["startcomponentcleanup"]; found {
+		os.RemoveAll(filepath.Join(m.dir, "Windows", "WinSxS", "Backup"))
+		os.RemoveAll(filepath.Join(m.dir, "Windows", "WinSxS", "Temp"))
+	}
+
+	return ok(dismHeader + "[==========================100.0%==========================]" + dismFooter)
+}
+
+// formatThousands 以千位分隔符格式化数字
+func formatThousands(n int64) string {
+	s := strconv.FormatInt(n, 10)
+	if len(s) <= 3 {
+		return s
+	}
+	var b strings.Builder
+	pre := len(s) % 3
+	if pre > 0 {
+		b.WriteString(s[:pre])
+	}
+	for i := pre; i < len(s); i += 3 {
+		if b.Len() > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(s[i : i+3])
+	}
+	return b.String()
+}
@@ -0,0 +1,161 @@
+package history
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"tiny11-builder/internal/config"
+	"tiny11-builder/internal/logger"
+	"tiny11-builder/internal/profile"
+	"tiny11-builder/internal/types"
+)
+
+// 步骤结束时的状态 (另见 logger.StepFinished、logger.StepSkipped)
+const (
+	StepFailed   = "failed"   // 构建失败时正在执行的步骤
+	StepCanceled = "canceled" // 构建取消时正在执行的步骤
+)
+
+// Recorder 从构建的日志事件中记录每个步骤的耗时
+type Recorder struct {
+	mu      sync.Mutex
+	steps   []types.StepTiming
+	running map[int]int // 进行中的步骤 -> steps 中的下标
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{running: make(map[int]int)}
+}
+
+// Observe 处理一条日志事件，可直接用作 logger.SetEventSink 的接收者
+func (r *Recorder) Observe(e logger.Event) {
+	if e.Type != logger.EventStep {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch e.Status {
+	case logger.StepStarted:
+		r.running[e.Step] = len(r.steps)
+		r.steps = append(r.steps, types.StepTiming{
+			Step: e.Step, Title: e.Message, Status: logger.StepStarted, StartedAt: e.Time})
+	case logger.StepFinished:
+		i, ok := r.running[e.Step]
+		if !ok {
+			r.steps = append(r.steps, types.StepTiming{
+				Step: e.Step, Title: e.Message, Status: logger.StepFinished, StartedAt: e.Time})
+			return
+		}
+		delete(r.running, e.Step)
+		r.steps[i].Status = logger.StepFinished
+		r.steps[i].Duration = seconds(e.Time.Sub(r.steps[i].StartedAt))
+	case logger.StepSkipped:
+		r.steps = append(r.steps, types.StepTiming{
+			Step: e.Step, Title: e.Message, Status: logger.StepSkipped, StartedAt: e.Time})
+	}
+}
+
+// Step 返回步骤最近一次的记录
+func (r *Recorder) Step(n int) (types.StepTiming, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := len(r.steps) - 1; i >= 0; i-- {
+		if r.steps[i].Step == n {
+			return r.steps[i], true
+		}
+	}
+	return types.StepTiming{}, false
+}
+
+// Steps 返回步骤耗时；到 end 时仍在执行的步骤按构建结果标记为 failed 或 canceled
+func (r *Recorder) Steps(end time.Time, state types.JobState) []types.StepTiming {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	steps := append([]types.StepTiming(nil), r.steps...)
+	for _, i := range r.running {
+		steps[i].Status = StepFailed
+		if state == types.JobCanceled {
+			steps[i].Status = StepCanceled
+		}
+		steps[i].Duration = seconds(end.Sub(steps[i].StartedAt))
+	}
+	return steps
+}
+
+// Record 生成构建结束时的记录: 结果、错误码、实际使用的主题和配置文件以及步骤耗时
+//
+// 构建还未开始 (如排队时被取消) 时 started 为 nil。调用者再填写 id、来源、
+// 请求和输出 ISO 等信息。
+func (r *Recorder) Record(cfg *config.Config, mode types.BuildMode, created time.Time, started *time.Time, err error) types.BuildRecord {
+	now := time.Now()
+	rec := types.BuildRecord{
+		Mode:       mode,
+		Theme:      cfg.ThemeName,
+		State:      State(err),
+		WorkDir:    cfg.WorkDir,
+		CreatedAt:  created,
+		StartedAt:  started,
+		FinishedAt: now,
+	}
+	if rec.Theme == "default" {
+		rec.Theme = ""
+	}
+	if started != nil {
+		rec.Duration = seconds(now.Sub(*started))
+	}
+	rec.Steps = r.Steps(now, rec.State)
+
+	// 构建器在开始时补全默认配置，cfg.Profile 即为实际使用的配置
+	p := cfg.Profile
+	if p == nil {
+		p = profile.Default(string(mode))
+	}
+	if data, err := json.Marshal(p); err == nil {
+		rec.Profile = data
+	}
+
+	if err != nil && rec.State == types.JobFailed {
+		rec.Error = err.Error()
+		var buildErr *types.BuildError
+		if errors.As(err, &buildErr) {
+			rec.ErrorCode = int(buildErr.Code)
+			rec.ErrorContext = errorContext(buildErr.Context)
+		}
+	}
+	return rec
+}
+
+// State 构建结果对应的状态
+func State(err error) types.JobState {
+	switch {
+	case err == nil:
+		return types.JobComplete
+	case errors.Is(err, context.Canceled):
+		return types.JobCanceled
+	}
+	return types.JobFailed
+}
+
+// errorContext 复制错误上下文，不能序列化为 JSON 的值转换为字符串
+func errorContext(ctx map[string]interface{}) map[string]interface{} {
+	if len(ctx) == 0 {
+		return nil
+	}
+	out := make(map[string]interface{}, len(ctx))
+	for k, v := range ctx {
+		if _, err := json.Marshal(v); err != nil {
+			v = fmt.Sprint(v)
+		}
+		out[k] = v
+	}
+	return out
+}
+
+func seconds(d time.Duration) float64 {
+	return float64(d.Round(time.Millisecond)) / float64(time.Second)
+}
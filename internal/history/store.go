@@ -0,0 +1,233 @@
+// Package history 构建历史: 每次构建结束后追加一条记录到 JSONL 文件
+package history
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"tiny11-builder/internal/types"
+)
+
+// 记录的来源
+const (
+	SourceAPI = "api"
+	SourceCLI = "cli"
+)
+
+// ErrNotFound 记录不存在
+var ErrNotFound = errors.New("构建记录不存在")
+
+// maxRecordSize 单条记录的最大长度 (包含完整的构建配置文件)
+const maxRecordSize = 16 << 20
+
+// Store 构建历史文件，每行一条 JSON 记录
+//
+// 只追加不修改: 每条记录一次写入，API 服务器和命令行同时构建时不会交错。
+type Store struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewStore 使用历史文件 (不存在时在第一次写入时创建)
+func NewStore(path string) *Store {
+	return &Store{path: path}
+}
+
+// Path 历史文件路径
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Append 追加一条记录
+func (s *Store) Append(rec types.BuildRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("序列化构建记录失败: %w", err)
+	}
+	data = append(data, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("创建目录失败: %w", err)
+	}
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("打开构建历史失败: %w", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("写入构建历史失败: %w", err)
+	}
+	return f.Close()
+}
+
+// List 返回符合条件的记录 (最近创建的在前)
+//
+// 无法解析的行 (如写入时断电留下的半行) 被忽略。
+func (s *Store) List(filter Filter) ([]types.BuildRecord, error) {
+	records, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+
+	matched := make([]types.BuildRecord, 0, len(records))
+	for i := len(records) - 1; i >= 0; i-- {
+		if filter.Match(records[i]) {
+			matched = append(matched, records[i])
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		return matched[i].CreatedAt.After(matched[j].CreatedAt)
+	})
+	if filter.Limit > 0 && len(matched) > filter.Limit {
+		matched = matched[:filter.Limit]
+	}
+	return matched, nil
+}
+
+// Get 按 id 返回记录
+func (s *Store) Get(id string) (types.BuildRecord, error) {
+	records, err := s.read()
+	if err != nil {
+		return types.BuildRecord{}, err
+	}
+	for i := len(records) - 1; i >= 0; i-- {
+		if records[i].ID == id {
+			return records[i], nil
+		}
+	}
+	return types.BuildRecord{}, ErrNotFound
+}
+
+// read 读取全部记录 (文件顺序)
+func (s *Store) read() ([]types.BuildRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取构建历史失败: %w", err)
+	}
+	defer f.Close()
+
+	var records []types.BuildRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64<<10), maxRecordSize)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var rec types.BuildRecord
+		if json.Unmarshal(line, &rec) != nil || rec.ID == "" {
+			continue
+		}
+		records = append(records, rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取构建历史失败: %w", err)
+	}
+	return records, nil
+}
+
+// Filter 历史记录的筛选条件 (空值表示不限)
+type Filter struct {
+	Mode  types.BuildMode
+	Theme string // none 表示没有应用主题的构建
+	State types.JobState
+	Since time.Time // 创建时间范围 [Since, Until)
+	Until time.Time
+	Limit int // 最多返回的条数
+}
+
+// Match 记录是否符合条件
+func (f Filter) Match(rec types.BuildRecord) bool {
+	switch {
+	case f.Mode != "" && !strings.EqualFold(string(f.Mode), string(rec.Mode)):
+		return false
+	case f.State != "" && !strings.EqualFold(string(f.State), string(rec.State)):
+		return false
+	case !f.Since.IsZero() && rec.CreatedAt.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && !rec.CreatedAt.Before(f.Until):
+		return false
+	}
+	if f.Theme != "" {
+		theme := f.Theme
+		if strings.EqualFold(theme, "none") || strings.EqualFold(theme, "default") {
+			theme = ""
+		}
+		if !strings.EqualFold(theme, rec.Theme) {
+			return false
+		}
+	}
+	return true
+}
+
+// States 记录中可能的任务结果
+func States() []string {
+	return []string{string(types.JobComplete), string(types.JobFailed), string(types.JobCanceled)}
+}
+
+// ParseState 解析任务结果 (不区分大小写)
+func ParseState(value string) (types.JobState, error) {
+	for _, s := range States() {
+		if strings.EqualFold(s, value) {
+			return types.JobState(s), nil
+		}
+	}
+	return "", fmt.Errorf("无效的结果: %s (应为 %s)", value, strings.Join(States(), "、"))
+}
+
+// ParseTime 解析筛选用的时间
+//
+// 支持日期 (2006-01-02，本地时间)、日期时间 (2006-01-02 15:04[:05])、RFC 3339
+// 和相对时间 (如 12h、7d 表示多久以前)。endOfDay 为 true 时只有日期的值表示
+// 当天结束，用作时间范围的上限时包含这一天。
+func ParseTime(value string, endOfDay bool) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if t, err := time.ParseInLocation(time.DateOnly, value, time.Local); err == nil {
+		if endOfDay {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+	for _, layout := range []string{time.DateTime, "2006-01-02 15:04", "2006-01-02T15:04:05", "2006-01-02T15:04"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return time.Now().AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return time.Now().Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("无效的时间: %s (如 2024-05-01、2024-05-01 08:00、12h 或 7d)", value)
+}
+
+// NewID 生成记录 id: 时间 + 随机后缀 (与 API 任务 id 格式相同)
+func NewID() string {
+	b := make([]byte, 3)
+	rand.Read(b)
+	return time.Now().Format("20060102-150405") + "-" + hex.EncodeToString(b)
+}
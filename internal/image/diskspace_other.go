@@ -0,0 +1,25 @@
+//go:build !windows
+
+package image
+
+import (
+	"syscall"
+
+	"tiny11-builder/internal/utils"
+)
+
+// getFreeDiskSpace 获取磁盘剩余空间
+func (m *Manager) getFreeDiskSpace(drive string) (uint64, error) {
+	path := drive
+	if utils.ValidateDriveLetter(drive) {
+		// 非 Windows 平台没有盘符，使用工作目录所在的文件系统
+		path = m.config.Tiny11Dir
+	}
+
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+
+	return stat.Bavail * uint64(stat.Bsize), nil
+}
@@ -0,0 +1,39 @@
+package image
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// getFreeDiskSpace 获取磁盘剩余空间
+func (m *Manager) getFreeDiskSpace(drive string) (uint64, error) {
+	kernel32 := syscall.NewLazyDLL("kernel32.dll")
+	getDiskFreeSpaceEx := kernel32.NewProc("GetDiskFreeSpaceExW")
+
+	if !strings.HasSuffix(drive, "\\") {
+		drive = drive + "\\"
+	}
+
+	drivePtr, err := syscall.UTF16PtrFromString(drive)
+	if err != nil {
+		return 0, err
+	}
+
+	var freeBytesAvailable uint64
+	var totalBytes uint64
+	var totalFreeBytes uint64
+
+	ret, _, _ := getDiskFreeSpaceEx.Call(
+		uintptr(unsafe.Pointer(drivePtr)),
+		uintptr(unsafe.Pointer(&freeBytesAvailable)),
+		uintptr(unsafe.Pointer(&totalBytes)),
+		uintptr(unsafe.Pointer(&totalFreeBytes)))
+
+	if ret == 0 {
+		return 0, fmt.Errorf("无法获取磁盘空间")
+	}
+
+	return freeBytesAvailable, nil
+}
@@ -1,24 +1,33 @@
 package image
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 	"runtime"
 	"strings"
-	"syscall"
 	"time"
-	"unsafe"
 
 	"tiny11-builder/internal/config"
+	"tiny11-builder/internal/dism"
+	"tiny11-builder/internal/iso"
 	"tiny11-builder/internal/logger"
 	"tiny11-builder/internal/types"
 	"tiny11-builder/internal/utils"
+	"tiny11-builder/internal/wim"
 )
 
+// isoVolumeLabel 生成的ISO卷标
+const isoVolumeLabel = "TINY11"
+
 type Manager struct {
 	config *config.Config
 	log    *logger.Logger
+	runner utils.CommandRunner
 	info   *ImageInfo
 }
 
@@ -36,30 +45,41 @@ func NewManager(cfg *config.Config, log *logger.Logger) *Manager {
 	return &Manager{
 		config: cfg,
 		log:    log,
+		runner: cfg.CommandRunner(),
 	}
 }
 
 // ValidateISO 验证ISO镜像完整性
 func (m *Manager) ValidateISO() error {
-	bootWim := filepath.Join(m.config.ISODrive, "sources", "boot.wim")
-	installWim := filepath.Join(m.config.ISODrive, "sources", "install.wim")
-	installEsd := filepath.Join(m.config.ISODrive, "sources", "install.esd")
+	source := m.sourceName()
+	bootWim := filepath.Join(source, "sources", "boot.wim")
+	installWim := filepath.Join(source, "sources", "install.wim")
+	installEsd := filepath.Join(source, "sources", "install.esd")
 
-	spinner := utils.NewSpinner("验证ISO镜像完整性...")
+	spinner := m.log.NewSpinner("验证ISO镜像完整性...")
 	spinner.Start()
 
-	if !utils.FileExists(bootWim) {
+	src, closeSrc, err := m.openSource()
+	if err != nil {
+		spinner.Stop(false)
+		return types.NewError(types.ErrCodeNotFound, "无法打开ISO镜像", err).
+			WithContext("path", source)
+	}
+	defer closeSrc()
+
+	if !fileExistsFS(src, "sources/boot.wim") {
 		spinner.Stop(false)
 		return types.NewError(types.ErrCodeNotFound, "未找到boot.wim", nil).
 			WithContext("path", bootWim)
 	}
 
-	hasWim := utils.FileExists(installWim)
-	hasEsd := utils.FileExists(installEsd)
+	hasWim := fileExistsFS(src, "sources/install.wim")
+	hasEsd := fileExistsFS(src, "sources/install.esd")
 
 	if !hasWim && !hasEsd {
 		spinner.Stop(false)
-		return types.NewError(types.ErrCodeNotFound, "未找到install.wim或install.esd", nil)
+		return types.NewError(types.ErrCodeNotFound, "未找到install.wim或install.esd", nil).
+			WithContext("path", installWim)
 	}
 
 	spinner.Stop(true)
@@ -67,6 +87,17 @@ func (m *Manager) ValidateISO() error {
 	// 如果是ESD格式，需要转换
 	if !hasWim && hasEsd {
 		m.log.Info("检测到install.esd，需要转换为install.wim")
+
+		// DISM 需要真实的文件路径，直接读取ISO时先提取到临时目录
+		if m.config.ISOFile != "" {
+			extracted := filepath.Join(m.config.TempDir, "install.esd")
+			if err := m.extractFile(src, "sources/install.esd", extracted); err != nil {
+				return types.NewError(types.ErrCodeGeneral, "提取install.esd失败", err)
+			}
+			defer os.Remove(extracted)
+			installEsd = extracted
+		}
+
 		if err := m.convertEsdToWim(installEsd); err != nil {
 			return types.NewError(types.ErrCodeDISM, "转换ESD失败", err)
 		}
@@ -75,45 +106,120 @@ func (m *Manager) ValidateISO() error {
 	return nil
 }
 
+// sourceName 返回安装介质的显示路径 (ISO文件或驱动器)
+func (m *Manager) sourceName() string {
+	if m.config.ISOFile != "" {
+		return m.config.ISOFile
+	}
+	return m.config.ISODrive
+}
+
+// openSource 打开安装介质: 指定了ISO文件时直接读取镜像，否则使用挂载的驱动器
+func (m *Manager) openSource() (fs.FS, func(), error) {
+	if m.config.ISOFile == "" {
+		return os.DirFS(m.config.ISODrive), func() {}, nil
+	}
+
+	img, err := iso.OpenImage(m.config.ISOFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	return img, func() { img.Close() }, nil
+}
+
+// extractFile 从安装介质中提取单个文件
+func (m *Manager) extractFile(src fs.FS, name, dst string) error {
+	info, err := fs.Stat(src, name)
+	if err != nil {
+		return err
+	}
+
+	in, err := src.Open(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	progress := m.log.NewProgressBar(info.Size(), "提取 "+path.Base(name))
+	_, err = io.Copy(out, io.TeeReader(in, progress))
+	progress.Finish()
+
+	return err
+}
+
+func fileExistsFS(fsys fs.FS, name string) bool {
+	info, err := fs.Stat(fsys, name)
+	return err == nil && !info.IsDir()
+}
+
+// SourceInstallWim 返回可直接挂载的源 install.wim，不复制整个安装介质
+//
+// ESD 已转换时使用构建目录中的 install.wim；直接读取 ISO 文件时先将
+// install.wim 提取到临时目录，返回的 cleanup 负责删除提取的文件。
+func (m *Manager) SourceInstallWim() (string, func(), error) {
+	converted := filepath.Join(m.config.Tiny11Dir, "sources", "install.wim")
+	if utils.FileExists(converted) {
+		return converted, func() {}, nil
+	}
+
+	if m.config.ISOFile == "" {
+		wimPath := filepath.Join(m.config.ISODrive, "sources", "install.wim")
+		if !utils.FileExists(wimPath) {
+			return "", nil, types.NewError(types.ErrCodeNotFound, "install.wim不存在", nil).
+				WithContext("path", wimPath)
+		}
+		return wimPath, func() {}, nil
+	}
+
+	src, closeSrc, err := m.openSource()
+	if err != nil {
+		return "", nil, types.NewError(types.ErrCodeNotFound, "无法打开ISO镜像", err).
+			WithContext("path", m.sourceName())
+	}
+	defer closeSrc()
+
+	extracted := filepath.Join(m.config.TempDir, "install.wim")
+	if err := m.extractFile(src, "sources/install.wim", extracted); err != nil {
+		os.Remove(extracted)
+		return "", nil, types.NewError(types.ErrCodeGeneral, "提取install.wim失败", err)
+	}
+	return extracted, func() { os.Remove(extracted) }, nil
+}
+
 // convertEsdToWim 转换ESD镜像为WIM格式
 func (m *Manager) convertEsdToWim(esdPath string) error {
 	m.log.Section("转换ESD镜像格式")
 
 	// 获取ESD信息
-	output, err := utils.RunCommand("dism", "/English", "/Get-WimInfo",
-		fmt.Sprintf("/WimFile:%s", esdPath))
+	images, err := m.listImages(esdPath)
 	if err != nil {
 		return fmt.Errorf("获取ESD信息失败: %w", err)
 	}
 
 	// 显示可用镜像
-	fmt.Println()
-	lines := m.parseImageList(output)
-	for _, line := range lines {
-		if strings.HasPrefix(line, "Index :") {
-			fmt.Println(utils.Colorize(line, utils.MikuCyan))
-		} else {
-			fmt.Println(utils.Colorize(line, utils.MikuWhite))
-		}
-	}
-	fmt.Println()
+	m.printImageList(images)
 
 	// 选择索引
-	index := m.config.ImageIndex
-	if index == 0 {
-		fmt.Print(utils.Colorize("请输入要转换的镜像索引: ", utils.MikuPink))
-		fmt.Scanln(&index)
-	}
+	index := m.selectIndex("请输入要转换的镜像索引: ")
 
 	// 转换
 	destWim := filepath.Join(m.config.Tiny11Dir, "sources", "install.wim")
 	os.MkdirAll(filepath.Dir(destWim), 0755)
 
 	m.log.Info("正在转换镜像，这可能需要10-30分钟...")
-	spinner := utils.NewSpinner("转换install.esd到install.wim")
+	spinner := m.log.NewSpinner("转换install.esd到install.wim")
 	spinner.Start()
 
-	_, err = utils.RunCommand("dism", "/English",
+	_, err = utils.RunWith(m.runner, "dism", "/English",
 		"/Export-Image",
 		fmt.Sprintf("/SourceImageFile:%s", esdPath),
 		fmt.Sprintf("/SourceIndex:%d", index),
@@ -131,14 +237,25 @@ func (m *Manager) convertEsdToWim(esdPath string) error {
 	return nil
 }
 
-// CopyImageFiles 复制镜像文件
-func (m *Manager) CopyImageFiles() error {
+// CopyImageFiles 复制镜像文件 (ctx 取消后停止复制)
+func (m *Manager) CopyImageFiles(ctx context.Context) error {
 	m.log.Info("正在分析ISO镜像结构...")
 
-	spinner := utils.NewSpinner("计算文件总大小...")
+	src, closeSrc, err := m.openSource()
+	if err != nil {
+		return types.NewError(types.ErrCodeNotFound, "无法打开ISO镜像", err).
+			WithContext("path", m.sourceName())
+	}
+	defer closeSrc()
+
+	if img, ok := src.(*iso.Image); ok {
+		m.log.Info("直接读取ISO镜像文件: %s (%s)", m.config.ISOFile, img.Format())
+	}
+
+	spinner := m.log.NewSpinner("计算文件总大小...")
 	spinner.Start()
 
-	totalSize, fileCount, err := m.getDirSizeAndCount(m.config.ISODrive)
+	totalSize, fileCount, err := m.getDirSizeAndCount(src)
 	if err != nil {
 		spinner.Stop(false)
 		return types.NewError(types.ErrCodeGeneral, "计算文件大小失败", err)
@@ -154,8 +271,8 @@ func (m *Manager) CopyImageFiles() error {
 	}
 
 	// 使用并发复制
-	progress := utils.NewProgressBar(totalSize, "复制镜像文件")
-	err = utils.CopyDirConcurrent(m.config.ISODrive, m.config.Tiny11Dir, progress)
+	progress := m.log.NewProgressBar(totalSize, "复制镜像文件")
+	err = utils.CopyFSConcurrent(ctx, src, m.config.Tiny11Dir, progress)
 	progress.Finish()
 
 	if err != nil {
@@ -180,15 +297,19 @@ func (m *Manager) CopyImageFiles() error {
 }
 
 // getDirSizeAndCount 计算目录大小和文件数量
-func (m *Manager) getDirSizeAndCount(path string) (int64, int, error) {
+func (m *Manager) getDirSizeAndCount(src fs.FS) (int64, int, error) {
 	var size int64
 	var count int
 
-	err := filepath.Walk(path, func(filePath string, info os.FileInfo, err error) error {
+	err := fs.WalkDir(src, ".", func(filePath string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return nil // 跳过错误
 		}
-		if !info.IsDir() {
+		if !d.IsDir() {
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
 			size += info.Size()
 			count++
 		}
@@ -203,9 +324,13 @@ func (m *Manager) getDirSizeAndCount(path string) (int64, int, error) {
 }
 
 // GetImageInfo 获取镜像信息
+// 优先直接读取 WIM 内嵌的 XML 元数据，读取失败时回退到 DISM
 func (m *Manager) GetImageInfo() (*ImageInfo, error) {
-	wimPath := filepath.Join(m.config.Tiny11Dir, "sources", "install.wim")
+	return m.GetImageInfoFrom(filepath.Join(m.config.Tiny11Dir, "sources", "install.wim"))
+}
 
+// GetImageInfoFrom 从指定的 install.wim 获取镜像信息
+func (m *Manager) GetImageInfoFrom(wimPath string) (*ImageInfo, error) {
 	if !utils.FileExists(wimPath) {
 		return nil, types.NewError(types.ErrCodeNotFound, "install.wim不存在", nil).
 			WithContext("path", wimPath)
@@ -213,45 +338,73 @@ func (m *Manager) GetImageInfo() (*ImageInfo, error) {
 
 	m.log.Section("获取镜像信息")
 
-	output, err := utils.RunCommand("dism", "/English", "/Get-WimInfo",
-		fmt.Sprintf("/WimFile:%s", wimPath))
+	meta, err := wim.Open(wimPath)
 	if err != nil {
-		return nil, types.NewError(types.ErrCodeDISM, "获取镜像信息失败", err)
+		m.log.Warn("无法直接读取WIM元数据，改用DISM: %v", err)
+		return m.getImageInfoDISM(wimPath)
 	}
 
 	// 显示镜像列表
-	fmt.Println()
-	lines := m.parseImageList(output)
-	for _, line := range lines {
-		if strings.HasPrefix(line, "Index :") {
-			fmt.Println(utils.Colorize(line, utils.MikuCyan))
-		} else if strings.Contains(line, "Name :") {
-			fmt.Println(utils.Colorize(line, utils.MikuPink))
-		} else {
-			fmt.Println(utils.Colorize(line, utils.MikuWhite))
-		}
+	m.printImageList(wimSummaries(meta))
+
+	index := m.selectIndex("请输入镜像索引: ")
+	if !m.isValidIndex(index, meta.Indices()) {
+		return nil, types.NewError(types.ErrCodeInvalidInput, "无效的镜像索引", nil).
+			WithContext("index", index)
 	}
-	fmt.Println()
 
-	// 选择索引
-	index := m.config.ImageIndex
-	if index == 0 {
-		fmt.Print(utils.Colorize("请输入镜像索引: ", utils.MikuPink))
-		fmt.Scanln(&index)
+	img := meta.Image(index)
+	info := &ImageInfo{
+		Index:        index,
+		Name:         img.Name,
+		Description:  img.Description,
+		Architecture: img.Architecture,
+		Language:     img.DefaultLanguage,
+		Build:        img.Build,
+		Size:         img.TotalBytes,
+	}
+
+	if info.Architecture == "x64" {
+		info.Architecture = "amd64"
+	}
+	if info.Language == "" {
+		info.Language = dism.DefaultLanguage
+	}
+
+	m.info = info
+	m.printImageInfo(info)
+
+	return info, nil
+}
+
+// getImageInfoDISM 通过DISM获取镜像信息 (需要临时挂载镜像检测语言)
+func (m *Manager) getImageInfoDISM(wimPath string) (*ImageInfo, error) {
+	output, err := utils.RunWith(m.runner, "dism", "/English", "/Get-WimInfo",
+		fmt.Sprintf("/WimFile:%s", wimPath))
+	if err != nil {
+		return nil, types.NewError(types.ErrCodeDISM, "获取镜像信息失败", err)
 	}
 
+	images, err := dism.ParseWimInfo(output)
+	if err != nil {
+		return nil, types.NewError(types.ErrCodeDISM, "解析镜像信息失败", err)
+	}
+
+	// 显示镜像列表
+	m.printImageList(dismSummaries(images))
+
 	// 验证索引
-	availableIndices := m.extractAvailableIndices(output)
-	if !m.isValidIndex(index, availableIndices) {
+	index := m.selectIndex("请输入镜像索引: ")
+	if !m.isValidIndex(index, dism.Indices(images)) {
 		return nil, types.NewError(types.ErrCodeInvalidInput, "无效的镜像索引", nil).
 			WithContext("index", index)
 	}
 
 	// 获取详细信息
-	spinner := utils.NewSpinner("读取镜像详细信息...")
+	spinner := m.log.NewSpinner("读取镜像详细信息...")
 	spinner.Start()
 
-	output, err = utils.RunCommand("dism", "/English", "/Get-WimInfo",
+	output, err = utils.RunWith(m.runner, "dism", "/English", "/Get-WimInfo",
 		fmt.Sprintf("/WimFile:%s", wimPath),
 		fmt.Sprintf("/Index:%d", index))
 
@@ -261,25 +414,47 @@ func (m *Manager) GetImageInfo() (*ImageInfo, error) {
 		return nil, types.NewError(types.ErrCodeDISM, "获取详细信息失败", err)
 	}
 
+	details, err := dism.ParseWimInfo(output)
+	if err != nil {
+		return nil, types.NewError(types.ErrCodeDISM, "解析详细信息失败", err)
+	}
+
 	// 解析信息
-	info := &ImageInfo{Index: index}
-	info.Name = utils.ExtractField(output, "Name")
-	info.Description = utils.ExtractField(output, "Description")
-	info.Architecture = utils.ExtractField(output, "Architecture")
+	detail := details[0]
+	info := &ImageInfo{
+		Index:        index,
+		Name:         detail.Name,
+		Description:  detail.Description,
+		Architecture: detail.Architecture,
+		Build:        detail.Build(),
+		Size:         detail.Size,
+	}
 
 	if info.Architecture == "x64" {
 		info.Architecture = "amd64"
 	}
 
-	sizeStr := utils.ExtractField(output, "Size")
-	info.Size = m.parseSizeString(sizeStr)
-
 	// 检测语言
 	info.Language = m.detectLanguage(wimPath, index)
 
 	m.info = info
+	m.printImageInfo(info)
+
+	return info, nil
+}
+
+// selectIndex 使用配置的镜像索引，未配置时提示输入
+func (m *Manager) selectIndex(prompt string) int {
+	index := m.config.ImageIndex
+	if index == 0 {
+		fmt.Print(utils.Colorize(prompt, utils.MikuPink))
+		fmt.Scanln(&index)
+	}
+	return index
+}
 
-	// 显示详情
+// printImageInfo 显示镜像详情
+func (m *Manager) printImageInfo(info *ImageInfo) {
 	fmt.Println()
 	m.log.Info("镜像详情:")
 	fmt.Printf("  %s %s\n", utils.Colorize("名称:", utils.MikuCyan),
@@ -288,11 +463,13 @@ func (m *Manager) GetImageInfo() (*ImageInfo, error) {
 		utils.Colorize(info.Architecture, utils.MikuWhite))
 	fmt.Printf("  %s %s\n", utils.Colorize("语言:", utils.MikuCyan),
 		utils.Colorize(info.Language, utils.MikuWhite))
+	if info.Build != "" {
+		fmt.Printf("  %s %s\n", utils.Colorize("版本:", utils.MikuCyan),
+			utils.Colorize(info.Build, utils.MikuWhite))
+	}
 	fmt.Printf("  %s %s\n", utils.Colorize("大小:", utils.MikuCyan),
 		utils.Colorize(utils.FormatBytes(info.Size), utils.MikuWhite))
 	fmt.Println()
-
-	return info, nil
 }
 
 // detectLanguage 检测系统语言
@@ -300,11 +477,11 @@ func (m *Manager) detectLanguage(wimPath string, index int) string {
 	mountPath := m.config.ScratchDir
 	os.MkdirAll(mountPath, 0755)
 
-	spinner := utils.NewSpinner("检测系统语言...")
+	spinner := m.log.NewSpinner("检测系统语言...")
 	spinner.Start()
 
 	// 临时挂载（只读）
-	_, err := utils.RunCommand("dism", "/English",
+	_, err := utils.RunWith(m.runner, "dism", "/English",
 		"/Mount-Image",
 		fmt.Sprintf("/ImageFile:%s", wimPath),
 		fmt.Sprintf("/Index:%d", index),
@@ -315,16 +492,16 @@ func (m *Manager) detectLanguage(wimPath string, index int) string {
 
 	if err == nil {
 		// 获取语言信息
-		langOutput, langErr := utils.RunCommand("dism", "/English",
+		langOutput, langErr := utils.RunWith(m.runner, "dism", "/English",
 			"/Get-Intl",
 			fmt.Sprintf("/Image:%s", mountPath))
 
 		if langErr == nil {
-			language = utils.ExtractLanguage(langOutput)
+			language = dism.ParseIntl(langOutput).Language()
 		}
 
 		// 卸载
-		utils.RunCommand("dism", "/English",
+		utils.RunWith(m.runner, "dism", "/English",
 			"/Unmount-Image",
 			fmt.Sprintf("/MountDir:%s", mountPath),
 			"/Discard")
@@ -353,18 +530,79 @@ func (m *Manager) MountInstallWim(index int) error {
 	m.log.Info("挂载点: %s", mountPath)
 
 	// 获取文件权限
-	if err := utils.Takeown(wimPath); err != nil {
+	if err := utils.Takeown(m.runner, wimPath); err != nil {
 		m.log.Warn("获取文件所有权失败: %v", err)
 	}
-	if err := utils.GrantPermission(wimPath); err != nil {
+	if err := utils.GrantPermission(m.runner, wimPath); err != nil {
 		m.log.Warn("设置文件权限失败: %v", err)
 	}
 	os.Chmod(wimPath, 0666)
 
+	if err := m.prepareMountDir(mountPath); err != nil {
+		return err
+	}
+
+	// 挂载镜像
+	spinner := m.log.NewSpinner(fmt.Sprintf("挂载install.wim (索引 %d)", index))
+	spinner.Start()
+
+	output, err := utils.RunWith(m.runner, "dism", "/English",
+		"/Mount-Image",
+		fmt.Sprintf("/ImageFile:%s", wimPath),
+		fmt.Sprintf("/Index:%d", index),
+		fmt.Sprintf("/MountDir:%s", mountPath))
+
+	spinner.Stop(err == nil)
+
+	if err != nil {
+		m.log.Error("DISM输出: %s", output)
+		return types.NewError(types.ErrCodeDISM, "挂载失败", err)
+	}
+
+	m.log.Success("镜像挂载成功")
+	return nil
+}
+
+// MountReadOnly 以只读方式挂载指定的 WIM (用于预演，卸载时只能放弃)
+func (m *Manager) MountReadOnly(wimPath string, index int) error {
+	mountPath, _ := filepath.Abs(m.config.ScratchDir)
+
+	if !utils.FileExists(wimPath) {
+		return types.NewError(types.ErrCodeNotFound, "WIM文件不存在", nil).
+			WithContext("path", wimPath)
+	}
+
+	if err := m.prepareMountDir(mountPath); err != nil {
+		return err
+	}
+
+	spinner := m.log.NewSpinner(fmt.Sprintf("只读挂载 %s (索引 %d)", filepath.Base(wimPath), index))
+	spinner.Start()
+
+	output, err := utils.RunWith(m.runner, "dism", "/English",
+		"/Mount-Image",
+		fmt.Sprintf("/ImageFile:%s", wimPath),
+		fmt.Sprintf("/Index:%d", index),
+		fmt.Sprintf("/MountDir:%s", mountPath),
+		"/ReadOnly")
+
+	spinner.Stop(err == nil)
+
+	if err != nil {
+		m.log.Error("DISM输出: %s", output)
+		return types.NewError(types.ErrCodeDISM, "挂载失败", err)
+	}
+
+	m.log.Success("镜像已只读挂载")
+	return nil
+}
+
+// prepareMountDir 清理残留的挂载并确保挂载目录为空
+func (m *Manager) prepareMountDir(mountPath string) error {
 	// 清理现有挂载
 	if utils.DirExists(mountPath) {
 		m.log.Info("清理现有挂载目录...")
-		utils.RunCommand("dism", "/English",
+		utils.RunWith(m.runner, "dism", "/English",
 			"/Unmount-Image",
 			fmt.Sprintf("/MountDir:%s", mountPath),
 			"/Discard")
@@ -373,8 +611,8 @@ func (m *Manager) MountInstallWim(index int) error {
 
 		if err := os.RemoveAll(mountPath); err != nil {
 			m.log.Warn("删除挂载目录失败，尝试获取权限...")
-			utils.TakeownRecursive(mountPath)
-			utils.GrantPermissionRecursive(mountPath)
+			utils.TakeownRecursive(m.runner, mountPath)
+			utils.GrantPermissionRecursive(m.runner, mountPath)
 			time.Sleep(1 * time.Second)
 
 			if err := os.RemoveAll(mountPath); err != nil {
@@ -402,25 +640,6 @@ func (m *Manager) MountInstallWim(index int) error {
 	}
 
 	m.log.Success("挂载目录准备完成")
-
-	// 挂载镜像
-	spinner := utils.NewSpinner(fmt.Sprintf("挂载install.wim (索引 %d)", index))
-	spinner.Start()
-
-	output, err := utils.RunCommand("dism", "/English",
-		"/Mount-Image",
-		fmt.Sprintf("/ImageFile:%s", wimPath),
-		fmt.Sprintf("/Index:%d", index),
-		fmt.Sprintf("/MountDir:%s", mountPath))
-
-	spinner.Stop(err == nil)
-
-	if err != nil {
-		m.log.Error("DISM输出: %s", output)
-		return types.NewError(types.ErrCodeDISM, "挂载失败", err)
-	}
-
-	m.log.Success("镜像挂载成功")
 	return nil
 }
 
@@ -440,14 +659,14 @@ func (m *Manager) MountBootWim() error {
 	m.log.Info("准备挂载boot.wim...")
 
 	// 获取权限
-	utils.Takeown(wimPath)
-	utils.GrantPermission(wimPath)
+	utils.Takeown(m.runner, wimPath)
+	utils.GrantPermission(m.runner, wimPath)
 	os.Chmod(wimPath, 0666)
 
 	// 清理现有挂载
 	if utils.DirExists(mountPath) {
 		m.log.Info("清理现有挂载目录...")
-		utils.RunCommand("dism", "/English",
+		utils.RunWith(m.runner, "dism", "/English",
 			"/Unmount-Image",
 			fmt.Sprintf("/MountDir:%s", mountPath),
 			"/Discard")
@@ -455,8 +674,8 @@ func (m *Manager) MountBootWim() error {
 		time.Sleep(2 * time.Second)
 
 		if err := os.RemoveAll(mountPath); err != nil {
-			utils.TakeownRecursive(mountPath)
-			utils.GrantPermissionRecursive(mountPath)
+			utils.TakeownRecursive(m.runner, mountPath)
+			utils.GrantPermissionRecursive(m.runner, mountPath)
 			time.Sleep(1 * time.Second)
 			os.RemoveAll(mountPath)
 		}
@@ -465,10 +684,10 @@ func (m *Manager) MountBootWim() error {
 	os.MkdirAll(mountPath, 0755)
 
 	// 挂载boot.wim的索引2
-	spinner := utils.NewSpinner("挂载boot.wim (索引 2)")
+	spinner := m.log.NewSpinner("挂载boot.wim (索引 2)")
 	spinner.Start()
 
-	_, err := utils.RunCommand("dism", "/English",
+	_, err := utils.RunWith(m.runner, "dism", "/English",
 		"/Mount-Image",
 		fmt.Sprintf("/ImageFile:%s", wimPath),
 		"/Index:2",
@@ -502,10 +721,10 @@ func (m *Manager) UnmountImage(commit bool) error {
 
 	m.log.Info("卸载镜像 (%s)...", actionDesc)
 
-	spinner := utils.NewSpinner(fmt.Sprintf("卸载镜像 (%s)", actionDesc))
+	spinner := m.log.NewSpinner(fmt.Sprintf("卸载镜像 (%s)", actionDesc))
 	spinner.Start()
 
-	_, err := utils.RunCommand("dism", "/English",
+	_, err := utils.RunWith(m.runner, "dism", "/English",
 		"/Unmount-Image",
 		fmt.Sprintf("/MountDir:%s", mountPath),
 		action)
@@ -541,12 +760,44 @@ func (m *Manager) isMounted(mountPath string) bool {
 	}
 
 	// 查询DISM挂载状态
-	output, err := utils.RunCommand("dism", "/English", "/Get-MountedImageInfo")
+	return m.mountedAt(mountPath) != nil
+}
+
+// MountedImage 查询挂载目录中当前挂载的镜像 (未挂载返回 nil)
+func (m *Manager) MountedImage() *dism.MountedImage {
+	return m.mountedAt(m.config.ScratchDir)
+}
+
+func (m *Manager) mountedAt(mountPath string) *dism.MountedImage {
+	output, err := utils.RunWith(m.runner, "dism", "/English", "/Get-MountedImageInfo")
 	if err != nil {
-		return false
+		return nil
+	}
+
+	mountPath, _ = filepath.Abs(mountPath)
+	for _, mounted := range dism.ParseMountedImages(output) {
+		if strings.EqualFold(filepath.Clean(mounted.MountDir), filepath.Clean(mountPath)) {
+			return &mounted
+		}
 	}
+	return nil
+}
+
+// RemountImage 重新装载因重启或进程中断而失效的挂载目录
+func (m *Manager) RemountImage() error {
+	spinner := m.log.NewSpinner("重新装载镜像")
+	spinner.Start()
+
+	_, err := utils.RunWith(m.runner, "dism", "/English",
+		"/Remount-Image",
+		fmt.Sprintf("/MountDir:%s", m.config.ScratchDir))
 
-	return strings.Contains(output, mountPath)
+	spinner.Stop(err == nil)
+
+	if err != nil {
+		return types.NewError(types.ErrCodeDISM, "重新装载失败", err)
+	}
+	return nil
 }
 
 // CleanupImage 清理镜像
@@ -555,10 +806,10 @@ func (m *Manager) CleanupImage() error {
 
 	m.log.Info("清理镜像组件存储...")
 
-	spinner := utils.NewSpinner("执行组件清理 (这可能需要几分钟)")
+	spinner := m.log.NewSpinner("执行组件清理 (这可能需要几分钟)")
 	spinner.Start()
 
-	output, err := utils.RunCommand("dism", "/English",
+	output, err := utils.RunWith(m.runner, "dism", "/English",
 		fmt.Sprintf("/Image:%s", mountPath),
 		"/Cleanup-Image",
 		"/StartComponentCleanup",
@@ -569,7 +820,7 @@ func (m *Manager) CleanupImage() error {
 	if err != nil {
 		m.log.Warn("组件清理失败，将使用延迟清理")
 
-		_, err2 := utils.RunCommand("dism", "/English",
+		_, err2 := utils.RunWith(m.runner, "dism", "/English",
 			fmt.Sprintf("/Image:%s", mountPath),
 			"/Cleanup-Image",
 			"/StartComponentCleanup")
@@ -633,8 +884,8 @@ func (m *Manager) ExportImage(index int) error {
 	// 删除已存在的目标文件
 	if utils.FileExists(destWim) {
 		m.log.Info("删除旧的导出文件...")
-		utils.Takeown(destWim)
-		utils.GrantPermission(destWim)
+		utils.Takeown(m.runner, destWim)
+		utils.GrantPermission(m.runner, destWim)
 		os.Chmod(destWim, 0666)
 		if err := os.Remove(destWim); err != nil {
 			return types.NewError(types.ErrCodePermission, "无法删除旧文件", err).
@@ -653,11 +904,11 @@ func (m *Manager) ExportImage(index int) error {
 			time.Sleep(2 * time.Second)
 		}
 		
-		spinner := utils.NewSpinner(fmt.Sprintf("导出镜像 (recovery压缩) - 尝试 %d/%d", attempt, maxRetries))
+		spinner := m.log.NewSpinner(fmt.Sprintf("导出镜像 (recovery压缩) - 尝试 %d/%d", attempt, maxRetries))
 		spinner.Start()
 		
 		// ✅ 关键修复：移除 /English 和 /CheckIntegrity，完全对齐 PowerShell 版本
-		output, err := utils.RunCommand("dism",
+		output, err := utils.RunWith(m.runner, "dism",
 			"/Export-Image",
 			fmt.Sprintf("/SourceImageFile:%s", sourceWim),
 			fmt.Sprintf("/SourceIndex:%d", index),
@@ -709,8 +960,8 @@ func (m *Manager) ExportImage(index int) error {
 	
 	// 替换原始文件
 	m.log.Info("替换原始WIM文件...")
-	utils.Takeown(sourceWim)
-	utils.GrantPermission(sourceWim)
+	utils.Takeown(m.runner, sourceWim)
+	utils.GrantPermission(m.runner, sourceWim)
 	os.Chmod(sourceWim, 0666)
 	
 	if err := os.Remove(sourceWim); err != nil {
@@ -737,37 +988,6 @@ func (m *Manager) ExportImage(index int) error {
 	return nil
 }
 
-// getFreeDiskSpace 获取磁盘剩余空间
-func (m *Manager) getFreeDiskSpace(drive string) (uint64, error) {
-	kernel32 := syscall.NewLazyDLL("kernel32.dll")
-	getDiskFreeSpaceEx := kernel32.NewProc("GetDiskFreeSpaceExW")
-
-	if !strings.HasSuffix(drive, "\\") {
-		drive = drive + "\\"
-	}
-
-	drivePtr, err := syscall.UTF16PtrFromString(drive)
-	if err != nil {
-		return 0, err
-	}
-
-	var freeBytesAvailable uint64
-	var totalBytes uint64
-	var totalFreeBytes uint64
-
-	ret, _, _ := getDiskFreeSpaceEx.Call(
-		uintptr(unsafe.Pointer(drivePtr)),
-		uintptr(unsafe.Pointer(&freeBytesAvailable)),
-		uintptr(unsafe.Pointer(&totalBytes)),
-		uintptr(unsafe.Pointer(&totalFreeBytes)))
-
-	if ret == 0 {
-		return 0, fmt.Errorf("无法获取磁盘空间")
-	}
-
-	return freeBytesAvailable, nil
-}
-
 // CreateISO 创建ISO镜像
 func (m *Manager) CreateISO() (string, error) {
 	m.log.Section("创建ISO镜像")
@@ -785,12 +1005,6 @@ func (m *Manager) CreateISO() (string, error) {
 		m.log.Warn("未找到autounattend.xml")
 	}
 
-	// 查找oscdimg
-	oscdimg, err := m.findOscdimg()
-	if err != nil {
-		return "", err
-	}
-
 	// 验证引导文件
 	etfsboot := filepath.Join(m.config.Tiny11Dir, "boot", "etfsboot.com")
 	efisys := filepath.Join(m.config.Tiny11Dir, "efi", "microsoft", "boot", "efisys.bin")
@@ -808,22 +1022,33 @@ func (m *Manager) CreateISO() (string, error) {
 	m.log.Info("正在构建ISO镜像文件...")
 	m.log.Info("输出路径: %s", m.config.OutputISO)
 
-	bootData := fmt.Sprintf("2#p0,e,b%s#pEF,e,b%s", etfsboot, efisys)
-
-	spinner := utils.NewSpinner("创建ISO镜像 (这可能需要几分钟)")
+	// 与 oscdimg -m -o -u2 -udfver102 -bootdata:2#p0,e,b<etfsboot>#pEF,e,b<efisys> 相同的布局
+	spinner := m.log.NewSpinner("扫描镜像文件...")
 	spinner.Start()
 
-	_, err = utils.RunCommand(oscdimg,
-		"-m",
-		"-o",
-		"-u2",
-		"-udfver102",
-		fmt.Sprintf("-bootdata:%s", bootData),
-		m.config.Tiny11Dir,
-		m.config.OutputISO)
+	writer, err := iso.NewWriter(m.config.Tiny11Dir, iso.Options{
+		VolumeID: isoVolumeLabel,
+		BIOSBoot: etfsboot,
+		EFIBoot:  efisys,
+		Dedup:    true,
+	})
 
 	spinner.Stop(err == nil)
 
+	if err != nil {
+		return "", types.NewError(types.ErrCodeGeneral, "分析ISO内容失败", err)
+	}
+
+	stats := writer.Stats()
+	m.log.Info("文件: %d, 目录: %d", stats.Files, stats.Dirs)
+	if stats.Deduped > 0 {
+		m.log.Info("重复文件: %d (节省 %s)", stats.Deduped, utils.FormatBytes(stats.SavedBytes))
+	}
+
+	progress := m.log.NewProgressBar(stats.DataBytes, "写入ISO镜像")
+	err = writer.WriteFile(m.config.OutputISO, progress.Add)
+	progress.Finish()
+
 	if err != nil {
 		return "", types.NewError(types.ErrCodeGeneral, "创建ISO失败", err)
 	}
@@ -843,56 +1068,6 @@ func (m *Manager) CreateISO() (string, error) {
 	return m.config.OutputISO, nil
 }
 
-// findOscdimg 查找oscdimg.exe
-func (m *Manager) findOscdimg() (string, error) {
-	// 搜索路径优先级
-	searchPaths := []string{
-		// 1. 本地目录
-		filepath.Join(m.config.WorkDir, "oscdimg.exe"),
-		filepath.Join(m.config.TempDir, "oscdimg.exe"),
-
-		// 2. ADK 标准路径 (amd64)
-		`C:\Program Files (x86)\Windows Kits\10\Assessment and Deployment Kit\Deployment Tools\amd64\Oscdimg\oscdimg.exe`,
-
-		// 3. ADK x86 路径
-		`C:\Program Files (x86)\Windows Kits\10\Assessment and Deployment Kit\Deployment Tools\x86\Oscdimg\oscdimg.exe`,
-
-		// 4. ADK ARM64 路径
-		`C:\Program Files (x86)\Windows Kits\10\Assessment and Deployment Kit\Deployment Tools\arm64\Oscdimg\oscdimg.exe`,
-
-		// 5. 其他可能的位置
-		`C:\Windows\System32\oscdimg.exe`,
-	}
-
-	// 优先使用已存在的
-	for _, path := range searchPaths {
-		if utils.FileExists(path) {
-			m.log.Info("找到 oscdimg: %s", path)
-			return path, nil
-		}
-	}
-
-	// 下载
-	m.log.Info("未找到 oscdimg.exe，正在从Microsoft下载...")
-	localPath := filepath.Join(m.config.TempDir, "oscdimg.exe")
-
-	url := "https://msdl.microsoft.com/download/symbols/oscdimg.exe/3D44737265000/oscdimg.exe"
-
-	spinner := utils.NewSpinner("下载 oscdimg.exe")
-	spinner.Start()
-
-	err := utils.DownloadFile(url, localPath)
-
-	spinner.Stop(err == nil)
-
-	if err != nil {
-		return "", types.NewError(types.ErrCodeNetwork, "下载oscdimg失败", err)
-	}
-
-	m.log.Success("oscdimg.exe 下载完成")
-	return localPath, nil
-}
-
 // Cleanup 清理临时文件
 func (m *Manager) Cleanup() error {
 	m.log.Info("清理临时文件...")
@@ -942,36 +1117,59 @@ func (m *Manager) Cleanup() error {
 
 // 辅助方法
 
-func (m *Manager) parseImageList(output string) []string {
-	var lines []string
-	outputLines := strings.Split(output, "\n")
+// imageSummary 镜像列表中显示的概要信息
+type imageSummary struct {
+	Index       int
+	Name        string
+	Description string
+	Size        int64
+}
 
-	for _, line := range outputLines {
-		trimmed := strings.TrimSpace(line)
-		if trimmed == "" {
-			continue
-		}
-		lines = append(lines, trimmed)
+func wimSummaries(meta *wim.Info) []imageSummary {
+	var list []imageSummary
+	for _, img := range meta.Images {
+		list = append(list, imageSummary{img.Index, img.Name, img.Description, img.TotalBytes})
 	}
+	return list
+}
 
-	return lines
+func dismSummaries(images []*dism.WimImage) []imageSummary {
+	var list []imageSummary
+	for _, img := range images {
+		list = append(list, imageSummary{img.Index, img.Name, img.Description, img.Size})
+	}
+	return list
 }
 
-func (m *Manager) extractAvailableIndices(output string) []int {
-	var indices []int
-	lines := strings.Split(output, "\n")
+// listImages 列出WIM/ESD中的镜像，读取元数据失败时回退到DISM
+func (m *Manager) listImages(path string) ([]imageSummary, error) {
+	if meta, err := wim.Open(path); err == nil {
+		return wimSummaries(meta), nil
+	}
 
-	for _, line := range lines {
-		trimmed := strings.TrimSpace(line)
-		if strings.HasPrefix(trimmed, "Index :") {
-			var index int
-			if _, err := fmt.Sscanf(trimmed, "Index : %d", &index); err == nil {
-				indices = append(indices, index)
-			}
-		}
+	output, err := utils.RunWith(m.runner, "dism", "/English", "/Get-WimInfo",
+		fmt.Sprintf("/WimFile:%s", path))
+	if err != nil {
+		return nil, err
+	}
+
+	images, err := dism.ParseWimInfo(output)
+	if err != nil {
+		return nil, err
 	}
+	return dismSummaries(images), nil
+}
 
-	return indices
+// printImageList 显示镜像列表
+func (m *Manager) printImageList(images []imageSummary) {
+	fmt.Println()
+	for _, img := range images {
+		fmt.Println(utils.Colorize(fmt.Sprintf("Index : %d", img.Index), utils.MikuCyan))
+		fmt.Println(utils.Colorize("Name : "+img.Name, utils.MikuPink))
+		fmt.Println(utils.Colorize("Description : "+img.Description, utils.MikuWhite))
+		fmt.Println(utils.Colorize("Size : "+utils.FormatBytes(img.Size), utils.MikuWhite))
+		fmt.Println()
+	}
 }
 
 func (m *Manager) isValidIndex(index int, availableIndices []int) bool {
@@ -982,14 +1180,3 @@ func (m *Manager) isValidIndex(index int, availableIndices []int) bool {
 	}
 	return false
 }
-
-func (m *Manager) parseSizeString(sizeStr string) int64 {
-	sizeStr = strings.ReplaceAll(sizeStr, ",", "")
-	sizeStr = strings.ReplaceAll(sizeStr, " bytes", "")
-	sizeStr = strings.TrimSpace(sizeStr)
-
-	var size int64
-	fmt.Sscanf(sizeStr, "%d", &size)
-
-	return size
-}
\ No newline at end of file
@@ -0,0 +1,548 @@
+// Package iso 生成可引导的 Windows 安装 ISO 镜像，不依赖 oscdimg.exe
+//
+// 生成的布局与 oscdimg -m -o -u2 -udfver102 -bootdata:2#p0,e,b<etfsboot>#pEF,e,b<efisys> 相同:
+// ISO9660 部分只包含 El Torito 引导目录和一个说明文件，完整的目录树记录在 UDF 1.02 文件系统中。
+// 单个文件可以超过 4GB (UDF 使用多个分配描述符)，内容相同的文件只写入一次。
+package iso
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SectorSize 扇区 (逻辑块) 大小
+const SectorSize = 2048
+
+// 固定的扇区分配
+const (
+	sectorPVD        = 16
+	sectorBootRecord = 17
+	sectorTerminator = 18
+	sectorBEA        = 19
+	sectorNSR        = 20
+	sectorTEA        = 21
+	sectorCatalog    = 22
+	sectorPathL      = 23
+	sectorPathM      = 24
+	sectorRootDir    = 25
+	sectorReadme     = 26
+	sectorMainVDS    = 32
+	sectorReserveVDS = 48
+	sectorLVID       = 64
+	sectorAnchor     = 256
+	partitionStart   = 257
+	vdsSectors       = 16
+)
+
+// maxExtent 单个 short_ad 能描述的最大长度 (30 位，按块对齐)
+const maxExtent = 0x3FFFF800
+
+// Options ISO 生成选项
+type Options struct {
+	// VolumeID 卷标
+	VolumeID string
+	// BIOSBoot BIOS 引导映像 (etfsboot.com)，必须位于源目录内
+	BIOSBoot string
+	// EFIBoot UEFI 引导映像 (efisys.bin)，必须位于源目录内
+	EFIBoot string
+	// Dedup 内容相同的文件共享同一份数据 (等同 oscdimg -o)
+	Dedup bool
+}
+
+// Stats 镜像统计信息
+type Stats struct {
+	Files      int
+	Dirs       int
+	Deduped    int
+	SavedBytes int64
+	DataBytes  int64
+	ImageSize  int64
+}
+
+// node 目录树中的文件或目录
+type node struct {
+	name     string
+	path     string
+	dir      bool
+	size     int64
+	modTime  time.Time
+	parent   *node
+	children []*node
+
+	uniqueID uint64
+	feBlock  uint32
+	fidBlock uint32
+	fidSize  int64
+	data     *extent
+}
+
+// extent 一段连续的文件数据 (块号为分区内的相对块号)
+type extent struct {
+	block uint32
+	size  int64
+	src   string
+}
+
+// Writer 根据目录生成 ISO 镜像
+type Writer struct {
+	opts    Options
+	root    *node
+	dirs    []*node
+	files   []*node
+	extents []*extent
+	bios    *node
+	efi     *node
+
+	partLength uint32
+	total      uint32
+	nextID     uint64
+	created    time.Time
+	stats      Stats
+}
+
+// NewWriter 扫描源目录并计算镜像布局
+func NewWriter(srcDir string, opts Options) (*Writer, error) {
+	w := &Writer{opts: opts, created: time.Now(), nextID: 16}
+
+	root, err := scan(srcDir)
+	if err != nil {
+		return nil, err
+	}
+	w.root = root
+
+	if opts.BIOSBoot != "" {
+		if w.bios, err = w.lookup(srcDir, opts.BIOSBoot); err != nil {
+			return nil, fmt.Errorf("BIOS引导映像: %w", err)
+		}
+	}
+	if opts.EFIBoot != "" {
+		if w.efi, err = w.lookup(srcDir, opts.EFIBoot); err != nil {
+			return nil, fmt.Errorf("UEFI引导映像: %w", err)
+		}
+	}
+
+	if err := w.layout(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Stats 返回镜像统计信息
+func (w *Writer) Stats() Stats {
+	return w.stats
+}
+
+// WriteFile 写入 ISO 文件，progress 在每次写入文件数据后以字节数回调 (可为 nil)
+func (w *Writer) WriteFile(dst string, progress func(n int64)) error {
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	err = w.write(f, progress)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(dst)
+	}
+	return err
+}
+
+// Create 从目录生成 ISO 文件
+func Create(srcDir, dst string, opts Options) (Stats, error) {
+	w, err := NewWriter(srcDir, opts)
+	if err != nil {
+		return Stats{}, err
+	}
+	return w.Stats(), w.WriteFile(dst, nil)
+}
+
+func scan(root string) (*node, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("源路径不是目录: %s", root)
+	}
+
+	n := &node{path: root, dir: true, modTime: info.ModTime()}
+	n.parent = n
+	return n, scanDir(n)
+}
+
+func scanDir(dir *node) error {
+	entries, err := os.ReadDir(dir.path)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		path := filepath.Join(dir.path, e.Name())
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			continue
+		}
+		if len(encodeName(e.Name())) > 255 {
+			return fmt.Errorf("文件名过长: %s", path)
+		}
+
+		child := &node{
+			name:    e.Name(),
+			path:    path,
+			dir:     info.IsDir(),
+			size:    info.Size(),
+			modTime: info.ModTime(),
+			parent:  dir,
+		}
+		if child.dir {
+			child.size = 0
+			if err := scanDir(child); err != nil {
+				return err
+			}
+		}
+		dir.children = append(dir.children, child)
+	}
+	return nil
+}
+
+// lookup 在目录树中查找文件 (path 可以是绝对路径或相对源目录的路径)
+func (w *Writer) lookup(srcDir, path string) (*node, error) {
+	if filepath.IsAbs(path) {
+		rel, err := filepath.Rel(srcDir, path)
+		if err != nil {
+			return nil, err
+		}
+		path = rel
+	}
+	path = filepath.ToSlash(filepath.Clean(path))
+	if path == "." || strings.HasPrefix(path, "../") {
+		return nil, fmt.Errorf("%s 不在源目录中", path)
+	}
+
+	n := w.root
+	for _, part := range strings.Split(path, "/") {
+		var next *node
+		for _, c := range n.children {
+			if strings.EqualFold(c.name, part) {
+				next = c
+				break
+			}
+		}
+		if next == nil {
+			return nil, fmt.Errorf("未找到 %s", path)
+		}
+		n = next
+	}
+	if n.dir {
+		return nil, fmt.Errorf("%s 是目录", path)
+	}
+	if n.size == 0 {
+		return nil, fmt.Errorf("%s 为空文件", path)
+	}
+	return n, nil
+}
+
+// layout 为所有描述符和文件数据分配分区内的块
+func (w *Writer) layout() error {
+	// 广度优先收集目录和文件
+	queue := []*node{w.root}
+	for len(queue) > 0 {
+		dir := queue[0]
+		queue = queue[1:]
+		w.dirs = append(w.dirs, dir)
+		for _, c := range dir.children {
+			if c.dir {
+				queue = append(queue, c)
+			} else {
+				w.files = append(w.files, c)
+			}
+		}
+	}
+
+	// 块 0: File Set Descriptor, 块 1: 终止描述符
+	next := uint32(2)
+
+	for _, dir := range w.dirs {
+		dir.uniqueID = w.uniqueID(dir)
+		dir.feBlock = next
+		next++
+
+		dir.fidSize = fidLength(0)
+		for _, c := range dir.children {
+			dir.fidSize += fidLength(len(encodeName(c.name)))
+		}
+		dir.fidBlock = next
+		next += blocks(dir.fidSize)
+	}
+
+	for _, f := range w.files {
+		f.uniqueID = w.uniqueID(f)
+		f.feBlock = next
+		next++
+	}
+
+	// 引导映像放在数据区最前面
+	order := make([]*node, 0, len(w.files))
+	for _, boot := range []*node{w.bios, w.efi} {
+		if boot != nil {
+			order = append(order, boot)
+		}
+	}
+	for _, f := range w.files {
+		if f != w.bios && f != w.efi {
+			order = append(order, f)
+		}
+	}
+
+	dedup, err := w.findDuplicates(order)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range order {
+		if f.data != nil || f.size == 0 {
+			continue
+		}
+		if orig, ok := dedup[f]; ok && orig.data != nil {
+			f.data = orig.data
+			w.stats.Deduped++
+			w.stats.SavedBytes += f.size
+			continue
+		}
+
+		f.data = &extent{block: next, size: f.size, src: f.path}
+		w.extents = append(w.extents, f.data)
+		w.stats.DataBytes += f.size
+		next += blocks(f.size)
+	}
+
+	w.partLength = next
+	w.total = partitionStart + w.partLength + 1
+
+	w.stats.Files = len(w.files)
+	w.stats.Dirs = len(w.dirs)
+	w.stats.ImageSize = int64(w.total) * SectorSize
+	return nil
+}
+
+func (w *Writer) uniqueID(n *node) uint64 {
+	if n == w.root {
+		return 0
+	}
+	id := w.nextID
+	w.nextID++
+	return id
+}
+
+// findDuplicates 返回内容与之前某个文件相同的文件 -> 最先出现的文件
+// 只对大小相同的文件计算哈希
+func (w *Writer) findDuplicates(order []*node) (map[*node]*node, error) {
+	dups := make(map[*node]*node)
+	if !w.opts.Dedup {
+		return dups, nil
+	}
+
+	bySize := make(map[int64][]*node)
+	for _, f := range order {
+		if f.size > 0 {
+			bySize[f.size] = append(bySize[f.size], f)
+		}
+	}
+
+	for _, f := range order {
+		group := bySize[f.size]
+		if len(group) < 2 || group[0] != f {
+			continue
+		}
+
+		seen := make(map[[sha256.Size]byte]*node)
+		for _, g := range group {
+			sum, err := hashFile(g.path)
+			if err != nil {
+				return nil, err
+			}
+			if orig, ok := seen[sum]; ok {
+				dups[g] = orig
+			} else {
+				seen[sum] = g
+			}
+		}
+	}
+	return dups, nil
+}
+
+func hashFile(path string) ([sha256.Size]byte, error) {
+	var sum [sha256.Size]byte
+
+	f, err := os.Open(path)
+	if err != nil {
+		return sum, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return sum, err
+	}
+	copy(sum[:], h.Sum(nil))
+	return sum, nil
+}
+
+func blocks(size int64) uint32 {
+	return uint32((size + SectorSize - 1) / SectorSize)
+}
+
+// sectorWriter 按扇区顺序写入，并检查位置与布局一致
+type sectorWriter struct {
+	w   *bufio.Writer
+	pos uint32
+}
+
+func (s *sectorWriter) write(b []byte) error {
+	if _, err := s.w.Write(b); err != nil {
+		return err
+	}
+	s.pos += blocks(int64(len(b)))
+	if rem := len(b) % SectorSize; rem != 0 {
+		if _, err := s.w.Write(make([]byte, SectorSize-rem)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// seek 用空扇区填充到指定位置
+func (s *sectorWriter) seek(sector uint32) error {
+	if s.pos > sector {
+		return fmt.Errorf("内部错误: 扇区 %d 已被占用 (当前位置 %d)", sector, s.pos)
+	}
+	zero := make([]byte, SectorSize)
+	for s.pos < sector {
+		if _, err := s.w.Write(zero); err != nil {
+			return err
+		}
+		s.pos++
+	}
+	return nil
+}
+
+func (w *Writer) write(f io.Writer, progress func(n int64)) error {
+	s := &sectorWriter{w: bufio.NewWriterSize(f, 1024*1024)}
+
+	if err := w.writeVolumeDescriptors(s); err != nil {
+		return err
+	}
+	if err := w.writeUDFDescriptors(s); err != nil {
+		return err
+	}
+	if err := w.writePartition(s, progress); err != nil {
+		return err
+	}
+
+	// 结尾的锚点
+	if err := s.seek(w.total - 1); err != nil {
+		return err
+	}
+	if err := s.write(w.anchor(w.total - 1)); err != nil {
+		return err
+	}
+
+	return s.w.Flush()
+}
+
+func (w *Writer) writePartition(s *sectorWriter, progress func(n int64)) error {
+	block := func(b uint32) error { return s.seek(partitionStart + b) }
+
+	if err := block(0); err != nil {
+		return err
+	}
+	if err := s.write(w.fileSetDescriptor()); err != nil {
+		return err
+	}
+	if err := s.write(terminatingDescriptor(1)); err != nil {
+		return err
+	}
+
+	for _, dir := range w.dirs {
+		if err := block(dir.feBlock); err != nil {
+			return err
+		}
+		if err := s.write(w.fileEntry(dir)); err != nil {
+			return err
+		}
+		if err := s.write(w.directoryData(dir)); err != nil {
+			return err
+		}
+	}
+
+	for _, f := range w.files {
+		if err := block(f.feBlock); err != nil {
+			return err
+		}
+		if err := s.write(w.fileEntry(f)); err != nil {
+			return err
+		}
+	}
+
+	for _, e := range w.extents {
+		if err := block(e.block); err != nil {
+			return err
+		}
+		if err := copyExtent(s, e, progress); err != nil {
+			return err
+		}
+	}
+
+	return block(w.partLength)
+}
+
+func copyExtent(s *sectorWriter, e *extent, progress func(n int64)) error {
+	f, err := os.Open(e.src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var dst io.Writer = s.w
+	if progress != nil {
+		dst = &progressWriter{w: s.w, progress: progress}
+	}
+
+	n, err := io.CopyN(dst, f, e.size)
+	if err != nil {
+		if err == io.EOF {
+			return fmt.Errorf("%s 在写入过程中被修改 (读取 %d / %d 字节)", e.src, n, e.size)
+		}
+		return fmt.Errorf("写入 %s 失败: %w", e.src, err)
+	}
+
+	if rem := e.size % SectorSize; rem != 0 {
+		if _, err := s.w.Write(make([]byte, SectorSize-rem)); err != nil {
+			return err
+		}
+	}
+	s.pos += blocks(e.size)
+	return nil
+}
+
+type progressWriter struct {
+	w        io.Writer
+	progress func(n int64)
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.progress(int64(n))
+	return n, err
+}
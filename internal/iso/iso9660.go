@@ -0,0 +1,218 @@
+package iso
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// readmeText ISO9660 部分中唯一的文件，提示该光盘需要 UDF 支持
+const readmeText = "This disc contains a \"UDF\" file system and requires an operating system\r\n" +
+	"that supports the ISO-13346 \"UDF\" file system specification.\r\n"
+
+// bootCatalogID El Torito 引导记录中的系统标识
+const bootCatalogID = "EL TORITO SPECIFICATION"
+
+// El Torito 平台标识
+const (
+	platformX86 = 0x00
+	platformEFI = 0xEF
+)
+
+func putBoth32(b []byte, v uint32) {
+	binary.LittleEndian.PutUint32(b[0:], v)
+	binary.BigEndian.PutUint32(b[4:], v)
+}
+
+func putBoth16(b []byte, v uint16) {
+	binary.LittleEndian.PutUint16(b[0:], v)
+	binary.BigEndian.PutUint16(b[2:], v)
+}
+
+// putPadded 写入用空格填充的定长字符串
+func putPadded(b []byte, s string) {
+	for i := range b {
+		b[i] = ' '
+	}
+	copy(b, s)
+}
+
+// putDecDate 17 字节的卷描述符日期格式
+func putDecDate(b []byte, t time.Time) {
+	t = t.UTC()
+	copy(b, fmt.Sprintf("%04d%02d%02d%02d%02d%02d%02d",
+		t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond()/10000000))
+	b[16] = 0
+}
+
+// putDirDate 7 字节的目录记录日期格式
+func putDirDate(b []byte, t time.Time) {
+	t = t.UTC()
+	b[0] = byte(t.Year() - 1900)
+	b[1] = byte(t.Month())
+	b[2] = byte(t.Day())
+	b[3] = byte(t.Hour())
+	b[4] = byte(t.Minute())
+	b[5] = byte(t.Second())
+	b[6] = 0
+}
+
+func dirRecord(name []byte, sector, size uint32, flags byte, t time.Time) []byte {
+	length := 33 + len(name)
+	if length%2 != 0 {
+		length++
+	}
+
+	b := make([]byte, length)
+	b[0] = byte(length)
+	putBoth32(b[2:], sector)
+	putBoth32(b[10:], size)
+	putDirDate(b[18:], t)
+	b[25] = flags
+	putBoth16(b[28:], 1)
+	b[32] = byte(len(name))
+	copy(b[33:], name)
+	return b
+}
+
+// isoVolumeID 转换为 ISO9660 d-characters
+func isoVolumeID(s string) string {
+	var sb strings.Builder
+	for _, r := range strings.ToUpper(s) {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' {
+			sb.WriteRune(r)
+		} else {
+			sb.WriteRune('_')
+		}
+	}
+	id := sb.String()
+	if len(id) > 32 {
+		id = id[:32]
+	}
+	return id
+}
+
+func (w *Writer) writeVolumeDescriptors(s *sectorWriter) error {
+	if err := s.seek(sectorPVD); err != nil {
+		return err
+	}
+
+	sectors := [][]byte{
+		w.isoPrimaryDescriptor(),
+		w.bootRecordDescriptor(),
+		volumeDescriptor(255, "CD001"),
+		volumeDescriptor(0, "BEA01"),
+		volumeDescriptor(0, "NSR02"),
+		volumeDescriptor(0, "TEA01"),
+		w.bootCatalog(),
+		pathTable(binary.LittleEndian),
+		pathTable(binary.BigEndian),
+		w.rootDirectory(),
+		[]byte(readmeText),
+	}
+	for _, b := range sectors {
+		if err := s.write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func volumeDescriptor(typ byte, id string) []byte {
+	b := make([]byte, SectorSize)
+	b[0] = typ
+	copy(b[1:6], id)
+	b[6] = 1
+	return b
+}
+
+func (w *Writer) isoPrimaryDescriptor() []byte {
+	b := volumeDescriptor(1, "CD001")
+	putPadded(b[8:40], "")
+	putPadded(b[40:72], isoVolumeID(w.opts.VolumeID))
+	putBoth32(b[80:], w.total)
+	putBoth16(b[120:], 1)
+	putBoth16(b[124:], 1)
+	putBoth16(b[128:], SectorSize)
+	putBoth32(b[132:], 10)
+	binary.LittleEndian.PutUint32(b[140:], sectorPathL)
+	binary.BigEndian.PutUint32(b[148:], sectorPathM)
+	copy(b[156:190], dirRecord([]byte{0}, sectorRootDir, SectorSize, 2, w.created))
+	putPadded(b[190:702], "")
+	putPadded(b[574:702], strings.ToUpper(strings.TrimPrefix(implementationID, "*")))
+	putPadded(b[702:813], "")
+	putDecDate(b[813:], w.created)
+	putDecDate(b[830:], w.created)
+	copy(b[847:], "0000000000000000")
+	putDecDate(b[864:], w.created)
+	b[881] = 1
+	return b
+}
+
+func (w *Writer) bootRecordDescriptor() []byte {
+	b := volumeDescriptor(0, "CD001")
+	copy(b[7:39], bootCatalogID)
+	binary.LittleEndian.PutUint32(b[71:], sectorCatalog)
+	return b
+}
+
+// bootCatalog El Torito 引导目录: BIOS 默认项 + UEFI 区段 (均为无模拟模式)
+func (w *Writer) bootCatalog() []byte {
+	b := make([]byte, SectorSize)
+
+	// 验证项
+	b[0] = 1
+	b[1] = platformX86
+	b[30] = 0x55
+	b[31] = 0xAA
+	var sum uint16
+	for i := 0; i < 32; i += 2 {
+		sum += binary.LittleEndian.Uint16(b[i:])
+	}
+	binary.LittleEndian.PutUint16(b[28:], -sum)
+
+	// 默认项 (BIOS)
+	if w.bios != nil {
+		w.bootEntry(b[32:64], w.bios)
+	}
+
+	// 区段 (UEFI)
+	if w.efi != nil {
+		b[64] = 0x91 // 最后一个区段
+		b[65] = platformEFI
+		binary.LittleEndian.PutUint16(b[66:], 1)
+		w.bootEntry(b[96:128], w.efi)
+	}
+
+	return b
+}
+
+func (w *Writer) bootEntry(b []byte, n *node) {
+	b[0] = 0x88 // 可引导
+	b[1] = 0    // 无模拟
+
+	count := (n.size + 511) / 512
+	if count > 0xFFFF {
+		count = 0xFFFF
+	}
+	binary.LittleEndian.PutUint16(b[6:], uint16(count))
+	binary.LittleEndian.PutUint32(b[8:], partitionStart+n.data.block)
+}
+
+// pathTable 只包含根目录的路径表
+func pathTable(order binary.ByteOrder) []byte {
+	b := make([]byte, 10)
+	b[0] = 1
+	order.PutUint32(b[2:], sectorRootDir)
+	order.PutUint16(b[6:], 1)
+	return b
+}
+
+func (w *Writer) rootDirectory() []byte {
+	var b []byte
+	b = append(b, dirRecord([]byte{0}, sectorRootDir, SectorSize, 2, w.created)...)
+	b = append(b, dirRecord([]byte{1}, sectorRootDir, SectorSize, 2, w.created)...)
+	b = append(b, dirRecord([]byte("README.TXT;1"), sectorReadme, uint32(len(readmeText)), 0, w.created)...)
+	return b
+}
@@ -0,0 +1,251 @@
+package iso
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeFiles 在临时目录中创建源文件 (路径使用 /)
+func writeFiles(t *testing.T, files map[string][]byte) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, data := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func (w *Writer) file(t *testing.T, name string) *node {
+	t.Helper()
+	for _, f := range w.files {
+		if f.name == name {
+			return f
+		}
+	}
+	t.Fatalf("镜像中没有 %s", name)
+	return nil
+}
+
+func readSectorAt(t *testing.T, f *os.File, sector uint32) []byte {
+	t.Helper()
+	b := make([]byte, SectorSize)
+	if _, err := f.ReadAt(b, int64(sector)*SectorSize); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// TestBootCatalog El Torito 引导目录包含 BIOS 默认项和 UEFI 区段，并指向引导映像的数据
+func TestBootCatalog(t *testing.T) {
+	etfsboot := bytes.Repeat([]byte{0xB0}, 2048)
+	efisys := bytes.Repeat([]byte{0xEF}, 1440*1024)
+	src := writeFiles(t, map[string][]byte{
+		"boot/etfsboot.com":             etfsboot,
+		"efi/microsoft/boot/efisys.bin": efisys,
+		"setup.exe":                     []byte("setup"),
+	})
+
+	dst := filepath.Join(t.TempDir(), "boot.iso")
+	if _, err := Create(src, dst, Options{
+		VolumeID: "TINY11",
+		BIOSBoot: "boot/etfsboot.com",
+		EFIBoot:  "efi/microsoft/boot/efisys.bin",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	record := readSectorAt(t, f, sectorBootRecord)
+	if record[0] != 0 || string(record[1:6]) != "CD001" {
+		t.Fatalf("引导记录描述符: % x", record[:7])
+	}
+	if id := string(bytes.TrimRight(record[7:39], "\x00")); id != bootCatalogID {
+		t.Errorf("引导系统标识 = %q", id)
+	}
+	if lba := binary.LittleEndian.Uint32(record[71:]); lba != sectorCatalog {
+		t.Fatalf("引导目录位置 = %d, want %d", lba, sectorCatalog)
+	}
+
+	catalog := readSectorAt(t, f, sectorCatalog)
+
+	// 验证项: 校验和使 16 位字之和为 0
+	if catalog[0] != 1 || catalog[1] != platformX86 || catalog[30] != 0x55 || catalog[31] != 0xAA {
+		t.Errorf("验证项: % x", catalog[:32])
+	}
+	var sum uint16
+	for i := 0; i < 32; i += 2 {
+		sum += binary.LittleEndian.Uint16(catalog[i:])
+	}
+	if sum != 0 {
+		t.Errorf("验证项校验和 = %#x", sum)
+	}
+
+	// 区段头: 最后一个区段，UEFI 平台，1 个条目
+	if catalog[64] != 0x91 || catalog[65] != platformEFI || binary.LittleEndian.Uint16(catalog[66:]) != 1 {
+		t.Errorf("UEFI 区段头: % x", catalog[64:68])
+	}
+
+	entries := []struct {
+		name    string
+		offset  int
+		content []byte
+	}{
+		{"BIOS 默认项", 32, etfsboot},
+		{"UEFI 区段项", 96, efisys},
+	}
+	for _, e := range entries {
+		b := catalog[e.offset : e.offset+32]
+		if b[0] != 0x88 || b[1] != 0 {
+			t.Errorf("%s: 可引导标志 %#x, 模拟模式 %d", e.name, b[0], b[1])
+		}
+		if count := binary.LittleEndian.Uint16(b[6:]); int(count) != len(e.content)/512 {
+			t.Errorf("%s: 扇区数 = %d, want %d", e.name, count, len(e.content)/512)
+		}
+
+		lba := binary.LittleEndian.Uint32(b[8:])
+		data := make([]byte, len(e.content))
+		if _, err := f.ReadAt(data, int64(lba)*SectorSize); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, e.content) {
+			t.Errorf("%s: 扇区 %d 处不是引导映像的内容", e.name, lba)
+		}
+	}
+}
+
+// TestLargeFileExtents 超过 4GB 的文件拆分为多个 short_ad，每个最多 maxExtent 字节且首尾相接
+func TestLargeFileExtents(t *testing.T) {
+	src := t.TempDir()
+	const size = 4<<30 + 5000
+
+	// 稀疏文件，不占用实际磁盘空间
+	f, err := os.Create(filepath.Join(src, "install.wim"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Truncate(size); err != nil {
+		f.Close()
+		t.Skipf("无法创建稀疏文件: %v", err)
+	}
+	f.Close()
+
+	w, err := NewWriter(src, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats := w.Stats(); stats.DataBytes != size || stats.ImageSize < size {
+		t.Errorf("Stats = %+v", stats)
+	}
+
+	n := w.file(t, "install.wim")
+	fe := w.fileEntry(n)
+	if got := int64(binary.LittleEndian.Uint64(fe[56:])); got != size {
+		t.Errorf("信息长度 = %d, want %d", got, size)
+	}
+	ads := fe[176 : 176+binary.LittleEndian.Uint32(fe[172:])]
+
+	u := &udfReader{partStart: partitionStart * SectorSize}
+	spans, err := u.allocation(ads, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(spans) != 5 {
+		t.Fatalf("short_ad 数量 = %d, want 5", len(spans))
+	}
+
+	var total int64
+	next := u.partStart + int64(n.data.block)*SectorSize
+	for i, sp := range spans {
+		if i < len(spans)-1 && sp.length != maxExtent {
+			t.Errorf("区段 %d 长度 = %#x, want %#x", i, sp.length, maxExtent)
+		}
+		if sp.offset != next || sp.sparse {
+			t.Errorf("区段 %d: %+v, want 偏移 %d", i, sp, next)
+		}
+		next += sp.length
+		total += sp.length
+	}
+	if total != size {
+		t.Errorf("区段总长度 = %d, want %d", total, size)
+	}
+	if last := spans[len(spans)-1].length; last != size-4*maxExtent {
+		t.Errorf("最后一个区段长度 = %d", last)
+	}
+}
+
+// TestDedup 开启 Dedup 时内容相同的文件共用一个区段，大小相同但内容不同的文件不受影响
+func TestDedup(t *testing.T) {
+	same := bytes.Repeat([]byte("tiny11"), 1000)
+	other := bytes.Repeat([]byte("TINY11"), 1000)
+	src := writeFiles(t, map[string][]byte{
+		"a.dll":     same,
+		"sub/b.dll": same,
+		"c.dll":     other,
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		w, err := NewWriter(src, Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if w.Stats().Deduped != 0 || len(w.extents) != 3 {
+			t.Errorf("Stats = %+v, 区段数 %d", w.Stats(), len(w.extents))
+		}
+	})
+
+	w, err := NewWriter(src, Options{Dedup: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := w.Stats()
+	if stats.Files != 3 || stats.Deduped != 1 || stats.SavedBytes != int64(len(same)) || len(w.extents) != 2 {
+		t.Errorf("Stats = %+v, 区段数 %d", stats, len(w.extents))
+	}
+	if a, b := w.file(t, "a.dll"), w.file(t, "b.dll"); a.data != b.data {
+		t.Errorf("相同内容的文件未共用区段: %+v, %+v", a.data, b.data)
+	}
+	if w.file(t, "a.dll").data == w.file(t, "c.dll").data {
+		t.Error("内容不同的文件共用了区段")
+	}
+
+	// 写入后两个文件指向镜像中的同一位置，内容可以正常读出
+	dst := filepath.Join(t.TempDir(), "dedup.iso")
+	if err := w.WriteFile(dst, nil); err != nil {
+		t.Fatal(err)
+	}
+	img, err := OpenImage(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer img.Close()
+
+	for name, want := range map[string][]byte{"a.dll": same, "sub/b.dll": same, "c.dll": other} {
+		got, err := fs.ReadFile(img, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s 内容不一致", name)
+		}
+	}
+	a, _ := img.lookup("a.dll")
+	b, _ := img.lookup("sub/b.dll")
+	if len(a.spans) != 1 || len(b.spans) != 1 || a.spans[0].offset != b.spans[0].offset {
+		t.Errorf("a.dll %+v, sub/b.dll %+v", a.spans, b.spans)
+	}
+}
@@ -0,0 +1,722 @@
+package iso
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// Image 以只读方式打开的 ISO 镜像文件
+// 优先读取 UDF 文件系统 (Windows 安装介质的完整目录树只在 UDF 中)，
+// 没有 UDF 时读取 ISO9660 (优先 Joliet 扩展)。Image 实现了 fs.FS，可并发读取。
+type Image struct {
+	f      *os.File
+	root   *entry
+	format string
+}
+
+// entry 目录树中的文件或目录
+type entry struct {
+	name     string
+	dir      bool
+	size     int64
+	modTime  time.Time
+	spans    []span
+	children []*entry
+}
+
+// span 文件数据在镜像中的一段字节范围，sparse 表示未记录的区段 (读取为零)
+type span struct {
+	offset int64
+	length int64
+	sparse bool
+}
+
+// OpenImage 打开 ISO 镜像并读取完整目录树
+func OpenImage(path string) (*Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	img := &Image{f: f}
+	if err := img.load(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("读取 %s 失败: %w", path, err)
+	}
+	return img, nil
+}
+
+// Close 关闭镜像文件
+func (img *Image) Close() error {
+	return img.f.Close()
+}
+
+// Format 返回读取的文件系统 ("UDF"、"Joliet" 或 "ISO9660")
+func (img *Image) Format() string {
+	return img.format
+}
+
+func (img *Image) load() error {
+	if hasUDF(img.f) {
+		u := &udfReader{r: img.f}
+		root, err := u.load()
+		if err != nil {
+			return fmt.Errorf("解析UDF失败: %w", err)
+		}
+		img.root, img.format = root, "UDF"
+		return nil
+	}
+
+	root, joliet, err := loadISO9660(img.f)
+	if err != nil {
+		return err
+	}
+	img.root, img.format = root, "ISO9660"
+	if joliet {
+		img.format = "Joliet"
+	}
+	return nil
+}
+
+func readSector(r io.ReaderAt, sector int64) ([]byte, error) {
+	b := make([]byte, SectorSize)
+	if _, err := r.ReadAt(b, sector*SectorSize); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// ==================== fs.FS ====================
+
+// Open 实现 fs.FS，名称匹配不区分大小写 (与 Windows 一致)
+func (img *Image) Open(name string) (fs.File, error) {
+	e, err := img.lookup(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	if e.dir {
+		return &dirHandle{e: e}, nil
+	}
+	return &fileHandle{e: e, r: &spanReader{r: img.f, spans: e.spans, size: e.size}}, nil
+}
+
+func (img *Image) lookup(name string) (*entry, error) {
+	if !fs.ValidPath(name) {
+		return nil, fs.ErrInvalid
+	}
+
+	e := img.root
+	if name == "." {
+		return e, nil
+	}
+
+	for _, part := range strings.Split(name, "/") {
+		if !e.dir {
+			return nil, fs.ErrNotExist
+		}
+		next := e.child(part)
+		if next == nil {
+			return nil, fs.ErrNotExist
+		}
+		e = next
+	}
+	return e, nil
+}
+
+func (e *entry) child(name string) *entry {
+	for _, c := range e.children {
+		if c.name == name {
+			return c
+		}
+	}
+	for _, c := range e.children {
+		if strings.EqualFold(c.name, name) {
+			return c
+		}
+	}
+	return nil
+}
+
+// fileInfo 同时实现 fs.FileInfo 和 fs.DirEntry
+type fileInfo struct {
+	e *entry
+}
+
+func (i fileInfo) Name() string {
+	if i.e.name == "" {
+		return "."
+	}
+	return i.e.name
+}
+
+func (i fileInfo) Size() int64        { return i.e.size }
+func (i fileInfo) ModTime() time.Time { return i.e.modTime }
+func (i fileInfo) IsDir() bool        { return i.e.dir }
+func (i fileInfo) Sys() any           { return nil }
+
+func (i fileInfo) Mode() fs.FileMode {
+	if i.e.dir {
+		return fs.ModeDir | 0755
+	}
+	return 0644
+}
+
+func (i fileInfo) Type() fs.FileMode          { return i.Mode().Type() }
+func (i fileInfo) Info() (fs.FileInfo, error) { return i, nil }
+
+type fileHandle struct {
+	e *entry
+	r *spanReader
+}
+
+func (f *fileHandle) Stat() (fs.FileInfo, error)              { return fileInfo{f.e}, nil }
+func (f *fileHandle) Read(b []byte) (int, error)              { return f.r.Read(b) }
+func (f *fileHandle) ReadAt(b []byte, off int64) (int, error) { return f.r.ReadAt(b, off) }
+func (f *fileHandle) Close() error                            { return nil }
+
+type dirHandle struct {
+	e      *entry
+	offset int
+}
+
+func (d *dirHandle) Stat() (fs.FileInfo, error) { return fileInfo{d.e}, nil }
+func (d *dirHandle) Close() error               { return nil }
+
+func (d *dirHandle) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.e.name, Err: errors.New("是目录")}
+}
+
+func (d *dirHandle) ReadDir(n int) ([]fs.DirEntry, error) {
+	rest := d.e.children[d.offset:]
+	if n > 0 && len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if n > 0 && len(rest) > n {
+		rest = rest[:n]
+	}
+	d.offset += len(rest)
+
+	list := make([]fs.DirEntry, len(rest))
+	for i, c := range rest {
+		list[i] = fileInfo{c}
+	}
+	return list, nil
+}
+
+// spanReader 按 span 列表读取文件内容
+type spanReader struct {
+	r     io.ReaderAt
+	spans []span
+	size  int64
+	pos   int64
+}
+
+func (s *spanReader) Read(b []byte) (int, error) {
+	n, err := s.ReadAt(b, s.pos)
+	s.pos += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (s *spanReader) ReadAt(b []byte, off int64) (int, error) {
+	if off >= s.size {
+		return 0, io.EOF
+	}
+	if remain := s.size - off; int64(len(b)) > remain {
+		b = b[:remain]
+	}
+
+	total := 0
+	var start int64
+	for _, sp := range s.spans {
+		if len(b) == 0 {
+			break
+		}
+		end := start + sp.length
+		if off < end {
+			rel := off - start
+			n := int(min(int64(len(b)), sp.length-rel))
+			if sp.sparse {
+				clear(b[:n])
+			} else if _, err := s.r.ReadAt(b[:n], sp.offset+rel); err != nil {
+				return total, err
+			}
+			b = b[n:]
+			off += int64(n)
+			total += n
+		}
+		start = end
+	}
+
+	if len(b) > 0 {
+		return total, io.ErrUnexpectedEOF
+	}
+	if off >= s.size {
+		return total, io.EOF
+	}
+	return total, nil
+}
+
+// ==================== UDF ====================
+
+// hasUDF 检查卷识别序列中是否有 NSR02/NSR03
+func hasUDF(r io.ReaderAt) bool {
+	for sector := int64(sectorPVD); sector < sectorPVD+64; sector++ {
+		b, err := readSector(r, sector)
+		if err != nil {
+			return false
+		}
+		id := string(b[1:6])
+		switch id {
+		case "NSR02", "NSR03":
+			return true
+		case "CD001", "BEA01", "TEA01", "CDW02", "BOOT2":
+			continue
+		}
+		if b[0] == 0 && id == "\x00\x00\x00\x00\x00" {
+			return false
+		}
+	}
+	return false
+}
+
+type udfReader struct {
+	r         io.ReaderAt
+	blockSize int64
+	partStart int64
+	visited   map[uint32]bool
+}
+
+// checkTag 校验描述符标签，返回标签标识
+func checkTag(b []byte) (uint16, error) {
+	var sum byte
+	for i := 0; i < 16; i++ {
+		if i != 4 {
+			sum += b[i]
+		}
+	}
+	if sum != b[4] {
+		return 0, errors.New("描述符标签校验和错误")
+	}
+	return le.Uint16(b[0:]), nil
+}
+
+func (u *udfReader) load() (*entry, error) {
+	anchor, err := readSector(u.r, sectorAnchor)
+	if err != nil {
+		return nil, err
+	}
+	if id, err := checkTag(anchor); err != nil || id != tagAnchor {
+		return nil, errors.New("未找到锚点描述符")
+	}
+
+	vdsLength := int64(le.Uint32(anchor[16:]))
+	vdsStart := int64(le.Uint32(anchor[20:]))
+
+	partitions := make(map[uint16]int64)
+	var partNumber uint16
+	var fsdBlock uint32
+	foundLVD := false
+
+	for i := int64(0); i < vdsLength/SectorSize; i++ {
+		b, err := readSector(u.r, vdsStart+i)
+		if err != nil {
+			return nil, err
+		}
+		id, err := checkTag(b)
+		if err != nil {
+			return nil, err
+		}
+
+		switch id {
+		case tagPartition:
+			partitions[le.Uint16(b[22:])] = int64(le.Uint32(b[188:]))
+		case tagLogicalVolume:
+			u.blockSize = int64(le.Uint32(b[212:]))
+			fsdBlock = le.Uint32(b[252:])
+			if b[440] != 1 {
+				return nil, fmt.Errorf("不支持的UDF分区映射类型: %d", b[440])
+			}
+			partNumber = le.Uint16(b[444:])
+			foundLVD = true
+		}
+		if id == tagTerminating {
+			break
+		}
+	}
+
+	start, ok := partitions[partNumber]
+	if !foundLVD || !ok {
+		return nil, errors.New("缺少逻辑卷或分区描述符")
+	}
+	if u.blockSize != SectorSize {
+		return nil, fmt.Errorf("不支持的逻辑块大小: %d", u.blockSize)
+	}
+	u.partStart = start * SectorSize
+	u.visited = make(map[uint32]bool)
+
+	fsd, err := u.block(fsdBlock)
+	if err != nil {
+		return nil, err
+	}
+	if id, err := checkTag(fsd); err != nil || id != tagFileSet {
+		return nil, errors.New("未找到文件集描述符")
+	}
+
+	root := &entry{dir: true}
+	if err := u.readEntry(root, le.Uint32(fsd[404:])); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+func (u *udfReader) block(n uint32) ([]byte, error) {
+	b := make([]byte, SectorSize)
+	if _, err := u.r.ReadAt(b, u.partStart+int64(n)*SectorSize); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// readEntry 读取 (Extended) File Entry 并填充 e，目录会递归读取子项
+func (u *udfReader) readEntry(e *entry, icb uint32) error {
+	b, err := u.block(icb)
+	if err != nil {
+		return err
+	}
+	id, err := checkTag(b)
+	if err != nil {
+		return err
+	}
+
+	var eaLen, adLen, adOffset int
+	var modTime []byte
+	switch id {
+	case tagFileEntry:
+		eaLen, adLen = int(le.Uint32(b[168:])), int(le.Uint32(b[172:]))
+		adOffset = 176
+		modTime = b[84:96]
+	case tagExtendedFileEntry:
+		eaLen, adLen = int(le.Uint32(b[208:])), int(le.Uint32(b[212:]))
+		adOffset = 216
+		modTime = b[92:104]
+	default:
+		return fmt.Errorf("块 %d 不是文件项 (标签 %d)", icb, id)
+	}
+	adOffset += eaLen
+	if adOffset+adLen > len(b) {
+		return fmt.Errorf("块 %d 的分配描述符长度无效", icb)
+	}
+
+	e.dir = b[27] == fileTypeDirectory
+	if e.dir {
+		if u.visited[icb] {
+			return fmt.Errorf("目录结构存在循环 (块 %d)", icb)
+		}
+		u.visited[icb] = true
+	}
+	e.size = int64(le.Uint64(b[56:]))
+	e.modTime = parseTimestamp(modTime)
+
+	adType := le.Uint16(b[34:]) & 0x07
+	if adType == 3 {
+		// 数据直接嵌入在文件项中
+		offset := u.partStart + int64(icb)*SectorSize + int64(adOffset)
+		e.spans = []span{{offset: offset, length: int64(adLen)}}
+	} else {
+		e.spans, err = u.allocation(b[adOffset:adOffset+adLen], adType)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !e.dir {
+		return nil
+	}
+	return u.readDirectory(e)
+}
+
+// allocation 解析 short_ad/long_ad 列表 (支持分配扩展描述符链)
+func (u *udfReader) allocation(ads []byte, adType uint16) ([]span, error) {
+	size := 8
+	switch adType {
+	case 0:
+	case 1:
+		size = 16
+	default:
+		return nil, fmt.Errorf("不支持的分配描述符类型: %d", adType)
+	}
+
+	var spans []span
+	for depth := 0; depth < 1024; depth++ {
+		var next *uint32
+		for i := 0; i+size <= len(ads); i += size {
+			raw := le.Uint32(ads[i:])
+			length, kind := int64(raw&0x3FFFFFFF), raw>>30
+			block := le.Uint32(ads[i+4:])
+			if length == 0 {
+				break
+			}
+			if kind == 3 {
+				next = &block
+				break
+			}
+			spans = append(spans, span{
+				offset: u.partStart + int64(block)*SectorSize,
+				length: length,
+				sparse: kind != 0,
+			})
+		}
+		if next == nil {
+			return spans, nil
+		}
+
+		b, err := u.block(*next)
+		if err != nil {
+			return nil, err
+		}
+		if id, err := checkTag(b); err != nil || id != tagAllocationExtent {
+			return nil, errors.New("无效的分配扩展描述符")
+		}
+		n := int(le.Uint32(b[20:]))
+		if 24+n > len(b) {
+			return nil, errors.New("无效的分配扩展描述符长度")
+		}
+		ads = b[24 : 24+n]
+	}
+	return nil, errors.New("分配扩展描述符链过长")
+}
+
+func (u *udfReader) readDirectory(dir *entry) error {
+	data := make([]byte, dir.size)
+	r := &spanReader{r: u.r, spans: dir.spans, size: dir.size}
+	if _, err := io.ReadFull(r, data); err != nil {
+		return fmt.Errorf("读取目录失败: %w", err)
+	}
+
+	for off := 0; off+38 <= len(data); {
+		fid := data[off:]
+		if id, err := checkTag(fid); err != nil || id != tagFileIdentifier {
+			return fmt.Errorf("无效的文件标识描述符 (偏移 %d)", off)
+		}
+
+		chars := fid[18]
+		nameLen := int(fid[19])
+		iuLen := int(le.Uint16(fid[36:]))
+		length := (38 + iuLen + nameLen + 3) &^ 3
+		if off+38+iuLen+nameLen > len(data) {
+			return errors.New("文件标识描述符超出目录范围")
+		}
+		icb := le.Uint32(fid[24:])
+		name := decodeName(fid[38+iuLen : 38+iuLen+nameLen])
+		off += length
+
+		if chars&(fileCharParent|fileCharDeleted) != 0 || name == "" {
+			continue
+		}
+
+		child := &entry{name: name}
+		if err := u.readEntry(child, icb); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		dir.children = append(dir.children, child)
+	}
+	return nil
+}
+
+// decodeName 解码 OSTA 压缩 Unicode
+func decodeName(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	switch b[0] {
+	case 8, 254:
+		r := make([]rune, len(b)-1)
+		for i, c := range b[1:] {
+			r[i] = rune(c)
+		}
+		return string(r)
+	case 16, 255:
+		u := make([]uint16, (len(b)-1)/2)
+		for i := range u {
+			u[i] = binary.BigEndian.Uint16(b[1+i*2:])
+		}
+		return string(utf16.Decode(u))
+	}
+	return ""
+}
+
+func parseTimestamp(b []byte) time.Time {
+	year := int(int16(le.Uint16(b[2:])))
+	if year == 0 {
+		return time.Time{}
+	}
+	t := time.Date(year, time.Month(b[4]), int(b[5]), int(b[6]), int(b[7]), int(b[8]),
+		int(b[9])*10000000+int(b[10])*100000+int(b[11])*1000, time.UTC)
+
+	// 时区偏移 (分钟，12 位有符号数)
+	tz := int16(le.Uint16(b[0:])<<4) >> 4
+	if le.Uint16(b[0:])>>12 == 1 && tz != -2047 {
+		t = t.Add(-time.Duration(tz) * time.Minute)
+	}
+	return t
+}
+
+// ==================== ISO9660 ====================
+
+// loadISO9660 读取 ISO9660 目录树，存在 Joliet 补充卷描述符时优先使用
+func loadISO9660(r io.ReaderAt) (*entry, bool, error) {
+	var primary, joliet []byte
+
+	for sector := int64(sectorPVD); sector < sectorPVD+64; sector++ {
+		b, err := readSector(r, sector)
+		if err != nil {
+			return nil, false, err
+		}
+		if string(b[1:6]) != "CD001" {
+			break
+		}
+		switch b[0] {
+		case 1:
+			primary = b
+		case 2:
+			if b[88] == '%' && b[89] == '/' && (b[90] == '@' || b[90] == 'C' || b[90] == 'E') {
+				joliet = b
+			}
+		}
+		if b[0] == 255 {
+			break
+		}
+	}
+
+	pvd, isJoliet := primary, false
+	if joliet != nil {
+		pvd, isJoliet = joliet, true
+	}
+	if pvd == nil {
+		return nil, false, errors.New("不是有效的ISO镜像")
+	}
+
+	rec := pvd[156:190]
+	root := &entry{
+		dir:  true,
+		size: int64(le.Uint32(rec[10:])),
+		spans: []span{{
+			offset: int64(le.Uint32(rec[2:])) * SectorSize,
+			length: int64(le.Uint32(rec[10:])),
+		}},
+	}
+	visited := make(map[int64]bool)
+	if err := readISODirectory(r, root, isJoliet, visited); err != nil {
+		return nil, false, err
+	}
+	return root, isJoliet, nil
+}
+
+func readISODirectory(r io.ReaderAt, dir *entry, joliet bool, visited map[int64]bool) error {
+	if visited[dir.spans[0].offset] {
+		return errors.New("目录结构存在循环")
+	}
+	visited[dir.spans[0].offset] = true
+
+	data := make([]byte, dir.size)
+	if _, err := r.ReadAt(data, dir.spans[0].offset); err != nil {
+		return err
+	}
+
+	var pending *entry
+	for off := 0; off < len(data); {
+		length := int(data[off])
+		if length == 0 {
+			// 记录不跨扇区，跳到下一个扇区
+			off = (off/SectorSize + 1) * SectorSize
+			continue
+		}
+		if off+length > len(data) || length < 34 {
+			return errors.New("无效的目录记录")
+		}
+		rec := data[off : off+length]
+		off += length
+
+		nameLen := int(rec[32])
+		rawName := rec[33 : 33+nameLen]
+		if nameLen == 1 && (rawName[0] == 0 || rawName[0] == 1) {
+			continue
+		}
+
+		flags := rec[25]
+		sp := span{
+			offset: int64(le.Uint32(rec[2:])) * SectorSize,
+			length: int64(le.Uint32(rec[10:])),
+		}
+
+		// 多区段文件: 同名记录依次追加
+		if pending != nil {
+			pending.spans = append(pending.spans, sp)
+			pending.size += sp.length
+			if flags&0x80 == 0 {
+				pending = nil
+			}
+			continue
+		}
+
+		child := &entry{
+			name:    isoName(rawName, joliet),
+			dir:     flags&0x02 != 0,
+			size:    sp.length,
+			modTime: parseDirDate(rec[18:25]),
+			spans:   []span{sp},
+		}
+		dir.children = append(dir.children, child)
+
+		if flags&0x80 != 0 {
+			pending = child
+			continue
+		}
+		if child.dir {
+			if err := readISODirectory(r, child, joliet, visited); err != nil {
+				return fmt.Errorf("%s: %w", child.name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func isoName(b []byte, joliet bool) string {
+	var name string
+	if joliet {
+		u := make([]uint16, len(b)/2)
+		for i := range u {
+			u[i] = binary.BigEndian.Uint16(b[i*2:])
+		}
+		name = string(utf16.Decode(u))
+	} else {
+		name = string(b)
+	}
+
+	if i := strings.LastIndex(name, ";"); i >= 0 {
+		name = name[:i]
+	}
+	if !joliet {
+		name = strings.TrimSuffix(name, ".")
+	}
+	return path.Base(name)
+}
+
+func parseDirDate(b []byte) time.Time {
+	if b[0] == 0 && b[1] == 0 {
+		return time.Time{}
+	}
+	t := time.Date(1900+int(b[0]), time.Month(b[1]), int(b[2]), int(b[3]), int(b[4]), int(b[5]), 0, time.UTC)
+	return t.Add(-time.Duration(int8(b[6])) * 15 * time.Minute)
+}
@@ -0,0 +1,428 @@
+package iso
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+	"unicode/utf16"
+)
+
+// UDF (ECMA-167) 描述符标识
+const (
+	tagPrimaryVolume       = 1
+	tagAnchor              = 2
+	tagImplementationUse   = 4
+	tagPartition           = 5
+	tagLogicalVolume       = 6
+	tagUnallocatedSpace    = 7
+	tagTerminating         = 8
+	tagIntegrity           = 9
+	tagFileSet             = 256
+	tagFileIdentifier      = 257
+	tagAllocationExtent    = 258
+	tagFileEntry           = 261
+	tagExtendedFileEntry   = 266
+	udfRevision            = 0x0102
+	implementationID       = "*Miku Tiny11 Builder"
+	domainID               = "*OSTA UDF Compliant"
+	lvInfoID               = "*UDF LV Info"
+	fileCharDirectory      = 0x02
+	fileCharDeleted        = 0x04
+	fileCharParent         = 0x08
+	fileTypeDirectory      = 4
+	fileTypeRegular        = 5
+	permissionsReadExecute = 0x14A5
+)
+
+var le = binary.LittleEndian
+
+var crcTable = func() [256]uint16 {
+	var t [256]uint16
+	for i := range t {
+		crc := uint16(i) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+		t[i] = crc
+	}
+	return t
+}()
+
+// crc16 CRC-ITU-T (多项式 0x1021，初始值 0)
+func crc16(b []byte) uint16 {
+	var crc uint16
+	for _, c := range b {
+		crc = crc<<8 ^ crcTable[byte(crc>>8)^c]
+	}
+	return crc
+}
+
+// setTag 填写描述符标签，b 必须是完整的描述符 (CRC 覆盖标签之后的全部字节)
+func setTag(b []byte, id uint16, location uint32) {
+	le.PutUint16(b[0:], id)
+	le.PutUint16(b[2:], 2)
+	le.PutUint16(b[6:], 1)
+	le.PutUint16(b[8:], crc16(b[16:]))
+	le.PutUint16(b[10:], uint16(len(b)-16))
+	le.PutUint32(b[12:], location)
+
+	var sum byte
+	for i := 0; i < 16; i++ {
+		if i != 4 {
+			sum += b[i]
+		}
+	}
+	b[4] = sum
+}
+
+// encodeName 编码为 OSTA 压缩 Unicode (8 位或 16 位)
+func encodeName(s string) []byte {
+	runes := []rune(s)
+	wide := false
+	for _, r := range runes {
+		if r > 0xFF {
+			wide = true
+			break
+		}
+	}
+
+	if !wide {
+		b := make([]byte, 1, len(runes)+1)
+		b[0] = 8
+		for _, r := range runes {
+			b = append(b, byte(r))
+		}
+		return b
+	}
+
+	u := utf16.Encode(runes)
+	b := make([]byte, 1+len(u)*2)
+	b[0] = 16
+	for i, c := range u {
+		binary.BigEndian.PutUint16(b[1+i*2:], c)
+	}
+	return b
+}
+
+// putDString 写入定长 dstring，最后一个字节为有效长度
+func putDString(b []byte, s string) {
+	if s == "" {
+		return
+	}
+	enc := encodeName(s)
+	if max := len(b) - 1; len(enc) > max {
+		if enc[0] == 16 && max%2 == 0 {
+			max--
+		}
+		enc = enc[:max]
+	}
+	copy(b, enc)
+	b[len(b)-1] = byte(len(enc))
+}
+
+func putCharspec(b []byte) {
+	b[0] = 0
+	copy(b[1:], "OSTA Compressed Unicode")
+}
+
+func putRegID(b []byte, id string, udfSuffix bool) {
+	copy(b[1:24], id)
+	if udfSuffix {
+		le.PutUint16(b[24:], udfRevision)
+	}
+}
+
+func putTimestamp(b []byte, t time.Time) {
+	t = t.UTC()
+	le.PutUint16(b[0:], 0x1000) // 类型 1 (本地时间)，时区偏移 0
+	le.PutUint16(b[2:], uint16(t.Year()))
+	b[4] = byte(t.Month())
+	b[5] = byte(t.Day())
+	b[6] = byte(t.Hour())
+	b[7] = byte(t.Minute())
+	b[8] = byte(t.Second())
+	ns := t.Nanosecond()
+	b[9] = byte(ns / 10000000)
+	b[10] = byte(ns / 100000 % 100)
+	b[11] = byte(ns / 1000 % 100)
+}
+
+// putLongAD 写入指向分区内块的 long_ad
+func putLongAD(b []byte, length uint32, block uint32, uniqueID uint64) {
+	le.PutUint32(b[0:], length)
+	le.PutUint32(b[4:], block)
+	le.PutUint16(b[8:], 0)
+	le.PutUint32(b[12:], uint32(uniqueID))
+}
+
+// volumeSetID 卷集标识的前 8 个字符必须唯一
+func (w *Writer) volumeSetID() string {
+	return fmt.Sprintf("%08X%s", uint32(w.created.Unix()), w.opts.VolumeID)
+}
+
+func (w *Writer) writeUDFDescriptors(s *sectorWriter) error {
+	for _, start := range []uint32{sectorMainVDS, sectorReserveVDS} {
+		if err := s.seek(start); err != nil {
+			return err
+		}
+		for i, d := range [][]byte{
+			w.primaryVolumeDescriptor(),
+			w.implementationUseDescriptor(),
+			w.partitionDescriptor(),
+			w.logicalVolumeDescriptor(),
+			unallocatedSpaceDescriptor(),
+		} {
+			le.PutUint32(d[16:], uint32(i))
+			setTag(d, le.Uint16(d[0:]), start+uint32(i))
+			if err := s.write(d); err != nil {
+				return err
+			}
+		}
+		if err := s.write(terminatingDescriptor(start + 5)); err != nil {
+			return err
+		}
+	}
+
+	if err := s.seek(sectorLVID); err != nil {
+		return err
+	}
+	if err := s.write(w.integrityDescriptor()); err != nil {
+		return err
+	}
+	if err := s.write(terminatingDescriptor(sectorLVID + 1)); err != nil {
+		return err
+	}
+
+	if err := s.seek(sectorAnchor); err != nil {
+		return err
+	}
+	return s.write(w.anchor(sectorAnchor))
+}
+
+// 以下卷描述符的序号和标签在 writeUDFDescriptors 中统一填写，此处只设置标识
+
+func (w *Writer) primaryVolumeDescriptor() []byte {
+	b := make([]byte, 512)
+	le.PutUint16(b[0:], tagPrimaryVolume)
+	putDString(b[24:56], w.opts.VolumeID)
+	le.PutUint16(b[56:], 1)
+	le.PutUint16(b[58:], 1)
+	le.PutUint16(b[60:], 2)
+	le.PutUint16(b[62:], 2)
+	le.PutUint32(b[64:], 1)
+	le.PutUint32(b[68:], 1)
+	putDString(b[72:200], w.volumeSetID())
+	putCharspec(b[200:])
+	putCharspec(b[264:])
+	putRegID(b[344:], implementationID, false)
+	putTimestamp(b[376:], w.created)
+	putRegID(b[388:], implementationID, false)
+	return b
+}
+
+func (w *Writer) implementationUseDescriptor() []byte {
+	b := make([]byte, 512)
+	le.PutUint16(b[0:], tagImplementationUse)
+	putRegID(b[20:], lvInfoID, true)
+	putCharspec(b[52:])
+	putDString(b[116:244], w.opts.VolumeID)
+	putRegID(b[352:], implementationID, false)
+	return b
+}
+
+func (w *Writer) partitionDescriptor() []byte {
+	b := make([]byte, 512)
+	le.PutUint16(b[0:], tagPartition)
+	le.PutUint16(b[20:], 1) // 已分配
+	le.PutUint16(b[22:], 0)
+	putRegID(b[24:], "+NSR02", false)
+	le.PutUint32(b[184:], 1) // 只读
+	le.PutUint32(b[188:], partitionStart)
+	le.PutUint32(b[192:], w.partLength)
+	putRegID(b[196:], implementationID, false)
+	return b
+}
+
+func (w *Writer) logicalVolumeDescriptor() []byte {
+	b := make([]byte, 446)
+	le.PutUint16(b[0:], tagLogicalVolume)
+	putCharspec(b[20:])
+	putDString(b[84:212], w.opts.VolumeID)
+	le.PutUint32(b[212:], SectorSize)
+	putRegID(b[216:], domainID, true)
+	putLongAD(b[248:], SectorSize, 0, 0) // File Set Descriptor
+	le.PutUint32(b[264:], 6)
+	le.PutUint32(b[268:], 1)
+	putRegID(b[272:], implementationID, false)
+	le.PutUint32(b[432:], 2*SectorSize)
+	le.PutUint32(b[436:], sectorLVID)
+
+	// 类型 1 分区映射
+	b[440] = 1
+	b[441] = 6
+	le.PutUint16(b[442:], 1)
+	le.PutUint16(b[444:], 0)
+	return b
+}
+
+func unallocatedSpaceDescriptor() []byte {
+	b := make([]byte, 24)
+	le.PutUint16(b[0:], tagUnallocatedSpace)
+	return b
+}
+
+func terminatingDescriptor(loc uint32) []byte {
+	b := make([]byte, 512)
+	setTag(b, tagTerminating, loc)
+	return b
+}
+
+func (w *Writer) integrityDescriptor() []byte {
+	b := make([]byte, 134)
+	putTimestamp(b[16:], w.created)
+	le.PutUint32(b[28:], 1) // 关闭
+	le.PutUint64(b[40:], w.nextID)
+	le.PutUint32(b[72:], 1)
+	le.PutUint32(b[76:], 46)
+	le.PutUint32(b[80:], 0)
+	le.PutUint32(b[84:], w.partLength)
+	putRegID(b[88:], implementationID, false)
+	le.PutUint32(b[120:], uint32(len(w.files)))
+	le.PutUint32(b[124:], uint32(len(w.dirs)))
+	le.PutUint16(b[128:], udfRevision)
+	le.PutUint16(b[130:], udfRevision)
+	le.PutUint16(b[132:], udfRevision)
+	setTag(b, tagIntegrity, sectorLVID)
+	return b
+}
+
+func (w *Writer) anchor(loc uint32) []byte {
+	b := make([]byte, 512)
+	le.PutUint32(b[16:], vdsSectors*SectorSize)
+	le.PutUint32(b[20:], sectorMainVDS)
+	le.PutUint32(b[24:], vdsSectors*SectorSize)
+	le.PutUint32(b[28:], sectorReserveVDS)
+	setTag(b, tagAnchor, loc)
+	return b
+}
+
+func (w *Writer) fileSetDescriptor() []byte {
+	b := make([]byte, 512)
+	putTimestamp(b[16:], w.created)
+	le.PutUint16(b[28:], 3)
+	le.PutUint16(b[30:], 3)
+	le.PutUint32(b[32:], 1)
+	le.PutUint32(b[36:], 1)
+	putCharspec(b[48:])
+	putDString(b[112:240], w.opts.VolumeID)
+	putCharspec(b[240:])
+	putDString(b[304:336], w.opts.VolumeID)
+	putLongAD(b[400:], SectorSize, w.root.feBlock, w.root.uniqueID)
+	putRegID(b[416:], domainID, true)
+	setTag(b, tagFileSet, 0)
+	return b
+}
+
+// fileEntry 生成文件或目录的 File Entry，数据使用 short_ad 描述
+func (w *Writer) fileEntry(n *node) []byte {
+	var ads []byte
+	var length int64
+	links := 1
+
+	if n.dir {
+		length = n.fidSize
+		ads = shortADs(n.fidBlock, n.fidSize)
+		for _, c := range n.children {
+			if c.dir {
+				links++
+			}
+		}
+	} else {
+		length = n.size
+		if n.data != nil {
+			ads = shortADs(n.data.block, n.size)
+		}
+	}
+
+	b := make([]byte, 176+len(ads))
+	// ICB 标签: 策略 4，最多 1 个条目
+	le.PutUint16(b[20:], 4)
+	le.PutUint16(b[24:], 1)
+	if n.dir {
+		b[27] = fileTypeDirectory
+	} else {
+		b[27] = fileTypeRegular
+	}
+
+	le.PutUint32(b[36:], 0xFFFFFFFF)
+	le.PutUint32(b[40:], 0xFFFFFFFF)
+	le.PutUint32(b[44:], permissionsReadExecute)
+	le.PutUint16(b[48:], uint16(links))
+	le.PutUint64(b[56:], uint64(length))
+	le.PutUint64(b[64:], uint64(blocks(length)))
+	putTimestamp(b[72:], n.modTime)
+	putTimestamp(b[84:], n.modTime)
+	putTimestamp(b[96:], n.modTime)
+	le.PutUint32(b[108:], 1)
+	putRegID(b[128:], implementationID, false)
+	le.PutUint64(b[160:], n.uniqueID)
+	le.PutUint32(b[172:], uint32(len(ads)))
+	copy(b[176:], ads)
+
+	setTag(b, tagFileEntry, n.feBlock)
+	return b
+}
+
+// shortADs 将一段连续数据拆分为多个 short_ad (每个最多约 1GB)
+func shortADs(block uint32, size int64) []byte {
+	var ads []byte
+	for size > 0 {
+		n := size
+		if n > maxExtent {
+			n = maxExtent
+		}
+		ad := make([]byte, 8)
+		le.PutUint32(ad[0:], uint32(n))
+		le.PutUint32(ad[4:], block)
+		ads = append(ads, ad...)
+
+		block += blocks(n)
+		size -= n
+	}
+	return ads
+}
+
+// fidLength 文件标识描述符长度 (按 4 字节对齐)
+func fidLength(nameLen int) int64 {
+	return int64((38 + nameLen + 3) &^ 3)
+}
+
+// directoryData 生成目录内容: 父目录项 + 每个子项的文件标识描述符
+func (w *Writer) directoryData(dir *node) []byte {
+	b := make([]byte, 0, dir.fidSize)
+
+	add := func(name []byte, chars byte, target *node) {
+		fid := make([]byte, fidLength(len(name)))
+		le.PutUint16(fid[16:], 1)
+		fid[18] = chars
+		fid[19] = byte(len(name))
+		putLongAD(fid[20:], SectorSize, target.feBlock, target.uniqueID)
+		copy(fid[38:], name)
+		setTag(fid, tagFileIdentifier, dir.fidBlock+uint32(len(b)/SectorSize))
+		b = append(b, fid...)
+	}
+
+	add(nil, fileCharDirectory|fileCharParent, dir.parent)
+	for _, c := range dir.children {
+		var chars byte
+		if c.dir {
+			chars = fileCharDirectory
+		}
+		add(encodeName(c.name), chars, c)
+	}
+	return b
+}
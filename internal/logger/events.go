@@ -0,0 +1,105 @@
+package logger
+
+import (
+	"fmt"
+	"time"
+
+	"tiny11-builder/internal/utils"
+)
+
+// 事件类型
+const (
+	EventLog      = "log"      // 日志行
+	EventStep     = "step"     // 构建步骤开始/完成/跳过
+	EventProgress = "progress" // 进度条或旋转动画
+)
+
+// 步骤状态
+const (
+	StepStarted  = "started"
+	StepFinished = "finished"
+	StepSkipped  = "skipped"
+)
+
+// Event 构建过程中的事件 (API 任务的实时事件流)
+type Event struct {
+	Time     time.Time            `json:"time"`
+	Type     string               `json:"type"`
+	Level    string               `json:"level,omitempty"` // 日志级别: info、success、warn、error、skip
+	Message  string               `json:"message,omitempty"`
+	Step     int                  `json:"step,omitempty"`
+	Steps    int                  `json:"steps,omitempty"` // 总步骤数
+	Status   string               `json:"status,omitempty"`
+	Progress *utils.ProgressEvent `json:"progress,omitempty"`
+}
+
+// SetEventSink 设置事件接收者，之后的日志、步骤和进度都会同时作为事件发送
+//
+// 接收者可能在多个 goroutine 中被调用。
+func (l *Logger) SetEventSink(fn func(Event)) {
+	l.sink = fn
+}
+
+// SetSteps 设置构建的总步骤数 (记录在步骤事件中)
+func (l *Logger) SetSteps(n int) {
+	l.steps = n
+}
+
+func (l *Logger) emit(e Event) {
+	if l.sink == nil {
+		return
+	}
+	e.Time = time.Now()
+	l.sink(e)
+}
+
+func (l *Logger) emitLog(level, msg string) {
+	l.emit(Event{Type: EventLog, Level: level, Message: msg})
+}
+
+func (l *Logger) emitStep(num int, desc, status string) {
+	l.emit(Event{Type: EventStep, Message: desc, Step: num, Steps: l.steps, Status: status})
+}
+
+// StepDone 记录步骤完成 (只写入日志文件和事件)
+func (l *Logger) StepDone(num int, desc string) {
+	if l.logger != nil {
+		l.logger.Printf("[STEP %d] 完成: %s", num, desc)
+	}
+	l.emitStep(num, desc, StepFinished)
+}
+
+// StepSkipped 记录已完成而跳过的步骤 (恢复构建)
+func (l *Logger) StepSkipped(num int, desc string) {
+	msg := fmt.Sprintf("步骤 %d 已完成: %s", num, desc)
+	fmt.Println(fmt.Sprintf("%s %s",
+		utils.Colorize("⊘", utils.MikuGray),
+		utils.Colorize(msg, utils.MikuGray),
+	))
+	if l.logger != nil {
+		l.logger.Println("[SKIP] " + msg)
+	}
+	l.emitStep(num, desc, StepSkipped)
+}
+
+// NewProgressBar 创建进度条，设置了事件接收者时进度同时作为事件发送
+func (l *Logger) NewProgressBar(total int64, prefix string) *utils.ProgressBar {
+	p := utils.NewProgressBar(total, prefix)
+	if l.sink != nil {
+		p.Observe(l.emitProgress)
+	}
+	return p
+}
+
+// NewSpinner 创建旋转动画，设置了事件接收者时状态同时作为事件发送
+func (l *Logger) NewSpinner(message string) *utils.SimpleSpinner {
+	s := utils.NewSpinner(message)
+	if l.sink != nil {
+		s.Observe(l.emitProgress)
+	}
+	return s
+}
+
+func (l *Logger) emitProgress(p utils.ProgressEvent) {
+	l.emit(Event{Type: EventProgress, Progress: &p})
+}
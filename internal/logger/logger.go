@@ -13,6 +13,8 @@ import (
 type Logger struct {
 	file    *os.File
 	logger  *log.Logger
+	sink    func(Event) // 事件接收者 (见 SetEventSink)
+	steps   int
 }
 
 // NewLogger 创建日志记录器
@@ -48,6 +50,7 @@ func (l *Logger) Info(format string, args ...interface{}) {
 	if l.logger != nil {
 		l.logger.Println(msg)
 	}
+	l.emitLog("info", msg)
 }
 
 // Success 记录成功信息
@@ -61,6 +64,7 @@ func (l *Logger) Success(format string, args ...interface{}) {
 	if l.logger != nil {
 		l.logger.Println("[SUCCESS] " + msg)
 	}
+	l.emitLog("success", msg)
 }
 
 // Warn 记录警告
@@ -74,6 +78,7 @@ func (l *Logger) Warn(format string, args ...interface{}) {
 	if l.logger != nil {
 		l.logger.Println("[WARN] " + msg)
 	}
+	l.emitLog("warn", msg)
 }
 
 // Error 记录错误
@@ -87,6 +92,7 @@ func (l *Logger) Error(format string, args ...interface{}) {
 	if l.logger != nil {
 		l.logger.Println("[ERROR] " + msg)
 	}
+	l.emitLog("error", msg)
 }
 
 // Step 记录步骤
@@ -120,6 +126,7 @@ func (l *Logger) Step(num int, desc string) {
 	if l.logger != nil {
 		l.logger.Printf("[STEP %d] %s", num, desc)
 	}
+	l.emitStep(num, desc, StepStarted)
 }
 
 // Header 显示标题
@@ -166,6 +173,15 @@ func (l *Logger) Skip(format string, args ...interface{}) {
 	if l.logger != nil {
 		l.logger.Println("[SKIP] " + msg)
 	}
+	l.emitLog("skip", msg)
+}
+
+// Path 日志文件路径 (无法创建日志文件时为空)
+func (l *Logger) Path() string {
+	if l.file == nil {
+		return ""
+	}
+	return l.file.Name()
 }
 
 // Close 关闭日志
@@ -0,0 +1,222 @@
+// Package plan 构建预演 (-plan)
+//
+// 预演以只读方式挂载源镜像，列出其中的预装应用、系统包、服务、驱动、字体
+// 和计划任务，按所选构建模式和配置文件计算构建时会移除的项、会写入的注册表
+// 值以及预计节省的空间。结束时放弃挂载，不修改安装介质和构建目录。
+package plan
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"tiny11-builder/internal/profile"
+	"tiny11-builder/internal/utils"
+)
+
+// Plan 预演结果
+type Plan struct {
+	Mode      string    `json:"mode"`
+	Profile   string    `json:"profile"`
+	Source    string    `json:"source"`
+	CreatedAt time.Time `json:"createdAt"`
+	Image     Image     `json:"image"`
+
+	Apps     Section `json:"apps"`
+	Packages Section `json:"packages"`
+	Services Section `json:"services"`
+	Drivers  Section `json:"drivers"`
+	Fonts    Section `json:"fonts"`
+	Tasks    Section `json:"scheduledTasks"`
+	Folders  Section `json:"folders"`
+
+	// Components 构建流程固定移除的组件 (Edge、OneDrive、WinRE、WinSxS 等)
+	Components []Item `json:"components"`
+
+	// Registry 构建时应用的注册表优化
+	Registry []profile.Tweak `json:"registry"`
+
+	// Savings 预计节省的空间 (未压缩大小)
+	Savings int64 `json:"estimatedSavings"`
+
+	Notes []string `json:"notes,omitempty"`
+}
+
+// Image 预演的镜像
+type Image struct {
+	Index        int    `json:"index"`
+	Name         string `json:"name"`
+	Architecture string `json:"architecture"`
+	Language     string `json:"language"`
+	Build        string `json:"build,omitempty"`
+	Size         int64  `json:"size"`
+}
+
+// Section 一类可移除项
+type Section struct {
+	// Present 镜像中现有的项
+	Present []string `json:"present"`
+
+	// Remove 构建时会移除的项
+	Remove []Item `json:"remove"`
+
+	// Missing 配置文件中列出但镜像中不存在的项 (仅按名称或路径精确指定的部分)
+	Missing []string `json:"missing,omitempty"`
+
+	// Size 移除项的总大小
+	Size int64 `json:"size"`
+}
+
+// Item 要移除的项
+type Item struct {
+	Name string `json:"name"`
+	Size int64  `json:"size,omitempty"`
+}
+
+func (s *Section) add(name string, size int64) {
+	s.Remove = append(s.Remove, Item{Name: name, Size: size})
+	s.Size += size
+}
+
+// sections 按输出顺序列出各部分
+func (p *Plan) sections() []struct {
+	title string
+	s     *Section
+} {
+	return []struct {
+		title string
+		s     *Section
+	}{
+		{"预装应用", &p.Apps},
+		{"系统包", &p.Packages},
+		{"系统服务", &p.Services},
+		{"驱动", &p.Drivers},
+		{"字体", &p.Fonts},
+		{"计划任务", &p.Tasks},
+		{"系统文件夹", &p.Folders},
+	}
+}
+
+// finish 汇总预计节省的空间 (空列表在 JSON 中输出为 [] 而不是 null)
+func (p *Plan) finish() {
+	p.Savings = 0
+	for _, sec := range p.sections() {
+		if sec.s.Present == nil {
+			sec.s.Present = []string{}
+		}
+		if sec.s.Remove == nil {
+			sec.s.Remove = []Item{}
+		}
+		p.Savings += sec.s.Size
+	}
+	if p.Components == nil {
+		p.Components = []Item{}
+	}
+	if p.Registry == nil {
+		p.Registry = []profile.Tweak{}
+	}
+	for _, c := range p.Components {
+		p.Savings += c.Size
+	}
+}
+
+// WriteJSON 将预演结果写入 JSON 文件
+func (p *Plan) WriteJSON(path string) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// Print 输出可读的预演报告
+func (p *Plan) Print() {
+	fmt.Println()
+	fmt.Println(utils.Colorize("╔════════════════════════════════════════════════════════════════════════╗", utils.MikuCyan))
+	fmt.Println(utils.Colorize("║                          📋 构建预演                                   ║", utils.MikuCyan+utils.Bold))
+	fmt.Println(utils.Colorize("╚════════════════════════════════════════════════════════════════════════╝", utils.MikuCyan))
+	fmt.Println()
+
+	field := func(label, value string) {
+		fmt.Printf("  %s %s\n", utils.Colorize(label, utils.MikuCyan), utils.Colorize(value, utils.MikuWhite))
+	}
+	field("构建模式:  ", p.Mode)
+	field("配置文件:  ", p.Profile)
+	field("安装介质:  ", p.Source)
+	field("镜像:      ", fmt.Sprintf("[%d] %s (%s, %s)", p.Image.Index, p.Image.Name, p.Image.Architecture, p.Image.Language))
+
+	for _, sec := range p.sections() {
+		s := sec.s
+		fmt.Println()
+		header := fmt.Sprintf("%s: 镜像中 %d 项，将移除 %d 项", sec.title, len(s.Present), len(s.Remove))
+		if s.Size > 0 {
+			header += fmt.Sprintf(" (约 %s)", utils.FormatBytes(s.Size))
+		}
+		fmt.Println(utils.Colorize(header, utils.MikuPink+utils.Bold))
+
+		for _, item := range s.Remove {
+			printItem(item)
+		}
+		if len(s.Missing) > 0 {
+			fmt.Println(utils.Colorize("    镜像中不存在: "+strings.Join(s.Missing, ", "), utils.MikuGray))
+		}
+	}
+
+	if len(p.Components) > 0 {
+		fmt.Println()
+		fmt.Println(utils.Colorize(fmt.Sprintf("%s 流程移除的组件:", p.Mode), utils.MikuPink+utils.Bold))
+		for _, c := range p.Components {
+			printItem(c)
+		}
+	}
+
+	fmt.Println()
+	values := 0
+	for _, t := range p.Registry {
+		values += len(t.Set) + len(t.Delete)
+	}
+	fmt.Println(utils.Colorize(fmt.Sprintf("注册表优化: %d 组，%d 项修改", len(p.Registry), values), utils.MikuPink+utils.Bold))
+	for _, t := range p.Registry {
+		title := fmt.Sprintf("  [%s] %s", t.ID, t.Description)
+		if t.Boot {
+			title += " (同时应用到 boot.wim)"
+		}
+		fmt.Println(utils.Colorize(title, utils.MikuYellow))
+		for _, v := range t.Set {
+			fmt.Printf("    设置 %s\\%s = %s (%s)\n", v.Key, v.Name, v.Value, v.Type)
+		}
+		for _, d := range t.Delete {
+			switch {
+			case d.WholeKey():
+				fmt.Printf("    删除 %s\n", d.Key)
+			case d.Default:
+				fmt.Printf("    删除 %s 的默认值\n", d.Key)
+			default:
+				fmt.Printf("    删除 %s\\%s\n", d.Key, d.Name)
+			}
+		}
+	}
+
+	fmt.Println()
+	fmt.Printf("  %s %s\n",
+		utils.Colorize("预计节省空间:", utils.MikuCyan),
+		utils.Colorize(utils.FormatBytes(p.Savings), utils.MikuGreen+utils.Bold))
+	for _, note := range p.Notes {
+		fmt.Println(utils.Colorize("  * "+note, utils.MikuGray))
+	}
+	fmt.Println()
+}
+
+func printItem(item Item) {
+	if item.Size > 0 {
+		fmt.Printf("    - %s %s\n", item.Name, utils.Colorize("("+utils.FormatBytes(item.Size)+")", utils.MikuGray))
+	} else {
+		fmt.Printf("    - %s\n", item.Name)
+	}
+}
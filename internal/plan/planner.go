@@ -0,0 +1,389 @@
+package plan
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"tiny11-builder/internal/config"
+	"tiny11-builder/internal/dism"
+	"tiny11-builder/internal/image"
+	"tiny11-builder/internal/logger"
+	"tiny11-builder/internal/profile"
+	"tiny11-builder/internal/registry"
+	"tiny11-builder/internal/remover"
+	"tiny11-builder/internal/utils"
+)
+
+// servicesKey 预演时加载 SYSTEM 配置单元副本的位置
+const servicesKey = `HKLM\zSYSTEM\ControlSet001\Services`
+
+// Planner 构建预演
+type Planner struct {
+	config  *config.Config
+	log     *logger.Logger
+	imgMgr  *image.Manager
+	runner  utils.CommandRunner
+	mode    string
+	profile *profile.Profile
+
+	// dir 预演使用的独立工作目录 (build\plan)
+	dir string
+}
+
+// NewPlanner 创建构建预演
+//
+// 预演使用独立的挂载和临时目录，不影响 build 中可以继续的构建。
+func NewPlanner(cfg *config.Config, log *logger.Logger, mode string) *Planner {
+	p := cfg.Profile
+	if p == nil {
+		p = profile.Default(mode)
+	}
+
+	dir := filepath.Join(cfg.WorkDir, "build", "plan")
+	planCfg := *cfg
+	planCfg.Tiny11Dir = filepath.Join(dir, "tiny11")
+	planCfg.ScratchDir = filepath.Join(dir, "mount")
+	planCfg.TempDir = filepath.Join(dir, "temp")
+
+	return &Planner{
+		config:  &planCfg,
+		log:     log,
+		imgMgr:  image.NewManager(&planCfg, log),
+		runner:  cfg.CommandRunner(),
+		mode:    mode,
+		profile: p,
+		dir:     dir,
+	}
+}
+
+// Run 只读挂载源镜像并生成预演结果
+func (p *Planner) Run() (*Plan, error) {
+	p.log.Header("Tiny11 Builder - 构建预演")
+	p.log.Info("构建配置: %s (%s)", p.profile.Name, p.profile.Source)
+	defer os.RemoveAll(p.dir)
+
+	if err := p.imgMgr.ValidateISO(); err != nil {
+		return nil, fmt.Errorf("ISO验证失败: %w", err)
+	}
+
+	wimPath, cleanup, err := p.imgMgr.SourceInstallWim()
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	info, err := p.imgMgr.GetImageInfoFrom(wimPath)
+	if err != nil {
+		return nil, fmt.Errorf("获取镜像信息失败: %w", err)
+	}
+
+	if err := p.imgMgr.MountReadOnly(wimPath, info.Index); err != nil {
+		return nil, err
+	}
+	defer p.imgMgr.UnmountImage(false)
+
+	source := p.config.ISOFile
+	if source == "" {
+		source = p.config.ISODrive
+	}
+
+	plan := &Plan{
+		Mode:      p.mode,
+		Profile:   p.profile.Source,
+		Source:    source,
+		CreatedAt: time.Now(),
+		Image: Image{
+			Index:        info.Index,
+			Name:         info.Name,
+			Architecture: info.Architecture,
+			Language:     info.Language,
+			Build:        info.Build,
+			Size:         info.Size,
+		},
+		Registry: slices.Concat(p.profile.Tweaks, p.config.RegTweaks),
+	}
+
+	p.log.Section("分析镜像内容")
+
+	if err := p.planApps(plan); err != nil {
+		return nil, err
+	}
+	if err := p.planPackages(plan, info.Language); err != nil {
+		return nil, err
+	}
+	if err := p.planServices(plan); err != nil {
+		p.log.Warn("读取系统服务失败: %v", err)
+		plan.Notes = append(plan.Notes, "无法读取镜像中的系统服务: "+err.Error())
+	}
+	p.planDrivers(plan)
+	p.planFonts(plan)
+	p.planTasks(plan)
+	p.planFolders(plan)
+	p.planComponents(plan)
+
+	if len(plan.Packages.Remove) > 0 {
+		plan.Notes = append(plan.Notes, "系统包的大小无法从挂载的镜像中估算，未计入预计节省空间")
+	}
+	if p.config.ThemeName != "" {
+		plan.Notes = append(plan.Notes, fmt.Sprintf("主题 %s 的注册表和文件修改未列出", p.config.ThemeName))
+	}
+	plan.Notes = append(plan.Notes, "预计节省空间按未压缩的文件大小计算，实际 ISO 大小还取决于镜像压缩和组件清理的效果")
+
+	plan.finish()
+	p.log.Success("预演完成，未修改任何文件")
+	return plan, nil
+}
+
+func (p *Planner) planApps(plan *Plan) error {
+	output, err := utils.RunWith(p.runner, "dism", "/English",
+		fmt.Sprintf("/Image:%s", p.config.ScratchDir),
+		"/Get-ProvisionedAppxPackages")
+	if err != nil {
+		return fmt.Errorf("获取应用列表失败: %w", err)
+	}
+
+	installed := dism.PackageNames(dism.ParseProvisionedAppx(output))
+	plan.Apps.Present = installed
+	p.log.Info("预装应用: %d 个", len(installed))
+
+	// 应用文件位于 Program Files\WindowsApps\<名称>_<版本>_<架构>_..._<发布者>
+	windowsApps := filepath.Join(p.config.ScratchDir, "Program Files", "WindowsApps")
+	folders, _ := utils.ListDirs(windowsApps)
+
+	for _, pkg := range p.profile.SelectApps(installed) {
+		prefix := strings.ToLower(strings.SplitN(pkg, "_", 2)[0]) + "_"
+		var size int64
+		for _, folder := range folders {
+			if strings.HasPrefix(strings.ToLower(filepath.Base(folder)), prefix) {
+				size += pathSize(folder)
+			}
+		}
+		plan.Apps.add(pkg, size)
+	}
+	return nil
+}
+
+func (p *Planner) planPackages(plan *Plan, language string) error {
+	output, err := utils.RunWith(p.runner, "dism",
+		fmt.Sprintf("/Image:%s", p.config.ScratchDir),
+		"/Get-Packages",
+		"/Format:Table")
+	if err != nil {
+		return fmt.Errorf("获取系统包列表失败: %w", err)
+	}
+
+	installed := dism.Identities(dism.ParsePackages(output))
+	plan.Packages.Present = installed
+	p.log.Info("系统包: %d 个", len(installed))
+
+	for _, pkg := range p.profile.SelectPackages(installed, language) {
+		plan.Packages.add(pkg, 0)
+	}
+	return nil
+}
+
+// planServices 读取 SYSTEM 配置单元中的服务
+//
+// 只读挂载的配置单元无法加载，先复制到临时目录再加载副本。
+func (p *Planner) planServices(plan *Plan) error {
+	hive := filepath.Join(p.config.ScratchDir, "Windows", "System32", "config", "SYSTEM")
+	hiveCopy := filepath.Join(p.config.TempDir, "SYSTEM")
+	if err := os.MkdirAll(p.config.TempDir, 0755); err != nil {
+		return err
+	}
+	if err := utils.CopyFile(hive, hiveCopy); err != nil {
+		return fmt.Errorf("复制 SYSTEM 配置单元失败: %w", err)
+	}
+
+	registry.LockHives()
+	defer registry.UnlockHives()
+	if _, err := utils.RunWith(p.runner, "reg", "load", `HKLM\zSYSTEM`, hiveCopy); err != nil {
+		return fmt.Errorf("加载 SYSTEM hive 失败: %w", err)
+	}
+	defer utils.RunWith(p.runner, "reg", "unload", `HKLM\zSYSTEM`)
+
+	output, err := utils.RunWith(p.runner, "reg", "query", servicesKey)
+	if err != nil {
+		return fmt.Errorf("读取服务列表失败: %w", err)
+	}
+
+	present := parseSubkeys(output, servicesKey)
+	plan.Services.Present = present
+	p.log.Info("系统服务: %d 个", len(present))
+
+	// 服务按名称精确删除 (注册表键名不区分大小写)
+	exists := make(map[string]string, len(present))
+	for _, name := range present {
+		exists[strings.ToLower(name)] = name
+	}
+	for _, name := range p.profile.Services {
+		if actual, ok := exists[strings.ToLower(name)]; ok {
+			plan.Services.add(actual, 0)
+		} else {
+			plan.Services.Missing = append(plan.Services.Missing, name)
+		}
+	}
+	return nil
+}
+
+func (p *Planner) planDrivers(plan *Plan) {
+	driverRepo := filepath.Join(p.config.ScratchDir, "Windows", "System32", "DriverStore", "FileRepository")
+	names := entryNames(driverRepo, true)
+	plan.Drivers.Present = names
+	p.log.Info("驱动包: %d 个", len(names))
+
+	for _, name := range p.profile.SelectDrivers(names) {
+		plan.Drivers.add(name, pathSize(filepath.Join(driverRepo, name)))
+	}
+}
+
+func (p *Planner) planFonts(plan *Plan) {
+	fontsPath := filepath.Join(p.config.ScratchDir, "Windows", "Fonts")
+	names := entryNames(fontsPath, false)
+	plan.Fonts.Present = names
+	p.log.Info("字体: %d 个", len(names))
+
+	for _, name := range p.profile.SelectFonts(names) {
+		plan.Fonts.add(name, pathSize(filepath.Join(fontsPath, name)))
+	}
+}
+
+func (p *Planner) planTasks(plan *Plan) {
+	tasksPath := filepath.Join(p.config.ScratchDir, "Windows", "System32", "Tasks")
+
+	filepath.Walk(tasksPath, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			rel, _ := filepath.Rel(tasksPath, path)
+			plan.Tasks.Present = append(plan.Tasks.Present, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	p.log.Info("计划任务: %d 个", len(plan.Tasks.Present))
+
+	for _, task := range p.profile.Tasks {
+		p.addPath(&plan.Tasks, task, task.Resolve(tasksPath))
+	}
+}
+
+func (p *Planner) planFolders(plan *Plan) {
+	for _, folder := range p.profile.Folders {
+		p.addPath(&plan.Folders, folder, folder.Resolve(p.config.ScratchDir))
+	}
+}
+
+func (p *Planner) addPath(s *Section, entry profile.PathEntry, path string) {
+	if _, err := os.Stat(path); err != nil {
+		s.Missing = append(s.Missing, entry.Path)
+		return
+	}
+	s.add(entry.Path, pathSize(path))
+}
+
+// planComponents 估算构建流程中不由配置文件控制的固定移除项
+func (p *Planner) planComponents(plan *Plan) {
+	mount := p.config.ScratchDir
+	windows := filepath.Join(mount, "Windows")
+	winsxs := filepath.Join(windows, "WinSxS")
+	arch := p.config.GetArchitecture()
+
+	component := func(name string, size int64) {
+		if size > 0 {
+			plan.Components = append(plan.Components, Item{Name: name, Size: size})
+		}
+	}
+
+	// 所有模式都会移除 Edge 和 OneDrive (路径与 remover.RemoveEdge 一致)
+	edgeSxS := globSize(filepath.Join(winsxs, arch+"_microsoft-edge-webview_*"))
+	component("Microsoft Edge", edgeSxS+
+		pathSize(filepath.Join(mount, "Program Files (x86)", "Microsoft", "Edge"))+
+		pathSize(filepath.Join(mount, "Program Files (x86)", "Microsoft", "EdgeUpdate"))+
+		pathSize(filepath.Join(mount, "Program Files (x86)", "Microsoft", "EdgeCore"))+
+		pathSize(filepath.Join(windows, "System32", "Microsoft-Edge-Webview")))
+	component("OneDrive 安装程序", pathSize(filepath.Join(windows, "System32", "OneDriveSetup.exe")))
+
+	if p.mode == profile.ModeStandard {
+		return
+	}
+
+	component("Windows 恢复环境 (winre.wim)", pathSize(filepath.Join(windows, "System32", "Recovery", "winre.wim")))
+
+	// WinSxS 只保留必要组件，Edge 组件已在上面计入
+	patterns := remover.WinSxSKeepPatterns(arch)
+	var keep int64
+	for _, pattern := range patterns {
+		keep += globSize(filepath.Join(winsxs, pattern))
+	}
+	if removed := pathSize(winsxs) - keep - edgeSxS; removed > 0 {
+		component(fmt.Sprintf("WinSxS (保留 %d 类必要组件)", len(patterns)), removed)
+	}
+
+	if p.mode == profile.ModeNano {
+		component("预编译 .NET 程序集 (NativeImages)", globSize(filepath.Join(windows, "assembly", "NativeImages_*")))
+	}
+}
+
+// parseSubkeys 从 reg query 的输出中提取 key 的直接子键名称
+// (reg 以完整路径列出子键，根键可能显示为 HKLM 或 HKEY_LOCAL_MACHINE)
+func parseSubkeys(output, key string) []string {
+	_, rest, _ := strings.Cut(key, `\`)
+	suffix := strings.ToLower(`\`+rest) + `\`
+
+	var names []string
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimRight(line, "\r ")
+		if line == "" || strings.HasPrefix(line, " ") {
+			continue
+		}
+		i := strings.Index(strings.ToLower(line), suffix)
+		if i < 0 {
+			continue
+		}
+		if name := line[i+len(suffix):]; name != "" && !strings.Contains(name, `\`) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// entryNames 列出目录中的子目录 (dirs 为 true) 或文件名称
+func entryNames(dir string, dirs bool) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() == dirs {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// pathSize 文件或目录的大小，不存在时为 0
+func pathSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	if !info.IsDir() {
+		return info.Size()
+	}
+	size, _ := utils.GetDirSize(path)
+	return size
+}
+
+func globSize(pattern string) int64 {
+	matches, _ := filepath.Glob(pattern)
+	var size int64
+	for _, m := range matches {
+		size += pathSize(m)
+	}
+	return size
+}
@@ -0,0 +1,190 @@
+package preinstall
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"tiny11-builder/internal/utils"
+)
+
+// InstallersDir 上传的安装包所在的目录 (相对于预装软件目录)
+const InstallersDir = "installers"
+
+// IDPattern 软件 id 的格式
+var IDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// configMu 串行化对 preinstall.json 的修改
+var configMu sync.Mutex
+
+// ValidID 软件 id 是否有效: 字母、数字、点、下划线和连字符
+func ValidID(id string) bool {
+	return IDPattern.MatchString(id)
+}
+
+// InstallerPath 软件安装包的路径
+func InstallerPath(dir string, app AppPackage) string {
+	return filepath.Join(dir, app.Source)
+}
+
+// WriteConfig 写入预装软件目录中的 preinstall.json
+func WriteConfig(dir string, cfg *PreinstallConfig) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	// 安装命令中可能有 > 和 &
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(cfg); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("创建预装软件目录失败: %w", err)
+	}
+	configPath := filepath.Join(dir, "preinstall.json")
+	tmp := configPath + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("写入预装配置文件失败: %w", err)
+	}
+	if err := os.Rename(tmp, configPath); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("写入预装配置文件失败: %w", err)
+	}
+	return nil
+}
+
+// AddApp 把已上传的安装包 uploaded 移动到 installers\<fileName>，并添加到 preinstall.json
+//
+// 已有相同 id (不区分大小写) 的软件时替换其配置 (沿用原 id 的大小写)，原来上传到 installers 中的
+// 安装包文件名不同时一并删除；配置文件不存在时创建并启用预装。
+// 安装命令为空时使用安装包的文件名。installers 中已有同名文件且不是被替换的软件的安装包时
+// 返回 os.ErrExist；写入配置失败时还原安装包目录。
+func AddApp(dir string, app AppPackage, fileName, uploaded string) (AppPackage, error) {
+	if !ValidID(app.ID) {
+		return app, fmt.Errorf("无效的软件 id: %q (只能包含字母、数字、点、下划线和连字符)", app.ID)
+	}
+	if fileName != filepath.Base(fileName) || strings.ContainsAny(fileName, `/\:`) ||
+		fileName == "." || fileName == ".." || fileName == "" {
+		return app, fmt.Errorf("无效的安装包文件名: %q", fileName)
+	}
+	if app.InstallCmd == "" {
+		app.InstallCmd = fileName
+	}
+	app.Source = InstallersDir + "/" + fileName
+
+	configMu.Lock()
+	defer configMu.Unlock()
+
+	cfg := &PreinstallConfig{Enabled: true}
+	if utils.FileExists(filepath.Join(dir, "preinstall.json")) {
+		var err error
+		if cfg, err = ReadConfig(dir); err != nil {
+			return app, err
+		}
+	}
+
+	index := -1
+	for i, existing := range cfg.Apps {
+		if strings.EqualFold(existing.ID, app.ID) {
+			index = i
+			app.ID = existing.ID
+			continue
+		}
+		if strings.EqualFold(filepath.ToSlash(existing.Source), app.Source) {
+			return app, fmt.Errorf("安装包 %s 已被 %s 使用: %w", fileName, existing.ID, os.ErrExist)
+		}
+	}
+
+	if app.Name == "" {
+		app.Name = app.ID
+	}
+
+	var replaced string
+	if index >= 0 {
+		replaced = filepath.ToSlash(cfg.Apps[index].Source)
+	}
+
+	// 只覆盖被替换的软件自己的安装包，不覆盖目录中其他的文件
+	target := InstallerPath(dir, app)
+	if utils.FileExists(target) && !strings.EqualFold(replaced, app.Source) {
+		return app, fmt.Errorf("安装包目录中已有 %s (未被 %s 使用): %w", fileName, app.ID, os.ErrExist)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return app, fmt.Errorf("创建安装包目录失败: %w", err)
+	}
+	restore, err := replaceFile(uploaded, target)
+	if err != nil {
+		return app, fmt.Errorf("保存安装包失败: %w", err)
+	}
+
+	if index >= 0 {
+		cfg.Apps[index] = app
+	} else {
+		cfg.Apps = append(cfg.Apps, app)
+	}
+	if err := WriteConfig(dir, cfg); err != nil {
+		restore(false)
+		return app, err
+	}
+	restore(true)
+
+	// 换了文件名重新上传时删除原来上传的安装包 (不再被任何软件引用时)
+	if strings.HasPrefix(replaced, InstallersDir+"/") && !referenced(cfg, replaced) {
+		os.Remove(filepath.Join(dir, replaced))
+	}
+	return app, nil
+}
+
+// replaceFile 把 src 移动到 dst，dst 已存在时先移到旁边的备份文件
+//
+// 返回的 done(true) 删除备份；done(false) 撤销: 删除移入的文件并还原备份。
+func replaceFile(src, dst string) (done func(keep bool), err error) {
+	var backup string
+	if utils.FileExists(dst) {
+		f, err := os.CreateTemp(filepath.Dir(dst), filepath.Base(dst)+".*.old")
+		if err != nil {
+			return nil, err
+		}
+		backup = f.Name()
+		f.Close()
+		if err := os.Rename(dst, backup); err != nil {
+			os.Remove(backup)
+			return nil, err
+		}
+	}
+
+	if err := os.Rename(src, dst); err != nil {
+		if backup != "" {
+			os.Rename(backup, dst)
+		}
+		return nil, err
+	}
+
+	return func(keep bool) {
+		if !keep {
+			os.Remove(dst)
+			if backup != "" {
+				os.Rename(backup, dst)
+			}
+			return
+		}
+		if backup != "" {
+			os.Remove(backup)
+		}
+	}, nil
+}
+
+// referenced 安装包是否被配置中的某个软件使用
+func referenced(cfg *PreinstallConfig, source string) bool {
+	for _, app := range cfg.Apps {
+		if strings.EqualFold(filepath.ToSlash(app.Source), source) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,137 @@
+package preinstall
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"tiny11-builder/internal/utils"
+)
+
+// upload 模拟 API 写入的临时上传文件
+func upload(t *testing.T, content string) string {
+	t.Helper()
+	f, err := os.CreateTemp(t.TempDir(), "upload-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(content)
+	f.Close()
+	return f.Name()
+}
+
+func TestAddAppReplacesInstaller(t *testing.T) {
+	dir := t.TempDir()
+	installer := func(name string) string {
+		return filepath.Join(dir, InstallersDir, name)
+	}
+
+	if _, err := AddApp(dir, AppPackage{ID: "7zip"}, "7z2301-x64.exe", upload(t, "v1")); err != nil {
+		t.Fatal(err)
+	}
+
+	// 相同文件名重新上传: 覆盖原文件
+	if _, err := AddApp(dir, AppPackage{ID: "7zip"}, "7z2301-x64.exe", upload(t, "v1.1")); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(installer("7z2301-x64.exe")); string(data) != "v1.1" {
+		t.Errorf("安装包内容 = %q", data)
+	}
+
+	// 换了文件名重新上传: 删除原来的安装包
+	app, err := AddApp(dir, AppPackage{ID: "7ZIP"}, "7z2408-x64.exe", upload(t, "v2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if app.ID != "7zip" || app.Source != InstallersDir+"/7z2408-x64.exe" {
+		t.Errorf("AddApp = %+v", app)
+	}
+	if utils.FileExists(installer("7z2301-x64.exe")) {
+		t.Error("原来的安装包未删除")
+	}
+	if data, _ := os.ReadFile(installer("7z2408-x64.exe")); string(data) != "v2" {
+		t.Errorf("新安装包内容 = %q", data)
+	}
+
+	cfg, err := ReadConfig(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Apps) != 1 || cfg.Apps[0].Source != app.Source {
+		t.Errorf("preinstall.json 中的软件: %+v", cfg.Apps)
+	}
+}
+
+func TestAddAppKeepsSharedInstaller(t *testing.T) {
+	dir := t.TempDir()
+
+	// 手动编辑的配置中两个软件共用一个安装包
+	shared := InstallersDir + "/setup.exe"
+	if err := WriteConfig(dir, &PreinstallConfig{Enabled: true, Apps: []AppPackage{
+		{ID: "a", Source: shared},
+		{ID: "b", Source: shared},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	os.MkdirAll(filepath.Join(dir, InstallersDir), 0755)
+	os.WriteFile(filepath.Join(dir, shared), []byte("setup"), 0644)
+
+	if _, err := AddApp(dir, AppPackage{ID: "a"}, "a.exe", upload(t, "a")); err != nil {
+		t.Fatal(err)
+	}
+	if !utils.FileExists(filepath.Join(dir, shared)) {
+		t.Error("仍被其他软件使用的安装包被删除")
+	}
+}
+
+func TestAddAppKeepsUnrelatedFiles(t *testing.T) {
+	dir := t.TempDir()
+	other := filepath.Join(dir, InstallersDir, "setup.exe")
+	os.MkdirAll(filepath.Dir(other), 0755)
+	os.WriteFile(other, []byte("manual"), 0644)
+
+	// 目录中已有未被任何软件引用的同名文件: 不覆盖
+	_, err := AddApp(dir, AppPackage{ID: "a"}, "setup.exe", upload(t, "a"))
+	if !errors.Is(err, os.ErrExist) {
+		t.Fatalf("AddApp = %v, want os.ErrExist", err)
+	}
+	if data, _ := os.ReadFile(other); string(data) != "manual" {
+		t.Errorf("已有的文件被覆盖: %q", data)
+	}
+}
+
+func TestAddAppConfigWriteFailure(t *testing.T) {
+	dir := t.TempDir()
+
+	// preinstall.json 是目录时写入配置失败，移入的安装包应被删除
+	os.MkdirAll(filepath.Join(dir, "preinstall.json", "x"), 0755)
+	if _, err := AddApp(dir, AppPackage{ID: "a"}, "a.exe", upload(t, "a")); err == nil {
+		t.Fatal("写入配置失败时 AddApp 应返回错误")
+	}
+	if utils.FileExists(filepath.Join(dir, InstallersDir, "a.exe")) {
+		t.Error("写入配置失败后留下了安装包")
+	}
+}
+
+func TestReplaceFileUndo(t *testing.T) {
+	dir := t.TempDir()
+	dst := filepath.Join(dir, "setup.exe")
+	os.WriteFile(dst, []byte("v1"), 0644)
+
+	done, err := replaceFile(upload(t, "v2"), dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(dst); string(data) != "v2" {
+		t.Errorf("替换后内容 = %q", data)
+	}
+	done(false)
+
+	if data, _ := os.ReadFile(dst); string(data) != "v1" {
+		t.Errorf("撤销后内容 = %q, want v1", data)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("撤销后留下了备份文件: %v", entries)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"tiny11-builder/internal/config"
 	"tiny11-builder/internal/logger"
@@ -64,6 +65,68 @@ func (m *Manager) LoadConfig() (*PreinstallConfig, error) {
 	return &cfg, nil
 }
 
+// ReadConfig 读取预装软件目录中的 preinstall.json (文件不存在时返回未启用的配置)
+func ReadConfig(dir string) (*PreinstallConfig, error) {
+	configPath := filepath.Join(dir, "preinstall.json")
+	if !utils.FileExists(configPath) {
+		return &PreinstallConfig{Enabled: false}, nil
+	}
+
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("读取预装配置文件失败: %w", err)
+	}
+	var cfg PreinstallConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("预装配置文件格式错误: %w", err)
+	}
+	return &cfg, nil
+}
+
+// SelectApps 校验要预装的软件 id，返回配置文件中的 id
+//
+// "all" 表示全部软件，"none" 表示不预装；id 不区分大小写。
+func (c *PreinstallConfig) SelectApps(ids []string) ([]string, error) {
+	var selected []string
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		switch strings.ToLower(id) {
+		case "none":
+			continue
+		case "all":
+			if !c.Enabled {
+				return nil, fmt.Errorf("预装软件功能未启用 (preinstall.json 不存在或 enabled 为 false)")
+			}
+			for _, app := range c.Apps {
+				if !seen[app.ID] {
+					seen[app.ID] = true
+					selected = append(selected, app.ID)
+				}
+			}
+			continue
+		}
+
+		if !c.Enabled {
+			return nil, fmt.Errorf("预装软件功能未启用 (preinstall.json 不存在或 enabled 为 false)")
+		}
+		found := false
+		for _, app := range c.Apps {
+			if strings.EqualFold(app.ID, id) {
+				found = true
+				if !seen[app.ID] {
+					seen[app.ID] = true
+					selected = append(selected, app.ID)
+				}
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("未知的预装软件: %s", id)
+		}
+	}
+	return selected, nil
+}
+
 func (m *Manager) InstallApps(selectedApps []string) error {
 	cfg, err := m.LoadConfig()
 	if err != nil {
@@ -0,0 +1,110 @@
+package profile
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+//go:embed builtin/*.json
+var builtinFS embed.FS
+
+// Builtins 返回内置配置文件名称
+func Builtins() []string {
+	entries, _ := builtinFS.ReadDir("builtin")
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, strings.TrimSuffix(e.Name(), ".json"))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Builtin 加载内置配置文件 (不展开 extends)
+func Builtin(name string) (*Profile, error) {
+	data, err := builtinFS.ReadFile("builtin/" + name + ".json")
+	if err != nil {
+		return nil, fmt.Errorf("内置配置文件不存在: %s", name)
+	}
+	p, err := parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("内置配置文件 %s 无效: %w", name, err)
+	}
+	p.Source = name
+	return p, nil
+}
+
+// Default 返回构建模式对应的内置配置文件 (已展开 extends)
+func Default(mode string) *Profile {
+	if !IsMode(mode) {
+		mode = ModeStandard
+	}
+	p, err := Resolve(mode, "")
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// Open 按名称或路径读取单个配置文件 (不展开继承，查找规则同 Resolve)
+func Open(ref, dir string) (*Profile, error) {
+	if isPath(ref) {
+		if !filepath.IsAbs(ref) && dir != "" {
+			ref = filepath.Join(dir, ref)
+		}
+		return ReadFile(ref)
+	}
+
+	if p, err := Builtin(ref); err == nil {
+		return p, nil
+	}
+
+	if dir != "" {
+		path := filepath.Join(dir, ref+".json")
+		if _, err := os.Stat(path); err == nil {
+			return ReadFile(path)
+		}
+	}
+
+	return nil, fmt.Errorf("找不到配置文件: %s (内置: %s)", ref, strings.Join(Builtins(), ", "))
+}
+
+// ReadFile 读取单个配置文件 (不展开 extends)
+func ReadFile(path string) (*Profile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取配置文件失败: %w", err)
+	}
+	p, err := parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("配置文件 %s 无效: %w", path, err)
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	p.Source = path
+	return p, nil
+}
+
+func parse(data []byte) (*Profile, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	var p Profile
+	if err := dec.Decode(&p); err != nil {
+		return nil, err
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func isPath(ref string) bool {
+	return strings.HasSuffix(strings.ToLower(ref), ".json") || strings.ContainsAny(ref, `/\`)
+}
@@ -0,0 +1,350 @@
+// Package profile 声明式构建配置文件
+//
+// 配置文件描述一次构建要移除的应用、系统包、服务、驱动、字体、计划任务、
+// 文件夹以及要应用的注册表优化。内置的 standard/core/nano 三种模式本身
+// 也是配置文件，用户可以直接选择，或通过 extends 在其基础上扩展。
+package profile
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// CurrentVersion 当前支持的配置文件格式版本
+const CurrentVersion = 1
+
+// LangPlaceholder 系统包名称中的语言占位符，构建时替换为镜像语言 (如 zh-CN)
+const LangPlaceholder = "{lang}"
+
+// 构建流程 (对应 app 中的构建器)
+const (
+	ModeStandard = "standard"
+	ModeCore     = "core"
+	ModeNano     = "nano"
+)
+
+// Profile 构建配置文件
+type Profile struct {
+	Version     int    `json:"version"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Extends     string `json:"extends,omitempty"`
+	Mode        string `json:"mode,omitempty"`
+
+	// 顶层各部分在父配置基础上追加
+	Sections
+
+	// 继承时对父配置的修改，解析后清空 (见 Resolve)
+	Import   map[string]string `json:"import,omitempty"`
+	Override *Sections         `json:"override,omitempty"`
+	Remove   *Removals         `json:"remove,omitempty"`
+
+	// Source 配置文件来源 (内置名称或文件路径)
+	Source string `json:"-"`
+
+	// Chain 解析时经过的继承链 (从最顶层的父配置开始)
+	Chain []string `json:"-"`
+
+	// Warnings 解析时发现的问题 (如 remove 中的项在父配置中不存在)
+	Warnings []string `json:"-"`
+}
+
+// Sections 配置文件中可继承的各部分
+type Sections struct {
+	Apps     []string    `json:"apps,omitempty"`
+	Packages []string    `json:"packages,omitempty"`
+	Services []string    `json:"services,omitempty"`
+	Drivers  []string    `json:"drivers,omitempty"`
+	Fonts    *FontRules  `json:"fonts,omitempty"`
+	Tasks    []PathEntry `json:"scheduledTasks,omitempty"`
+	Folders  []PathEntry `json:"folders,omitempty"`
+	Tweaks   []Tweak     `json:"tweaks,omitempty"`
+}
+
+// Removals 从父配置中删除的项: 列表按名称匹配 (不区分大小写)，
+// 计划任务和文件夹按路径匹配，注册表优化按 id 匹配
+type Removals struct {
+	Apps     []string `json:"apps,omitempty"`
+	Packages []string `json:"packages,omitempty"`
+	Services []string `json:"services,omitempty"`
+	Drivers  []string `json:"drivers,omitempty"`
+	Tasks    []string `json:"scheduledTasks,omitempty"`
+	Folders  []string `json:"folders,omitempty"`
+	Tweaks   []string `json:"tweaks,omitempty"`
+}
+
+// SectionNames 可用于 import 的部分名称
+var SectionNames = []string{"apps", "packages", "services", "drivers", "fonts", "scheduledTasks", "folders", "tweaks"}
+
+// FontRules 字体精简规则
+//
+// Keep 非空时，Windows\Fonts 中所有不匹配 Keep 的字体都会被删除；
+// 匹配 Remove 的字体无论是否匹配 Keep 都会被删除。
+type FontRules struct {
+	Keep   []string `json:"keep,omitempty"`
+	Remove []string `json:"remove,omitempty"`
+}
+
+// PathEntry 要删除的文件或目录 (相对路径，使用 / 或 \ 分隔)
+type PathEntry struct {
+	Path        string `json:"path"`
+	Description string `json:"description,omitempty"`
+}
+
+// Tweak 一组注册表修改
+type Tweak struct {
+	ID          string      `json:"id"`
+	Description string      `json:"description"`
+	Category    string      `json:"category,omitempty"` // 分类 (privacy、security、ui 等)
+	Risk        string      `json:"risk,omitempty"`     // 风险等级: low / medium / high
+	Boot        bool        `json:"boot,omitempty"`     // 同时应用到 boot.wim
+	Required    bool        `json:"required,omitempty"` // 必需: 严格模式下未生效时中止构建
+	Set         []RegValue  `json:"set,omitempty"`
+	Delete      []RegDelete `json:"delete,omitempty"`
+}
+
+// RegValue 要写入的注册表值，Key 使用挂载后的路径 (如 HKLM\zSOFTWARE\...)
+type RegValue struct {
+	Key   string `json:"key"`
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// RegDelete 要删除的注册表键或值 (Name 为空时删除整个键，Default 为 true 时只删除默认值)
+type RegDelete struct {
+	Key     string `json:"key"`
+	Name    string `json:"name,omitempty"`
+	Default bool   `json:"default,omitempty"`
+}
+
+// WholeKey 是否删除整个键
+func (d RegDelete) WholeKey() bool {
+	return d.Name == "" && !d.Default
+}
+
+// 注册表优化的风险等级
+const (
+	RiskLow    = "low"    // 只影响界面、广告等，不影响系统功能
+	RiskMedium = "medium" // 改变系统行为 (加密、安装要求等)
+	RiskHigh   = "high"   // 关闭安全防护或系统更新
+)
+
+// validTypes 支持的注册表值类型
+var validTypes = map[string]bool{
+	"REG_SZ":        true,
+	"REG_EXPAND_SZ": true,
+	"REG_DWORD":     true,
+	"REG_QWORD":     true,
+	"REG_MULTI_SZ":  true,
+	"REG_BINARY":    true,
+}
+
+// IsMode 判断是否为有效的构建流程
+func IsMode(mode string) bool {
+	switch mode {
+	case ModeStandard, ModeCore, ModeNano:
+		return true
+	}
+	return false
+}
+
+// Validate 检查配置文件内容
+func (p *Profile) Validate() error {
+	if p.Version == 0 {
+		return fmt.Errorf("缺少 version 字段")
+	}
+	if p.Version > CurrentVersion {
+		return fmt.Errorf("不支持的配置文件版本 %d (最高支持 %d)", p.Version, CurrentVersion)
+	}
+	if p.Name == "" {
+		return fmt.Errorf("缺少 name 字段")
+	}
+	if p.Mode != "" && !IsMode(p.Mode) {
+		return fmt.Errorf("无效的 mode: %s (应为 standard、core 或 nano)", p.Mode)
+	}
+
+	if p.Extends == "" && (p.Override != nil || p.Remove != nil) {
+		return fmt.Errorf("override 和 remove 只能在设置了 extends 的配置文件中使用")
+	}
+
+	if err := p.Sections.validate(""); err != nil {
+		return err
+	}
+	if p.Override != nil {
+		if err := p.Override.validate("override."); err != nil {
+			return err
+		}
+	}
+
+	for section, ref := range p.Import {
+		if !isSection(section) {
+			return fmt.Errorf("import 中的部分名称无效: %s (可用: %s)", section, strings.Join(SectionNames, ", "))
+		}
+		if ref == "" {
+			return fmt.Errorf("import.%s 缺少配置文件名称", section)
+		}
+	}
+
+	if r := p.Remove; r != nil {
+		lists := map[string][]string{
+			"apps":           r.Apps,
+			"packages":       r.Packages,
+			"services":       r.Services,
+			"drivers":        r.Drivers,
+			"scheduledTasks": r.Tasks,
+			"folders":        r.Folders,
+			"tweaks":         r.Tweaks,
+		}
+		for section, list := range lists {
+			for _, item := range list {
+				if strings.TrimSpace(item) == "" {
+					return fmt.Errorf("remove.%s 中存在空项", section)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *Sections) validate(prefix string) error {
+	patterns := map[string][]string{
+		"apps":     s.Apps,
+		"packages": s.Packages,
+		"services": s.Services,
+		"drivers":  s.Drivers,
+	}
+	if s.Fonts != nil {
+		patterns["fonts.keep"] = s.Fonts.Keep
+		patterns["fonts.remove"] = s.Fonts.Remove
+	}
+	for section, list := range patterns {
+		for _, pattern := range list {
+			if strings.TrimSpace(pattern) == "" {
+				return fmt.Errorf("%s%s 中存在空项", prefix, section)
+			}
+			if _, err := path.Match(strings.ToLower(pattern), ""); err != nil {
+				return fmt.Errorf("%s%s 中的模式无效: %s", prefix, section, pattern)
+			}
+		}
+	}
+
+	for _, entries := range [][]PathEntry{s.Tasks, s.Folders} {
+		for _, e := range entries {
+			if err := checkRelPath(e.Path); err != nil {
+				return err
+			}
+		}
+	}
+
+	ids := make(map[string]bool)
+	for _, t := range s.Tweaks {
+		if t.ID == "" {
+			return fmt.Errorf("注册表优化缺少 id: %s", t.Description)
+		}
+		if ids[t.ID] {
+			return fmt.Errorf("注册表优化 id 重复: %s", t.ID)
+		}
+		ids[t.ID] = true
+
+		switch t.Risk {
+		case "", RiskLow, RiskMedium, RiskHigh:
+		default:
+			return fmt.Errorf("注册表优化 %s: 无效的 risk: %s (应为 low、medium 或 high)", t.ID, t.Risk)
+		}
+
+		for _, v := range t.Set {
+			if v.Key == "" || v.Name == "" {
+				return fmt.Errorf("注册表优化 %s: set 项缺少 key 或 name", t.ID)
+			}
+			if !validTypes[v.Type] {
+				return fmt.Errorf("注册表优化 %s: 不支持的值类型 %s", t.ID, v.Type)
+			}
+		}
+		for _, d := range t.Delete {
+			if d.Key == "" {
+				return fmt.Errorf("注册表优化 %s: delete 项缺少 key", t.ID)
+			}
+		}
+	}
+
+	return nil
+}
+
+func isSection(name string) bool {
+	for _, s := range SectionNames {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRelPath 路径必须是不越出根目录的相对路径
+func checkRelPath(p string) error {
+	clean := path.Clean(strings.ReplaceAll(p, "\\", "/"))
+	if p == "" || clean == "." || path.IsAbs(clean) || filepath.VolumeName(p) != "" ||
+		clean == ".." || strings.HasPrefix(clean, "../") {
+		return fmt.Errorf("无效的相对路径: %q", p)
+	}
+	return nil
+}
+
+// Resolve 将相对路径转换为 root 下的本地路径
+func (e PathEntry) Resolve(root string) string {
+	return filepath.Join(root, filepath.FromSlash(strings.ReplaceAll(e.Path, "\\", "/")))
+}
+
+// Label 日志中显示的名称
+func (e PathEntry) Label() string {
+	if e.Description != "" {
+		return e.Description
+	}
+	return e.Path
+}
+
+// PackagePatterns 返回替换语言占位符后的系统包模式
+func (p *Profile) PackagePatterns(languageCode string) []string {
+	patterns := make([]string, 0, len(p.Packages))
+	for _, pattern := range p.Packages {
+		patterns = append(patterns, strings.ReplaceAll(pattern, LangPlaceholder, languageCode))
+	}
+	return patterns
+}
+
+// BootTweaks 返回需要同时应用到 boot.wim 的注册表优化
+func (p *Profile) BootTweaks() []Tweak {
+	var tweaks []Tweak
+	for _, t := range p.Tweaks {
+		if t.Boot {
+			tweaks = append(tweaks, t)
+		}
+	}
+	return tweaks
+}
+
+// Match 判断名称是否匹配模式 (不区分大小写)
+//
+// 含 * 或 ? 的模式按通配符整体匹配，否则按子串匹配。
+func Match(pattern, name string) bool {
+	pattern = strings.ToLower(pattern)
+	name = strings.ToLower(name)
+	if strings.ContainsAny(pattern, "*?") {
+		matched, _ := path.Match(pattern, name)
+		return matched
+	}
+	return strings.Contains(name, pattern)
+}
+
+// MatchAny 判断名称是否匹配任一模式
+func MatchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if Match(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,322 @@
+package profile
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Resolve 按名称或路径加载配置文件并展开继承链，返回最终生效的配置
+//
+// ref 以 .json 结尾或包含路径分隔符时视为文件路径；否则依次查找内置配置文件
+// 和 dir 中的 <ref>.json。
+//
+// 每一层在父配置基础上依次应用: override (整体替换某部分) -> import (追加
+// 其他配置文件的某部分) -> 顶层各部分 (追加，同 id 的注册表优化替换) ->
+// remove (删除)。解析结果不再包含 extends/import/override/remove。
+func Resolve(ref, dir string) (*Profile, error) {
+	return resolve(ref, dir, nil)
+}
+
+func resolve(ref, dir string, chain []string) (*Profile, error) {
+	p, err := Open(ref, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, seen := range chain {
+		if seen == p.Source {
+			return nil, fmt.Errorf("配置文件循环引用: %s -> %s", strings.Join(chain, " -> "), p.Source)
+		}
+	}
+	chain = append(append([]string(nil), chain...), p.Source)
+
+	// 相对路径的引用基于当前文件所在目录查找
+	baseDir := dir
+	if isPath(p.Source) {
+		baseDir = filepath.Dir(p.Source)
+	}
+
+	parent := &Profile{}
+	if p.Extends != "" {
+		parent, err = resolve(p.Extends, baseDir, chain)
+		if err != nil {
+			return nil, fmt.Errorf("加载 %s 的父配置文件失败: %w", p.Name, err)
+		}
+	}
+
+	out := &Profile{
+		Version:     p.Version,
+		Name:        p.Name,
+		Description: p.Description,
+		Mode:        p.Mode,
+		Source:      p.Source,
+		Chain:       append(append([]string(nil), parent.Chain...), p.Source),
+		Warnings:    append([]string(nil), parent.Warnings...),
+	}
+	if out.Mode == "" {
+		out.Mode = parent.Mode
+	}
+	if out.Description == "" {
+		out.Description = parent.Description
+	}
+	out.Sections.add(&parent.Sections)
+
+	if p.Override != nil {
+		out.Sections.override(p.Override)
+	}
+
+	sections := make([]string, 0, len(p.Import))
+	for section := range p.Import {
+		sections = append(sections, section)
+	}
+	sort.Strings(sections)
+	for _, section := range sections {
+		src, err := resolve(p.Import[section], baseDir, chain)
+		if err != nil {
+			return nil, fmt.Errorf("%s 导入 %s 失败: %w", p.Name, section, err)
+		}
+		out.Sections.add(src.Sections.only(section))
+	}
+
+	out.Sections.add(&p.Sections)
+
+	if p.Remove != nil {
+		for _, w := range out.Sections.remove(p.Remove) {
+			out.Warnings = append(out.Warnings, fmt.Sprintf("%s: %s", p.Name, w))
+		}
+	}
+
+	return out, nil
+}
+
+// add 追加另一组配置 (跳过重复项，同 id 的注册表优化替换)
+func (s *Sections) add(o *Sections) {
+	s.Apps = appendUnique(s.Apps, o.Apps)
+	s.Packages = appendUnique(s.Packages, o.Packages)
+	s.Services = appendUnique(s.Services, o.Services)
+	s.Drivers = appendUnique(s.Drivers, o.Drivers)
+
+	if o.Fonts != nil {
+		var fonts FontRules
+		if s.Fonts != nil {
+			fonts = *s.Fonts
+		}
+		s.Fonts = &FontRules{
+			Keep:   appendUnique(fonts.Keep, o.Fonts.Keep),
+			Remove: appendUnique(fonts.Remove, o.Fonts.Remove),
+		}
+	}
+
+	s.Tasks = appendPaths(s.Tasks, o.Tasks)
+	s.Folders = appendPaths(s.Folders, o.Folders)
+
+	tweaks := append([]Tweak(nil), s.Tweaks...)
+	for _, t := range o.Tweaks {
+		replaced := false
+		for i := range tweaks {
+			if tweaks[i].ID == t.ID {
+				tweaks[i] = t
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			tweaks = append(tweaks, t)
+		}
+	}
+	s.Tweaks = tweaks
+}
+
+// override 用另一组配置中出现的部分整体替换 (空列表表示清空)
+func (s *Sections) override(o *Sections) {
+	if o.Apps != nil {
+		s.Apps = append([]string(nil), o.Apps...)
+	}
+	if o.Packages != nil {
+		s.Packages = append([]string(nil), o.Packages...)
+	}
+	if o.Services != nil {
+		s.Services = append([]string(nil), o.Services...)
+	}
+	if o.Drivers != nil {
+		s.Drivers = append([]string(nil), o.Drivers...)
+	}
+	if o.Fonts != nil {
+		fonts := *o.Fonts
+		s.Fonts = &fonts
+	}
+	if o.Tasks != nil {
+		s.Tasks = append([]PathEntry(nil), o.Tasks...)
+	}
+	if o.Folders != nil {
+		s.Folders = append([]PathEntry(nil), o.Folders...)
+	}
+	if o.Tweaks != nil {
+		s.Tweaks = append([]Tweak(nil), o.Tweaks...)
+	}
+}
+
+// only 返回只包含指定部分的副本
+func (s *Sections) only(section string) *Sections {
+	out := &Sections{}
+	switch section {
+	case "apps":
+		out.Apps = s.Apps
+	case "packages":
+		out.Packages = s.Packages
+	case "services":
+		out.Services = s.Services
+	case "drivers":
+		out.Drivers = s.Drivers
+	case "fonts":
+		out.Fonts = s.Fonts
+	case "scheduledTasks":
+		out.Tasks = s.Tasks
+	case "folders":
+		out.Folders = s.Folders
+	case "tweaks":
+		out.Tweaks = s.Tweaks
+	}
+	return out
+}
+
+// remove 删除指定的项，返回未找到的项的提示
+func (s *Sections) remove(r *Removals) []string {
+	var warnings []string
+	notFound := func(section string, missing []string) {
+		for _, m := range missing {
+			warnings = append(warnings, fmt.Sprintf("remove.%s 中的 %q 不存在", section, m))
+		}
+	}
+
+	var missing []string
+	s.Apps, missing = removeStrings(s.Apps, r.Apps)
+	notFound("apps", missing)
+	s.Packages, missing = removeStrings(s.Packages, r.Packages)
+	notFound("packages", missing)
+	s.Services, missing = removeStrings(s.Services, r.Services)
+	notFound("services", missing)
+	s.Drivers, missing = removeStrings(s.Drivers, r.Drivers)
+	notFound("drivers", missing)
+	s.Tasks, missing = removePaths(s.Tasks, r.Tasks)
+	notFound("scheduledTasks", missing)
+	s.Folders, missing = removePaths(s.Folders, r.Folders)
+	notFound("folders", missing)
+
+	for _, id := range r.Tweaks {
+		found := false
+		for i, t := range s.Tweaks {
+			if t.ID == id {
+				s.Tweaks = append(s.Tweaks[:i:i], s.Tweaks[i+1:]...)
+				found = true
+				break
+			}
+		}
+		if !found {
+			notFound("tweaks", []string{id})
+		}
+	}
+
+	return warnings
+}
+
+func removeStrings(list, remove []string) ([]string, []string) {
+	if len(remove) == 0 {
+		return list, nil
+	}
+
+	drop := make(map[string]bool, len(remove))
+	for _, r := range remove {
+		drop[strings.ToLower(r)] = true
+	}
+
+	var out []string
+	hit := make(map[string]bool)
+	for _, item := range list {
+		key := strings.ToLower(item)
+		if drop[key] {
+			hit[key] = true
+			continue
+		}
+		out = append(out, item)
+	}
+
+	var missing []string
+	for _, r := range remove {
+		if !hit[strings.ToLower(r)] {
+			missing = append(missing, r)
+		}
+	}
+	return out, missing
+}
+
+func removePaths(list []PathEntry, remove []string) ([]PathEntry, []string) {
+	if len(remove) == 0 {
+		return list, nil
+	}
+
+	var out []PathEntry
+	var missing []string
+	hit := make(map[int]bool)
+	for _, item := range list {
+		matched := false
+		for i, r := range remove {
+			if samePath(item.Path, r) {
+				hit[i] = true
+				matched = true
+			}
+		}
+		if !matched {
+			out = append(out, item)
+		}
+	}
+
+	for i, r := range remove {
+		if !hit[i] {
+			missing = append(missing, r)
+		}
+	}
+	return out, missing
+}
+
+func samePath(a, b string) bool {
+	clean := func(p string) string {
+		return strings.ToLower(path.Clean(strings.ReplaceAll(p, "\\", "/")))
+	}
+	return clean(a) == clean(b)
+}
+
+func appendUnique(base, extra []string) []string {
+	out := append([]string(nil), base...)
+	seen := make(map[string]bool, len(out))
+	for _, s := range out {
+		seen[strings.ToLower(s)] = true
+	}
+	for _, s := range extra {
+		if !seen[strings.ToLower(s)] {
+			seen[strings.ToLower(s)] = true
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func appendPaths(base, extra []PathEntry) []PathEntry {
+	out := append([]PathEntry(nil), base...)
+	for _, e := range extra {
+		dup := false
+		for _, b := range out {
+			if samePath(b.Path, e.Path) {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			out = append(out, e)
+		}
+	}
+	return out
+}
@@ -0,0 +1,57 @@
+package profile
+
+// 以下方法根据配置文件从镜像中实际存在的项里挑选要移除的项，
+// 构建 (remover) 和预演 (plan) 共用，保证两者结果一致。
+
+// SelectApps 返回匹配 apps 模式的预装应用包
+func (p *Profile) SelectApps(installed []string) []string {
+	return selectMatching(p.Apps, installed)
+}
+
+// SelectPackages 返回匹配 packages 模式的系统包，按模式顺序排列并去重
+func (p *Profile) SelectPackages(installed []string, languageCode string) []string {
+	var selected []string
+	seen := make(map[string]bool)
+	for _, pattern := range p.PackagePatterns(languageCode) {
+		for _, pkg := range installed {
+			if !seen[pkg] && Match(pattern, pkg) {
+				seen[pkg] = true
+				selected = append(selected, pkg)
+			}
+		}
+	}
+	return selected
+}
+
+// SelectDrivers 返回匹配 drivers 模式的驱动包目录
+func (p *Profile) SelectDrivers(names []string) []string {
+	return selectMatching(p.Drivers, names)
+}
+
+// SelectFonts 返回按字体规则要删除的字体文件
+func (p *Profile) SelectFonts(names []string) []string {
+	rules := p.Fonts
+	if rules == nil {
+		return nil
+	}
+
+	var selected []string
+	for _, name := range names {
+		// 未配置保留列表时只删除明确要移除的字体
+		keep := len(rules.Keep) == 0 || MatchAny(rules.Keep, name)
+		if MatchAny(rules.Remove, name) || !keep {
+			selected = append(selected, name)
+		}
+	}
+	return selected
+}
+
+func selectMatching(patterns, names []string) []string {
+	var selected []string
+	for _, name := range names {
+		if MatchAny(patterns, name) {
+			selected = append(selected, name)
+		}
+	}
+	return selected
+}
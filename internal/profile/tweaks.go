@@ -0,0 +1,126 @@
+package profile
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TweakInfo 注册表优化目录中的一项
+type TweakInfo struct {
+	ID          string   `json:"id"`
+	Description string   `json:"description"`
+	Category    string   `json:"category,omitempty"`
+	Risk        string   `json:"risk,omitempty"`
+	Modes       []string `json:"modes"` // 默认包含该优化的构建模式
+	Boot        bool     `json:"boot,omitempty"`
+	Required    bool     `json:"required,omitempty"`
+}
+
+// Catalog 返回内置配置文件中的全部注册表优化
+//
+// 按 standard -> core -> nano 的顺序列出，每项记录默认包含它的构建模式。
+// -enable-tweak 可以启用目录中任意一项。
+func Catalog() []TweakInfo {
+	var infos []TweakInfo
+	index := make(map[string]int)
+	for _, mode := range []string{ModeStandard, ModeCore, ModeNano} {
+		for _, t := range Default(mode).Tweaks {
+			i, ok := index[t.ID]
+			if !ok {
+				i = len(infos)
+				index[t.ID] = i
+				infos = append(infos, TweakInfo{
+					ID:          t.ID,
+					Description: t.Description,
+					Category:    t.Category,
+					Risk:        t.Risk,
+					Boot:        t.Boot,
+					Required:    t.Required,
+				})
+			}
+			infos[i].Modes = append(infos[i].Modes, mode)
+		}
+	}
+	return infos
+}
+
+// catalogTweak 按 id 查找内置的注册表优化 (优先使用最先包含它的模式中的定义)
+func catalogTweak(id string) (Tweak, bool) {
+	for _, mode := range []string{ModeStandard, ModeCore, ModeNano} {
+		for _, t := range Default(mode).Tweaks {
+			if t.ID == id {
+				return t, true
+			}
+		}
+	}
+	return Tweak{}, false
+}
+
+// KnownTweak id 是否为配置中已有的或内置目录中的优化
+func (p *Profile) KnownTweak(id string) bool {
+	if _, ok := catalogTweak(id); ok {
+		return true
+	}
+	for _, t := range p.Tweaks {
+		if t.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// SelectTweaks 在配置文件的基础上单独启用或禁用注册表优化
+//
+// disable 中的 id 从配置中去掉；enable 中的 id 不在配置中时从内置目录追加。
+// 两个列表中的 id 都必须是配置中已有的或内置目录中的优化，同一 id 不能
+// 同时启用和禁用。
+func (p *Profile) SelectTweaks(enable, disable []string) error {
+	known := p.KnownTweak
+
+	disabled := make(map[string]bool, len(disable))
+	for _, id := range disable {
+		if !known(id) {
+			return fmt.Errorf("未知的注册表优化: %s (可用 tweaks list 查看)", id)
+		}
+		disabled[id] = true
+	}
+	for _, id := range enable {
+		if !known(id) {
+			return fmt.Errorf("未知的注册表优化: %s (可用 tweaks list 查看)", id)
+		}
+		if disabled[id] {
+			return fmt.Errorf("注册表优化 %s 不能同时启用和禁用", id)
+		}
+	}
+
+	var tweaks []Tweak
+	present := make(map[string]bool)
+	for _, t := range p.Tweaks {
+		if disabled[t.ID] {
+			continue
+		}
+		present[t.ID] = true
+		tweaks = append(tweaks, t)
+	}
+	for _, id := range enable {
+		if present[id] {
+			continue
+		}
+		t, _ := catalogTweak(id)
+		present[id] = true
+		tweaks = append(tweaks, t)
+	}
+	p.Tweaks = tweaks
+	return nil
+}
+
+// SplitTweakIDs 拆分以逗号分隔的优化 id 列表 (去掉空项)
+func SplitTweakIDs(s string) []string {
+	var ids []string
+	for _, id := range strings.Split(s, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
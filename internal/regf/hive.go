@@ -0,0 +1,456 @@
+// Package regf 离线读写 Windows 注册表配置单元文件 (regf 格式)
+//
+// 直接打开 SYSTEM、SOFTWARE、DEFAULT、NTUSER.DAT、COMPONENTS 等配置单元文件，
+// 在内存中创建、读取、修改和删除键与值，不需要 reg load/unload、管理员权限或
+// Windows 主机。打开未正常关闭的配置单元时从事务日志 (.LOG1/.LOG2) 恢复；
+// Save 写回文件时更新序列号和校验和，并清空事务日志。
+//
+// 修改直接作用于原有的单元 (cell)：新单元优先使用空闲单元，空间不足时在
+// 文件末尾追加 hbin；释放的单元与相邻的空闲单元合并，不会整理或压缩文件。
+package regf
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+	"unicode/utf16"
+)
+
+var le = binary.LittleEndian
+
+const (
+	baseBlockSize  = 4096
+	hbinHeaderSize = 32
+	hbinAlign      = 4096
+
+	// invalidOffset 表示不存在的单元
+	invalidOffset = 0xFFFFFFFF
+
+	// bigDataThreshold 超过该大小的值数据使用 db 分段存储 (1.4 及以上版本)
+	bigDataThreshold = 16344
+)
+
+// 基本块字段偏移
+const (
+	bbSignature = 0
+	bbSequence1 = 4
+	bbSequence2 = 8
+	bbTimestamp = 12
+	bbMajor     = 20
+	bbMinor     = 24
+	bbFileType  = 28
+	bbFormat    = 32
+	bbRootCell  = 36
+	bbBinsSize  = 40
+	bbClusters  = 44
+	bbFileName  = 48
+	bbChecksum  = 508
+)
+
+// ErrNotFound 键或值不存在
+var ErrNotFound = errors.New("注册表键或值不存在")
+
+// Hive 已打开的配置单元
+type Hive struct {
+	path string
+
+	// data 完整的文件内容 (基本块 + 所有 hbin)
+	data []byte
+
+	// bins 各 hbin 的范围 (相对于 hbin 数据区)，单元不会跨越 hbin
+	bins []binRange
+
+	// 空闲单元: 起始偏移 -> 大小，结束偏移 -> 起始偏移 (用于合并相邻的空闲单元)
+	freeCells map[uint32]uint32
+	freeEnds  map[uint32]uint32
+
+	modified bool
+}
+
+type binRange struct {
+	start, end uint32
+}
+
+// IsHive 判断文件是否为 regf 格式的配置单元
+func IsHive(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	sig := make([]byte, 4)
+	if _, err := f.Read(sig); err != nil {
+		return false
+	}
+	return string(sig) == "regf"
+}
+
+// Open 打开配置单元文件，需要时从事务日志恢复
+func Open(path string) (*Hive, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < baseBlockSize || string(data[:4]) != "regf" {
+		return nil, fmt.Errorf("%s 不是注册表配置单元文件", path)
+	}
+
+	h := &Hive{path: path, data: data}
+
+	validBase := checksum(data) == le.Uint32(data[bbChecksum:])
+	dirty := le.Uint32(data[bbSequence1:]) != le.Uint32(data[bbSequence2:])
+	if !validBase || dirty {
+		if err := h.recover(validBase); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	if major := le.Uint32(h.data[bbMajor:]); major != 1 {
+		return nil, fmt.Errorf("%s: 不支持的配置单元版本 %d.%d", path, major, le.Uint32(h.data[bbMinor:]))
+	}
+	if t := le.Uint32(h.data[bbFileType:]); t != 0 {
+		return nil, fmt.Errorf("%s: 不是主配置单元文件 (类型 %d)", path, t)
+	}
+
+	binsSize := int(le.Uint32(h.data[bbBinsSize:]))
+	if binsSize%hbinAlign != 0 || baseBlockSize+binsSize > len(h.data) {
+		return nil, fmt.Errorf("%s: hbin 数据大小无效 (%d)", path, binsSize)
+	}
+	// 文件末尾可能有填充，只保留 hbin 数据区
+	h.data = h.data[:baseBlockSize+binsSize]
+	if err := h.scanBins(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if _, err := h.Root(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return h, nil
+}
+
+// New 创建只包含根键的空配置单元 (调用 Save 后写入 path)
+func New(path, rootName string) (*Hive, error) {
+	h := &Hive{
+		path:      path,
+		data:      make([]byte, baseBlockSize),
+		freeCells: make(map[uint32]uint32),
+		freeEnds:  make(map[uint32]uint32),
+		modified:  true,
+	}
+
+	b := h.data
+	copy(b[bbSignature:], "regf")
+	le.PutUint32(b[bbSequence1:], 1)
+	le.PutUint32(b[bbSequence2:], 1)
+	le.PutUint32(b[bbMajor:], 1)
+	le.PutUint32(b[bbMinor:], 5)
+	le.PutUint32(b[bbFormat:], 1)
+	le.PutUint32(b[bbClusters:], 1)
+
+	// 根键的安全描述符: 所有者和组为 SYSTEM，不设置 DACL
+	sd := []byte{
+		1, 0, 0x00, 0x80, // 修订版本 1，SE_SELF_RELATIVE
+		20, 0, 0, 0, // 所有者偏移
+		32, 0, 0, 0, // 组偏移
+		0, 0, 0, 0, // SACL
+		0, 0, 0, 0, // DACL
+		1, 1, 0, 0, 0, 0, 0, 5, 18, 0, 0, 0, // S-1-5-18
+		1, 1, 0, 0, 0, 0, 0, 5, 18, 0, 0, 0,
+	}
+	skOff, err := h.alloc(20 + len(sd))
+	if err != nil {
+		return nil, err
+	}
+	sk := h.mustCell(skOff)
+	copy(sk, "sk")
+	le.PutUint32(sk[skFlink:], skOff)
+	le.PutUint32(sk[skBlink:], skOff)
+	le.PutUint32(sk[skRefCount:], 1)
+	le.PutUint32(sk[skDescSize:], uint32(len(sd)))
+	copy(sk[skDesc:], sd)
+
+	root, err := h.newKey(rootName, invalidOffset, skOff)
+	if err != nil {
+		return nil, err
+	}
+	nk := h.mustCell(root)
+	le.PutUint16(nk[nkFlags:], le.Uint16(nk[nkFlags:])|keyHiveEntry|keyNoDelete)
+	le.PutUint32(h.data[bbRootCell:], root)
+
+	name := utf16.Encode([]rune(rootName))
+	for i := 0; i < len(name) && i < 32; i++ {
+		le.PutUint16(h.data[bbFileName+i*2:], name[i])
+	}
+
+	return h, nil
+}
+
+// Path 配置单元文件路径
+func (h *Hive) Path() string {
+	return h.path
+}
+
+// Modified 打开后是否有修改 (或从事务日志恢复过)
+func (h *Hive) Modified() bool {
+	return h.modified
+}
+
+// Root 返回根键
+func (h *Hive) Root() (*Key, error) {
+	off := le.Uint32(h.data[bbRootCell:])
+	c, err := h.cell(off)
+	if err != nil || len(c) < nkName || string(c[:2]) != "nk" {
+		return nil, fmt.Errorf("根键无效")
+	}
+	return &Key{h: h, off: off}, nil
+}
+
+// Save 写回配置单元文件并清空事务日志
+//
+// 先写入临时文件再替换原文件，写入过程中断时原文件保持不变。
+func (h *Hive) Save() error {
+	b := h.data
+
+	seq := le.Uint32(b[bbSequence1:]) + 1
+	le.PutUint32(b[bbSequence1:], seq)
+	le.PutUint32(b[bbSequence2:], seq)
+	le.PutUint64(b[bbTimestamp:], filetime(time.Now()))
+	le.PutUint32(b[bbBinsSize:], uint32(len(b)-baseBlockSize))
+	le.PutUint32(b[bbChecksum:], checksum(b))
+
+	tmp := h.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, h.path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	if err := clearLogs(h.path); err != nil {
+		return fmt.Errorf("清空事务日志失败: %w", err)
+	}
+
+	h.modified = false
+	return nil
+}
+
+// checksum 基本块校验和: 前 508 字节按 32 位异或
+func checksum(b []byte) uint32 {
+	var sum uint32
+	for i := 0; i < bbChecksum; i += 4 {
+		sum ^= le.Uint32(b[i:])
+	}
+	switch sum {
+	case 0:
+		return 1
+	case 0xFFFFFFFF:
+		return 0xFFFFFFFE
+	}
+	return sum
+}
+
+// filetime 转换为 Windows FILETIME (1601-01-01 起的 100 纳秒数)
+func filetime(t time.Time) uint64 {
+	return uint64(t.UnixNano()/100) + 116444736000000000
+}
+
+// ==================== 单元分配 ====================
+
+// cell 返回已分配单元的数据 (不含大小字段)
+//
+// 返回的切片引用 h.data，分配新单元后可能失效，需要重新获取。
+func (h *Hive) cell(off uint32) ([]byte, error) {
+	if off == invalidOffset || off%8 != 0 {
+		return nil, fmt.Errorf("无效的单元偏移 0x%x", off)
+	}
+	abs := baseBlockSize + int(off)
+	if abs+4 > len(h.data) {
+		return nil, fmt.Errorf("单元偏移 0x%x 超出文件范围", off)
+	}
+	size := int32(le.Uint32(h.data[abs:]))
+	if size >= 0 {
+		return nil, fmt.Errorf("单元 0x%x 未分配", off)
+	}
+	n := int(-size)
+	if n < 8 || abs+n > len(h.data) {
+		return nil, fmt.Errorf("单元 0x%x 大小无效", off)
+	}
+	return h.data[abs+4 : abs+n], nil
+}
+
+// mustCell 获取刚分配的单元
+func (h *Hive) mustCell(off uint32) []byte {
+	c, err := h.cell(off)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// scanBins 遍历所有 hbin，记录其范围和其中的空闲单元
+func (h *Hive) scanBins() error {
+	h.bins = nil
+	h.freeCells = make(map[uint32]uint32)
+	h.freeEnds = make(map[uint32]uint32)
+
+	total := uint32(len(h.data) - baseBlockSize)
+	for start := uint32(0); start < total; {
+		bin := h.data[baseBlockSize+int(start):]
+		size := le.Uint32(bin[8:])
+		if string(bin[:4]) != "hbin" || size < hbinAlign || size%hbinAlign != 0 || size > total-start {
+			return fmt.Errorf("偏移 0x%x 处的 hbin 无效", start)
+		}
+		end := start + size
+		h.bins = append(h.bins, binRange{start: start, end: end})
+
+		for off := start + hbinHeaderSize; off+4 <= end; {
+			cellSize := int32(le.Uint32(h.data[baseBlockSize+int(off):]))
+			n := uint32(cellSize)
+			if cellSize < 0 {
+				n = uint32(-cellSize)
+			}
+			if n < 8 || n%8 != 0 || n > end-off {
+				// 单元链损坏: 不再使用该 hbin 中剩余的空间
+				break
+			}
+			if cellSize > 0 {
+				h.addFree(off, n)
+			}
+			off += n
+		}
+		start = end
+	}
+	return nil
+}
+
+// alloc 分配至少 n 字节数据的单元 (内容清零)
+//
+// 优先使用能容纳的最小空闲单元，剩余部分仍为空闲单元；没有合适的空闲单元时追加新的 hbin。
+func (h *Hive) alloc(n int) (uint32, error) {
+	size := uint32(n+4+7) &^ 7
+
+	best, bestSize := uint32(invalidOffset), uint32(0)
+	for off, free := range h.freeCells {
+		if free < size {
+			continue
+		}
+		if best == invalidOffset || free < bestSize || (free == bestSize && off < best) {
+			best, bestSize = off, free
+		}
+	}
+	if best == invalidOffset {
+		best = h.appendBin(size)
+		bestSize = h.freeCells[best]
+	}
+
+	h.removeFree(best)
+	if rest := bestSize - size; rest >= 8 {
+		h.addFree(best+size, rest)
+		le.PutUint32(h.data[baseBlockSize+int(best+size):], rest)
+	} else {
+		size = bestSize
+	}
+
+	abs := baseBlockSize + int(best)
+	le.PutUint32(h.data[abs:], uint32(-int32(size)))
+	clear(h.data[abs+4 : abs+int(size)])
+
+	h.modified = true
+	return best, nil
+}
+
+// appendBin 在文件末尾追加能容纳 size 字节单元的 hbin，返回其中空闲单元的偏移
+func (h *Hive) appendBin(size uint32) uint32 {
+	binSize := (size + hbinHeaderSize + hbinAlign - 1) / hbinAlign * hbinAlign
+	start := uint32(len(h.data) - baseBlockSize)
+
+	h.data = append(h.data, make([]byte, binSize)...)
+	bin := h.data[baseBlockSize+int(start):]
+	copy(bin, "hbin")
+	le.PutUint32(bin[4:], start)
+	le.PutUint32(bin[8:], binSize)
+	le.PutUint64(bin[20:], filetime(time.Now()))
+	h.bins = append(h.bins, binRange{start: start, end: start + binSize})
+
+	off := start + hbinHeaderSize
+	le.PutUint32(bin[hbinHeaderSize:], binSize-hbinHeaderSize)
+	h.addFree(off, binSize-hbinHeaderSize)
+	return off
+}
+
+// free 将单元标记为空闲，并与同一 hbin 中相邻的空闲单元合并
+func (h *Hive) free(off uint32) {
+	if off == invalidOffset {
+		return
+	}
+	abs := baseBlockSize + int(off)
+	if abs+4 > len(h.data) {
+		return
+	}
+	cellSize := int32(le.Uint32(h.data[abs:]))
+	if cellSize >= 0 {
+		return
+	}
+	size := uint32(-cellSize)
+	h.modified = true
+
+	bin, ok := h.binOf(off)
+	if !ok {
+		le.PutUint32(h.data[abs:], size)
+		return
+	}
+	if next := off + size; next < bin.end {
+		if n, free := h.freeCells[next]; free {
+			h.removeFree(next)
+			size += n
+		}
+	}
+	if prev, free := h.freeEnds[off]; free && prev >= bin.start {
+		size += h.freeCells[prev]
+		h.removeFree(prev)
+		off = prev
+	}
+	le.PutUint32(h.data[baseBlockSize+int(off):], size)
+	h.addFree(off, size)
+}
+
+func (h *Hive) addFree(off, size uint32) {
+	h.freeCells[off] = size
+	h.freeEnds[off+size] = off
+}
+
+func (h *Hive) removeFree(off uint32) {
+	if size, ok := h.freeCells[off]; ok {
+		delete(h.freeCells, off)
+		delete(h.freeEnds, off+size)
+	}
+}
+
+// binOf 查找偏移所在的 hbin
+func (h *Hive) binOf(off uint32) (binRange, bool) {
+	i := sort.Search(len(h.bins), func(i int) bool { return h.bins[i].end > off })
+	if i < len(h.bins) && h.bins[i].start <= off {
+		return h.bins[i], true
+	}
+	return binRange{}, false
+}
+
+// allocData 分配单元并写入数据
+func (h *Hive) allocData(data []byte) (uint32, error) {
+	off, err := h.alloc(len(data))
+	if err != nil {
+		return 0, err
+	}
+	copy(h.mustCell(off), data)
+	return off, nil
+}
+
+// minor 配置单元次版本号
+func (h *Hive) minor() uint32 {
+	return le.Uint32(h.data[bbMinor:])
+}
@@ -0,0 +1,426 @@
+package regf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// newHive 在临时目录中创建空配置单元
+func newHive(t *testing.T) *Hive {
+	t.Helper()
+	h, err := New(filepath.Join(t.TempDir(), "SOFTWARE"), "ROOT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+// reopen 保存并重新打开配置单元，检查基本块
+func reopen(t *testing.T, h *Hive) *Hive {
+	t.Helper()
+	if err := h.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(h.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum := le.Uint32(data[bbChecksum:]); checksum(data) != sum {
+		t.Errorf("基本块校验和 %#x, want %#x", sum, checksum(data))
+	}
+	if s1, s2 := le.Uint32(data[bbSequence1:]), le.Uint32(data[bbSequence2:]); s1 != s2 {
+		t.Errorf("序列号不一致: %d/%d", s1, s2)
+	}
+	if size := int(le.Uint32(data[bbBinsSize:])); baseBlockSize+size != len(data) {
+		t.Errorf("hbin 数据大小 %d, 文件大小 %d", size, len(data))
+	}
+
+	h2, err := Open(h.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h2.Modified() {
+		t.Error("重新打开的配置单元不应标记为已修改")
+	}
+	return h2
+}
+
+// bigData 生成指定大小的非重复数据
+func bigData(n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(i*7 + i/251)
+	}
+	return b
+}
+
+func TestValueRoundTrip(t *testing.T) {
+	values := []Value{
+		{"", TypeSZ, StringData("默认值")},
+		{"None", TypeNone, nil},
+		{"NoneData", TypeNone, []byte{1, 2, 3, 4, 5, 6}},
+		{"String", TypeSZ, StringData("Hello, 世界")},
+		{"Empty", TypeSZ, StringData("")},
+		{"Expand", TypeExpandSZ, StringData(`%SystemRoot%\System32`)},
+		{"Binary", TypeBinary, []byte{0xDE, 0xAD, 0xBE, 0xEF, 0x00, 0x01}},
+		{"Short", TypeBinary, []byte{0xFF}},
+		{"DWORD", TypeDWORD, DWORDData(0x12345678)},
+		{"BigEndian", TypeDWORDBigEndian, []byte{0x12, 0x34, 0x56, 0x78}},
+		{"Link", TypeLink, encodeUTF16(`\Registry\Machine\Software\Target`)},
+		{"Multi", TypeMultiSZ, MultiStringData([]string{"one", "二", "three"})},
+		{"ResourceList", TypeResourceList, bigData(40)},
+		{"FullResource", TypeFullResourceDescriptor, bigData(24)},
+		{"Requirements", TypeResourceRequirementsList, bigData(72)},
+		{"QWORD", TypeQWORD, QWORDData(0x0123456789ABCDEF)},
+		{"Unknown", 0x1234, []byte{9, 8, 7}},
+		{"名称", TypeSZ, StringData("非 ASCII 值名")},
+		// 刚好不分段和需要分段的数据
+		{"Segment", TypeBinary, bigData(segmentBytes)},
+		{"Big", TypeBinary, bigData(40000)},
+		{"BigString", TypeSZ, StringData(string(bytes.Repeat([]byte("x"), 20000)))},
+	}
+
+	h := newHive(t)
+	k, err := h.CreateKey(`Microsoft\Windows\Test`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range values {
+		if err := k.SetValue(v.Name, v.Type, v.Data); err != nil {
+			t.Fatalf("SetValue(%q): %v", v.Name, err)
+		}
+	}
+
+	h = reopen(t, h)
+	k, err = h.OpenKey(`MICROSOFT\windows\test`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := k.Values()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(values) {
+		t.Fatalf("读回 %d 个值, want %d", len(got), len(values))
+	}
+	for i, want := range values {
+		if got[i].Name != want.Name || got[i].Type != want.Type || !bytes.Equal(got[i].Data, want.Data) {
+			t.Errorf("值 %q: got %s (%d 字节), want %s (%d 字节)",
+				want.Name, TypeName(got[i].Type), len(got[i].Data), TypeName(want.Type), len(want.Data))
+		}
+	}
+
+	// 超过 16344 字节的数据分段存储在 db 单元中
+	for name, wantDB := range map[string]bool{"Segment": false, "Big": true, "BigString": true} {
+		_, off, err := k.findValue(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := h.cell(le.Uint32(h.mustCell(off)[vkDataOffset:]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if isDB := string(data[:2]) == "db"; isDB != wantDB {
+			t.Errorf("值 %s: db = %v, want %v", name, isDB, wantDB)
+		}
+	}
+
+	if v, _ := k.Value("dword"); mustUint64(t, v) != 0x12345678 {
+		t.Errorf("DWORD = %#x", mustUint64(t, v))
+	}
+	if v, _ := k.Value("BigEndian"); mustUint64(t, v) != 0x12345678 {
+		t.Errorf("REG_DWORD_BIG_ENDIAN = %#x", mustUint64(t, v))
+	}
+	if v, _ := k.Value("QWORD"); mustUint64(t, v) != 0x0123456789ABCDEF {
+		t.Errorf("QWORD = %#x", mustUint64(t, v))
+	}
+	if v, _ := k.Value("Multi"); !reflect.DeepEqual(v.Strings(), []string{"one", "二", "three"}) {
+		t.Errorf("MULTI_SZ = %q", v.Strings())
+	}
+	if v, _ := k.Value(""); v.String() != "默认值" {
+		t.Errorf("默认值 = %q", v.String())
+	}
+}
+
+func mustUint64(t *testing.T, v Value) uint64 {
+	t.Helper()
+	n, err := v.Uint64()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestOverwriteValue(t *testing.T) {
+	h := newHive(t)
+	k, err := h.CreateKey("Test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 内联 -> 分段 -> 普通单元 -> 内联，每次覆盖都释放原来的数据
+	for _, data := range [][]byte{DWORDData(1), bigData(50000), bigData(100), DWORDData(2)} {
+		if err := k.SetValue("Value", TypeBinary, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h = reopen(t, h)
+	k, _ = h.OpenKey("Test")
+	values, err := k.Values()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 1 || !bytes.Equal(values[0].Data, DWORDData(2)) {
+		t.Errorf("覆盖后的值: %+v", values)
+	}
+}
+
+// indexSignature 返回键的子键索引单元类型及 ri 下各索引叶的类型
+func indexSignature(t *testing.T, k *Key) (string, []string) {
+	t.Helper()
+	c, err := k.h.cell(le.Uint32(k.nk()[nkSubkeyList:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := string(c[:2])
+	if sig != "ri" {
+		return sig, nil
+	}
+	var leaves []string
+	for i := 0; i < int(le.Uint16(c[2:])); i++ {
+		leaf, err := k.h.cell(le.Uint32(c[4+i*4:]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		leaves = append(leaves, fmt.Sprintf("%s%d", leaf[:2], le.Uint16(leaf[2:])))
+	}
+	return sig, leaves
+}
+
+func TestSubkeyIndexSplit(t *testing.T) {
+	const count = 1200
+
+	h := newHive(t)
+	parent, err := h.CreateKey("Parent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 倒序创建，检查索引按名称排序
+	for i := count - 1; i >= 0; i-- {
+		if _, err := parent.CreateSubkey(fmt.Sprintf("Key%04d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h = reopen(t, h)
+	parent, _ = h.OpenKey("Parent")
+	sig, leaves := indexSignature(t, parent)
+	if sig != "ri" || !reflect.DeepEqual(leaves, []string{"lh500", "lh500", "lh200"}) {
+		t.Errorf("子键索引: %s %v, want ri [lh500 lh500 lh200]", sig, leaves)
+	}
+
+	subs, err := parent.Subkeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subs) != count {
+		t.Fatalf("读回 %d 个子键, want %d", len(subs), count)
+	}
+	for i, sub := range subs {
+		if want := fmt.Sprintf("Key%04d", i); sub.Name() != want {
+			t.Fatalf("子键 %d = %s, want %s", i, sub.Name(), want)
+		}
+	}
+	if _, err := h.OpenKey(`Parent\key0777`); err != nil {
+		t.Errorf("打开 ri 索引下的子键: %v", err)
+	}
+
+	// 删除到 500 个以下时合并为单个 lh 索引叶
+	for i := 0; i < count-400; i++ {
+		if err := parent.DeleteSubkey(fmt.Sprintf("Key%04d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h = reopen(t, h)
+	parent, _ = h.OpenKey("Parent")
+	if sig, _ := indexSignature(t, parent); sig != "lh" {
+		t.Errorf("子键索引: %s, want lh", sig)
+	}
+	if subs, _ := parent.Subkeys(); len(subs) != 400 || subs[0].Name() != "Key0800" {
+		t.Errorf("删除后剩余 %d 个子键", len(subs))
+	}
+}
+
+func TestDelete(t *testing.T) {
+	h := newHive(t)
+	k, err := h.CreateKey(`Policies\Microsoft\Windows`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"A", "B", "C"} {
+		if err := k.SetValue(name, TypeDWORD, DWORDData(1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := k.SetValue("Big", TypeBinary, bigData(30000)); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{`Policies\Microsoft\Windows\Sub1\Deep`, `Policies\Microsoft\Windows\Sub2`, `Policies\Other`} {
+		if _, err := h.CreateKey(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := k.DeleteValue("b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.DeleteValue("Big"); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.DeleteValue("Missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("删除不存在的值: %v", err)
+	}
+	if err := h.DeleteKey(`Policies\Microsoft\Windows\Sub1`); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.DeleteKey(`Policies\Missing`); !errors.Is(err, ErrNotFound) {
+		t.Errorf("删除不存在的键: %v", err)
+	}
+	if err := h.DeleteKey(""); err == nil {
+		t.Error("不应允许删除根键")
+	}
+
+	h = reopen(t, h)
+	k, err = h.OpenKey(`Policies\Microsoft\Windows`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, _ := k.Values()
+	var names []string
+	for _, v := range values {
+		names = append(names, v.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"A", "C"}) {
+		t.Errorf("剩余的值: %v", names)
+	}
+	subs, _ := k.Subkeys()
+	if len(subs) != 1 || subs[0].Name() != "Sub2" {
+		t.Errorf("剩余的子键: %d", len(subs))
+	}
+	if _, err := h.OpenKey(`Policies\Microsoft\Windows\Sub1\Deep`); !errors.Is(err, ErrNotFound) {
+		t.Errorf("已删除的键: %v", err)
+	}
+
+	// 删除全部值和子键后，键的列表单元也被释放
+	for _, name := range []string{"A", "C"} {
+		if err := k.DeleteValue(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := k.DeleteSubkey("Sub2"); err != nil {
+		t.Fatal(err)
+	}
+	nk := k.nk()
+	if le.Uint32(nk[nkValueList:]) != invalidOffset || le.Uint32(nk[nkSubkeyList:]) != invalidOffset {
+		t.Error("空键仍引用值列表或子键索引")
+	}
+	if err := h.DeleteKey("Policies"); err != nil {
+		t.Fatal(err)
+	}
+
+	h = reopen(t, h)
+	root, _ := h.Root()
+	if subs, _ := root.Subkeys(); len(subs) != 0 {
+		t.Errorf("根键下仍有 %d 个子键", len(subs))
+	}
+}
+
+func TestDeleteReusesFreeCells(t *testing.T) {
+	h := newHive(t)
+	fill := func() {
+		for i := 0; i < 50; i++ {
+			k, err := h.CreateKey(fmt.Sprintf(`Reuse\Key%02d`, i))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := k.SetValue("Data", TypeBinary, bigData(2000)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	fill()
+	size := len(h.data)
+	if err := h.DeleteKey("Reuse"); err != nil {
+		t.Fatal(err)
+	}
+	fill()
+	if len(h.data) != size {
+		t.Errorf("删除后重新创建相同内容，文件从 %d 增长到 %d 字节", size, len(h.data))
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	h := newHive(t)
+	if _, err := h.CreateKey("Test"); err != nil {
+		t.Fatal(err)
+	}
+	reopen(t, h)
+
+	// 基本块损坏且没有事务日志时无法打开
+	data, _ := os.ReadFile(h.Path())
+	data[bbTimestamp] ^= 0xFF
+	if err := os.WriteFile(h.Path(), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(h.Path()); err == nil {
+		t.Error("基本块校验和错误时应无法打开")
+	}
+}
+
+func TestSaveClearsLogs(t *testing.T) {
+	h := newHive(t)
+	if err := h.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	logs := []string{h.Path() + ".LOG", h.Path() + ".LOG1", h.Path() + ".LOG2"}
+	for _, log := range logs {
+		if err := os.WriteFile(log, bytes.Repeat([]byte{0xAB}, 8192), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	k, err := h.CreateKey("Test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := k.SetValue("Value", TypeSZ, StringData("x")); err != nil {
+		t.Fatal(err)
+	}
+	h = reopen(t, h)
+
+	for _, log := range logs {
+		fi, err := os.Stat(log)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Size() != 0 {
+			t.Errorf("%s 未清空 (%d 字节)", filepath.Base(log), fi.Size())
+		}
+	}
+	if _, err := os.Stat(h.Path() + ".tmp"); !os.IsNotExist(err) {
+		t.Error("临时文件未删除")
+	}
+	if _, err := h.OpenKey("Test"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,557 @@
+package regf
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf16"
+)
+
+// nk 单元 (键节点) 字段偏移
+const (
+	nkFlags          = 2
+	nkTimestamp      = 4
+	nkParent         = 16
+	nkSubkeyCount    = 20
+	nkVolatileCount  = 24
+	nkSubkeyList     = 28
+	nkVolatileList   = 32
+	nkValueCount     = 36
+	nkValueList      = 40
+	nkSecurity       = 44
+	nkClass          = 48
+	nkMaxSubkeyName  = 52
+	nkMaxSubkeyClass = 56
+	nkMaxValueName   = 60
+	nkMaxValueData   = 64
+	nkNameLength     = 72
+	nkClassLength    = 74
+	nkName           = 76
+)
+
+// nk 标志
+const (
+	keyHiveEntry = 0x0004
+	keyNoDelete  = 0x0008
+	keyCompName  = 0x0020
+)
+
+// sk 单元 (安全描述符) 字段偏移
+const (
+	skFlink    = 4
+	skBlink    = 8
+	skRefCount = 12
+	skDescSize = 16
+	skDesc     = 20
+)
+
+// maxLeafEntries 单个子键索引叶 (lh/lf) 的最大条目数，超过时拆分为 ri 索引
+const maxLeafEntries = 500
+
+// Key 配置单元中的键
+type Key struct {
+	h   *Hive
+	off uint32
+}
+
+func (k *Key) nk() []byte {
+	return k.h.mustCell(k.off)
+}
+
+// Name 键名
+func (k *Key) Name() string {
+	nk := k.nk()
+	n := int(le.Uint16(nk[nkNameLength:]))
+	if nkName+n > len(nk) {
+		n = len(nk) - nkName
+	}
+	return decodeName(nk[nkName:nkName+n], le.Uint16(nk[nkFlags:])&keyCompName != 0)
+}
+
+// Timestamp 键的最后修改时间
+func (k *Key) Timestamp() time.Time {
+	ft := int64(le.Uint64(k.nk()[nkTimestamp:]))
+	return time.Unix(0, (ft-116444736000000000)*100)
+}
+
+// touch 更新最后修改时间
+func (k *Key) touch() {
+	le.PutUint64(k.nk()[nkTimestamp:], filetime(time.Now()))
+	k.h.modified = true
+}
+
+// ==================== 子键 ====================
+
+// Subkeys 列出所有子键
+func (k *Key) Subkeys() ([]*Key, error) {
+	offs, err := k.subkeyOffsets()
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]*Key, 0, len(offs))
+	for _, off := range offs {
+		c, err := k.h.cell(off)
+		if err != nil || len(c) < nkName || string(c[:2]) != "nk" {
+			return nil, fmt.Errorf("键 %s 的子键索引损坏", k.Name())
+		}
+		keys = append(keys, &Key{h: k.h, off: off})
+	}
+	return keys, nil
+}
+
+// Subkey 按名称 (不区分大小写) 打开子键
+func (k *Key) Subkey(name string) (*Key, error) {
+	keys, err := k.Subkeys()
+	if err != nil {
+		return nil, err
+	}
+	for _, sub := range keys {
+		if strings.EqualFold(sub.Name(), name) {
+			return sub, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// OpenKey 打开相对路径 (以 \ 分隔) 指定的子键
+func (k *Key) OpenKey(path string) (*Key, error) {
+	cur := k
+	for _, part := range splitPath(path) {
+		sub, err := cur.Subkey(part)
+		if err != nil {
+			return nil, err
+		}
+		cur = sub
+	}
+	return cur, nil
+}
+
+// CreateKey 创建相对路径指定的子键 (包括中间各级)，已存在时直接打开
+func (k *Key) CreateKey(path string) (*Key, error) {
+	cur := k
+	for _, part := range splitPath(path) {
+		sub, err := cur.CreateSubkey(part)
+		if err != nil {
+			return nil, err
+		}
+		cur = sub
+	}
+	return cur, nil
+}
+
+// CreateSubkey 创建子键，已存在时直接打开
+func (k *Key) CreateSubkey(name string) (*Key, error) {
+	if name == "" || strings.Contains(name, `\`) {
+		return nil, fmt.Errorf("无效的键名: %q", name)
+	}
+	if len(utf16.Encode([]rune(name))) > 255 {
+		return nil, fmt.Errorf("键名过长: %s", name)
+	}
+
+	offs, err := k.subkeyOffsets()
+	if err != nil {
+		return nil, err
+	}
+
+	// 子键索引按名称 (大写) 排序，找到插入位置
+	pos := len(offs)
+	for i, off := range offs {
+		c := compareNames((&Key{h: k.h, off: off}).Name(), name)
+		if c == 0 {
+			return &Key{h: k.h, off: off}, nil
+		}
+		if c > 0 {
+			pos = i
+			break
+		}
+	}
+
+	off, err := k.h.newKey(name, k.off, le.Uint32(k.nk()[nkSecurity:]))
+	if err != nil {
+		return nil, err
+	}
+	if sk := le.Uint32(k.h.mustCell(off)[nkSecurity:]); sk != invalidOffset {
+		if c, err := k.h.cell(sk); err == nil {
+			le.PutUint32(c[skRefCount:], le.Uint32(c[skRefCount:])+1)
+		}
+	}
+
+	offs = append(offs[:pos], append([]uint32{off}, offs[pos:]...)...)
+	if err := k.writeSubkeyList(offs); err != nil {
+		return nil, err
+	}
+
+	nk := k.nk()
+	nameBytes := uint32(len(utf16.Encode([]rune(name))) * 2)
+	if max := le.Uint32(nk[nkMaxSubkeyName:]); nameBytes > max&0xFFFF {
+		le.PutUint32(nk[nkMaxSubkeyName:], max&^0xFFFF|nameBytes)
+	}
+	k.touch()
+
+	return &Key{h: k.h, off: off}, nil
+}
+
+// DeleteSubkey 删除子键及其下所有子键和值
+func (k *Key) DeleteSubkey(name string) error {
+	offs, err := k.subkeyOffsets()
+	if err != nil {
+		return err
+	}
+	for i, off := range offs {
+		sub := &Key{h: k.h, off: off}
+		if !strings.EqualFold(sub.Name(), name) {
+			continue
+		}
+		if err := sub.destroy(); err != nil {
+			return err
+		}
+		offs = append(offs[:i], offs[i+1:]...)
+		if err := k.writeSubkeyList(offs); err != nil {
+			return err
+		}
+		k.touch()
+		return nil
+	}
+	return ErrNotFound
+}
+
+// destroy 释放键及其下所有内容占用的单元
+func (k *Key) destroy() error {
+	subs, err := k.Subkeys()
+	if err != nil {
+		return err
+	}
+	for _, sub := range subs {
+		if err := sub.destroy(); err != nil {
+			return err
+		}
+	}
+
+	values, err := k.valueOffsets()
+	if err != nil {
+		return err
+	}
+	for _, off := range values {
+		k.h.freeValue(off)
+	}
+
+	nk := k.nk()
+	k.h.freeSubkeyList(le.Uint32(nk[nkSubkeyList:]))
+	k.h.free(le.Uint32(nk[nkValueList:]))
+	if le.Uint16(nk[nkClassLength:]) > 0 {
+		k.h.free(le.Uint32(nk[nkClass:]))
+	}
+	k.h.releaseSecurity(le.Uint32(nk[nkSecurity:]))
+	k.h.free(k.off)
+	return nil
+}
+
+// subkeyOffsets 读取子键索引中的 nk 偏移
+func (k *Key) subkeyOffsets() ([]uint32, error) {
+	nk := k.nk()
+	count := le.Uint32(nk[nkSubkeyCount:])
+	if count == 0 {
+		return nil, nil
+	}
+
+	offs, err := k.h.readIndex(le.Uint32(nk[nkSubkeyList:]), 0)
+	if err != nil {
+		return nil, fmt.Errorf("读取键 %s 的子键索引失败: %w", k.Name(), err)
+	}
+	if uint32(len(offs)) != count {
+		return nil, fmt.Errorf("键 %s 的子键数量不一致 (%d/%d)", k.Name(), len(offs), count)
+	}
+	return offs, nil
+}
+
+// readIndex 读取子键索引单元 (li/lf/lh/ri)
+func (h *Hive) readIndex(off uint32, depth int) ([]uint32, error) {
+	if depth > 2 {
+		return nil, fmt.Errorf("子键索引层级过深")
+	}
+	c, err := h.cell(off)
+	if err != nil {
+		return nil, err
+	}
+	if len(c) < 4 {
+		return nil, fmt.Errorf("子键索引单元过小")
+	}
+
+	sig := string(c[:2])
+	count := int(le.Uint16(c[2:]))
+	stride := 4
+	switch sig {
+	case "lf", "lh":
+		stride = 8
+	case "li", "ri":
+	default:
+		return nil, fmt.Errorf("未知的子键索引类型 %q", sig)
+	}
+	if 4+count*stride > len(c) {
+		return nil, fmt.Errorf("子键索引单元过小")
+	}
+
+	var offs []uint32
+	for i := 0; i < count; i++ {
+		entry := le.Uint32(c[4+i*stride:])
+		if sig != "ri" {
+			offs = append(offs, entry)
+			continue
+		}
+		leaf, err := h.readIndex(entry, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		offs = append(offs, leaf...)
+	}
+	return offs, nil
+}
+
+// writeSubkeyList 用新的索引单元替换键的子键索引
+func (k *Key) writeSubkeyList(offs []uint32) error {
+	h := k.h
+	old := le.Uint32(k.nk()[nkSubkeyList:])
+
+	list := uint32(invalidOffset)
+	if len(offs) > 0 {
+		var leaves []uint32
+		for start := 0; start < len(offs); start += maxLeafEntries {
+			end := min(start+maxLeafEntries, len(offs))
+			leaf, err := h.writeLeaf(offs[start:end])
+			if err != nil {
+				return err
+			}
+			leaves = append(leaves, leaf)
+		}
+
+		list = leaves[0]
+		if len(leaves) > 1 {
+			ri := make([]byte, 4+4*len(leaves))
+			copy(ri, "ri")
+			le.PutUint16(ri[2:], uint16(len(leaves)))
+			for i, leaf := range leaves {
+				le.PutUint32(ri[4+i*4:], leaf)
+			}
+			var err error
+			if list, err = h.allocData(ri); err != nil {
+				return err
+			}
+		}
+	}
+
+	nk := k.nk()
+	le.PutUint32(nk[nkSubkeyList:], list)
+	le.PutUint32(nk[nkSubkeyCount:], uint32(len(offs)))
+	h.freeSubkeyList(old)
+	return nil
+}
+
+// writeLeaf 写入一个 lh 索引叶 (1.5 之前的版本使用 lf)
+func (h *Hive) writeLeaf(offs []uint32) (uint32, error) {
+	leaf := make([]byte, 4+8*len(offs))
+	hashLeaf := h.minor() >= 5
+	if hashLeaf {
+		copy(leaf, "lh")
+	} else {
+		copy(leaf, "lf")
+	}
+	le.PutUint16(leaf[2:], uint16(len(offs)))
+
+	for i, off := range offs {
+		name := (&Key{h: h, off: off}).Name()
+		le.PutUint32(leaf[4+i*8:], off)
+		if hashLeaf {
+			le.PutUint32(leaf[8+i*8:], nameHash(name))
+		} else {
+			copy(leaf[8+i*8:12+i*8], nameHint(name))
+		}
+	}
+	return h.allocData(leaf)
+}
+
+// freeSubkeyList 释放子键索引单元 (包括 ri 下的各个索引叶)
+func (h *Hive) freeSubkeyList(off uint32) {
+	if off == invalidOffset {
+		return
+	}
+	if c, err := h.cell(off); err == nil && len(c) >= 4 && string(c[:2]) == "ri" {
+		count := int(le.Uint16(c[2:]))
+		for i := 0; i < count && 8+i*4 <= len(c); i++ {
+			h.free(le.Uint32(c[4+i*4:]))
+		}
+	}
+	h.free(off)
+}
+
+// newKey 分配新的 nk 单元
+func (h *Hive) newKey(name string, parent, security uint32) (uint32, error) {
+	nameData, compressed := encodeName(name)
+
+	off, err := h.alloc(nkName + len(nameData))
+	if err != nil {
+		return 0, err
+	}
+	nk := h.mustCell(off)
+	copy(nk, "nk")
+	if compressed {
+		le.PutUint16(nk[nkFlags:], keyCompName)
+	}
+	le.PutUint64(nk[nkTimestamp:], filetime(time.Now()))
+	le.PutUint32(nk[nkParent:], parent)
+	le.PutUint32(nk[nkSubkeyList:], invalidOffset)
+	le.PutUint32(nk[nkVolatileList:], invalidOffset)
+	le.PutUint32(nk[nkValueList:], invalidOffset)
+	le.PutUint32(nk[nkSecurity:], security)
+	le.PutUint32(nk[nkClass:], invalidOffset)
+	le.PutUint16(nk[nkNameLength:], uint16(len(nameData)))
+	copy(nk[nkName:], nameData)
+	return off, nil
+}
+
+// releaseSecurity 减少安全描述符的引用计数，为 0 时从链表中移除并释放
+func (h *Hive) releaseSecurity(off uint32) {
+	if off == invalidOffset {
+		return
+	}
+	sk, err := h.cell(off)
+	if err != nil || len(sk) < skDesc || string(sk[:2]) != "sk" {
+		return
+	}
+
+	refs := le.Uint32(sk[skRefCount:])
+	if refs > 1 {
+		le.PutUint32(sk[skRefCount:], refs-1)
+		return
+	}
+
+	flink, blink := le.Uint32(sk[skFlink:]), le.Uint32(sk[skBlink:])
+	if flink != off {
+		if prev, err := h.cell(blink); err == nil {
+			le.PutUint32(prev[skFlink:], flink)
+		}
+		if next, err := h.cell(flink); err == nil {
+			le.PutUint32(next[skBlink:], blink)
+		}
+	}
+	h.free(off)
+}
+
+// ==================== 路径 ====================
+
+// OpenKey 打开根键下的路径
+func (h *Hive) OpenKey(path string) (*Key, error) {
+	root, err := h.Root()
+	if err != nil {
+		return nil, err
+	}
+	return root.OpenKey(path)
+}
+
+// CreateKey 创建根键下的路径 (包括中间各级)
+func (h *Hive) CreateKey(path string) (*Key, error) {
+	root, err := h.Root()
+	if err != nil {
+		return nil, err
+	}
+	return root.CreateKey(path)
+}
+
+// DeleteKey 删除根键下的路径及其所有子键
+func (h *Hive) DeleteKey(path string) error {
+	parts := splitPath(path)
+	if len(parts) == 0 {
+		return fmt.Errorf("不能删除根键")
+	}
+	parent, err := h.OpenKey(strings.Join(parts[:len(parts)-1], `\`))
+	if err != nil {
+		return err
+	}
+	return parent.DeleteSubkey(parts[len(parts)-1])
+}
+
+func splitPath(path string) []string {
+	var parts []string
+	for _, p := range strings.Split(path, `\`) {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return parts
+}
+
+// ==================== 名称编码 ====================
+
+// decodeName 解码键名或值名 (压缩格式为每字符一字节)
+func decodeName(b []byte, compressed bool) string {
+	if compressed {
+		r := make([]rune, len(b))
+		for i, c := range b {
+			r[i] = rune(c)
+		}
+		return string(r)
+	}
+	return decodeUTF16(b)
+}
+
+// encodeName 编码名称，全部为 ASCII 字符时使用压缩格式
+func encodeName(name string) ([]byte, bool) {
+	ascii := true
+	for _, r := range name {
+		if r >= 0x80 {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return []byte(name), true
+	}
+	return encodeUTF16(name), false
+}
+
+// compareNames 按 Windows 的方式比较名称 (转换为大写后逐个 UTF-16 单元比较)
+func compareNames(a, b string) int {
+	ua, ub := upcaseUnits(a), upcaseUnits(b)
+	for i := 0; i < len(ua) && i < len(ub); i++ {
+		if ua[i] != ub[i] {
+			if ua[i] < ub[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return len(ua) - len(ub)
+}
+
+func upcaseUnits(s string) []uint16 {
+	units := utf16.Encode([]rune(s))
+	for i, u := range units {
+		if r := unicode.ToUpper(rune(u)); r <= 0xFFFF {
+			units[i] = uint16(r)
+		}
+	}
+	return units
+}
+
+// nameHash lh 索引使用的名称哈希
+func nameHash(name string) uint32 {
+	var hash uint32
+	for _, u := range upcaseUnits(name) {
+		hash = hash*37 + uint32(u)
+	}
+	return hash
+}
+
+// nameHint lf 索引使用的名称前 4 个字符
+func nameHint(name string) []byte {
+	hint := make([]byte, 4)
+	for i, u := range utf16.Encode([]rune(name)) {
+		if i == 4 {
+			break
+		}
+		if u < 0x100 {
+			hint[i] = byte(u)
+		}
+	}
+	return hint
+}
@@ -0,0 +1,198 @@
+package regf
+
+import (
+	"fmt"
+	"math/bits"
+	"os"
+	"sort"
+)
+
+// 事务日志 (新格式，Windows 8.1 起)
+//
+// .LOG1/.LOG2 以 512 字节的基本块副本开头，之后是若干 HvLE 日志条目，
+// 每个条目记录一次刷新时写入的脏页。配置单元未正常关闭时 (主序列号与
+// 次序列号不一致) 按序列号顺序重放条目即可恢复到最后一次刷新的状态。
+
+const (
+	logBaseSize = 512
+
+	leSize      = 4
+	leSequence  = 12
+	leBinsSize  = 16
+	leDirtyPage = 20
+	leHash1     = 24
+	leHash2     = 32
+	leHeader    = 40
+
+	marvinSeed = 0x82EF4D887A4E55C5
+)
+
+// logEntry 事务日志条目
+type logEntry struct {
+	seq      uint32
+	binsSize uint32
+	pages    []dirtyPage
+}
+
+type dirtyPage struct {
+	offset uint32
+	data   []byte
+}
+
+// recover 从事务日志恢复未正常关闭的配置单元
+func (h *Hive) recover(validBase bool) error {
+	var entries []logEntry
+	var logBase []byte
+
+	for _, ext := range []string{".LOG1", ".LOG2"} {
+		data, err := os.ReadFile(h.path + ext)
+		if err != nil || len(data) < logBaseSize || string(data[:4]) != "regf" {
+			continue
+		}
+		if checksum(data) == le.Uint32(data[bbChecksum:]) && logBase == nil {
+			logBase = data[:logBaseSize]
+		}
+		entries = append(entries, parseLog(data)...)
+	}
+
+	if !validBase {
+		if logBase == nil {
+			return fmt.Errorf("基本块校验和错误，且没有可用的事务日志")
+		}
+		copy(h.data, logBase)
+	}
+
+	// 从次序列号开始按顺序重放连续的条目
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].seq < entries[j].seq })
+	next := le.Uint32(h.data[bbSequence2:])
+	applied := 0
+	for _, e := range entries {
+		if e.seq < next {
+			continue
+		}
+		if e.seq != next {
+			break
+		}
+		h.applyEntry(e)
+		next++
+		applied++
+	}
+
+	if applied > 0 {
+		le.PutUint32(h.data[bbSequence1:], next)
+		le.PutUint32(h.data[bbSequence2:], next)
+	} else {
+		// 没有可重放的条目: 以主文件现有内容为准
+		le.PutUint32(h.data[bbSequence2:], le.Uint32(h.data[bbSequence1:]))
+	}
+	h.modified = true
+	return nil
+}
+
+// parseLog 解析日志文件中有效的条目，遇到无效条目时停止
+func parseLog(data []byte) []logEntry {
+	var entries []logEntry
+	pos := logBaseSize
+	for pos+leHeader <= len(data) {
+		e := data[pos:]
+		if string(e[:4]) != "HvLE" {
+			break
+		}
+		size := int(le.Uint32(e[leSize:]))
+		if size < leHeader || size%512 != 0 || size > len(e) {
+			break
+		}
+		e = e[:size]
+		if marvin32(e[:leHash2]) != le.Uint64(e[leHash2:]) || marvin32(e[leHeader:]) != le.Uint64(e[leHash1:]) {
+			break
+		}
+
+		count := int(le.Uint32(e[leDirtyPage:]))
+		refs := e[leHeader:]
+		if count*8 > len(refs) {
+			break
+		}
+		pages := refs[count*8:]
+
+		entry := logEntry{seq: le.Uint32(e[leSequence:]), binsSize: le.Uint32(e[leBinsSize:])}
+		ok := true
+		for i := 0; i < count; i++ {
+			off := le.Uint32(refs[i*8:])
+			n := int(le.Uint32(refs[i*8+4:]))
+			if n > len(pages) {
+				ok = false
+				break
+			}
+			entry.pages = append(entry.pages, dirtyPage{offset: off, data: pages[:n]})
+			pages = pages[n:]
+		}
+		if !ok {
+			break
+		}
+
+		entries = append(entries, entry)
+		pos += size
+	}
+	return entries
+}
+
+// applyEntry 将日志条目中的脏页写入配置单元
+func (h *Hive) applyEntry(e logEntry) {
+	need := baseBlockSize + int(e.binsSize)
+	if need > len(h.data) {
+		h.data = append(h.data, make([]byte, need-len(h.data))...)
+	}
+	for _, p := range e.pages {
+		start := baseBlockSize + int(p.offset)
+		if start+len(p.data) <= len(h.data) {
+			copy(h.data[start:], p.data)
+		}
+	}
+	le.PutUint32(h.data[bbBinsSize:], e.binsSize)
+}
+
+// clearLogs 清空配置单元的事务日志文件
+func clearLogs(path string) error {
+	for _, ext := range []string{".LOG", ".LOG1", ".LOG2"} {
+		if _, err := os.Stat(path + ext); err != nil {
+			continue
+		}
+		if err := os.Truncate(path+ext, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// marvin32 日志条目使用的 Marvin32 哈希
+func marvin32(data []byte) uint64 {
+	lo := uint32(marvinSeed & 0xFFFFFFFF)
+	hi := uint32(marvinSeed >> 32)
+
+	block := func() {
+		hi ^= lo
+		lo = bits.RotateLeft32(lo, 20)
+		lo += hi
+		hi = bits.RotateLeft32(hi, 9)
+		hi ^= lo
+		lo = bits.RotateLeft32(lo, 27)
+		lo += hi
+		hi = bits.RotateLeft32(hi, 19)
+	}
+
+	for len(data) >= 4 {
+		lo += le.Uint32(data)
+		block()
+		data = data[4:]
+	}
+
+	final := uint32(0x80)
+	for i := len(data) - 1; i >= 0; i-- {
+		final = final<<8 | uint32(data[i])
+	}
+	lo += final
+	block()
+	block()
+
+	return uint64(hi)<<32 | uint64(lo)
+}
@@ -0,0 +1,477 @@
+package regf
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// 值类型
+const (
+	TypeNone                     uint32 = 0
+	TypeSZ                       uint32 = 1
+	TypeExpandSZ                 uint32 = 2
+	TypeBinary                   uint32 = 3
+	TypeDWORD                    uint32 = 4
+	TypeDWORDBigEndian           uint32 = 5
+	TypeLink                     uint32 = 6
+	TypeMultiSZ                  uint32 = 7
+	TypeResourceList             uint32 = 8
+	TypeFullResourceDescriptor   uint32 = 9
+	TypeResourceRequirementsList uint32 = 10
+	TypeQWORD                    uint32 = 11
+)
+
+var typeNames = map[uint32]string{
+	TypeNone:                     "REG_NONE",
+	TypeSZ:                       "REG_SZ",
+	TypeExpandSZ:                 "REG_EXPAND_SZ",
+	TypeBinary:                   "REG_BINARY",
+	TypeDWORD:                    "REG_DWORD",
+	TypeDWORDBigEndian:           "REG_DWORD_BIG_ENDIAN",
+	TypeLink:                     "REG_LINK",
+	TypeMultiSZ:                  "REG_MULTI_SZ",
+	TypeResourceList:             "REG_RESOURCE_LIST",
+	TypeFullResourceDescriptor:   "REG_FULL_RESOURCE_DESCRIPTOR",
+	TypeResourceRequirementsList: "REG_RESOURCE_REQUIREMENTS_LIST",
+	TypeQWORD:                    "REG_QWORD",
+}
+
+// TypeName 返回值类型名称 (如 REG_DWORD)
+func TypeName(t uint32) string {
+	if name, ok := typeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("REG_0x%X", t)
+}
+
+// ParseType 解析值类型名称 (不区分大小写)
+func ParseType(name string) (uint32, bool) {
+	for t, n := range typeNames {
+		if strings.EqualFold(n, name) {
+			return t, true
+		}
+	}
+	return 0, false
+}
+
+// vk 单元 (值) 字段偏移
+const (
+	vkNameLength = 2
+	vkDataSize   = 4
+	vkDataOffset = 8
+	vkType       = 12
+	vkFlags      = 16
+	vkName       = 20
+
+	vkCompName   = 0x0001
+	dataInline   = 0x80000000
+	segmentBytes = 16344
+)
+
+// Value 注册表值 (名称为空表示默认值)
+type Value struct {
+	Name string
+	Type uint32
+	Data []byte
+}
+
+// String 按字符串解码值数据 (REG_SZ / REG_EXPAND_SZ / REG_LINK)
+func (v Value) String() string {
+	s := decodeUTF16(v.Data)
+	if i := strings.IndexByte(s, 0); i >= 0 {
+		s = s[:i]
+	}
+	return s
+}
+
+// Strings 解码 REG_MULTI_SZ 值数据
+func (v Value) Strings() []string {
+	s := strings.TrimRight(decodeUTF16(v.Data), "\x00")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\x00")
+}
+
+// Uint64 解码 REG_DWORD / REG_DWORD_BIG_ENDIAN / REG_QWORD 值数据
+func (v Value) Uint64() (uint64, error) {
+	switch {
+	case v.Type == TypeDWORD && len(v.Data) >= 4:
+		return uint64(le.Uint32(v.Data)), nil
+	case v.Type == TypeDWORDBigEndian && len(v.Data) >= 4:
+		d := v.Data
+		return uint64(d[0])<<24 | uint64(d[1])<<16 | uint64(d[2])<<8 | uint64(d[3]), nil
+	case v.Type == TypeQWORD && len(v.Data) >= 8:
+		return le.Uint64(v.Data), nil
+	}
+	return 0, fmt.Errorf("值 %s 不是数值类型 (%s, %d 字节)", v.Name, TypeName(v.Type), len(v.Data))
+}
+
+// StringData 编码 REG_SZ / REG_EXPAND_SZ 数据 (UTF-16LE，带结尾的 NUL)
+func StringData(s string) []byte {
+	return encodeUTF16(s + "\x00")
+}
+
+// MultiStringData 编码 REG_MULTI_SZ 数据
+func MultiStringData(items []string) []byte {
+	var sb strings.Builder
+	for _, s := range items {
+		sb.WriteString(s)
+		sb.WriteByte(0)
+	}
+	sb.WriteByte(0)
+	return encodeUTF16(sb.String())
+}
+
+// DWORDData 编码 REG_DWORD 数据
+func DWORDData(v uint32) []byte {
+	b := make([]byte, 4)
+	le.PutUint32(b, v)
+	return b
+}
+
+// QWORDData 编码 REG_QWORD 数据
+func QWORDData(v uint64) []byte {
+	b := make([]byte, 8)
+	le.PutUint64(b, v)
+	return b
+}
+
+func encodeUTF16(s string) []byte {
+	units := utf16.Encode([]rune(s))
+	b := make([]byte, len(units)*2)
+	for i, u := range units {
+		le.PutUint16(b[i*2:], u)
+	}
+	return b
+}
+
+func decodeUTF16(b []byte) string {
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		units[i] = le.Uint16(b[i*2:])
+	}
+	return string(utf16.Decode(units))
+}
+
+// ==================== 键的值 ====================
+
+// Values 列出键的所有值
+func (k *Key) Values() ([]Value, error) {
+	offs, err := k.valueOffsets()
+	if err != nil {
+		return nil, err
+	}
+	values := make([]Value, 0, len(offs))
+	for _, off := range offs {
+		v, err := k.h.readValue(off)
+		if err != nil {
+			return nil, fmt.Errorf("读取键 %s 的值失败: %w", k.Name(), err)
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// Value 按名称 (不区分大小写) 读取值，空名称为默认值
+func (k *Key) Value(name string) (Value, error) {
+	_, off, err := k.findValue(name)
+	if err != nil {
+		return Value{}, err
+	}
+	return k.h.readValue(off)
+}
+
+// SetValue 创建或覆盖值
+func (k *Key) SetValue(name string, typ uint32, data []byte) error {
+	h := k.h
+
+	dataSize, dataOff, err := h.writeData(data)
+	if err != nil {
+		return err
+	}
+
+	_, off, err := k.findValue(name)
+	switch {
+	case err == nil:
+		// 覆盖已有值: 保留 vk 单元，只替换数据
+		h.freeData(h.mustCell(off))
+	case err == ErrNotFound:
+		nameData, compressed := encodeName(name)
+		if off, err = h.alloc(vkName + len(nameData)); err != nil {
+			return err
+		}
+		vk := h.mustCell(off)
+		copy(vk, "vk")
+		le.PutUint16(vk[vkNameLength:], uint16(len(nameData)))
+		if compressed {
+			le.PutUint16(vk[vkFlags:], vkCompName)
+		}
+		copy(vk[vkName:], nameData)
+
+		if err := k.appendValue(off); err != nil {
+			return err
+		}
+	default:
+		return err
+	}
+
+	vk := h.mustCell(off)
+	le.PutUint32(vk[vkDataSize:], dataSize)
+	le.PutUint32(vk[vkDataOffset:], dataOff)
+	le.PutUint32(vk[vkType:], typ)
+
+	nk := k.nk()
+	if n := uint32(len(utf16.Encode([]rune(name))) * 2); n > le.Uint32(nk[nkMaxValueName:]) {
+		le.PutUint32(nk[nkMaxValueName:], n)
+	}
+	if n := uint32(len(data)); n > le.Uint32(nk[nkMaxValueData:]) {
+		le.PutUint32(nk[nkMaxValueData:], n)
+	}
+	k.touch()
+	return nil
+}
+
+// DeleteValue 删除值
+func (k *Key) DeleteValue(name string) error {
+	i, off, err := k.findValue(name)
+	if err != nil {
+		return err
+	}
+	k.h.freeValue(off)
+
+	nk := k.nk()
+	count := int(le.Uint32(nk[nkValueCount:]))
+	list := le.Uint32(nk[nkValueList:])
+	if count == 1 {
+		k.h.free(list)
+		le.PutUint32(nk[nkValueList:], invalidOffset)
+	} else {
+		c := k.h.mustCell(list)
+		copy(c[i*4:count*4], c[(i+1)*4:count*4])
+	}
+	le.PutUint32(nk[nkValueCount:], uint32(count-1))
+	k.touch()
+	return nil
+}
+
+// valueOffsets 读取值列表中的 vk 偏移
+func (k *Key) valueOffsets() ([]uint32, error) {
+	nk := k.nk()
+	count := int(le.Uint32(nk[nkValueCount:]))
+	if count == 0 {
+		return nil, nil
+	}
+	c, err := k.h.cell(le.Uint32(nk[nkValueList:]))
+	if err != nil {
+		return nil, fmt.Errorf("读取键 %s 的值列表失败: %w", k.Name(), err)
+	}
+	if count*4 > len(c) {
+		return nil, fmt.Errorf("键 %s 的值列表损坏", k.Name())
+	}
+	offs := make([]uint32, count)
+	for i := range offs {
+		offs[i] = le.Uint32(c[i*4:])
+	}
+	return offs, nil
+}
+
+// findValue 查找值，返回在值列表中的位置和 vk 偏移
+func (k *Key) findValue(name string) (int, uint32, error) {
+	offs, err := k.valueOffsets()
+	if err != nil {
+		return 0, 0, err
+	}
+	for i, off := range offs {
+		vk, err := k.h.cell(off)
+		if err != nil || len(vk) < vkName || string(vk[:2]) != "vk" {
+			return 0, 0, fmt.Errorf("键 %s 的值列表损坏", k.Name())
+		}
+		if strings.EqualFold(valueName(vk), name) {
+			return i, off, nil
+		}
+	}
+	return 0, 0, ErrNotFound
+}
+
+// appendValue 将 vk 追加到值列表，列表单元空间不足时重新分配
+func (k *Key) appendValue(off uint32) error {
+	h := k.h
+	nk := k.nk()
+	count := int(le.Uint32(nk[nkValueCount:]))
+	list := le.Uint32(nk[nkValueList:])
+
+	if count > 0 {
+		if c, err := h.cell(list); err == nil && len(c) >= (count+1)*4 {
+			le.PutUint32(c[count*4:], off)
+			le.PutUint32(nk[nkValueCount:], uint32(count+1))
+			return nil
+		}
+	}
+
+	offs, err := k.valueOffsets()
+	if err != nil {
+		return err
+	}
+	newList, err := h.alloc((count + 1) * 4)
+	if err != nil {
+		return err
+	}
+	c := h.mustCell(newList)
+	for i, o := range offs {
+		le.PutUint32(c[i*4:], o)
+	}
+	le.PutUint32(c[count*4:], off)
+
+	nk = k.nk()
+	if count > 0 {
+		h.free(list)
+	}
+	le.PutUint32(nk[nkValueList:], newList)
+	le.PutUint32(nk[nkValueCount:], uint32(count+1))
+	return nil
+}
+
+func valueName(vk []byte) string {
+	n := int(le.Uint16(vk[vkNameLength:]))
+	if vkName+n > len(vk) {
+		n = len(vk) - vkName
+	}
+	return decodeName(vk[vkName:vkName+n], le.Uint16(vk[vkFlags:])&vkCompName != 0)
+}
+
+// readValue 读取 vk 单元
+func (h *Hive) readValue(off uint32) (Value, error) {
+	vk, err := h.cell(off)
+	if err != nil {
+		return Value{}, err
+	}
+	if len(vk) < vkName || string(vk[:2]) != "vk" {
+		return Value{}, fmt.Errorf("值单元 0x%x 无效", off)
+	}
+
+	v := Value{Name: valueName(vk), Type: le.Uint32(vk[vkType:])}
+	size := le.Uint32(vk[vkDataSize:])
+	dataOff := le.Uint32(vk[vkDataOffset:])
+
+	if size&dataInline != 0 {
+		n := min(int(size&^dataInline), 4)
+		v.Data = append([]byte(nil), vk[vkDataOffset:vkDataOffset+n]...)
+		return v, nil
+	}
+	if size == 0 {
+		return v, nil
+	}
+
+	c, err := h.cell(dataOff)
+	if err != nil {
+		return Value{}, fmt.Errorf("值 %s 的数据无效: %w", v.Name, err)
+	}
+	if size > segmentBytes && len(c) >= 8 && string(c[:2]) == "db" {
+		if v.Data, err = h.readBigData(c, int(size)); err != nil {
+			return Value{}, fmt.Errorf("值 %s 的数据无效: %w", v.Name, err)
+		}
+		return v, nil
+	}
+	if int(size) > len(c) {
+		return Value{}, fmt.Errorf("值 %s 的数据长度无效", v.Name)
+	}
+	v.Data = append([]byte(nil), c[:size]...)
+	return v, nil
+}
+
+// readBigData 读取 db 单元中分段存储的数据
+func (h *Hive) readBigData(db []byte, size int) ([]byte, error) {
+	count := int(le.Uint16(db[2:]))
+	list, err := h.cell(le.Uint32(db[4:]))
+	if err != nil {
+		return nil, err
+	}
+	if count*4 > len(list) {
+		return nil, fmt.Errorf("分段列表损坏")
+	}
+
+	data := make([]byte, 0, size)
+	for i := 0; i < count && len(data) < size; i++ {
+		seg, err := h.cell(le.Uint32(list[i*4:]))
+		if err != nil {
+			return nil, err
+		}
+		n := min(len(seg), segmentBytes, size-len(data))
+		data = append(data, seg[:n]...)
+	}
+	if len(data) != size {
+		return nil, fmt.Errorf("分段数据不完整")
+	}
+	return data, nil
+}
+
+// writeData 写入值数据，返回 vk 中的数据大小和数据偏移字段
+func (h *Hive) writeData(data []byte) (uint32, uint32, error) {
+	if len(data) <= 4 {
+		var inline [4]byte
+		copy(inline[:], data)
+		return uint32(len(data)) | dataInline, le.Uint32(inline[:]), nil
+	}
+
+	if len(data) <= segmentBytes || h.minor() < 4 {
+		off, err := h.allocData(data)
+		return uint32(len(data)), off, err
+	}
+
+	var segments []uint32
+	for start := 0; start < len(data); start += segmentBytes {
+		end := min(start+segmentBytes, len(data))
+		seg, err := h.allocData(data[start:end])
+		if err != nil {
+			return 0, 0, err
+		}
+		segments = append(segments, seg)
+	}
+
+	list, err := h.alloc(len(segments) * 4)
+	if err != nil {
+		return 0, 0, err
+	}
+	c := h.mustCell(list)
+	for i, seg := range segments {
+		le.PutUint32(c[i*4:], seg)
+	}
+
+	db := make([]byte, 8)
+	copy(db, "db")
+	le.PutUint16(db[2:], uint16(len(segments)))
+	le.PutUint32(db[4:], list)
+	off, err := h.allocData(db)
+	return uint32(len(data)), off, err
+}
+
+// freeData 释放 vk 引用的数据单元
+func (h *Hive) freeData(vk []byte) {
+	size := le.Uint32(vk[vkDataSize:])
+	off := le.Uint32(vk[vkDataOffset:])
+	if size&dataInline != 0 || size == 0 {
+		return
+	}
+
+	if c, err := h.cell(off); err == nil && size > segmentBytes && len(c) >= 8 && string(c[:2]) == "db" {
+		count := int(le.Uint16(c[2:]))
+		listOff := le.Uint32(c[4:])
+		if list, err := h.cell(listOff); err == nil {
+			for i := 0; i < count && (i+1)*4 <= len(list); i++ {
+				h.free(le.Uint32(list[i*4:]))
+			}
+		}
+		h.free(listOff)
+	}
+	h.free(off)
+}
+
+// freeValue 释放 vk 单元及其数据
+func (h *Hive) freeValue(off uint32) {
+	if vk, err := h.cell(off); err == nil && len(vk) >= vkName {
+		h.freeData(vk)
+	}
+	h.free(off)
+}
@@ -2,17 +2,46 @@ package registry
 
 import (
 	"fmt"
+	"sync"
 	"time"
 	"tiny11-builder/internal/config"
 	"tiny11-builder/internal/logger"
 	"tiny11-builder/internal/utils"
 )
 
+// hiveFiles 构建时加载的配置单元: 挂载路径和相对于挂载目录的文件路径
+var hiveFiles = []struct {
+	mount string
+	file  string
+}{
+	{"HKLM\\zCOMPONENTS", "Windows\\System32\\config\\COMPONENTS"},
+	{"HKLM\\zDEFAULT", "Windows\\System32\\config\\default"},
+	{"HKLM\\zNTUSER", "Users\\Default\\ntuser.dat"},
+	{"HKLM\\zSOFTWARE", "Windows\\System32\\config\\SOFTWARE"},
+	{"HKLM\\zSYSTEM", "Windows\\System32\\config\\SYSTEM"},
+}
+
+// hiveMu 配置单元的挂载路径 (HKLM\zSOFTWARE 等) 在系统中全局唯一，
+// 同一进程中并行的构建 (API 任务) 依次加载和卸载
+var hiveMu sync.Mutex
+
+// LockHives 独占配置单元挂载路径；直接 reg load 的代码在加载前调用，卸载后调用 UnlockHives
+func LockHives() {
+	hiveMu.Lock()
+}
+
+// UnlockHives 释放配置单元挂载路径
+func UnlockHives() {
+	hiveMu.Unlock()
+}
+
 // Manager 注册表管理器
 type Manager struct {
 	config      *config.Config
 	log         *logger.Logger
+	runner      utils.CommandRunner
 	hivesLoaded bool
+	locked      bool // 持有 hiveMu (LoadHives 到 UnloadHives 之间)
 }
 
 // NewManager 创建注册表管理器
@@ -20,26 +49,23 @@ func NewManager(cfg *config.Config, log *logger.Logger) *Manager {
 	return &Manager{
 		config: cfg,
 		log:    log,
+		runner: cfg.CommandRunner(),
 	}
 }
 
 // LoadHives 加载注册表Hive
 func (m *Manager) LoadHives() error {
 	mountPath := m.config.ScratchDir
-	m.log.Info("加载注册表Hive...")
-
-	hives := map[string]string{
-		"HKLM\\zCOMPONENTS": "Windows\\System32\\config\\COMPONENTS",
-		"HKLM\\zDEFAULT":    "Windows\\System32\\config\\default",
-		"HKLM\\zNTUSER":     "Users\\Default\\ntuser.dat",
-		"HKLM\\zSOFTWARE":   "Windows\\System32\\config\\SOFTWARE",
-		"HKLM\\zSYSTEM":     "Windows\\System32\\config\\SYSTEM",
+	if !m.locked {
+		LockHives()
+		m.locked = true
 	}
+	m.log.Info("加载注册表Hive...")
 
-	for hive, path := range hives {
-		fullPath := fmt.Sprintf("%s\\%s", mountPath, path)
-		if err := loadHive(hive, fullPath); err != nil {
-			m.log.Warn("加载Hive失败 %s: %v", hive, err)
+	for _, h := range hiveFiles {
+		fullPath := fmt.Sprintf("%s\\%s", mountPath, h.file)
+		if err := m.loadHive(h.mount, fullPath); err != nil {
+			m.log.Warn("加载Hive失败 %s: %v", h.mount, err)
 		}
 	}
 
@@ -52,17 +78,10 @@ func (m *Manager) UnloadHives() error {
 	if !m.hivesLoaded {
 		return nil
 	}
+	defer m.unlock()
 
 	m.log.Info("卸载注册表Hive...")
 
-	hives := []string{
-		"HKLM\\zCOMPONENTS",
-		"HKLM\\zDEFAULT",
-		"HKLM\\zNTUSER",
-		"HKLM\\zSOFTWARE",
-		"HKLM\\zSYSTEM",
-	}
-
 	// 多次尝试卸载（有时需要等待）
 	maxRetries := 3
 	for retry := 0; retry < maxRetries; retry++ {
@@ -72,9 +91,9 @@ func (m *Manager) UnloadHives() error {
 		}
 
 		allSuccess := true
-		for _, hive := range hives {
-			if err := unloadHive(hive); err != nil {
-				m.log.Warn("卸载Hive失败 %s: %v (尝试 %d/%d)", hive, err, retry+1, maxRetries)
+		for _, h := range hiveFiles {
+			if err := m.unloadHive(h.mount); err != nil {
+				m.log.Warn("卸载Hive失败 %s: %v (尝试 %d/%d)", h.mount, err, retry+1, maxRetries)
 				allSuccess = false
 			}
 		}
@@ -91,25 +110,33 @@ func (m *Manager) UnloadHives() error {
 	return fmt.Errorf("部分注册表Hive卸载失败")
 }
 
+// unlock 卸载完成 (或放弃重试) 后释放挂载路径
+func (m *Manager) unlock() {
+	if m.locked {
+		m.locked = false
+		UnlockHives()
+	}
+}
+
 // loadHive 加载单个Hive
-func loadHive(hive, path string) error {
-	_, err := utils.RunCommand("reg", "load", hive, path)
+func (m *Manager) loadHive(hive, path string) error {
+	_, err := utils.RunWith(m.runner, "reg", "load", hive, path)
 	return err
 }
 
 // unloadHive 卸载单个Hive
-func unloadHive(hive string) error {
+func (m *Manager) unloadHive(hive string) error {
 	// 先尝试正常卸载
-	_, err := utils.RunCommand("reg", "unload", hive)
+	_, err := utils.RunWith(m.runner, "reg", "unload", hive)
 	if err == nil {
 		return nil
 	}
 
 	// 如果失败，强制垃圾回收
-	utils.RunCommand("reg", "unload", hive)
+	utils.RunWith(m.runner, "reg", "unload", hive)
 	time.Sleep(500 * time.Millisecond)
 	
 	// 再次尝试
-	_, err = utils.RunCommand("reg", "unload", hive)
+	_, err = utils.RunWith(m.runner, "reg", "unload", hive)
 	return err
 }
\ No newline at end of file
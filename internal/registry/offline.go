@@ -0,0 +1,425 @@
+package registry
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"tiny11-builder/internal/regf"
+	"tiny11-builder/internal/utils"
+)
+
+const (
+	regSuccess     = "The operation completed successfully.\n"
+	regErrNotFound = "ERROR: The system was unable to find the specified registry key or value."
+	regErrSyntax   = "ERROR: Invalid syntax."
+)
+
+// OfflineRunner 离线注册表执行器
+//
+// 拦截 reg load/unload/add/delete/query 命令，直接读写配置单元文件 (regf 包)，
+// 不需要管理员权限，也不会出现卸载失败需要重试的情况。加载的文件不是
+// regf 格式 (例: 模拟器的 JSON 配置单元) 或键不在离线加载的配置单元下时，
+// 命令交给内部执行器处理。其他命令 (dism 等) 原样交给内部执行器。
+type OfflineRunner struct {
+	inner utils.CommandRunner
+
+	mu sync.Mutex
+	// hives 小写挂载路径 (HKLM\zSYSTEM) -> 已打开的配置单元
+	hives map[string]*offlineHive
+}
+
+type offlineHive struct {
+	root string
+	hive *regf.Hive
+}
+
+// NewOfflineRunner 创建离线注册表执行器
+func NewOfflineRunner(inner utils.CommandRunner) *OfflineRunner {
+	if inner == nil {
+		inner = utils.NewExecRunner()
+	}
+	return &OfflineRunner{
+		inner: inner,
+		hives: make(map[string]*offlineHive),
+	}
+}
+
+// Inner 返回内部执行器
+func (r *OfflineRunner) Inner() utils.CommandRunner {
+	return r.inner
+}
+
+// Offline 与内部执行器一致 (dism 等命令仍由内部执行器执行)
+func (r *OfflineRunner) Offline() bool {
+	return utils.IsOffline(r.inner)
+}
+
+// Run 执行命令，reg 命令尽量在进程内处理
+func (r *OfflineRunner) Run(name string, args ...string) (*utils.CommandResult, error) {
+	base := strings.ToLower(filepath.Base(strings.ReplaceAll(name, "\\", "/")))
+	if strings.TrimSuffix(base, ".exe") != "reg" || len(args) < 2 {
+		return r.inner.Run(name, args...)
+	}
+
+	r.mu.Lock()
+	result, handled := r.runReg(args)
+	r.mu.Unlock()
+	if !handled {
+		return r.inner.Run(name, args...)
+	}
+
+	result.Name = name
+	result.Args = args
+	if result.ExitCode != 0 {
+		return result, fmt.Errorf("exit status %d", result.ExitCode)
+	}
+	return result, nil
+}
+
+// runReg 处理 reg 命令，返回 false 表示交给内部执行器
+func (r *OfflineRunner) runReg(args []string) (*utils.CommandResult, bool) {
+	op := strings.ToLower(args[0])
+	key := normalizeKey(args[1])
+
+	switch op {
+	case "load":
+		if len(args) < 3 || !regf.IsHive(args[2]) {
+			return nil, false
+		}
+		return r.load(key, args[2]), true
+	case "unload":
+		h := r.hives[strings.ToLower(key)]
+		if h == nil {
+			return nil, false
+		}
+		return r.unload(h), true
+	case "add", "delete", "query":
+		h, sub := r.find(key)
+		if h == nil {
+			return nil, false
+		}
+		opts := regOptions(args[2:])
+		switch op {
+		case "add":
+			return r.add(h, sub, opts), true
+		case "delete":
+			return r.delete(h, sub, opts), true
+		default:
+			return r.query(h, sub, opts), true
+		}
+	}
+	return nil, false
+}
+
+func (r *OfflineRunner) load(root, path string) *utils.CommandResult {
+	lower := strings.ToLower(root)
+	if _, loaded := r.hives[lower]; loaded {
+		return regFail("ERROR: The process cannot access the file because it is being used by another process.")
+	}
+	hive, err := regf.Open(path)
+	if err != nil {
+		return regFail("ERROR: " + err.Error())
+	}
+	r.hives[lower] = &offlineHive{root: root, hive: hive}
+	return &utils.CommandResult{Stdout: regSuccess}
+}
+
+func (r *OfflineRunner) unload(h *offlineHive) *utils.CommandResult {
+	if h.hive.Modified() {
+		if err := h.hive.Save(); err != nil {
+			return regFail("ERROR: " + err.Error())
+		}
+	}
+	delete(r.hives, strings.ToLower(h.root))
+	return &utils.CommandResult{Stdout: regSuccess}
+}
+
+// find 查找键所在的离线配置单元，返回配置单元和相对路径
+func (r *OfflineRunner) find(key string) (*offlineHive, string) {
+	lower := strings.ToLower(key)
+	for root, h := range r.hives {
+		if lower == root {
+			return h, ""
+		}
+		if strings.HasPrefix(lower, root+`\`) {
+			return h, key[len(root)+1:]
+		}
+	}
+	return nil, ""
+}
+
+func (r *OfflineRunner) add(h *offlineHive, sub string, opts map[string]string) *utils.CommandResult {
+	name, hasName := opts["/v"]
+	if _, ve := opts["/ve"]; ve {
+		name, hasName = "", true
+	}
+
+	var typ uint32 = regf.TypeSZ
+	if t, ok := opts["/t"]; ok {
+		if typ, ok = regf.ParseType(t); !ok {
+			return regFail(regErrSyntax)
+		}
+	}
+	data, err := encodeRegData(typ, opts["/d"], opts["/s"])
+	if err != nil {
+		return regFail(regErrSyntax)
+	}
+
+	key, err := h.hive.CreateKey(sub)
+	if err != nil {
+		return regFail("ERROR: " + err.Error())
+	}
+	if hasName {
+		if err := key.SetValue(name, typ, data); err != nil {
+			return regFail("ERROR: " + err.Error())
+		}
+	}
+	return &utils.CommandResult{Stdout: regSuccess}
+}
+
+func (r *OfflineRunner) delete(h *offlineHive, sub string, opts map[string]string) *utils.CommandResult {
+	key, err := h.hive.OpenKey(sub)
+	if err != nil {
+		return regFail(regErrNotFound)
+	}
+
+	name, hasName := opts["/v"]
+	if _, ve := opts["/ve"]; ve {
+		name, hasName = "", true
+	}
+
+	switch {
+	case hasName:
+		err = key.DeleteValue(name)
+	case hasOpt(opts, "/va"):
+		values, verr := key.Values()
+		if err = verr; err == nil {
+			for _, v := range values {
+				if err = key.DeleteValue(v.Name); err != nil {
+					break
+				}
+			}
+		}
+	case sub == "":
+		return regFail("ERROR: Access is denied.")
+	default:
+		err = h.hive.DeleteKey(sub)
+	}
+
+	if errors.Is(err, regf.ErrNotFound) {
+		return regFail(regErrNotFound)
+	}
+	if err != nil {
+		return regFail("ERROR: " + err.Error())
+	}
+	return &utils.CommandResult{Stdout: regSuccess}
+}
+
+func (r *OfflineRunner) query(h *offlineHive, sub string, opts map[string]string) *utils.CommandResult {
+	key, err := h.hive.OpenKey(sub)
+	if err != nil {
+		return regFail(regErrNotFound)
+	}
+
+	path := displayKey(h.root, sub)
+	var b strings.Builder
+
+	name, hasName := opts["/v"]
+	if _, ve := opts["/ve"]; ve {
+		name, hasName = "", true
+	}
+	if hasName {
+		v, err := key.Value(name)
+		if err != nil {
+			return regFail(regErrNotFound)
+		}
+		fmt.Fprintf(&b, "\n%s\n", path)
+		writeRegValue(&b, v)
+		b.WriteString("\n")
+		return &utils.CommandResult{Stdout: b.String()}
+	}
+
+	if err := writeRegKey(&b, key, path, hasOpt(opts, "/s")); err != nil {
+		return regFail("ERROR: " + err.Error())
+	}
+	b.WriteString("\n")
+	return &utils.CommandResult{Stdout: b.String()}
+}
+
+// writeRegKey 按 reg query 的格式输出键的值，之后以完整路径列出子键 (/s 时递归输出)
+func writeRegKey(b *strings.Builder, key *regf.Key, path string, recursive bool) error {
+	values, err := key.Values()
+	if err != nil {
+		return err
+	}
+	subkeys, err := key.Subkeys()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(b, "\n%s\n", path)
+	for _, v := range values {
+		writeRegValue(b, v)
+	}
+
+	if !recursive {
+		if len(subkeys) > 0 {
+			b.WriteString("\n")
+		}
+		for _, sub := range subkeys {
+			fmt.Fprintf(b, "%s\\%s\n", path, sub.Name())
+		}
+		return nil
+	}
+
+	for _, sub := range subkeys {
+		if err := writeRegKey(b, sub, path+`\`+sub.Name(), true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeRegValue(b *strings.Builder, v regf.Value) {
+	name := v.Name
+	if name == "" {
+		name = "(Default)"
+	}
+	fmt.Fprintf(b, "    %s    %s    %s\n", name, regf.TypeName(v.Type), formatRegData(v))
+}
+
+// formatRegData 按 reg query 的格式输出值数据
+func formatRegData(v regf.Value) string {
+	switch v.Type {
+	case regf.TypeSZ, regf.TypeExpandSZ:
+		return v.String()
+	case regf.TypeMultiSZ:
+		return strings.Join(v.Strings(), `\0`)
+	case regf.TypeDWORD, regf.TypeDWORDBigEndian, regf.TypeQWORD:
+		if n, err := v.Uint64(); err == nil {
+			return fmt.Sprintf("0x%x", n)
+		}
+	}
+	return strings.ToUpper(hex.EncodeToString(v.Data))
+}
+
+// encodeRegData 按 reg add 的规则将 /d 参数编码为值数据
+func encodeRegData(typ uint32, data, sep string) ([]byte, error) {
+	switch typ {
+	case regf.TypeDWORD, regf.TypeDWORDBigEndian:
+		n, err := parseRegNumber(data, 32)
+		if err != nil {
+			return nil, err
+		}
+		if typ == regf.TypeDWORDBigEndian {
+			return []byte{byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)}, nil
+		}
+		return regf.DWORDData(uint32(n)), nil
+	case regf.TypeQWORD:
+		n, err := parseRegNumber(data, 64)
+		if err != nil {
+			return nil, err
+		}
+		return regf.QWORDData(n), nil
+	case regf.TypeMultiSZ:
+		if sep == "" {
+			sep = `\0`
+		}
+		var items []string
+		if data != "" {
+			items = strings.Split(data, sep)
+		}
+		return regf.MultiStringData(items), nil
+	case regf.TypeBinary, regf.TypeNone:
+		return hex.DecodeString(data)
+	}
+	return regf.StringData(data), nil
+}
+
+// parseRegNumber 解析十进制或 0x 开头的十六进制数
+func parseRegNumber(s string, bitSize int) (uint64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		return strconv.ParseUint(s[2:], 16, bitSize)
+	}
+	return strconv.ParseUint(s, 10, bitSize)
+}
+
+// regOptions 解析 /v /t /d /s /f /ve 等参数
+//
+// /s 在 reg add 中带分隔符参数，在 reg query 中是递归开关，
+// 后面紧跟的参数不以 / 开头时视为分隔符。
+func regOptions(args []string) map[string]string {
+	opts := make(map[string]string)
+	for i := 0; i < len(args); i++ {
+		arg := strings.ToLower(args[i])
+		switch arg {
+		case "/v", "/t", "/d":
+			if i+1 < len(args) {
+				opts[arg] = args[i+1]
+				i++
+			}
+		case "/s":
+			opts[arg] = ""
+			if i+1 < len(args) && !strings.HasPrefix(args[i+1], "/") {
+				opts[arg] = args[i+1]
+				i++
+			}
+		default:
+			opts[arg] = ""
+		}
+	}
+	return opts
+}
+
+func hasOpt(opts map[string]string, name string) bool {
+	_, ok := opts[name]
+	return ok
+}
+
+// normalizeKey 统一根键缩写 (HKEY_LOCAL_MACHINE -> HKLM 等)
+func normalizeKey(key string) string {
+	key = strings.Trim(key, `\`)
+	root, rest, _ := strings.Cut(key, `\`)
+	switch strings.ToUpper(root) {
+	case "HKEY_LOCAL_MACHINE", "HKLM":
+		root = "HKLM"
+	case "HKEY_CURRENT_USER", "HKCU":
+		root = "HKCU"
+	case "HKEY_USERS", "HKU":
+		root = "HKU"
+	case "HKEY_CLASSES_ROOT", "HKCR":
+		root = "HKCR"
+	}
+	if rest == "" {
+		return root
+	}
+	return root + `\` + rest
+}
+
+// displayKey 按 reg query 的格式输出完整键路径
+func displayKey(root, sub string) string {
+	path := root
+	if sub != "" {
+		path += `\` + sub
+	}
+	if head, rest, _ := strings.Cut(path, `\`); head == "HKLM" {
+		return `HKEY_LOCAL_MACHINE\` + rest
+	}
+	return path
+}
+
+func regFail(msg string) *utils.CommandResult {
+	return &utils.CommandResult{
+		Stdout:   msg + "\n",
+		Stderr:   msg,
+		ExitCode: 1,
+	}
+}
@@ -0,0 +1,453 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"tiny11-builder/internal/regf"
+	"tiny11-builder/internal/utils"
+)
+
+// 注册表快照的两个阶段
+const (
+	SnapshotBefore = "before"
+	SnapshotAfter  = "after"
+)
+
+// 差异类型
+const (
+	DiffAdded   = "added"
+	DiffRemoved = "removed"
+	DiffChanged = "changed"
+)
+
+// diffDataWidth 文本报告中值数据的最大显示长度
+const diffDataWidth = 96
+
+// RegDiff 两个注册表快照之间的差异
+type RegDiff struct {
+	Summary DiffSummary `json:"summary"`
+	Keys    []KeyDiff   `json:"keys"`
+}
+
+// DiffSummary 差异统计
+type DiffSummary struct {
+	KeysAdded     int `json:"keysAdded"`
+	KeysRemoved   int `json:"keysRemoved"`
+	ValuesAdded   int `json:"valuesAdded"`
+	ValuesRemoved int `json:"valuesRemoved"`
+	ValuesChanged int `json:"valuesChanged"`
+}
+
+// KeyDiff 一个键的差异 (路径为在线系统的路径)
+//
+// 删除的键只列出最上层的键，不列出其子键和值。
+type KeyDiff struct {
+	Key    string      `json:"key"`
+	Change string      `json:"change,omitempty"` // added / removed，只有值变化的键为空
+	Values []ValueDiff `json:"values,omitempty"`
+}
+
+// ValueDiff 一个值的差异 (名称为空表示默认值)
+type ValueDiff struct {
+	Name   string     `json:"name"`
+	Change string     `json:"change"`
+	Old    *DiffValue `json:"old,omitempty"`
+	New    *DiffValue `json:"new,omitempty"`
+}
+
+// DiffValue 值的类型和数据 (数据按 reg query 的格式显示)
+type DiffValue struct {
+	Type string `json:"type"`
+	Data string `json:"data"`
+
+	raw regf.Value
+}
+
+// snapshotKey 快照中的一个键
+type snapshotKey struct {
+	path   string                // 挂载路径 (HKLM\zSOFTWARE\...)
+	values map[string]regf.Value // 小写名称 -> 值
+}
+
+// snapshot 小写键路径 -> 键
+type snapshot map[string]*snapshotKey
+
+// HiveValue regf 以外格式的配置单元中的值 (数据为 reg add 的格式)
+type HiveValue struct {
+	Type string
+	Data string
+}
+
+// HiveDecoder 读取 regf 以外格式的配置单元文件 (如模拟器保存的配置单元)
+type HiveDecoder interface {
+	// DecodeHive 返回子键路径 -> 值名称 -> 值；不是该格式的文件返回 ok = false
+	DecodeHive(data []byte) (keys map[string]map[string]HiveValue, ok bool, err error)
+}
+
+var hiveDecoders []HiveDecoder
+
+// RegisterHiveDecoder 注册配置单元格式，注册表差异可以读取该格式的快照
+func RegisterHiveDecoder(d HiveDecoder) {
+	hiveDecoders = append(hiveDecoders, d)
+}
+
+// SnapshotHives 将挂载镜像中的配置单元文件 (及事务日志) 复制到 dir
+//
+// 配置单元需处于卸载状态。镜像中不存在的配置单元跳过。
+func (m *Manager) SnapshotHives(dir string) error {
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	if err := utils.EnsureDir(dir); err != nil {
+		return err
+	}
+
+	for _, h := range hiveFiles {
+		src := filepath.Join(append([]string{m.config.ScratchDir}, strings.Split(h.file, `\`)...)...)
+		if !utils.FileExists(src) {
+			continue
+		}
+		for _, ext := range []string{"", ".LOG1", ".LOG2"} {
+			if ext != "" && !utils.FileExists(src+ext) {
+				continue
+			}
+			if err := utils.CopyFile(src+ext, filepath.Join(dir, filepath.Base(src)+ext)); err != nil {
+				return fmt.Errorf("复制配置单元 %s 失败: %w", h.mount, err)
+			}
+		}
+	}
+	return nil
+}
+
+// DiffHives 比较两个注册表快照
+//
+// before 和 after 可以是快照目录 (或镜像的 Windows\System32\config 目录)，
+// 也可以是单个配置单元文件。配置单元按文件名对应到挂载路径
+// (SOFTWARE -> HKLM\zSOFTWARE 等)，输出时还原为在线系统的路径。
+func DiffHives(before, after string) (*RegDiff, error) {
+	old, err := loadSnapshot(before)
+	if err != nil {
+		return nil, err
+	}
+	cur, err := loadSnapshot(after)
+	if err != nil {
+		return nil, err
+	}
+	return diffSnapshots(old, cur), nil
+}
+
+// loadSnapshot 读取快照目录或单个配置单元文件
+func loadSnapshot(path string) (snapshot, error) {
+	snap := make(snapshot)
+	if !utils.DirExists(path) {
+		if !utils.FileExists(path) {
+			return nil, fmt.Errorf("注册表快照不存在: %s", path)
+		}
+		if err := snap.load(path, hiveMountFor(filepath.Base(path))); err != nil {
+			return nil, err
+		}
+		return snap, nil
+	}
+
+	for _, h := range hiveFiles {
+		file := filepath.Join(path, hiveBase(h.file))
+		if !utils.FileExists(file) {
+			continue
+		}
+		if err := snap.load(file, h.mount); err != nil {
+			return nil, err
+		}
+	}
+	return snap, nil
+}
+
+// hiveMountFor 按文件名查找配置单元的挂载路径，未知的文件挂载为 HKLM\<文件名>
+func hiveMountFor(name string) string {
+	for _, h := range hiveFiles {
+		if strings.EqualFold(hiveBase(h.file), name) {
+			return h.mount
+		}
+	}
+	return `HKLM\` + name
+}
+
+func hiveBase(file string) string {
+	return file[strings.LastIndex(file, `\`)+1:]
+}
+
+// load 读取配置单元文件 (regf 格式或已注册的其他格式) 到快照
+func (s snapshot) load(file, mount string) error {
+	if regf.IsHive(file) {
+		hive, err := regf.Open(file)
+		if err != nil {
+			return fmt.Errorf("读取配置单元 %s 失败: %w", file, err)
+		}
+		root, err := hive.Root()
+		if err != nil {
+			return fmt.Errorf("读取配置单元 %s 失败: %w", file, err)
+		}
+		if err := s.walk(root, mount); err != nil {
+			return fmt.Errorf("读取配置单元 %s 失败: %w", file, err)
+		}
+		return nil
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	for _, d := range hiveDecoders {
+		keys, ok, err := d.DecodeHive(data)
+		if !ok {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("读取配置单元 %s 失败: %w", file, err)
+		}
+		s.addDecoded(mount, keys)
+		return nil
+	}
+	return fmt.Errorf("%s 不是有效的配置单元文件", file)
+}
+
+// addDecoded 添加其他格式的配置单元中的键和值
+func (s snapshot) addDecoded(mount string, keys map[string]map[string]HiveValue) {
+	s.add(mount)
+	for sub, values := range keys {
+		k := s.add(mount + `\` + sub)
+		for name, v := range values {
+			typ, ok := regf.ParseType(v.Type)
+			if !ok {
+				typ = regf.TypeSZ
+			}
+			raw, err := encodeRegData(typ, v.Data, "")
+			if err != nil {
+				raw = regf.StringData(v.Data)
+			}
+			k.values[strings.ToLower(name)] = regf.Value{Name: name, Type: typ, Data: raw}
+		}
+	}
+}
+
+func (s snapshot) walk(key *regf.Key, path string) error {
+	k := s.add(path)
+	values, err := key.Values()
+	if err != nil {
+		return err
+	}
+	for _, v := range values {
+		k.values[strings.ToLower(v.Name)] = v
+	}
+
+	subkeys, err := key.Subkeys()
+	if err != nil {
+		return err
+	}
+	for _, sub := range subkeys {
+		if err := s.walk(sub, path+`\`+sub.Name()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// add 添加键 (包括所有父键)，已存在时返回现有的键
+func (s snapshot) add(path string) *snapshotKey {
+	lower := strings.ToLower(path)
+	if k := s[lower]; k != nil {
+		return k
+	}
+	if i := strings.LastIndex(path, `\`); i > 0 {
+		s.add(path[:i])
+	}
+	k := &snapshotKey{path: path, values: make(map[string]regf.Value)}
+	s[lower] = k
+	return k
+}
+
+// diffSnapshots 逐键比较两个快照
+func diffSnapshots(before, after snapshot) *RegDiff {
+	paths := make([]string, 0, len(before)+len(after))
+	for p := range before {
+		paths = append(paths, p)
+	}
+	for p := range after {
+		if before[p] == nil {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+
+	diff := &RegDiff{}
+	for _, p := range paths {
+		old, cur := before[p], after[p]
+		switch {
+		case cur == nil:
+			// 父键也被删除时只记录父键
+			if i := strings.LastIndex(p, `\`); i > 0 && before[p[:i]] != nil && after[p[:i]] == nil {
+				continue
+			}
+			diff.Keys = append(diff.Keys, KeyDiff{Key: LiveKey(old.path), Change: DiffRemoved})
+			diff.Summary.KeysRemoved++
+		case old == nil:
+			kd := KeyDiff{Key: LiveKey(cur.path), Change: DiffAdded}
+			kd.Values = diffValues(nil, cur.values, &diff.Summary)
+			diff.Keys = append(diff.Keys, kd)
+			diff.Summary.KeysAdded++
+		default:
+			if values := diffValues(old.values, cur.values, &diff.Summary); len(values) > 0 {
+				diff.Keys = append(diff.Keys, KeyDiff{Key: LiveKey(cur.path), Values: values})
+			}
+		}
+	}
+	return diff
+}
+
+func diffValues(before, after map[string]regf.Value, sum *DiffSummary) []ValueDiff {
+	names := make([]string, 0, len(before)+len(after))
+	for n := range before {
+		names = append(names, n)
+	}
+	for n := range after {
+		if _, ok := before[n]; !ok {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+
+	var diffs []ValueDiff
+	for _, n := range names {
+		old, hadOld := before[n]
+		cur, hasCur := after[n]
+		switch {
+		case !hasCur:
+			diffs = append(diffs, ValueDiff{Name: old.Name, Change: DiffRemoved, Old: diffValue(old)})
+			sum.ValuesRemoved++
+		case !hadOld:
+			diffs = append(diffs, ValueDiff{Name: cur.Name, Change: DiffAdded, New: diffValue(cur)})
+			sum.ValuesAdded++
+		case old.Type != cur.Type || !bytes.Equal(old.Data, cur.Data):
+			diffs = append(diffs, ValueDiff{Name: cur.Name, Change: DiffChanged, Old: diffValue(old), New: diffValue(cur)})
+			sum.ValuesChanged++
+		}
+	}
+	return diffs
+}
+
+func diffValue(v regf.Value) *DiffValue {
+	return &DiffValue{Type: regf.TypeName(v.Type), Data: formatRegData(v), raw: v}
+}
+
+// ==================== 输出 ====================
+
+// WriteFiles 将差异写入 <prefix>.txt、<prefix>.json 和 <prefix>.reg，返回写入的文件
+func (d *RegDiff) WriteFiles(prefix string) ([]string, error) {
+	if err := utils.EnsureDir(filepath.Dir(prefix)); err != nil {
+		return nil, err
+	}
+
+	var files []string
+	write := func(ext string, data []byte) error {
+		path := prefix + ext
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return err
+		}
+		files = append(files, path)
+		return nil
+	}
+
+	if err := write(".txt", []byte(d.Text())); err != nil {
+		return files, err
+	}
+	data, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return files, err
+	}
+	if err := write(".json", data); err != nil {
+		return files, err
+	}
+	if err := write(".reg", encodeRegFile(d.Reg())); err != nil {
+		return files, err
+	}
+	return files, nil
+}
+
+// SummaryLine 一行统计
+func (d *RegDiff) SummaryLine() string {
+	s := d.Summary
+	return fmt.Sprintf("新增键 %d, 删除键 %d, 新增值 %d, 删除值 %d, 修改值 %d",
+		s.KeysAdded, s.KeysRemoved, s.ValuesAdded, s.ValuesRemoved, s.ValuesChanged)
+}
+
+// Text 文本格式的差异 (+ 新增, - 删除, ~ 修改)
+func (d *RegDiff) Text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "注册表差异: %s\n", d.SummaryLine())
+
+	for _, k := range d.Keys {
+		b.WriteString("\n")
+		switch k.Change {
+		case DiffAdded:
+			fmt.Fprintf(&b, "+ [%s]\n", k.Key)
+		case DiffRemoved:
+			fmt.Fprintf(&b, "- [%s]\n", k.Key)
+		default:
+			fmt.Fprintf(&b, "  [%s]\n", k.Key)
+		}
+		for _, v := range k.Values {
+			name := displayName(v.Name)
+			switch v.Change {
+			case DiffAdded:
+				fmt.Fprintf(&b, "    + %s = %s\n", name, v.New.text())
+			case DiffRemoved:
+				fmt.Fprintf(&b, "    - %s = %s\n", name, v.Old.text())
+			default:
+				fmt.Fprintf(&b, "    ~ %s = %s -> %s\n", name, v.Old.text(), v.New.text())
+			}
+		}
+	}
+	return b.String()
+}
+
+func (v *DiffValue) text() string {
+	data := strings.NewReplacer("\r", `\r`, "\n", `\n`).Replace(v.Data)
+	if r := []rune(data); len(r) > diffDataWidth {
+		data = string(r[:diffDataWidth]) + "..."
+	}
+	return v.Type + " " + data
+}
+
+// Reg .reg 格式的差异: 导入到修改前的注册表即得到修改后的状态
+func (d *RegDiff) Reg() string {
+	var b strings.Builder
+	b.WriteString(regFileHeader + "\r\n")
+
+	for _, k := range d.Keys {
+		b.WriteString("\r\n")
+		if k.Change == DiffRemoved {
+			fmt.Fprintf(&b, "[-%s]\r\n", k.Key)
+			continue
+		}
+		fmt.Fprintf(&b, "[%s]\r\n", k.Key)
+		for _, v := range k.Values {
+			if v.Change == DiffRemoved {
+				name := "@"
+				if v.Name != "" {
+					name = quoteRegString(v.Name)
+				}
+				b.WriteString(name + "=-\r\n")
+				continue
+			}
+			b.WriteString(formatRegEntry(v.Name, v.New.raw) + "\r\n")
+		}
+	}
+
+	b.WriteString("\r\n")
+	return b.String()
+}
@@ -0,0 +1,68 @@
+package registry
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// lineDecoder 测试用的配置单元格式: 每行 "键|名称|类型|数据"，以 # 开头
+type lineDecoder struct{}
+
+func (lineDecoder) DecodeHive(data []byte) (map[string]map[string]HiveValue, bool, error) {
+	text, ok := strings.CutPrefix(string(data), "#")
+	if !ok {
+		return nil, false, nil
+	}
+	keys := make(map[string]map[string]HiveValue)
+	for _, line := range strings.Split(strings.TrimSpace(text), "\n") {
+		f := strings.Split(line, "|")
+		if len(f) != 4 {
+			return nil, true, errors.New("格式错误")
+		}
+		if keys[f[0]] == nil {
+			keys[f[0]] = make(map[string]HiveValue)
+		}
+		keys[f[0]][f[1]] = HiveValue{Type: f[2], Data: f[3]}
+	}
+	return keys, true, nil
+}
+
+func TestDiffHivesDecoder(t *testing.T) {
+	saved := hiveDecoders
+	t.Cleanup(func() { hiveDecoders = saved })
+	hiveDecoders = []HiveDecoder{lineDecoder{}}
+
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name, "SOFTWARE")
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	before := write("before", "#Policies|Enabled|REG_DWORD|1\nPolicies|Old|REG_SZ|x\n")
+	after := write("after", "#Policies|Enabled|REG_DWORD|0\nPolicies\\New|Name|REG_SZ|y\n")
+	diff, err := DiffHives(before, after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := DiffSummary{KeysAdded: 1, ValuesAdded: 1, ValuesRemoved: 1, ValuesChanged: 1}
+	if diff.Summary != want {
+		t.Errorf("Summary = %+v, want %+v", diff.Summary, want)
+	}
+	if len(diff.Keys) == 0 || diff.Keys[0].Key != `HKEY_LOCAL_MACHINE\SOFTWARE\Policies` {
+		t.Errorf("Keys = %+v", diff.Keys)
+	}
+
+	// 损坏的配置单元和无法识别的文件返回错误，而不是当作空的配置单元
+	for name, content := range map[string]string{"corrupt": "#Policies", "unknown": "garbage"} {
+		if _, err := DiffHives(before, write(name, content)); err == nil {
+			t.Errorf("%s: DiffHives 应返回错误", name)
+		}
+	}
+}
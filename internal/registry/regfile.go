@@ -0,0 +1,629 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"tiny11-builder/internal/profile"
+	"tiny11-builder/internal/regf"
+	"tiny11-builder/internal/utils"
+)
+
+const (
+	regFileHeader  = "Windows Registry Editor Version 5.00"
+	regFileHeader4 = "REGEDIT4"
+
+	// regLineWidth 导出十六进制数据时每行的最大长度 (与注册表编辑器一致)
+	regLineWidth = 80
+)
+
+// 挂载的配置单元与实际注册表路径的对应关系
+var hiveMounts = []struct {
+	live  string // 在线系统中的路径
+	mount string // 构建时挂载的路径
+}{
+	{`HKLM\SOFTWARE`, `HKLM\zSOFTWARE`},
+	{`HKLM\SYSTEM`, `HKLM\zSYSTEM`},
+	{`HKLM\COMPONENTS`, `HKLM\zCOMPONENTS`},
+	{`HKCU`, `HKLM\zNTUSER`},
+	{`HKU\.DEFAULT`, `HKLM\zDEFAULT`},
+	{`HKCR`, `HKLM\zSOFTWARE\Classes`},
+}
+
+// LoadRegFiles 读取多个 .reg 文件并转换为注册表优化 (id 为 reg:<文件名>)
+func LoadRegFiles(paths []string) ([]profile.Tweak, error) {
+	var tweaks []profile.Tweak
+	ids := make(map[string]bool)
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("读取 .reg 文件失败: %w", err)
+		}
+		parts, err := ParseRegFile(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		base := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		for i, tweak := range parts {
+			id := "reg:" + base
+			for n := 2; ids[id]; n++ {
+				id = fmt.Sprintf("reg:%s-%d", base, n)
+			}
+			ids[id] = true
+
+			tweak.ID = id
+			tweak.Description = "导入 " + filepath.Base(path)
+			if len(parts) > 1 {
+				tweak.Description += fmt.Sprintf(" (第 %d 部分)", i+1)
+			}
+			tweaks = append(tweaks, tweak)
+		}
+	}
+	return tweaks, nil
+}
+
+// ParseRegFile 解析注册表编辑器导出的 .reg 文件 (5.00 或 REGEDIT4 格式)
+//
+// 键路径映射到构建时挂载的配置单元 (HKEY_LOCAL_MACHINE\SOFTWARE -> HKLM\zSOFTWARE，
+// HKEY_CURRENT_USER -> HKLM\zNTUSER 等)，值转换为 reg add 使用的格式。
+//
+// 一组优化先写入值再执行删除，而 .reg 文件按顺序执行；先删除键再重新写入
+// (常见的"重置"写法) 时从写入处拆分为新的一组，保持原有的执行顺序。
+func ParseRegFile(data []byte) ([]profile.Tweak, error) {
+	var parts []profile.Tweak
+	var tweak profile.Tweak
+
+	text := decodeRegText(data)
+	lines := joinRegLines(text)
+
+	header := ""
+	for len(lines) > 0 && header == "" {
+		header = strings.TrimSpace(lines[0].text)
+		lines = lines[1:]
+	}
+	ansi := false
+	switch header {
+	case regFileHeader:
+	case regFileHeader4:
+		// REGEDIT4 中的字符串数据为 ANSI 编码
+		ansi = true
+	default:
+		return nil, fmt.Errorf("不是注册表文件 (缺少 %q 文件头)", regFileHeader)
+	}
+
+	key := ""
+	for _, line := range lines {
+		s := strings.TrimSpace(line.text)
+		if s == "" || strings.HasPrefix(s, ";") {
+			continue
+		}
+		lineErr := func(format string, args ...any) error {
+			return fmt.Errorf("第 %d 行: %s", line.no, fmt.Sprintf(format, args...))
+		}
+
+		if strings.HasPrefix(s, "[") {
+			if !strings.HasSuffix(s, "]") {
+				return nil, lineErr("键路径缺少 ]")
+			}
+			path := s[1 : len(s)-1]
+			deleteKey := strings.HasPrefix(path, "-")
+			mapped, err := MountKey(strings.TrimPrefix(path, "-"))
+			if err != nil {
+				return nil, lineErr("%v", err)
+			}
+			if deleteKey {
+				tweak.Set = dropSets(tweak.Set, mapped, "", true)
+				tweak.Delete = append(tweak.Delete, profile.RegDelete{Key: mapped})
+				key = ""
+			} else {
+				key = mapped
+			}
+			continue
+		}
+
+		if key == "" {
+			return nil, lineErr("值不在任何键下")
+		}
+		name, rest, err := parseRegName(s)
+		if err != nil {
+			return nil, lineErr("%v", err)
+		}
+		if rest == "-" {
+			// @=- 删除默认值
+			tweak.Set = dropSets(tweak.Set, key, name, false)
+			tweak.Delete = append(tweak.Delete, profile.RegDelete{Key: key, Name: name, Default: name == ""})
+			continue
+		}
+		typ, value, err := parseRegData(rest, ansi)
+		if err != nil {
+			return nil, lineErr("%s: %v", displayName(name), err)
+		}
+		if deletedBefore(tweak, key, name) {
+			parts = append(parts, tweak)
+			tweak = profile.Tweak{}
+		}
+		tweak.Set = append(tweak.Set, profile.RegValue{Key: key, Name: name, Type: typ, Value: value})
+	}
+
+	if len(tweak.Set) > 0 || len(tweak.Delete) > 0 || len(parts) == 0 {
+		parts = append(parts, tweak)
+	}
+	return parts, nil
+}
+
+// dropSets 去掉之后会被删除的写入 (删除整个键时包括其子键下的值)
+func dropSets(sets []profile.RegValue, key, name string, wholeKey bool) []profile.RegValue {
+	return slices.DeleteFunc(sets, func(v profile.RegValue) bool {
+		if wholeKey {
+			_, ok := cutKeyPrefix(v.Key, key)
+			return ok
+		}
+		return strings.EqualFold(v.Key, key) && strings.EqualFold(v.Name, name)
+	})
+}
+
+// deletedBefore 判断该组中是否已删除了要写入的值或其所在的键
+func deletedBefore(tweak profile.Tweak, key, name string) bool {
+	for _, d := range tweak.Delete {
+		if d.WholeKey() {
+			if _, ok := cutKeyPrefix(key, d.Key); ok {
+				return true
+			}
+		} else if strings.EqualFold(d.Key, key) && strings.EqualFold(d.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// MountKey 将在线系统的注册表路径映射到构建时挂载的配置单元
+//
+// HKLM\SYSTEM\CurrentControlSet 映射为 ControlSet001；已经是挂载路径
+// (HKLM\zSOFTWARE\...) 的保持不变。
+func MountKey(key string) (string, error) {
+	norm := normalizeKey(key)
+	for _, m := range hiveMounts {
+		if rest, ok := cutKeyPrefix(norm, m.mount); ok {
+			return m.mount + rest, nil
+		}
+	}
+	for _, m := range hiveMounts {
+		rest, ok := cutKeyPrefix(norm, m.live)
+		if !ok {
+			continue
+		}
+		if m.mount == `HKLM\zSYSTEM` {
+			if sub, ok := cutKeyPrefix(rest, `\CurrentControlSet`); ok {
+				rest = `\ControlSet001` + sub
+			}
+		}
+		return m.mount + rest, nil
+	}
+	return "", fmt.Errorf("无法映射到挂载的配置单元: %s", key)
+}
+
+// LiveKey 将挂载的配置单元路径还原为在线系统的注册表路径 (MountKey 的逆操作)
+func LiveKey(key string) string {
+	norm := normalizeKey(key)
+	for _, m := range hiveMounts {
+		rest, ok := cutKeyPrefix(norm, m.mount)
+		if !ok {
+			continue
+		}
+		if m.mount == `HKLM\zSYSTEM` {
+			if sub, ok := cutKeyPrefix(rest, `\ControlSet001`); ok {
+				rest = `\CurrentControlSet` + sub
+			}
+		}
+		return expandRoot(m.live + rest)
+	}
+	return expandRoot(norm)
+}
+
+// cutKeyPrefix 不区分大小写地去掉键路径前缀 (只在路径分隔处匹配)
+func cutKeyPrefix(key, prefix string) (string, bool) {
+	if len(key) < len(prefix) || !strings.EqualFold(key[:len(prefix)], prefix) {
+		return "", false
+	}
+	rest := key[len(prefix):]
+	if rest != "" && rest[0] != '\\' {
+		return "", false
+	}
+	return rest, true
+}
+
+// expandRoot 将根键缩写展开为完整名称
+func expandRoot(key string) string {
+	root, rest, _ := strings.Cut(key, `\`)
+	names := map[string]string{
+		"HKLM": "HKEY_LOCAL_MACHINE",
+		"HKCU": "HKEY_CURRENT_USER",
+		"HKU":  "HKEY_USERS",
+		"HKCR": "HKEY_CLASSES_ROOT",
+	}
+	if full, ok := names[root]; ok {
+		root = full
+	}
+	if rest == "" {
+		return root
+	}
+	return root + `\` + rest
+}
+
+// regLine 合并续行后的一行及其起始行号
+type regLine struct {
+	no   int
+	text string
+}
+
+// decodeRegText 按 BOM 解码 .reg 文件 (UTF-16 LE/BE、UTF-8，无 BOM 且不是 UTF-8 时按 GBK)
+func decodeRegText(data []byte) string {
+	var text string
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		text = decodeUTF16Bytes(data[2:], false)
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		text = decodeUTF16Bytes(data[2:], true)
+	case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+		text = string(data[3:])
+	case utf8.Valid(data):
+		text = string(data)
+	default:
+		text = utils.TryDecodeGBK(data)
+	}
+	return strings.ReplaceAll(text, "\r\n", "\n")
+}
+
+func decodeUTF16Bytes(b []byte, bigEndian bool) string {
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		if bigEndian {
+			units[i] = uint16(b[i*2])<<8 | uint16(b[i*2+1])
+		} else {
+			units[i] = uint16(b[i*2+1])<<8 | uint16(b[i*2])
+		}
+	}
+	return string(utf16.Decode(units))
+}
+
+// joinRegLines 合并以 \ 结尾的续行 (十六进制数据跨多行)
+func joinRegLines(text string) []regLine {
+	var lines []regLine
+	var cur *regLine
+	for i, raw := range strings.Split(text, "\n") {
+		s := strings.TrimRight(raw, " \t\r")
+		if cur != nil {
+			cur.text += strings.TrimLeft(s, " \t")
+		} else {
+			lines = append(lines, regLine{no: i + 1, text: s})
+			cur = &lines[len(lines)-1]
+		}
+		if strings.HasSuffix(cur.text, `\`) && !strings.HasPrefix(strings.TrimSpace(cur.text), "[") {
+			cur.text = strings.TrimSuffix(cur.text, `\`)
+		} else {
+			cur = nil
+		}
+	}
+	return lines
+}
+
+// parseRegName 解析值名称 ("name" 或表示默认值的 @)，返回 = 之后的部分
+func parseRegName(s string) (string, string, error) {
+	var name string
+	if strings.HasPrefix(s, "@") {
+		s = s[1:]
+	} else if strings.HasPrefix(s, `"`) {
+		var err error
+		if name, s, err = parseRegString(s); err != nil {
+			return "", "", err
+		}
+	} else {
+		return "", "", fmt.Errorf("无法识别的行: %s", s)
+	}
+
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "=") {
+		return "", "", fmt.Errorf("值 %s 缺少 =", displayName(name))
+	}
+	return name, strings.TrimSpace(s[1:]), nil
+}
+
+// parseRegString 解析带引号的字符串 (\\ 和 \" 转义)，返回字符串和之后的部分
+func parseRegString(s string) (string, string, error) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+			}
+			b.WriteByte(s[i])
+		case '"':
+			return b.String(), s[i+1:], nil
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return "", "", fmt.Errorf("字符串缺少结尾的引号")
+}
+
+// parseRegData 解析值数据，返回值类型和 reg add /d 格式的数据
+func parseRegData(s string, ansi bool) (string, string, error) {
+	lower := strings.ToLower(s)
+	switch {
+	case strings.HasPrefix(s, `"`):
+		str, rest, err := parseRegString(s)
+		if err != nil {
+			return "", "", err
+		}
+		if strings.TrimSpace(rest) != "" {
+			return "", "", fmt.Errorf("字符串之后有多余内容")
+		}
+		return "REG_SZ", str, nil
+
+	case strings.HasPrefix(lower, "dword:"):
+		n, err := strconv.ParseUint(strings.TrimSpace(s[len("dword:"):]), 16, 32)
+		if err != nil {
+			return "", "", fmt.Errorf("无效的 dword 数据")
+		}
+		return "REG_DWORD", strconv.FormatUint(n, 10), nil
+
+	case strings.HasPrefix(lower, "hex:"):
+		data, err := parseRegHex(s[len("hex:"):])
+		if err != nil {
+			return "", "", err
+		}
+		return "REG_BINARY", hex.EncodeToString(data), nil
+
+	case strings.HasPrefix(lower, "hex("):
+		end := strings.Index(lower, "):")
+		if end < 0 {
+			return "", "", fmt.Errorf("无效的 hex() 数据")
+		}
+		typ, err := strconv.ParseUint(lower[len("hex("):end], 16, 32)
+		if err != nil {
+			return "", "", fmt.Errorf("无效的值类型 %s", s[:end+1])
+		}
+		data, err := parseRegHex(s[end+2:])
+		if err != nil {
+			return "", "", err
+		}
+		return regDataValue(uint32(typ), data, ansi)
+	}
+	return "", "", fmt.Errorf("无法识别的数据: %s", s)
+}
+
+// regDataValue 将 hex(N) 数据转换为值类型和 reg add /d 格式的数据
+func regDataValue(typ uint32, data []byte, ansi bool) (string, string, error) {
+	text := func() string {
+		if ansi {
+			return strings.TrimRight(string(data), "\x00")
+		}
+		return regf.Value{Data: data}.String()
+	}
+
+	switch typ {
+	case regf.TypeNone:
+		// 与 REG_BINARY 一样以十六进制传给 reg add
+		return "REG_NONE", hex.EncodeToString(data), nil
+	case regf.TypeSZ, regf.TypeExpandSZ:
+		return regf.TypeName(typ), text(), nil
+	case regf.TypeMultiSZ:
+		var items []string
+		if ansi {
+			items = strings.Split(strings.TrimRight(string(data), "\x00"), "\x00")
+		} else {
+			items = regf.Value{Data: data}.Strings()
+		}
+		return "REG_MULTI_SZ", strings.Join(items, `\0`), nil
+	case regf.TypeBinary:
+		return "REG_BINARY", hex.EncodeToString(data), nil
+	case regf.TypeDWORD, regf.TypeQWORD:
+		n, err := regf.Value{Type: typ, Data: data}.Uint64()
+		if err != nil {
+			return "", "", fmt.Errorf("数据长度无效")
+		}
+		return regf.TypeName(typ), strconv.FormatUint(n, 10), nil
+	}
+	return "", "", fmt.Errorf("不支持的值类型 %s", regf.TypeName(typ))
+}
+
+// parseRegHex 解析以逗号分隔的十六进制字节
+func parseRegHex(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	var data []byte
+	for _, part := range strings.Split(s, ",") {
+		b, err := strconv.ParseUint(strings.TrimSpace(part), 16, 8)
+		if err != nil {
+			return nil, fmt.Errorf("无效的十六进制数据: %q", part)
+		}
+		data = append(data, byte(b))
+	}
+	return data, nil
+}
+
+func displayName(name string) string {
+	if name == "" {
+		return "(默认)"
+	}
+	return name
+}
+
+// ==================== 导出 ====================
+
+// WriteRegFile 将注册表优化导出为 .reg 文件 (UTF-16 LE，与注册表编辑器导出的格式一致)
+//
+// 挂载路径还原为在线系统的路径，导出的文件可以直接导入到运行中的系统，
+// 也可以再通过 -import-reg 用于构建。
+func WriteRegFile(path string, tweaks []profile.Tweak) error {
+	text, err := FormatRegFile(tweaks)
+	if err != nil {
+		return err
+	}
+	if err := utils.EnsureDir(filepath.Dir(path)); err != nil {
+		return err
+	}
+	return os.WriteFile(path, encodeRegFile(text), 0644)
+}
+
+// encodeRegFile 将 .reg 文件内容编码为带 BOM 的 UTF-16 LE
+func encodeRegFile(text string) []byte {
+	units := utf16.Encode([]rune(text))
+	data := make([]byte, 2+len(units)*2)
+	data[0], data[1] = 0xFF, 0xFE
+	for i, u := range units {
+		data[2+i*2] = byte(u)
+		data[3+i*2] = byte(u >> 8)
+	}
+	return data
+}
+
+// FormatRegFile 生成 .reg 文件内容 (CRLF 换行)
+//
+// 每组优化按应用顺序输出: 先写入值，再删除值，最后删除键。
+func FormatRegFile(tweaks []profile.Tweak) (string, error) {
+	var b strings.Builder
+	b.WriteString(regFileHeader + "\r\n")
+
+	for _, t := range tweaks {
+		b.WriteString("\r\n")
+		if t.Description != "" {
+			fmt.Fprintf(&b, "; [%s] %s\r\n", t.ID, t.Description)
+		} else {
+			fmt.Fprintf(&b, "; [%s]\r\n", t.ID)
+		}
+
+		sets := newRegSections()
+		for _, v := range t.Set {
+			line, err := formatRegValue(v)
+			if err != nil {
+				return "", fmt.Errorf("注册表优化 %s: %w", t.ID, err)
+			}
+			sets.add(v.Key, line)
+		}
+		deletes := newRegSections()
+		for _, d := range t.Delete {
+			switch {
+			case d.Default:
+				deletes.add(d.Key, "@=-")
+			case d.Name != "":
+				deletes.add(d.Key, quoteRegString(d.Name)+"=-")
+			}
+		}
+
+		sets.write(&b)
+		deletes.write(&b)
+		for _, d := range t.Delete {
+			if d.WholeKey() {
+				fmt.Fprintf(&b, "[-%s]\r\n", LiveKey(d.Key))
+			}
+		}
+	}
+
+	b.WriteString("\r\n")
+	return b.String(), nil
+}
+
+// regSections 按键分组的值行，保持键首次出现的顺序
+type regSections struct {
+	keys  []string
+	lines map[string][]string
+}
+
+func newRegSections() *regSections {
+	return &regSections{lines: make(map[string][]string)}
+}
+
+func (s *regSections) add(key, line string) {
+	live := LiveKey(key)
+	if _, ok := s.lines[live]; !ok {
+		s.keys = append(s.keys, live)
+	}
+	s.lines[live] = append(s.lines[live], line)
+}
+
+func (s *regSections) write(b *strings.Builder) {
+	for _, key := range s.keys {
+		fmt.Fprintf(b, "[%s]\r\n", key)
+		for _, line := range s.lines[key] {
+			b.WriteString(line + "\r\n")
+		}
+	}
+}
+
+// formatRegValue 按注册表编辑器的格式输出一个值
+func formatRegValue(v profile.RegValue) (string, error) {
+	typ, ok := regf.ParseType(v.Type)
+	if !ok {
+		return "", fmt.Errorf("不支持的值类型 %s", v.Type)
+	}
+	data, err := encodeRegData(typ, v.Value, "")
+	if err != nil {
+		return "", fmt.Errorf("%s\\%s 的数据无效: %s", v.Key, v.Name, v.Value)
+	}
+	return formatRegEntry(v.Name, regf.Value{Type: typ, Data: data}), nil
+}
+
+// formatRegEntry 按注册表编辑器的格式输出值数据
+//
+// 无法用 "..." 或 dword: 原样表示的数据 (含换行的字符串、长度不是 4 的 DWORD 等)
+// 与注册表编辑器一样以 hex(N): 输出。
+func formatRegEntry(name string, v regf.Value) string {
+	prefix := "@"
+	if name != "" {
+		prefix = quoteRegString(name)
+	}
+
+	switch v.Type {
+	case regf.TypeSZ:
+		s := v.String()
+		if !strings.ContainsAny(s, "\r\n") && bytes.Equal(regf.StringData(s), v.Data) {
+			return prefix + "=" + quoteRegString(s)
+		}
+	case regf.TypeDWORD:
+		if len(v.Data) == 4 {
+			n, _ := v.Uint64()
+			return fmt.Sprintf("%s=dword:%08x", prefix, n)
+		}
+	case regf.TypeBinary:
+		return formatRegHex(prefix+"=hex:", v.Data)
+	}
+	return formatRegHex(fmt.Sprintf("%s=hex(%x):", prefix, v.Type), v.Data)
+}
+
+// formatRegHex 输出以逗号分隔的十六进制数据，超过行宽时以 \ 续行
+func formatRegHex(prefix string, data []byte) string {
+	var b strings.Builder
+	line := prefix
+	for i, c := range data {
+		item := fmt.Sprintf("%02x", c)
+		if i < len(data)-1 {
+			item += ","
+		}
+		if len(line)+len(item) > regLineWidth-2 {
+			b.WriteString(line + "\\\r\n")
+			line = "  "
+		}
+		line += item
+	}
+	b.WriteString(line)
+	return b.String()
+}
+
+func quoteRegString(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
@@ -0,0 +1,80 @@
+package registry
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"tiny11-builder/internal/profile"
+)
+
+func TestParseRegFileDefaultAndNone(t *testing.T) {
+	data := strings.Join([]string{
+		regFileHeader,
+		``,
+		`[HKEY_LOCAL_MACHINE\SOFTWARE\Classes\CLSID\{test}]`,
+		`@=-`,
+		`"Marker"=hex(0):`,
+		`"Flags"=hex(0):01,02,ff`,
+		``,
+		`[HKEY_CURRENT_USER\Software\Test]`,
+		`@="value"`,
+		`@=-`,
+	}, "\r\n")
+
+	tweaks, err := ParseRegFile([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []profile.Tweak{{
+		Set: []profile.RegValue{
+			{Key: `HKLM\zSOFTWARE\Classes\CLSID\{test}`, Name: "Marker", Type: "REG_NONE", Value: ""},
+			{Key: `HKLM\zSOFTWARE\Classes\CLSID\{test}`, Name: "Flags", Type: "REG_NONE", Value: "0102ff"},
+		},
+		Delete: []profile.RegDelete{
+			{Key: `HKLM\zSOFTWARE\Classes\CLSID\{test}`, Default: true},
+			{Key: `HKLM\zNTUSER\Software\Test`, Default: true},
+		},
+	}}
+	if !reflect.DeepEqual(tweaks, want) {
+		t.Errorf("ParseRegFile:\n got %+v\nwant %+v", tweaks, want)
+	}
+	if tweaks[0].Delete[0].WholeKey() {
+		t.Error("删除默认值不应删除整个键")
+	}
+}
+
+func TestFormatRegFileDefaultDelete(t *testing.T) {
+	tweaks := []profile.Tweak{{
+		ID: "test",
+		Set: []profile.RegValue{
+			{Key: `HKLM\zSOFTWARE\Test`, Name: "Marker", Type: "REG_NONE", Value: "01"},
+		},
+		Delete: []profile.RegDelete{
+			{Key: `HKLM\zSOFTWARE\Test`, Default: true},
+			{Key: `HKLM\zSOFTWARE\Other`},
+		},
+	}}
+	text, err := FormatRegFile(tweaks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		`"Marker"=hex(0):01`,
+		`@=-`,
+		`[-HKEY_LOCAL_MACHINE\SOFTWARE\Other]`,
+	} {
+		if !strings.Contains(text, line+"\r\n") {
+			t.Errorf("导出的 .reg 缺少 %q:\n%s", line, text)
+		}
+	}
+
+	// 导出的文件可以重新导入
+	parsed, err := ParseRegFile([]byte(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed[0].Set, tweaks[0].Set) || !reflect.DeepEqual(parsed[0].Delete, tweaks[0].Delete) {
+		t.Errorf("重新导入:\n got %+v\nwant %+v", parsed[0], tweaks[0])
+	}
+}
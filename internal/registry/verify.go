@@ -0,0 +1,286 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"tiny11-builder/internal/profile"
+	"tiny11-builder/internal/utils"
+)
+
+// 注册表优化的应用结果
+const (
+	TweakApplied    = "applied"     // 已写入并校验通过
+	TweakAlreadySet = "already-set" // 应用前已是目标值，未修改
+	TweakMismatch   = "mismatch"    // 命令执行成功，但读回的值与预期不一致
+	TweakFailed     = "failed"      // 命令执行失败
+)
+
+// 报告中区分安装镜像和 boot.wim 的优化
+const (
+	ImageInstall = "install"
+	ImageBoot    = "boot"
+)
+
+// TweakReport 注册表优化报告
+type TweakReport struct {
+	Time   time.Time     `json:"time"`
+	Strict bool          `json:"strict"`
+	Tweaks []TweakResult `json:"tweaks"`
+}
+
+// TweakResult 一组注册表优化的应用结果
+type TweakResult struct {
+	ID          string        `json:"id"`
+	Description string        `json:"description"`
+	Image       string        `json:"image"`
+	Required    bool          `json:"required,omitempty"`
+	Status      string        `json:"status"`
+	Values      []ValueResult `json:"values,omitempty"`
+}
+
+// ValueResult 单个注册表值 (或删除项) 的校验结果
+type ValueResult struct {
+	Key      string `json:"key"`
+	Name     string `json:"name,omitempty"`
+	Delete   bool   `json:"delete,omitempty"`
+	Default  bool   `json:"default,omitempty"` // 删除的是默认值
+	Expected string `json:"expected,omitempty"`
+	Actual   string `json:"actual,omitempty"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Verified 优化是否已生效 (已应用或本就是目标值)
+func (r TweakResult) Verified() bool {
+	return verified(r.Status)
+}
+
+// applyAndVerify 应用一组注册表优化并读回校验
+//
+// 应用前先读取现有值，全部已是目标值时不做修改；写入和删除之后再次读取，
+// 与预期不一致的记为 mismatch。
+func (m *Manager) applyAndVerify(tweak profile.Tweak, image string) TweakResult {
+	result := TweakResult{
+		ID:          tweak.ID,
+		Description: tweak.Description,
+		Image:       image,
+		Required:    tweak.Required,
+	}
+
+	pending := 0
+	for _, v := range tweak.Set {
+		vr := ValueResult{Key: v.Key, Name: v.Name, Expected: v.Type + " " + v.Value}
+		if cur, ok := m.queryValue(v.Key, v.Name); ok && valueMatches(v, cur) {
+			vr.Actual = cur.String()
+			vr.Status = TweakAlreadySet
+		} else {
+			pending++
+		}
+		result.Values = append(result.Values, vr)
+	}
+	existed := make([]bool, len(tweak.Delete))
+	for i, d := range tweak.Delete {
+		if existed[i] = m.exists(d); existed[i] {
+			pending++
+		}
+		result.Values = append(result.Values, ValueResult{Key: d.Key, Name: d.Name, Delete: true, Default: d.Default})
+	}
+
+	if pending == 0 {
+		for i := range result.Values {
+			result.Values[i].Status = TweakAlreadySet
+		}
+		result.Status = TweakAlreadySet
+		return result
+	}
+
+	// 按 写入 -> 删除 的顺序执行，之后统一读回。写入可能重新创建要删除的键，
+	// 删除总是执行 (不存在时的错误忽略)
+	for i, v := range tweak.Set {
+		vr := &result.Values[i]
+		if vr.Status == TweakAlreadySet {
+			continue
+		}
+		if err := m.setValue(v); err != nil {
+			vr.Status = TweakFailed
+			vr.Error = err.Error()
+		}
+	}
+	for i, d := range tweak.Delete {
+		vr := &result.Values[len(tweak.Set)+i]
+		if err := m.deleteValue(d); err != nil && m.exists(d) {
+			vr.Status = TweakFailed
+			vr.Error = err.Error()
+		}
+	}
+
+	for i, v := range tweak.Set {
+		vr := &result.Values[i]
+		if vr.Status == TweakFailed {
+			continue
+		}
+		cur, ok := m.queryValue(v.Key, v.Name)
+		switch {
+		case !ok:
+			vr.Status = TweakMismatch
+			vr.Actual = "(不存在)"
+		case !valueMatches(v, cur):
+			vr.Status = TweakMismatch
+			vr.Actual = cur.String()
+		case vr.Status != TweakAlreadySet:
+			vr.Status = TweakApplied
+			vr.Actual = cur.String()
+		}
+	}
+	for i, d := range tweak.Delete {
+		vr := &result.Values[len(tweak.Set)+i]
+		switch {
+		case vr.Status == TweakFailed:
+		case m.exists(d):
+			vr.Status = TweakMismatch
+			vr.Actual = "(仍然存在)"
+		case existed[i]:
+			vr.Status = TweakApplied
+		default:
+			vr.Status = TweakAlreadySet
+		}
+	}
+
+	result.Status = TweakApplied
+	for _, vr := range result.Values {
+		switch vr.Status {
+		case TweakFailed:
+			result.Status = TweakFailed
+		case TweakMismatch:
+			if result.Status != TweakFailed {
+				result.Status = TweakMismatch
+			}
+		}
+	}
+	return result
+}
+
+// deleteValue 删除注册表键、值或默认值
+func (m *Manager) deleteValue(d profile.RegDelete) error {
+	var err error
+	switch {
+	case d.Default:
+		_, err = utils.RunWith(m.runner, "reg", "delete", d.Key, "/ve", "/f")
+	case d.Name != "":
+		_, err = utils.RunWith(m.runner, "reg", "delete", d.Key, "/v", d.Name, "/f")
+	default:
+		_, err = utils.RunWith(m.runner, "reg", "delete", d.Key, "/f")
+	}
+	return err
+}
+
+// exists 要删除的键或值当前是否存在
+func (m *Manager) exists(d profile.RegDelete) bool {
+	if !d.WholeKey() {
+		_, ok := m.queryValue(d.Key, d.Name)
+		return ok
+	}
+	_, err := utils.RunWith(m.runner, "reg", "query", d.Key)
+	return err == nil
+}
+
+// queriedValue reg query 读到的值
+type queriedValue struct {
+	Type string
+	Data string
+}
+
+func (q queriedValue) String() string {
+	return q.Type + " " + q.Data
+}
+
+// regQueryLine reg query 输出中的值行: 名称、类型、数据以 4 个空格分隔
+var regQueryLine = regexp.MustCompile(`^ {4}(.*?) {4}(REG_[A-Z_]+)(?: {4}(.*?))?\s*$`)
+
+// queryValue 读取注册表值 (名称为空时读取默认值)
+func (m *Manager) queryValue(key, name string) (queriedValue, bool) {
+	args := []string{"query", key}
+	if name == "" {
+		args = append(args, "/ve")
+	} else {
+		args = append(args, "/v", name)
+	}
+	output, err := utils.RunWith(m.runner, "reg", args...)
+	if err != nil {
+		return queriedValue{}, false
+	}
+
+	// 只查询了一个值，第一个值行即为结果 (默认值的名称因系统语言而异)
+	for _, line := range strings.Split(strings.ReplaceAll(output, "\r\n", "\n"), "\n") {
+		if m := regQueryLine.FindStringSubmatch(line); m != nil {
+			return queriedValue{Type: m[2], Data: m[3]}, true
+		}
+	}
+	return queriedValue{}, false
+}
+
+// valueMatches 比较读回的值与要写入的值
+//
+// reg query 中 DWORD/QWORD 以 0x 十六进制显示、二进制数据为大写十六进制，
+// 按类型归一化后比较。
+func valueMatches(want profile.RegValue, got queriedValue) bool {
+	if !strings.EqualFold(want.Type, got.Type) {
+		return false
+	}
+	switch strings.ToUpper(want.Type) {
+	case "REG_DWORD", "REG_QWORD":
+		w, err1 := parseRegNumber(want.Value, 64)
+		g, err2 := parseRegNumber(got.Data, 64)
+		return err1 == nil && err2 == nil && w == g
+	case "REG_BINARY", "REG_NONE":
+		return strings.EqualFold(want.Value, got.Data)
+	}
+	return want.Value == got.Data
+}
+
+// writeTweakReport 写入注册表优化报告
+//
+// 安装镜像和 boot.wim 的优化分两个步骤应用 (中断后可能在另一次运行中继续)，
+// 报告中已有的另一镜像的结果保留。新的构建开始时会先删除上次构建的报告。
+func writeTweakReport(path string, strict bool, image string, results []TweakResult) error {
+	report := TweakReport{}
+	if data, err := os.ReadFile(path); err == nil {
+		json.Unmarshal(data, &report)
+	}
+
+	var tweaks []TweakResult
+	for _, r := range report.Tweaks {
+		if r.Image != image {
+			tweaks = append(tweaks, r)
+		}
+	}
+	report.Time = time.Now()
+	report.Strict = strict
+	report.Tweaks = append(tweaks, results...)
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := utils.EnsureDir(filepath.Dir(path)); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// requiredFailures 返回未生效的必需优化
+func requiredFailures(results []TweakResult) []string {
+	var ids []string
+	for _, r := range results {
+		if r.Required && !r.Verified() {
+			ids = append(ids, fmt.Sprintf("%s (%s)", r.ID, r.Status))
+		}
+	}
+	return ids
+}
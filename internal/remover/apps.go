@@ -1,10 +1,13 @@
 package remover
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"tiny11-builder/internal/config"
+	"tiny11-builder/internal/dism"
 	"tiny11-builder/internal/logger"
+	"tiny11-builder/internal/profile"
 	"tiny11-builder/internal/utils"
 )
 
@@ -12,6 +15,7 @@ import (
 type AppRemover struct {
 	config *config.Config
 	log    *logger.Logger
+	runner utils.CommandRunner
 }
 
 // NewAppRemover 创建应用移除器
@@ -19,20 +23,21 @@ func NewAppRemover(cfg *config.Config, log *logger.Logger) *AppRemover {
 	return &AppRemover{
 		config: cfg,
 		log:    log,
+		runner: cfg.CommandRunner(),
 	}
 }
 
-// RemoveProvisionedApps 移除预装应用
-func (r *AppRemover) RemoveProvisionedApps() error {
+// RemoveProvisionedApps 移除预装应用 (ctx 取消后不再移除后面的应用)
+func (r *AppRemover) RemoveProvisionedApps(ctx context.Context) error {
 	mountPath := r.config.ScratchDir
 
 	r.log.Section("移除预装应用")
 
 	// 获取已安装的应用列表
-	spinner := utils.NewSpinner("扫描已安装的应用包...")
+	spinner := r.log.NewSpinner("扫描已安装的应用包...")
 	spinner.Start()
 
-	output, err := utils.RunCommand("dism", "/English",
+	output, err := utils.RunWith(r.runner, "dism", "/English",
 		fmt.Sprintf("/Image:%s", mountPath),
 		"/Get-ProvisionedAppxPackages")
 
@@ -43,14 +48,11 @@ func (r *AppRemover) RemoveProvisionedApps() error {
 	}
 
 	// 解析包名列表
-	packages := r.parsePackageNames(output)
+	packages := dism.PackageNames(dism.ParseProvisionedAppx(output))
 	r.log.Info("发现 %d 个预装应用包", len(packages))
 
-	// 要移除的应用前缀列表
-	appPrefixes := r.getRemovalList()
-
-	// 匹配要移除的包
-	packagesToRemove := r.matchPackages(packages, appPrefixes)
+	// 匹配配置文件中要移除的应用
+	packagesToRemove := activeProfile(r.config).SelectApps(packages)
 
 	if len(packagesToRemove) == 0 {
 		r.log.Info("没有需要移除的应用包")
@@ -64,12 +66,17 @@ func (r *AppRemover) RemoveProvisionedApps() error {
 	failed := 0
 
 	for i, pkg := range packagesToRemove {
+		if err := ctx.Err(); err != nil {
+			r.log.Warn("已取消: 移除了 %d/%d 个应用包", removed+failed, len(packagesToRemove))
+			return err
+		}
+
 		pkgName := r.extractShortName(pkg)
 		r.log.Info("[%d/%d] 移除: %s",
 			i+1, len(packagesToRemove),
 			utils.Colorize(pkgName, utils.MikuYellow))
 
-		_, err := utils.RunCommand("dism", "/English",
+		_, err := utils.RunWith(r.runner, "dism", "/English",
 			fmt.Sprintf("/Image:%s", mountPath),
 			"/Remove-ProvisionedAppxPackage",
 			fmt.Sprintf("/PackageName:%s", pkg))
@@ -90,99 +97,6 @@ func (r *AppRemover) RemoveProvisionedApps() error {
 	return nil
 }
 
-// getRemovalList 获取要移除的应用列表
-func (r *AppRemover) getRemovalList() []string {
-	return []string{
-				"AppUp.IntelManagementandSecurityStatus",
-		"Clipchamp.Clipchamp",
-		"DolbyLaboratories.DolbyAccess",
-		"DolbyLaboratories.DolbyDigitalPlusDecoderOEM",
-		"Microsoft.BingNews",
-		"Microsoft.BingSearch",
-		"Microsoft.BingWeather",
-		"Microsoft.Copilot",
-		"Microsoft.Windows.CrossDevice",
-		"Microsoft.GamingApp",
-		"Microsoft.GetHelp",
-		"Microsoft.Getstarted",
-		"Microsoft.Microsoft3DViewer",
-		"Microsoft.MicrosoftOfficeHub",
-		"Microsoft.MicrosoftSolitaireCollection",
-		"Microsoft.MicrosoftStickyNotes",
-		"Microsoft.MixedReality.Portal",
-		"Microsoft.MSPaint",
-		"Microsoft.Office.OneNote",
-		"Microsoft.OfficePushNotificationUtility",
-		"Microsoft.OutlookForWindows",
-		"Microsoft.Paint",
-		"Microsoft.People",
-		"Microsoft.PowerAutomateDesktop",
-		"Microsoft.SkypeApp",
-		"Microsoft.StartExperiencesApp",
-		"Microsoft.Todos",
-		"Microsoft.Wallet",
-		"Microsoft.Windows.DevHome",
-		"Microsoft.Windows.Copilot",
-		"Microsoft.Windows.Teams",
-		"Microsoft.WindowsAlarms",
-		"Microsoft.WindowsCamera",
-		"microsoft.windowscommunicationsapps",
-		"Microsoft.WindowsFeedbackHub",
-		"Microsoft.WindowsMaps",
-		"Microsoft.WindowsSoundRecorder",
-		"Microsoft.WindowsTerminal",
-		"Microsoft.Xbox.TCUI",
-		"Microsoft.XboxApp",
-		"Microsoft.XboxGameOverlay",
-		"Microsoft.XboxGamingOverlay",
-		"Microsoft.XboxIdentityProvider",
-		"Microsoft.XboxSpeechToTextOverlay",
-		"Microsoft.YourPhone",
-		"Microsoft.ZuneMusic",
-		"Microsoft.ZuneVideo",
-		"MicrosoftCorporationII.MicrosoftFamily",
-		"MicrosoftCorporationII.QuickAssist",
-		"MSTeams",
-		"MicrosoftTeams",
-		"Microsoft.WindowsTerminal",
-		"Microsoft.549981C3F5F10", 
-	}
-}
-
-// parsePackageNames 解析包名列表
-func (r *AppRemover) parsePackageNames(output string) []string {
-	var packages []string
-	lines := strings.Split(output, "\n")
-
-	for _, line := range lines {
-		trimmed := strings.TrimSpace(line)
-		if strings.HasPrefix(trimmed, "PackageName :") {
-			pkgName := strings.TrimSpace(strings.TrimPrefix(trimmed, "PackageName :"))
-			if pkgName != "" && !strings.Contains(pkgName, "...") {
-				packages = append(packages, pkgName)
-			}
-		}
-	}
-
-	return packages
-}
-
-// matchPackages 匹配要移除的包
-func (r *AppRemover) matchPackages(packages []string, prefixes []string) []string {
-	var matched []string
-
-	for _, pkg := range packages {
-		for _, prefix := range prefixes {
-			if strings.Contains(pkg, prefix) {
-				matched = append(matched, pkg)
-				break
-			}
-		}
-	}
-
-	return matched
-}
-
 // extractShortName 提取包的短名称
 func (r *AppRemover) extractShortName(fullName string) string {
 	// 从完整包名中提取简短名称
@@ -194,14 +108,14 @@ func (r *AppRemover) extractShortName(fullName string) string {
 	return fullName
 }
 
-// RemoveSystemPackages 移除系统包
-func (r *AppRemover) RemoveSystemPackages(languageCode string) error {
+// RemoveSystemPackages 移除系统包 (ctx 取消后不再移除后面的包)
+func (r *AppRemover) RemoveSystemPackages(ctx context.Context, languageCode string) error {
 	mountPath := r.config.ScratchDir
 
 	r.log.Section("移除系统组件包")
 
 	// 获取所有包
-	output, err := utils.RunCommand("dism",
+	output, err := utils.RunWith(r.runner, "dism",
 		fmt.Sprintf("/Image:%s", mountPath),
 		"/Get-Packages",
 		"/Format:Table")
@@ -210,11 +124,18 @@ func (r *AppRemover) RemoveSystemPackages(languageCode string) error {
 		return fmt.Errorf("获取系统包列表失败: %w", err)
 	}
 
+	installed := dism.Identities(dism.ParsePackages(output))
+
 	// 要移除的包模式
-	packagePatterns := r.getSystemPackagePatterns(languageCode)
+	packagePatterns := activeProfile(r.config).PackagePatterns(languageCode)
+	if len(packagePatterns) == 0 {
+		r.log.Info("配置文件中没有要移除的系统包")
+		return nil
+	}
 
 	removed := 0
 	failed := 0
+	handled := make(map[string]bool)
 
 	for i, pattern := range packagePatterns {
 		r.log.Info("[%d/%d] 检查包: %s",
@@ -222,18 +143,28 @@ func (r *AppRemover) RemoveSystemPackages(languageCode string) error {
 			utils.Colorize(pattern, utils.MikuYellow))
 
 		// 查找匹配的包
-		packages := r.findMatchingPackages(output, pattern)
+		packages := r.findMatchingPackages(installed, pattern)
 
 		if len(packages) == 0 {
 			r.log.Info("  未找到匹配的包")
 			continue
 		}
 
-		// 移除找到的包
+		// 移除找到的包 (多个模式可能匹配同一个包)
 		for _, pkg := range packages {
+			if handled[pkg] {
+				continue
+			}
+			handled[pkg] = true
+
+			if err := ctx.Err(); err != nil {
+				r.log.Warn("已取消: 移除了 %d 个系统包", removed+failed)
+				return err
+			}
+
 			r.log.Info("  移除: %s", pkg)
 
-			_, err := utils.RunCommand("dism",
+			_, err := utils.RunWith(r.runner, "dism",
 				fmt.Sprintf("/Image:%s", mountPath),
 				"/Remove-Package",
 				fmt.Sprintf("/PackageName:%s", pkg))
@@ -254,39 +185,23 @@ func (r *AppRemover) RemoveSystemPackages(languageCode string) error {
 	return nil
 }
 
-// getSystemPackagePatterns 获取系统包模式列表
-func (r *AppRemover) getSystemPackagePatterns(languageCode string) []string {
-	return []string{
-		"Microsoft-Windows-InternetExplorer-Optional-Package~31bf3856ad364e35",
-		"Microsoft-Windows-Kernel-LA57-FoD-Package~31bf3856ad364e35~amd64",
-		fmt.Sprintf("Microsoft-Windows-LanguageFeatures-Handwriting-%s-Package~31bf3856ad364e35", languageCode),
-		fmt.Sprintf("Microsoft-Windows-LanguageFeatures-OCR-%s-Package~31bf3856ad364e35", languageCode),
-		fmt.Sprintf("Microsoft-Windows-LanguageFeatures-Speech-%s-Package~31bf3856ad364e35", languageCode),
-		fmt.Sprintf("Microsoft-Windows-LanguageFeatures-TextToSpeech-%s-Package~31bf3856ad364e35", languageCode),
-		"Microsoft-Windows-MediaPlayer-Package~31bf3856ad364e35",
-		"Microsoft-Windows-Wallpaper-Content-Extended-FoD-Package~31bf3856ad364e35",
-		"Windows-Defender-Client-Package~31bf3856ad364e35~",
-		"Microsoft-Windows-WordPad-FoD-Package~",
-		"Microsoft-Windows-TabletPCMath-Package~",
-		"Microsoft-Windows-StepsRecorder-Package~",
-	}
-}
-
 // findMatchingPackages 查找匹配的包
-func (r *AppRemover) findMatchingPackages(output, pattern string) []string {
+func (r *AppRemover) findMatchingPackages(packages []string, pattern string) []string {
 	var matches []string
-	lines := strings.Split(output, "\n")
-
-	for _, line := range lines {
-		trimmed := strings.TrimSpace(line)
-		if strings.Contains(trimmed, pattern) {
-			// 提取包标识（第一列）
-			fields := strings.Fields(trimmed)
-			if len(fields) > 0 {
-				matches = append(matches, fields[0])
-			}
+
+	for _, pkg := range packages {
+		if profile.Match(pattern, pkg) {
+			matches = append(matches, pkg)
 		}
 	}
 
 	return matches
-}
\ No newline at end of file
+}
+
+// activeProfile 当前构建使用的配置文件
+func activeProfile(cfg *config.Config) *profile.Profile {
+	if cfg.Profile != nil {
+		return cfg.Profile
+	}
+	return profile.Default(profile.ModeStandard)
+}
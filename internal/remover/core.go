@@ -1,6 +1,7 @@
 package remover
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
@@ -14,6 +15,7 @@ import (
 type CoreRemover struct {
 	config *config.Config
 	log    *logger.Logger
+	runner utils.CommandRunner
 }
 
 // NewCoreRemover 创建Core版移除器
@@ -21,11 +23,15 @@ func NewCoreRemover(cfg *config.Config, log *logger.Logger) *CoreRemover {
 	return &CoreRemover{
 		config: cfg,
 		log:    log,
+		runner: cfg.CommandRunner(),
 	}
 }
 
 // RemoveWinSxS 移除WinSxS (保留必要组件)
-func (r *CoreRemover) RemoveWinSxS() error {
+//
+// ctx 在删除原目录之前取消时丢弃已复制的组件并返回；原目录删除后
+// 必须完成替换，不再响应取消。
+func (r *CoreRemover) RemoveWinSxS(ctx context.Context) error {
 	mountPath := r.config.ScratchDir
 	winsxsPath := filepath.Join(mountPath, "Windows", "WinSxS")
 	winsxsEditPath := filepath.Join(mountPath, "Windows", "WinSxS_edit")
@@ -39,7 +45,7 @@ func (r *CoreRemover) RemoveWinSxS() error {
 	}
 
 	// 获取WinSxS大小
-	spinner := utils.NewSpinner("计算WinSxS大小...")
+	spinner := r.log.NewSpinner("计算WinSxS大小...")
 	spinner.Start()
 	originalSize, _ := r.getDirSize(winsxsPath)
 	spinner.Stop(true)
@@ -77,6 +83,10 @@ func (r *CoreRemover) RemoveWinSxS() error {
 		}
 
 		for _, match := range matches {
+			if err := ctx.Err(); err != nil {
+				return r.abortWinSxS(winsxsEditPath, err)
+			}
+
 			relPath, _ := filepath.Rel(winsxsPath, match)
 			destPath := filepath.Join(winsxsEditPath, relPath)
 
@@ -103,10 +113,10 @@ func (r *CoreRemover) RemoveWinSxS() error {
 
 	// 获取所有权
 	r.log.Info("获取WinSxS所有权...")
-	spinner = utils.NewSpinner("获取目录所有权 (这可能需要几分钟)...")
+	spinner = r.log.NewSpinner("获取目录所有权 (这可能需要几分钟)...")
 	spinner.Start()
 
-	if err := utils.TakeownRecursive(winsxsPath); err != nil {
+	if err := utils.TakeownRecursive(r.runner, winsxsPath); err != nil {
 		spinner.Stop(false)
 		r.log.Warn("获取所有权失败: %v", err)
 	} else {
@@ -115,19 +125,23 @@ func (r *CoreRemover) RemoveWinSxS() error {
 
 	// 设置权限
 	r.log.Info("设置目录权限...")
-	spinner = utils.NewSpinner("设置完全控制权限...")
+	spinner = r.log.NewSpinner("设置完全控制权限...")
 	spinner.Start()
 
-	if err := utils.GrantPermissionRecursive(winsxsPath); err != nil {
+	if err := utils.GrantPermissionRecursive(r.runner, winsxsPath); err != nil {
 		spinner.Stop(false)
 		r.log.Warn("设置权限失败: %v", err)
 	} else {
 		spinner.Stop(true)
 	}
 
+	if err := ctx.Err(); err != nil {
+		return r.abortWinSxS(winsxsEditPath, err)
+	}
+
 	// 删除原WinSxS
 	r.log.Info("删除原始WinSxS目录...")
-	spinner = utils.NewSpinner("删除WinSxS (这可能需要10-20分钟)...")
+	spinner = r.log.NewSpinner("删除WinSxS (这可能需要10-20分钟)...")
 	spinner.Start()
 
 	if err := os.RemoveAll(winsxsPath); err != nil {
@@ -157,10 +171,20 @@ func (r *CoreRemover) RemoveWinSxS() error {
 	return nil
 }
 
+// abortWinSxS 取消精简: 删除临时工作目录，原 WinSxS 保持不变
+func (r *CoreRemover) abortWinSxS(editPath string, err error) error {
+	r.log.Warn("已取消 WinSxS 精简，原目录保持不变")
+	os.RemoveAll(editPath)
+	return err
+}
+
 // getKeepDirs 获取要保留的目录列表
 func (r *CoreRemover) getKeepDirs() []string {
-	arch := r.config.GetArchitecture()
+	return WinSxSKeepPatterns(r.config.GetArchitecture())
+}
 
+// WinSxSKeepPatterns 精简 WinSxS 时保留的目录 (相对于 WinSxS 的通配符模式)
+func WinSxSKeepPatterns(arch string) []string {
 	// 通用目录
 	common := []string{
 		"Catalogs",
@@ -324,8 +348,8 @@ func (r *CoreRemover) RemoveWinRE() error {
 	}
 
 	// 获取权限
-	utils.TakeownRecursive(recoveryPath)
-	utils.GrantPermissionRecursive(recoveryPath)
+	utils.TakeownRecursive(r.runner, recoveryPath)
+	utils.GrantPermissionRecursive(r.runner, recoveryPath)
 
 	// 删除WinRE
 	if err := os.Remove(winrePath); err != nil {
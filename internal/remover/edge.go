@@ -45,11 +45,11 @@ func (r *AppRemover) RemoveEdge() error {
 		r.log.Info("移除Edge WebView...")
 
 		// 获取所有权和权限
-		if err := utils.TakeownRecursive(webviewPath); err != nil {
+		if err := utils.TakeownRecursive(r.runner, webviewPath); err != nil {
 			r.log.Warn("  获取所有权失败: %v", err)
 		}
 
-		if err := utils.GrantPermissionRecursive(webviewPath); err != nil {
+		if err := utils.GrantPermissionRecursive(r.runner, webviewPath); err != nil {
 			r.log.Warn("  设置权限失败: %v", err)
 		}
 
@@ -100,11 +100,11 @@ func (r *AppRemover) removeEdgeFromWinSxS(mountPath string, removed, failed *int
 		r.log.Info("  移除WinSxS: %s", dirName)
 
 		// 获取权限
-		if err := utils.TakeownRecursive(match); err != nil {
+		if err := utils.TakeownRecursive(r.runner, match); err != nil {
 			r.log.Warn("    获取所有权失败: %v", err)
 		}
 
-		if err := utils.GrantPermissionRecursive(match); err != nil {
+		if err := utils.GrantPermissionRecursive(r.runner, match); err != nil {
 			r.log.Warn("    设置权限失败: %v", err)
 		}
 
@@ -132,11 +132,11 @@ func (r *AppRemover) RemoveOneDrive() error {
 	}
 
 	// 获取权限
-	if err := utils.Takeown(onedrivePath); err != nil {
+	if err := utils.Takeown(r.runner, onedrivePath); err != nil {
 		r.log.Warn("获取所有权失败: %v", err)
 	}
 
-	if err := utils.GrantPermission(onedrivePath); err != nil {
+	if err := utils.GrantPermission(r.runner, onedrivePath); err != nil {
 		r.log.Warn("设置权限失败: %v", err)
 	}
 
@@ -155,43 +155,25 @@ func (r *AppRemover) RemoveScheduledTasks() error {
 	mountPath := r.config.ScratchDir
 	tasksPath := filepath.Join(mountPath, "Windows", "System32", "Tasks")
 
-	r.log.Section("移除遥测计划任务")
+	r.log.Section("移除计划任务")
 
-	// 要删除的任务文件列表
-	tasks := []struct {
-		path string
-		desc string
-	}{
-		{
-			filepath.Join(tasksPath, "Microsoft", "Windows", "Application Experience", "Microsoft Compatibility Appraiser"),
-			"应用兼容性评估",
-		},
-		{
-			filepath.Join(tasksPath, "Microsoft", "Windows", "Application Experience", "ProgramDataUpdater"),
-			"程序数据更新",
-		},
-		{
-			filepath.Join(tasksPath, "Microsoft", "Windows", "Customer Experience Improvement Program"),
-			"客户体验改善计划(整个文件夹)",
-		},
-		{
-			filepath.Join(tasksPath, "Microsoft", "Windows", "Chkdsk", "Proxy"),
-			"磁盘检查代理",
-		},
-		{
-			filepath.Join(tasksPath, "Microsoft", "Windows", "Windows Error Reporting", "QueueReporting"),
-			"错误报告队列",
-		},
+	// 配置文件中的任务 (相对于 Windows\System32\Tasks)
+	tasks := activeProfile(r.config).Tasks
+	if len(tasks) == 0 {
+		r.log.Info("配置文件中没有要移除的计划任务")
+		return nil
 	}
 
 	removed := 0
 	failed := 0
 
 	for _, task := range tasks {
-		r.log.Info("删除: %s", task.desc)
+		r.log.Info("删除: %s", task.Label())
+
+		taskPath := task.Resolve(tasksPath)
 
 		var err error
-		info, statErr := os.Stat(task.path)
+		info, statErr := os.Stat(taskPath)
 
 		if os.IsNotExist(statErr) {
 			r.log.Info("  不存在，跳过")
@@ -200,10 +182,10 @@ func (r *AppRemover) RemoveScheduledTasks() error {
 
 		if statErr == nil && info.IsDir() {
 			// 删除整个目录
-			err = os.RemoveAll(task.path)
+			err = os.RemoveAll(taskPath)
 		} else {
 			// 删除单个文件
-			err = os.Remove(task.path)
+			err = os.Remove(taskPath)
 		}
 
 		if err != nil {
@@ -1,6 +1,7 @@
 package remover
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -8,293 +9,27 @@ import (
 
 	"tiny11-builder/internal/config"
 	"tiny11-builder/internal/logger"
+	"tiny11-builder/internal/profile"
+	"tiny11-builder/internal/registry"
 	"tiny11-builder/internal/utils"
 )
 
 type NanoRemover struct {
 	config *config.Config
 	log    *logger.Logger
+	runner utils.CommandRunner
 }
 
 func NewNanoRemover(cfg *config.Config, log *logger.Logger) *NanoRemover {
 	return &NanoRemover{
 		config: cfg,
 		log:    log,
+		runner: cfg.CommandRunner(),
 	}
 }
 
-// RemoveAggressiveApps 移除更多应用（Nano模式）
-func (r *NanoRemover) RemoveAggressiveApps() error {
-	mountPath := r.config.ScratchDir
-	r.log.Section("移除扩展应用列表 (Nano模式)")
-
-	// Nano 模式额外移除的应用（基于 nano11builder.ps1）
-	extraPatterns := []string{
-		"*Photos*",
-		"*Camera*",
-		"*Paint*",
-		"*Notepad*",
-		"*QuickAssist*",
-		"*CoreAI*",
-		"*PeopleExperienceHost*",
-		"*PinningConfirmationDialog*",
-		"*SecureAssessmentBrowser*",
-		"*AV1VideoExtension*",
-		"*AVCEncoderVideoExtension*",
-		"*HEIFImageExtension*",
-		"*HEVCVideoExtension*",
-		"*RawImageExtension*",
-		"*VP9VideoExtensions*",
-		"*WebpImageExtension*",
-		"*SecHealthUI*",
-		"*CompatibilityEnhancements*",
-	}
-
-	spinner := utils.NewSpinner("获取已安装的应用包...")
-	spinner.Start()
-
-	output, err := utils.RunCommand("dism", "/English",
-		fmt.Sprintf("/Image:%s", mountPath),
-		"/Get-ProvisionedAppxPackages")
-
-	spinner.Stop(err == nil)
-
-	if err != nil {
-		return fmt.Errorf("获取应用列表失败: %w", err)
-	}
-
-	// 解析包名
-	var packages []string
-	lines := strings.Split(output, "\n")
-	for _, line := range lines {
-		trimmed := strings.TrimSpace(line)
-		if strings.HasPrefix(trimmed, "PackageName :") {
-			pkgName := strings.TrimSpace(strings.TrimPrefix(trimmed, "PackageName :"))
-			if pkgName != "" {
-				packages = append(packages, pkgName)
-			}
-		}
-	}
-
-	r.log.Info("发现 %d 个已安装的应用包", len(packages))
-
-	removed := 0
-	failed := 0
-
-	for i, pattern := range extraPatterns {
-		r.log.Info("[%d/%d] 检查应用模式: %s", i+1, len(extraPatterns),
-			utils.Colorize(pattern, utils.MikuYellow))
-
-		// 去除通配符
-		cleanPattern := strings.Trim(pattern, "*")
-		found := false
-
-		for _, pkg := range packages {
-			if strings.Contains(strings.ToLower(pkg), strings.ToLower(cleanPattern)) {
-				found = true
-				r.log.Info("  移除: %s", pkg)
-
-				_, err := utils.RunCommand("dism", "/English",
-					fmt.Sprintf("/Image:%s", mountPath),
-					"/Remove-ProvisionedAppxPackage",
-					fmt.Sprintf("/PackageName:%s", pkg))
-
-				if err != nil {
-					r.log.Warn("  ✗ 失败: %v", err)
-					failed++
-				} else {
-					r.log.Success("  ✓ 成功")
-					removed++
-				}
-			}
-		}
-
-		if !found {
-			r.log.Info("  未找到匹配的包")
-		}
-	}
-
-	// 尝试移除 WindowsApps 残留文件夹
-	r.log.Info("清理 WindowsApps 残留文件夹...")
-	windowsAppsPath := filepath.Join(mountPath, "Program Files", "WindowsApps")
-	
-	if utils.DirExists(windowsAppsPath) {
-		entries, err := os.ReadDir(windowsAppsPath)
-		if err == nil {
-			cleanedFolders := 0
-			for _, entry := range entries {
-				if !entry.IsDir() {
-					continue
-				}
-
-				// 检查是否匹配已移除的应用
-				folderName := entry.Name()
-				shouldRemove := false
-
-				for _, pattern := range extraPatterns {
-					cleanPattern := strings.Trim(pattern, "*")
-					if strings.Contains(strings.ToLower(folderName), strings.ToLower(cleanPattern)) {
-						shouldRemove = true
-						break
-					}
-				}
-
-				if shouldRemove {
-					folderPath := filepath.Join(windowsAppsPath, folderName)
-					r.log.Info("  删除文件夹: %s", folderName)
-					
-					if err := os.RemoveAll(folderPath); err != nil {
-						r.log.Warn("  ✗ 删除失败: %v", err)
-					} else {
-						cleanedFolders++
-					}
-				}
-			}
-			
-			if cleanedFolders > 0 {
-				r.log.Success("清理了 %d 个残留文件夹", cleanedFolders)
-			}
-		}
-	}
-
-	r.log.Info("")
-	r.log.Success("扩展应用移除完成: 成功 %d, 失败 %d", removed, failed)
-	return nil
-}
-
-// RemoveAggressivePackages 移除更多系统包
-func (r *NanoRemover) RemoveAggressivePackages(languageCode string) error {
-	mountPath := r.config.ScratchDir
-	r.log.Section("移除扩展系统包 (Nano模式)")
-
-	// 基于 nano11builder.ps1 的包列表
-	packagePatterns := []string{
-		// Legacy 组件
-		"Microsoft-Windows-InternetExplorer-Optional-Package~",
-		"Microsoft-Windows-MediaPlayer-Package~",
-		"Microsoft-Windows-WordPad-FoD-Package~",
-		"Microsoft-Windows-StepsRecorder-Package~",
-		"Microsoft-Windows-MSPaint-FoD-Package~",
-		"Microsoft-Windows-SnippingTool-FoD-Package~",
-		"Microsoft-Windows-TabletPCMath-Package~",
-		"Microsoft-Windows-Xps-Xps-Viewer-Opt-Package~",
-		"Microsoft-Windows-PowerShell-ISE-FOD-Package~",
-		"OpenSSH-Client-Package~",
-
-		// 语言功能
-		fmt.Sprintf("Microsoft-Windows-LanguageFeatures-Handwriting-%s-Package~", languageCode),
-		fmt.Sprintf("Microsoft-Windows-LanguageFeatures-OCR-%s-Package~", languageCode),
-		fmt.Sprintf("Microsoft-Windows-LanguageFeatures-Speech-%s-Package~", languageCode),
-		fmt.Sprintf("Microsoft-Windows-LanguageFeatures-TextToSpeech-%s-Package~", languageCode),
-
-		// IME (亚洲语言输入法)
-		"*IME-ja-jp*",
-		"*IME-ko-kr*",
-		"*IME-zh-cn*",
-		"*IME-zh-tw*",
-
-		// 核心功能 (Nano 模式激进移除)
-		"Windows-Defender-Client-Package~",
-		"Microsoft-Windows-Search-Engine-Client-Package~",
-		"Microsoft-Windows-Kernel-LA57-FoD-Package~",
-
-		// 安全和身份
-		"Microsoft-Windows-Hello-Face-Package~",
-		"Microsoft-Windows-Hello-BioEnrollment-Package~",
-		"Microsoft-Windows-BitLocker-DriveEncryption-FVE-Package~",
-		"Microsoft-Windows-TPM-WMI-Provider-Package~",
-
-		// 辅助功能
-		"Microsoft-Windows-Narrator-App-Package~",
-		"Microsoft-Windows-Magnifier-App-Package~",
-
-		// 其他功能
-		"Microsoft-Windows-Printing-PMCPPC-FoD-Package~",
-		"Microsoft-Windows-WebcamExperience-Package~",
-		"Microsoft-Media-MPEG2-Decoder-Package~",
-		"Microsoft-Windows-Wallpaper-Content-Extended-FoD-Package~",
-	}
-
-	spinner := utils.NewSpinner("获取系统包列表...")
-	spinner.Start()
-
-	output, err := utils.RunCommand("dism",
-		fmt.Sprintf("/image:%s", mountPath),
-		"/Get-Packages",
-		"/Format:Table")
-
-	spinner.Stop(err == nil)
-
-	if err != nil {
-		return fmt.Errorf("获取系统包列表失败: %w", err)
-	}
-
-	lines := strings.Split(output, "\n")
-	removed := 0
-	failed := 0
-
-	for i, pattern := range packagePatterns {
-		r.log.Info("[%d/%d] 检查包模式: %s", i+1, len(packagePatterns),
-			utils.Colorize(pattern, utils.MikuYellow))
-
-		foundPackages := false
-
-		for _, line := range lines {
-			line = strings.TrimSpace(line)
-			if line == "" {
-				continue
-			}
-
-			// 检查是否匹配模式
-			matchFound := false
-			if strings.Contains(pattern, "*") {
-				// 通配符匹配
-				cleanPattern := strings.Trim(pattern, "*")
-				if strings.Contains(strings.ToLower(line), strings.ToLower(cleanPattern)) {
-					matchFound = true
-				}
-			} else {
-				// 精确前缀匹配
-				if strings.Contains(line, pattern) {
-					matchFound = true
-				}
-			}
-
-			if matchFound {
-				foundPackages = true
-				fields := strings.Fields(line)
-				if len(fields) > 0 {
-					pkgName := fields[0]
-					r.log.Info("  移除: %s", pkgName)
-
-					_, err := utils.RunCommand("dism",
-						fmt.Sprintf("/image:%s", mountPath),
-						"/Remove-Package",
-						fmt.Sprintf("/PackageName:%s", pkgName))
-
-					if err != nil {
-						r.log.Warn("  ✗ 失败: %v", err)
-						failed++
-					} else {
-						r.log.Success("  ✓ 成功")
-						removed++
-					}
-				}
-			}
-		}
-
-		if !foundPackages {
-			r.log.Info("  未找到匹配的包")
-		}
-	}
-
-	r.log.Info("")
-	r.log.Success("系统包移除完成: 成功 %d, 失败 %d", removed, failed)
-	return nil
-}
-
-// RemoveNativeImages 移除 .NET Native Images
-func (r *NanoRemover) RemoveNativeImages() error {
+// RemoveNativeImages 移除 .NET Native Images (ctx 取消后停止移除)
+func (r *NanoRemover) RemoveNativeImages(ctx context.Context) error {
 	mountPath := r.config.ScratchDir
 	assemblyPath := filepath.Join(mountPath, "Windows", "assembly")
 
@@ -318,6 +53,11 @@ func (r *NanoRemover) RemoveNativeImages() error {
 		}
 
 		if strings.HasPrefix(entry.Name(), "NativeImages_") {
+			if err := ctx.Err(); err != nil {
+				r.log.Warn("已取消: 移除了 %d 个 Native Images 目录", removed)
+				return err
+			}
+
 			niPath := filepath.Join(assemblyPath, entry.Name())
 			r.log.Info("移除: %s", entry.Name())
 
@@ -339,27 +79,23 @@ func (r *NanoRemover) RemoveNativeImages() error {
 	return nil
 }
 
-// SlimDriverStore 精简驱动存储
-func (r *NanoRemover) SlimDriverStore() error {
+// SlimDriverStore 精简驱动存储 (ctx 取消后停止移除)
+func (r *NanoRemover) SlimDriverStore(ctx context.Context) error {
 	mountPath := r.config.ScratchDir
 	driverRepo := filepath.Join(mountPath, "Windows", "System32", "DriverStore", "FileRepository")
 
 	r.log.Section("精简 DriverStore (移除非必需驱动)")
 
-	if !utils.DirExists(driverRepo) {
-		r.log.Warn("DriverStore 目录不存在: %s", driverRepo)
+	// 要移除的驱动包模式
+	patternsToRemove := activeProfile(r.config).Drivers
+	if len(patternsToRemove) == 0 {
+		r.log.Info("配置文件中没有要移除的驱动")
 		return nil
 	}
 
-	// 要移除的驱动模式（基于 nano11builder.ps1）
-	patternsToRemove := []string{
-		"prn*",         // 打印机驱动
-		"scan*",        // 扫描仪驱动
-		"mfd*",         // 多功能设备驱动
-		"wscsmd.inf*",  // 智能卡读卡器
-		"tapdrv*",      // 磁带驱动器
-		"rdpbus.inf*",  // 远程桌面虚拟总线
-		"tdibth.inf*",  // 蓝牙 PAN
+	if !utils.DirExists(driverRepo) {
+		r.log.Warn("DriverStore 目录不存在: %s", driverRepo)
+		return nil
 	}
 
 	entries, err := os.ReadDir(driverRepo)
@@ -367,36 +103,32 @@ func (r *NanoRemover) SlimDriverStore() error {
 		return fmt.Errorf("读取 DriverStore 目录失败: %w", err)
 	}
 
-	removed := 0
-	skipped := 0
-
+	var names []string
 	for _, entry := range entries {
-		if !entry.IsDir() {
-			continue
+		if entry.IsDir() {
+			names = append(names, entry.Name())
 		}
+	}
 
-		driverName := entry.Name()
-		shouldRemove := false
+	removed := 0
+	skipped := 0
 
-		for _, pattern := range patternsToRemove {
-			matched, _ := filepath.Match(pattern, strings.ToLower(driverName))
-			if matched {
-				shouldRemove = true
-				break
-			}
+	toRemove := activeProfile(r.config).SelectDrivers(names)
+	for _, driverName := range toRemove {
+		if err := ctx.Err(); err != nil {
+			r.log.Warn("已取消: 移除了 %d/%d 个驱动包", removed+skipped, len(toRemove))
+			return err
 		}
 
-		if shouldRemove {
-			driverPath := filepath.Join(driverRepo, driverName)
-			r.log.Info("移除驱动包: %s", driverName)
+		driverPath := filepath.Join(driverRepo, driverName)
+		r.log.Info("移除驱动包: %s", driverName)
 
-			if err := os.RemoveAll(driverPath); err != nil {
-				r.log.Warn("  ✗ 失败: %v", err)
-				skipped++
-			} else {
-				r.log.Success("  ✓ 成功")
-				removed++
-			}
+		if err := os.RemoveAll(driverPath); err != nil {
+			r.log.Warn("  ✗ 失败: %v", err)
+			skipped++
+		} else {
+			r.log.Success("  ✓ 成功")
+			removed++
 		}
 	}
 
@@ -405,43 +137,22 @@ func (r *NanoRemover) SlimDriverStore() error {
 	return nil
 }
 
-// SlimFonts 精简字体
-func (r *NanoRemover) SlimFonts() error {
+// SlimFonts 精简字体 (ctx 取消后停止移除)
+func (r *NanoRemover) SlimFonts(ctx context.Context) error {
 	mountPath := r.config.ScratchDir
 	fontsPath := filepath.Join(mountPath, "Windows", "Fonts")
 
 	r.log.Section("精简系统字体 (只保留必需字体)")
 
-	if !utils.DirExists(fontsPath) {
-		r.log.Warn("Fonts 目录不存在: %s", fontsPath)
+	rules := activeProfile(r.config).Fonts
+	if rules == nil || (len(rules.Keep) == 0 && len(rules.Remove) == 0) {
+		r.log.Info("配置文件中没有字体精简规则")
 		return nil
 	}
 
-	// 保留的字体模式（基于 nano11builder.ps1）
-	keepPatterns := []string{
-		"segoe*",
-		"tahoma*",
-		"marlett.ttf",
-		"8541oem.fon",
-		"segui*",
-		"consol*",
-		"lucon*",
-		"calibri*",
-		"arial*",
-		"times*",
-		"cou*",
-		"8*",
-	}
-
-	// 明确需要移除的亚洲字体
-	removePatterns := []string{
-		"mingli*",
-		"msjh*",
-		"msyh*",
-		"malgun*",
-		"meiryo*",
-		"yugoth*",
-		"segoeuihistoric.ttf",
+	if !utils.DirExists(fontsPath) {
+		r.log.Warn("Fonts 目录不存在: %s", fontsPath)
+		return nil
 	}
 
 	entries, err := os.ReadDir(fontsPath)
@@ -449,48 +160,31 @@ func (r *NanoRemover) SlimFonts() error {
 		return fmt.Errorf("读取 Fonts 目录失败: %w", err)
 	}
 
-	removed := 0
-	kept := 0
-
+	var names []string
 	for _, entry := range entries {
-		if entry.IsDir() {
-			continue
+		if !entry.IsDir() {
+			names = append(names, entry.Name())
 		}
+	}
 
-		fontName := entry.Name()
-		fontNameLower := strings.ToLower(fontName)
-		shouldKeep := false
-		shouldRemove := false
-
-		// 检查是否在保留列表
-		for _, pattern := range keepPatterns {
-			matched, _ := filepath.Match(pattern, fontNameLower)
-			if matched {
-				shouldKeep = true
-				break
-			}
-		}
+	// 不在保留列表或在移除列表中的字体
+	toRemove := activeProfile(r.config).SelectFonts(names)
 
-		// 检查是否在移除列表
-		for _, pattern := range removePatterns {
-			matched, _ := filepath.Match(pattern, fontNameLower)
-			if matched {
-				shouldRemove = true
-				break
-			}
+	removed := 0
+	kept := len(names) - len(toRemove)
+
+	for _, fontName := range toRemove {
+		if err := ctx.Err(); err != nil {
+			r.log.Warn("已取消: 移除了 %d 个字体", removed)
+			return err
 		}
 
-		// 如果不在保留列表或在移除列表，则删除
-		if shouldRemove || !shouldKeep {
-			fontPath := filepath.Join(fontsPath, fontName)
+		fontPath := filepath.Join(fontsPath, fontName)
 
-			if err := os.Remove(fontPath); err != nil {
-				// 静默忽略错误
-			} else {
-				removed++
-			}
+		if err := os.Remove(fontPath); err != nil {
+			// 静默忽略错误
 		} else {
-			kept++
+			removed++
 		}
 	}
 
@@ -499,41 +193,36 @@ func (r *NanoRemover) SlimFonts() error {
 	return nil
 }
 
-// RemoveSystemFolders 移除系统文件夹
-func (r *NanoRemover) RemoveSystemFolders() error {
+// RemoveSystemFolders 移除系统文件夹 (ctx 取消后停止移除)
+func (r *NanoRemover) RemoveSystemFolders(ctx context.Context) error {
 	mountPath := r.config.ScratchDir
 	r.log.Section("移除非必需系统文件夹")
 
-	// 基于 nano11builder.ps1
-	foldersToRemove := []struct {
-		path string
-		desc string
-	}{
-		{filepath.Join(mountPath, "Windows", "Speech", "Engines", "TTS"), "TTS 语音合成引擎"},
-		{filepath.Join(mountPath, "ProgramData", "Microsoft", "Windows Defender", "Definition Updates"), "Defender 定义更新"},
-		{filepath.Join(mountPath, "Windows", "System32", "InputMethod", "CHS"), "简体中文输入法"},
-		{filepath.Join(mountPath, "Windows", "System32", "InputMethod", "CHT"), "繁体中文输入法"},
-		{filepath.Join(mountPath, "Windows", "System32", "InputMethod", "JPN"), "日文输入法"},
-		{filepath.Join(mountPath, "Windows", "System32", "InputMethod", "KOR"), "韩文输入法"},
-		{filepath.Join(mountPath, "Windows", "Temp"), "临时文件"},
-		{filepath.Join(mountPath, "Windows", "Web"), "Web 内容"},
-		{filepath.Join(mountPath, "Windows", "Help"), "帮助文件"},
-		{filepath.Join(mountPath, "Windows", "Cursors"), "光标主题"},
+	foldersToRemove := activeProfile(r.config).Folders
+	if len(foldersToRemove) == 0 {
+		r.log.Info("配置文件中没有要移除的文件夹")
+		return nil
 	}
 
 	removed := 0
 	skipped := 0
 
 	for i, folder := range foldersToRemove {
-		r.log.Info("[%d/%d] %s", i+1, len(foldersToRemove), folder.desc)
+		if err := ctx.Err(); err != nil {
+			r.log.Warn("已取消: 处理了 %d/%d 个文件夹", i, len(foldersToRemove))
+			return err
+		}
 
-		if !utils.DirExists(folder.path) {
+		r.log.Info("[%d/%d] %s", i+1, len(foldersToRemove), folder.Label())
+
+		folderPath := folder.Resolve(mountPath)
+		if !utils.DirExists(folderPath) {
 			r.log.Info("  目录不存在，跳过")
 			skipped++
 			continue
 		}
 
-		if err := os.RemoveAll(folder.path); err != nil {
+		if err := os.RemoveAll(folderPath); err != nil {
 			r.log.Warn("  ✗ 失败: %v", err)
 			skipped++
 		} else {
@@ -547,16 +236,24 @@ func (r *NanoRemover) RemoveSystemFolders() error {
 	return nil
 }
 
-// RemoveSystemServices 移除系统服务
-func (r *NanoRemover) RemoveSystemServices() error {
+// RemoveSystemServices 移除系统服务 (ctx 取消后停止移除，仍会卸载 SYSTEM 注册表)
+func (r *NanoRemover) RemoveSystemServices(ctx context.Context) error {
 	mountPath := r.config.ScratchDir
 	r.log.Section("移除非必需系统服务")
 
+	servicesToRemove := activeProfile(r.config).Services
+	if len(servicesToRemove) == 0 {
+		r.log.Info("配置文件中没有要移除的服务")
+		return nil
+	}
+
 	// 加载注册表
 	systemHive := filepath.Join(mountPath, "Windows", "System32", "config", "SYSTEM")
 	
 	r.log.Info("加载 SYSTEM 注册表...")
-	_, err := utils.RunCommand("reg", "load", "HKLM\\zSYSTEM", systemHive)
+	registry.LockHives()
+	defer registry.UnlockHives()
+	_, err := utils.RunWith(r.runner, "reg", "load", "HKLM\\zSYSTEM", systemHive)
 	if err != nil {
 		return fmt.Errorf("加载 SYSTEM hive 失败: %w", err)
 	}
@@ -564,37 +261,24 @@ func (r *NanoRemover) RemoveSystemServices() error {
 	// 确保卸载
 	defer func() {
 		r.log.Info("卸载 SYSTEM 注册表...")
-		utils.RunCommand("reg", "unload", "HKLM\\zSYSTEM")
+		utils.RunWith(r.runner, "reg", "unload", "HKLM\\zSYSTEM")
 	}()
 
-	// 基于 nano11builder.ps1 的服务列表
-	servicesToRemove := []string{
-		"Spooler",              // 打印后台处理程序
-		"PrintNotify",          // 打印机通知
-		"Fax",                  // 传真
-		"RemoteRegistry",       // 远程注册表
-		"diagsvc",              // 诊断服务
-		"WerSvc",               // Windows 错误报告
-		"PcaSvc",               // 程序兼容性助手
-		"MapsBroker",           // 地图管理器
-		"WalletService",        // 电子钱包
-		"BthAvctpSvc",          // 蓝牙 AVCTP
-		"BluetoothUserService", // 蓝牙用户服务
-		"wuauserv",             // Windows Update
-		"UsoSvc",               // Update Orchestrator
-		"WaaSMedicSvc",         // Windows Update Medic
-	}
-
 	removed := 0
 	failed := 0
 
 	for i, service := range servicesToRemove {
+		if err := ctx.Err(); err != nil {
+			r.log.Warn("已取消: 处理了 %d/%d 个服务", i, len(servicesToRemove))
+			return err
+		}
+
 		r.log.Info("[%d/%d] 移除服务: %s", i+1, len(servicesToRemove),
 			utils.Colorize(service, utils.MikuYellow))
 
 		servicePath := fmt.Sprintf("HKLM\\zSYSTEM\\ControlSet001\\Services\\%s", service)
 
-		_, err := utils.RunCommand("reg", "delete", servicePath, "/f")
+		_, err := utils.RunWith(r.runner, "reg", "delete", servicePath, "/f")
 
 		if err != nil {
 			// 服务可能不存在，这是正常的
@@ -611,8 +295,8 @@ func (r *NanoRemover) RemoveSystemServices() error {
 	return nil
 }
 
-// CleanupWindowsAppsLeftovers 清理 WindowsApps 残留
-func (r *NanoRemover) CleanupWindowsAppsLeftovers(packagesToRemove []string) error {
+// CleanupWindowsAppsLeftovers 清理 WindowsApps 中匹配配置文件应用模式的残留文件夹
+func (r *NanoRemover) CleanupWindowsAppsLeftovers() error {
 	mountPath := r.config.ScratchDir
 	windowsAppsPath := filepath.Join(mountPath, "Program Files", "WindowsApps")
 
@@ -635,19 +319,9 @@ func (r *NanoRemover) CleanupWindowsAppsLeftovers(packagesToRemove []string) err
 		}
 
 		folderName := entry.Name()
-		shouldRemove := false
 
 		// 检查是否匹配已移除的应用
-		for _, pkg := range packagesToRemove {
-			// 提取包的基本名称
-			pkgBaseName := strings.Split(pkg, "_")[0]
-			if strings.Contains(folderName, pkgBaseName) {
-				shouldRemove = true
-				break
-			}
-		}
-
-		if shouldRemove {
+		if profile.MatchAny(activeProfile(r.config).Apps, folderName) {
 			folderPath := filepath.Join(windowsAppsPath, folderName)
 			r.log.Info("  删除残留: %s", folderName)
 
@@ -15,6 +15,7 @@ type Applier struct {
 	config    *config.Config
 	log       *logger.Logger
 	themeMgr  *Manager
+	runner    utils.CommandRunner
 	mountPath string
 }
 
@@ -23,6 +24,7 @@ func NewApplier(cfg *config.Config, log *logger.Logger, themeMgr *Manager) *Appl
 		config:    cfg,
 		log:       log,
 		themeMgr:  themeMgr,
+		runner:    cfg.CommandRunner(),
 		mountPath: cfg.ScratchDir,
 	}
 }
@@ -647,7 +649,7 @@ func (a *Applier) applyAdvancedSettings(theme *Theme) error {
 
 // setRegistryValue 设置注册表值（辅助函数）
 func (a *Applier) setRegistryValue(path, name, valueType, value string) error {
-	_, err := utils.RunCommand("reg", "add", path, "/v", name, "/t", valueType, "/d", value, "/f")
+	_, err := utils.RunWith(a.runner, "reg", "add", path, "/v", name, "/t", valueType, "/d", value, "/f")
 	return err
 }
 
@@ -0,0 +1,207 @@
+package theme
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// 解压主题压缩包的限制，避免压缩炸弹占满磁盘
+const (
+	maxThemeFiles = 10000
+	maxThemeSize  = 2 << 30 // 解压后的总大小
+)
+
+// installMu 串行化主题的安装和替换
+var installMu sync.Mutex
+
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// ValidName 主题名称 (主题目录名) 是否有效: 字母、数字、点、下划线和连字符
+func ValidName(name string) bool {
+	return namePattern.MatchString(name)
+}
+
+// Sections 启用的主题部分
+func (t *Theme) Sections() []string {
+	sections := []string{}
+	for _, s := range []struct {
+		name    string
+		enabled bool
+	}{
+		{"branding", t.Branding.Enabled},
+		{"wallpapers", t.Wallpapers.Enabled},
+		{"colors", t.Colors.Enabled},
+		{"images", t.Images.Enabled},
+		{"boot", t.Boot.Enabled},
+		{"sounds", t.Sounds.Enabled},
+		{"fonts", t.Fonts.Enabled},
+		{"advanced", t.Advanced.Enabled},
+	} {
+		if s.enabled {
+			sections = append(sections, s.name)
+		}
+	}
+	return sections
+}
+
+// Install 从 zip 压缩包安装主题，返回安装后的主题
+//
+// theme.json 可以在压缩包的根目录，也可以在唯一的顶层目录中；name 为空时使用
+// 顶层目录名。先解压到主题目录中的临时目录并解析 theme.json，成功后再移动到
+// themes\<name>。replace 为 false 时不覆盖已有的主题。
+func (m *Manager) Install(name, archive string, replace bool) (*Theme, error) {
+	if err := os.MkdirAll(m.themesDir, 0755); err != nil {
+		return nil, fmt.Errorf("创建主题目录失败: %w", err)
+	}
+	tmp, err := os.MkdirTemp(m.themesDir, ".upload-")
+	if err != nil {
+		return nil, fmt.Errorf("创建临时目录失败: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	if err := extractZip(archive, tmp); err != nil {
+		return nil, err
+	}
+	root, top, err := findThemeRoot(tmp)
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		name = top
+	}
+	if name == "" {
+		return nil, fmt.Errorf("压缩包中没有顶层目录，需要指定主题名称")
+	}
+	if !ValidName(name) {
+		return nil, fmt.Errorf("无效的主题名称: %s (只能包含字母、数字、点、下划线和连字符)", name)
+	}
+	if _, err := readTheme(root, name); err != nil {
+		return nil, err
+	}
+
+	installMu.Lock()
+	defer installMu.Unlock()
+
+	dest := filepath.Join(m.themesDir, name)
+	if _, err := os.Stat(dest); err == nil {
+		if !replace {
+			return nil, fmt.Errorf("主题已存在: %s: %w", name, os.ErrExist)
+		}
+		// 旧主题先移到临时目录，新主题移动失败时还原
+		backup, err := os.MkdirTemp(m.themesDir, ".replace-")
+		if err != nil {
+			return nil, fmt.Errorf("创建临时目录失败: %w", err)
+		}
+		defer os.RemoveAll(backup)
+		old := filepath.Join(backup, name)
+		if err := os.Rename(dest, old); err != nil {
+			return nil, fmt.Errorf("替换主题失败: %w", err)
+		}
+		if err := os.Rename(root, dest); err != nil {
+			os.Rename(old, dest)
+			return nil, fmt.Errorf("替换主题失败: %w", err)
+		}
+	} else if err := os.Rename(root, dest); err != nil {
+		return nil, fmt.Errorf("安装主题失败: %w", err)
+	}
+
+	m.log.Success("已安装主题: %s", name)
+	return m.ReadTheme(name)
+}
+
+// findThemeRoot 找到包含 theme.json 的目录: 解压目录本身或其中唯一的子目录
+func findThemeRoot(dir string) (root, top string, err error) {
+	if _, err := os.Stat(filepath.Join(dir, "theme.json")); err == nil {
+		return dir, "", nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", "", err
+	}
+	if len(entries) == 1 && entries[0].IsDir() {
+		sub := filepath.Join(dir, entries[0].Name())
+		if _, err := os.Stat(filepath.Join(sub, "theme.json")); err == nil {
+			return sub, entries[0].Name(), nil
+		}
+	}
+	return "", "", fmt.Errorf("压缩包中没有 theme.json")
+}
+
+// extractZip 解压 zip 到 dest，拒绝指向目录之外的路径，只解压普通文件和目录
+func extractZip(archive, dest string) error {
+	zr, err := zip.OpenReader(archive)
+	if err != nil {
+		return fmt.Errorf("无法打开 zip 压缩包: %w", err)
+	}
+	defer zr.Close()
+
+	if len(zr.File) > maxThemeFiles {
+		return fmt.Errorf("压缩包中的文件过多 (%d，最多 %d)", len(zr.File), maxThemeFiles)
+	}
+
+	var remaining int64 = maxThemeSize
+	for _, f := range zr.File {
+		// Windows 上创建的压缩包可能使用反斜杠
+		name := path.Clean(strings.ReplaceAll(f.Name, `\`, "/"))
+		if name == "." {
+			continue
+		}
+		local := filepath.FromSlash(name)
+		if !filepath.IsLocal(local) {
+			return fmt.Errorf("压缩包中的路径无效: %s", f.Name)
+		}
+		target := filepath.Join(dest, local)
+
+		mode := f.Mode()
+		switch {
+		case mode.IsDir():
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			continue
+		case !mode.IsRegular():
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		n, err := extractFile(f, target, remaining)
+		if err != nil {
+			return err
+		}
+		remaining -= n
+	}
+	return nil
+}
+
+// extractFile 解压一个文件，超过 limit 字节时返回错误
+func extractFile(f *zip.File, target string, limit int64) (int64, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return 0, fmt.Errorf("解压 %s 失败: %w", f.Name, err)
+	}
+	defer rc.Close()
+
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return 0, fmt.Errorf("解压 %s 失败: %w", f.Name, err)
+	}
+	defer out.Close()
+
+	n, err := io.Copy(out, io.LimitReader(rc, limit+1))
+	if err != nil {
+		return n, fmt.Errorf("解压 %s 失败: %w", f.Name, err)
+	}
+	if n > limit {
+		return n, fmt.Errorf("压缩包解压后超过 %d MB", maxThemeSize>>20)
+	}
+	return n, nil
+}
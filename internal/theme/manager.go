@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"tiny11-builder/internal/config"
 	"tiny11-builder/internal/logger"
@@ -157,7 +158,7 @@ type ColorScheme struct {
 }
 
 func NewManager(cfg *config.Config, log *logger.Logger) *Manager {
-	themesDir := filepath.Join(cfg.WorkDir, "themes")
+	themesDir := cfg.ThemesDir
 	return &Manager{
 		config:    cfg,
 		log:       log,
@@ -166,7 +167,26 @@ func NewManager(cfg *config.Config, log *logger.Logger) *Manager {
 }
 
 func (m *Manager) LoadTheme(themeName string) (*Theme, error) {
+	theme, err := m.ReadTheme(themeName)
+	if err != nil {
+		return nil, err
+	}
+	m.activeTheme = theme
+
+	m.log.Success("加载主题: %s v%s", theme.Name, theme.Version)
+	m.log.Info("  作者: %s", theme.Author)
+	m.log.Info("  描述: %s", theme.Description)
+
+	return theme, nil
+}
+
+// ReadTheme 读取主题配置 (不输出日志，也不设为当前主题)
+func (m *Manager) ReadTheme(themeName string) (*Theme, error) {
 	themePath := filepath.Join(m.themesDir, themeName)
+	return readTheme(themePath, themeName)
+}
+
+func readTheme(themePath, themeName string) (*Theme, error) {
 	themeFile := filepath.Join(themePath, "theme.json")
 
 	if _, err := os.Stat(themeFile); os.IsNotExist(err) {
@@ -184,12 +204,6 @@ func (m *Manager) LoadTheme(themeName string) (*Theme, error) {
 	}
 
 	theme.ThemePath = themePath
-	m.activeTheme = &theme
-
-	m.log.Success("加载主题: %s v%s", theme.Name, theme.Version)
-	m.log.Info("  作者: %s", theme.Author)
-	m.log.Info("  描述: %s", theme.Description)
-
 	return &theme, nil
 }
 
@@ -205,7 +219,8 @@ func (m *Manager) ListThemes() ([]string, error) {
 
 	var themes []string
 	for _, entry := range entries {
-		if entry.IsDir() {
+		// 以 . 开头的是正在上传的主题
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
 			themeFile := filepath.Join(m.themesDir, entry.Name(), "theme.json")
 			if _, err := os.Stat(themeFile); err == nil {
 				themes = append(themes, entry.Name())
@@ -28,6 +28,11 @@ func (e *BuildError) Error() string {
 	return fmt.Sprintf("[%d] %s", e.Code, e.Message)
 }
 
+// Unwrap 返回原始错误 (支持 errors.Is / errors.As)
+func (e *BuildError) Unwrap() error {
+	return e.Cause
+}
+
 func NewError(code ErrorCode, message string, cause error) *BuildError {
 	return &BuildError{
 		Code:    code,
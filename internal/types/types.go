@@ -1,5 +1,10 @@
 package types
 
+import (
+	"encoding/json"
+	"time"
+)
+
 type BuildMode string
 
 const (
@@ -10,12 +15,21 @@ const (
 
 type BuildRequest struct {
 	ISODrive       string      `json:"isoDrive"`
+	ISOFile        string      `json:"isoFile,omitempty"`
 	ScratchDrive   string      `json:"scratchDrive,omitempty"`
+	WorkDir        string      `json:"workDir,omitempty"`
 	Mode           BuildMode   `json:"mode"`
 	Theme          string      `json:"theme"`
+	Profile        string      `json:"profile,omitempty"`
 	ImageIndex     int         `json:"imageIndex,omitempty"`
 	OutputISO      string      `json:"outputIso,omitempty"`
 	PreinstallApps []string    `json:"preinstallApps,omitempty"`
+	RegFiles       []string    `json:"regFiles,omitempty"`
+	EnableTweaks   []string    `json:"enableTweaks,omitempty"`
+	DisableTweaks  []string    `json:"disableTweaks,omitempty"`
+	ExportReg      string      `json:"exportReg,omitempty"`
+	StrictTweaks   bool        `json:"strictTweaks,omitempty"`
+	RegDiff        bool        `json:"regDiff,omitempty"`
 	UseESD         bool        `json:"useEsd,omitempty"`
 	Verbose        bool        `json:"verbose,omitempty"`
 }
@@ -30,8 +44,162 @@ type BuildStatus struct {
 }
 
 type BuildResponse struct {
-	Success   bool   `json:"success"`
-	Message   string `json:"message"`
-	OutputISO string `json:"outputIso,omitempty"`
-	Error     string `json:"error,omitempty"`
+	Success   bool         `json:"success"`
+	Message   string       `json:"message"`
+	JobID     string       `json:"jobId,omitempty"`
+	OutputISO string       `json:"outputIso,omitempty"`
+	Error     string       `json:"error,omitempty"`
+	Fields    []FieldError `json:"fields,omitempty"` // 请求校验失败的字段
+}
+
+// FieldError 构建请求中某个字段的错误
+type FieldError struct {
+	Field   string `json:"field"` // JSON 字段名，数组元素为 field[i]
+	Message string `json:"message"`
+}
+
+// JobState 构建任务状态
+type JobState string
+
+const (
+	JobQueued   JobState = "queued"
+	JobRunning  JobState = "running"
+	JobComplete JobState = "complete"
+	JobFailed   JobState = "failed"
+	JobCanceled JobState = "canceled"
+)
+
+// Job 构建任务 (API 中的一次构建)
+type Job struct {
+	ID         string       `json:"id"`
+	State      JobState     `json:"state"`
+	Request    BuildRequest `json:"request"`
+	WorkDir    string       `json:"workDir"`
+	Phase      string       `json:"phase"`
+	Progress   float64      `json:"progress"`
+	Step       int          `json:"step,omitempty"`  // 当前构建步骤
+	Steps      int          `json:"steps,omitempty"` // 总步骤数
+	Message    string       `json:"message"`
+	Error      string       `json:"error,omitempty"`
+	OutputISO  string       `json:"outputIso,omitempty"`
+	CreatedAt  time.Time    `json:"createdAt"`
+	StartedAt  *time.Time   `json:"startedAt,omitempty"`
+	FinishedAt *time.Time   `json:"finishedAt,omitempty"`
+}
+
+// Artifact 任务产生的文件 (输出 ISO、日志和报告)
+type Artifact struct {
+	Name    string    `json:"name"`
+	Kind    string    `json:"kind"` // iso、log、report
+	Size    int64     `json:"size"`
+	SHA256  string    `json:"sha256"`
+	ModTime time.Time `json:"modTime"`
+	URL     string    `json:"url"` // 下载地址 (支持 Range)
+}
+
+// ThemeInfo 已安装的主题
+type ThemeInfo struct {
+	ID          string   `json:"id"` // 主题目录名，即构建请求中的 theme
+	Name        string   `json:"name"`
+	Version     string   `json:"version"`
+	Author      string   `json:"author"`
+	Description string   `json:"description"`
+	Enabled     bool     `json:"enabled"`
+	Sections    []string `json:"sections"`           // 启用的部分: branding、wallpapers、colors 等
+	Warnings    []string `json:"warnings,omitempty"` // 缺少的壁纸、图片等文件
+	Error       string   `json:"error,omitempty"`    // theme.json 无法读取或解析
+}
+
+// PreinstallCatalog 预装软件列表 (preinstall.json)
+type PreinstallCatalog struct {
+	Enabled bool            `json:"enabled"`
+	Apps    []PreinstallApp `json:"apps"`
+}
+
+// PreinstallApp 预装软件及其安装包
+type PreinstallApp struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Version     string `json:"version"`
+	Source      string `json:"source"`
+	InstallCmd  string `json:"installCmd"`
+	Silent      bool   `json:"silent"`
+	Present     bool   `json:"present"` // 安装包是否存在
+	Size        int64  `json:"size"`
+}
+
+// BuildRecord 构建历史中的一条记录
+type BuildRecord struct {
+	ID           string                 `json:"id"`
+	Source       string                 `json:"source"` // api 或 cli
+	Mode         BuildMode              `json:"mode"`
+	Theme        string                 `json:"theme,omitempty"`
+	State        JobState               `json:"state"`
+	Request      *BuildRequest          `json:"request,omitempty"` // API 提交的请求
+	Profile      json.RawMessage        `json:"profile,omitempty"` // 实际使用的构建配置文件
+	Steps        []StepTiming           `json:"steps,omitempty"`
+	Error        string                 `json:"error,omitempty"`
+	ErrorCode    int                    `json:"errorCode,omitempty"`    // BuildError 的错误码
+	ErrorContext map[string]interface{} `json:"errorContext,omitempty"` // BuildError 的上下文
+	OutputISO    string                 `json:"outputIso,omitempty"`
+	SHA256       string                 `json:"sha256,omitempty"` // 输出 ISO 的校验和
+	LogFile      string                 `json:"logFile,omitempty"`
+	WorkDir      string                 `json:"workDir"`
+	CreatedAt    time.Time              `json:"createdAt"`
+	StartedAt    *time.Time             `json:"startedAt,omitempty"`
+	FinishedAt   time.Time              `json:"finishedAt"`
+	Duration     float64                `json:"duration"` // 开始到结束的秒数
+}
+
+// StepTiming 构建步骤的耗时
+type StepTiming struct {
+	Step      int       `json:"step"`
+	Title     string    `json:"title"`
+	Status    string    `json:"status"` // finished、skipped、failed 或 canceled
+	StartedAt time.Time `json:"startedAt"`
+	Duration  float64   `json:"duration"` // 秒
+}
+
+// WebhookPayload webhook 请求体
+type WebhookPayload struct {
+	Delivery string       `json:"delivery"` // 投递 id (重试时不变)
+	Event    string       `json:"event"`
+	Time     time.Time    `json:"time"`
+	Job      *WebhookJob  `json:"job,omitempty"`
+	Step     *WebhookStep `json:"step,omitempty"` // job.step_completed 事件
+}
+
+// WebhookJob webhook 中的任务信息
+type WebhookJob struct {
+	ID           string                 `json:"id"`
+	Source       string                 `json:"source"` // api 或 cli
+	Mode         BuildMode              `json:"mode"`
+	Theme        string                 `json:"theme,omitempty"`
+	State        JobState               `json:"state"`
+	WorkDir      string                 `json:"workDir"`
+	CreatedAt    time.Time              `json:"createdAt"`
+	StartedAt    *time.Time             `json:"startedAt,omitempty"`
+	FinishedAt   *time.Time             `json:"finishedAt,omitempty"`
+	Duration     float64                `json:"duration,omitempty"` // 开始到结束的秒数
+	OutputISO    string                 `json:"outputIso,omitempty"`
+	SHA256       string                 `json:"sha256,omitempty"`
+	LogFile      string                 `json:"logFile,omitempty"`
+	Error        string                 `json:"error,omitempty"`
+	ErrorCode    int                    `json:"errorCode,omitempty"`
+	ErrorContext map[string]interface{} `json:"errorContext,omitempty"`
+}
+
+// WebhookStep webhook 中完成的构建步骤
+type WebhookStep struct {
+	Step      int       `json:"step"`
+	Steps     int       `json:"steps,omitempty"` // 总步骤数
+	Title     string    `json:"title"`
+	StartedAt time.Time `json:"startedAt"`
+	Duration  float64   `json:"duration"` // 秒
+}
+
+// Finished 任务是否已结束
+func (j *Job) Finished() bool {
+	return j.State == JobComplete || j.State == JobFailed || j.State == JobCanceled
 }
\ No newline at end of file
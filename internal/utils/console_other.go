@@ -0,0 +1,23 @@
+//go:build !windows
+
+package utils
+
+import "fmt"
+
+// InitConsole 非 Windows 平台的终端默认支持 UTF-8 和 ANSI 颜色
+func InitConsole() error {
+	return nil
+}
+
+// SetConsoleTitle 非 Windows 平台不设置标题
+func SetConsoleTitle(title string) {}
+
+// ClearScreen 清屏
+func ClearScreen() {
+	fmt.Print("\033[H\033[2J")
+}
+
+// GetConsoleWidth 获取控制台宽度
+func GetConsoleWidth() int {
+	return 80
+}
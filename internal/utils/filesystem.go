@@ -1,8 +1,12 @@
 package utils
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
+	"io/fs"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -24,18 +28,32 @@ type CopyTask struct {
 }
 
 // CopyDirConcurrent 并发复制目录 - 大幅提升速度
-func CopyDirConcurrent(src, dst string, progress *ProgressBar) error {
+func CopyDirConcurrent(ctx context.Context, src, dst string, progress *ProgressBar) error {
+	return CopyFSConcurrent(ctx, os.DirFS(src), dst, progress)
+}
+
+// CopyFSConcurrent 并发复制文件系统中的全部文件 (本地目录或 ISO 镜像)
+//
+// ctx 取消后不再开始复制新的文件，等正在复制的文件完成后返回 ctx.Err()。
+func CopyFSConcurrent(ctx context.Context, fsys fs.FS, dst string, progress *ProgressBar) error {
 	// 收集所有文件
 	var tasks []CopyTask
 	var totalSize int64
 
-	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+	err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
 		if err != nil {
 			return nil // 跳过错误文件
 		}
 
-		relPath, _ := filepath.Rel(src, path)
-		targetPath := filepath.Join(dst, relPath)
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+
+		targetPath := filepath.Join(dst, filepath.FromSlash(path))
 
 		if info.IsDir() {
 			return os.MkdirAll(targetPath, info.Mode())
@@ -76,7 +94,10 @@ func CopyDirConcurrent(src, dst string, progress *ProgressBar) error {
 		go func() {
 			defer wg.Done()
 			for task := range taskChan {
-				if err := copyFileOptimized(task.Src, task.Dst, task.Size, progress); err != nil {
+				if ctx.Err() != nil {
+					continue // 已取消: 丢弃剩余任务
+				}
+				if err := copyFileOptimized(fsys, task.Src, task.Dst, task.Size, progress); err != nil {
 					// 记录错误但继续
 					select {
 					case errChan <- fmt.Errorf("复制失败 %s: %w", task.Src, err):
@@ -88,8 +109,13 @@ func CopyDirConcurrent(src, dst string, progress *ProgressBar) error {
 	}
 
 	// 分发任务
+dispatch:
 	for _, task := range tasks {
-		taskChan <- task
+		select {
+		case taskChan <- task:
+		case <-ctx.Done():
+			break dispatch
+		}
 	}
 	close(taskChan)
 
@@ -97,6 +123,10 @@ func CopyDirConcurrent(src, dst string, progress *ProgressBar) error {
 	wg.Wait()
 	close(errChan)
 
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	// 检查是否有错误
 	if len(errChan) > 0 {
 		return <-errChan
@@ -109,8 +139,8 @@ func CopyDirConcurrent(src, dst string, progress *ProgressBar) error {
 }
 
 // copyFileOptimized 优化的文件复制 - 使用内存池
-func copyFileOptimized(src, dst string, fileSize int64, progress *ProgressBar) error {
-	sourceFile, err := os.Open(src)
+func copyFileOptimized(fsys fs.FS, src, dst string, fileSize int64, progress *ProgressBar) error {
+	sourceFile, err := fsys.Open(src)
 	if err != nil {
 		// 无法打开源文件，更新进度并跳过
 		if progress != nil {
@@ -120,6 +150,10 @@ func copyFileOptimized(src, dst string, fileSize int64, progress *ProgressBar) e
 	}
 	defer sourceFile.Close()
 
+	if progress != nil {
+		progress.SetItem(src)
+	}
+
 	// 确保目标目录存在
 	dstDir := filepath.Dir(dst)
 	if err := os.MkdirAll(dstDir, 0755); err != nil {
@@ -354,6 +388,20 @@ func GetFileSize(path string) (int64, error) {
 	return info.Size(), nil
 }
 
+// FileSHA256 计算文件的 SHA-256 (十六进制)
+func FileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
 // GetDirSize 计算目录大小
 func GetDirSize(path string) (int64, error) {
 	var size int64
@@ -1,118 +1,60 @@
 package utils
 
 import (
-	"bytes"
 	"fmt"
-	"golang.org/x/sys/windows"
 	"os"
 	"os/exec"
 	"strings"
-	"syscall"
 	"time"
 )
 
+// RunCommand 用真实的执行器运行命令 (构建中的命令使用 config.Runner，见 RunWith)
 func RunCommand(name string, args ...string) (string, error) {
-	cmd := exec.Command(name, args...)
-	cmd.SysProcAttr = &syscall.SysProcAttr{
-		HideWindow: true}
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	err := cmd.Run()
-	output := TryDecodeGBK(stdout.Bytes())
-	if err != nil {
-		errMsg := TryDecodeGBK(stderr.Bytes())
-		if errMsg != "" {
-			return output, fmt.Errorf("%w: %s", err, errMsg)
-		}
-		return output, err
-	}
-	return output, nil
+	return RunWith(execRunner, name, args...)
 }
 func RunCommandWithOutput(name string, args ...string) error {
 	cmd := exec.Command(name, args...)
-	cmd.SysProcAttr = &syscall.SysProcAttr{
-		HideWindow: true}
+	hideWindow(cmd)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	return cmd.Run()
 }
-func Takeown(path string) error {
-	_, err := RunCommand("takeown", "/F", path)
+func Takeown(r CommandRunner, path string) error {
+	_, err := RunWith(r, "takeown", "/F", path)
 	if err != nil {
 		return fmt.Errorf("takeown失败: %w", err)
 	}
 	return nil
 }
-func TakeownRecursive(path string) error {
-	_, err := RunCommand("takeown", "/F", path, "/R")
+func TakeownRecursive(r CommandRunner, path string) error {
+	_, err := RunWith(r, "takeown", "/F", path, "/R")
 	if err != nil {
 		return fmt.Errorf("takeown递归失败: %w", err)
 	}
 	return nil
 }
-func GrantPermission(path string) error {
-	_, err := RunCommand("icacls", path, "/grant", "Administrators:(F)")
+func GrantPermission(r CommandRunner, path string) error {
+	_, err := RunWith(r, "icacls", path, "/grant", "Administrators:(F)")
 	if err != nil {
 		return fmt.Errorf("icacls失败: %w", err)
 	}
 	return nil
 }
-func GrantPermissionRecursive(path string) error {
-	_, err := RunCommand("icacls", path, "/grant", "Administrators:(F)", "/T", "/C")
+func GrantPermissionRecursive(r CommandRunner, path string) error {
+	_, err := RunWith(r, "icacls", path, "/grant", "Administrators:(F)", "/T", "/C")
 	if err != nil {
 		return fmt.Errorf("icacls递归失败: %w", err)
 	}
 	return nil
 }
-func ExtractField(output, field string) string {
-	lines := strings.Split(output, "\n")
-	prefix := field + " :"
-	for _, line := range lines {
-		trimmed := strings.TrimSpace(line)
-		if strings.HasPrefix(trimmed, prefix) {
-			value := strings.TrimPrefix(trimmed, prefix)
-			return strings.TrimSpace(value)
-		}
-	}
-	return ""
-}
-func ExtractLanguage(output string) string {
-	lines := strings.Split(output, "\n")
-	for _, line := range lines {
-		trimmed := strings.TrimSpace(line)
-		if strings.Contains(trimmed, "Default system UI language") {
-			parts := strings.Split(trimmed, ":")
-			if len(parts) >= 2 {
-				lang := strings.TrimSpace(parts[1])
-				if lang != "" {
-					return lang
-				}
-			}
-		}
-	}
-	for _, line := range lines {
-		trimmed := strings.TrimSpace(line)
-		if strings.Contains(trimmed, "Default language") {
-			parts := strings.Split(trimmed, ":")
-			if len(parts) >= 2 {
-				lang := strings.TrimSpace(parts[1])
-				if lang != "" {
-					return lang
-				}
-			}
-		}
-	}
-	return "en-US"
-}
 func KillProcess(name string) error {
 	cmd := exec.Command("taskkill", "/F", "/IM", name)
-	cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
+	hideWindow(cmd)
 	return cmd.Run()
 }
 func IsProcessRunning(name string) bool {
 	cmd := exec.Command("tasklist", "/FI", fmt.Sprintf("IMAGENAME eq %s", name))
-	cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
+	hideWindow(cmd)
 	output, err := cmd.Output()
 	if err != nil {
 		return false
@@ -128,7 +70,7 @@ func GetSystemDrive() string {
 	if len(systemRoot) >= 2 && systemRoot[1] == ':' {
 		return systemRoot[:2]
 	}
-	sysDir, err := windows.GetSystemDirectory()
+	sysDir, err := systemDirectory()
 	if err == nil && len(sysDir) >= 2 && sysDir[1] == ':' {
 		return sysDir[:2]
 	}
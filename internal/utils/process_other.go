@@ -0,0 +1,16 @@
+//go:build !windows
+
+package utils
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// hideWindow 非 Windows 平台无需处理
+func hideWindow(cmd *exec.Cmd) {}
+
+// systemDirectory 非 Windows 平台没有系统目录
+func systemDirectory() (string, error) {
+	return "", errors.New("不支持的平台")
+}
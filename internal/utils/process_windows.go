@@ -0,0 +1,24 @@
+package utils
+
+import (
+	"os/exec"
+	"syscall"
+
+	"golang.org/x/sys/windows"
+)
+
+// hideWindow 隐藏子进程的控制台窗口
+//
+// 子进程放在单独的进程组中: 控制台的 Ctrl+C 只通知本程序，由构建流程
+// 取消并清理，不会中断正在卸载镜像的 DISM。
+func hideWindow(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		HideWindow:    true,
+		CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP,
+	}
+}
+
+// systemDirectory 获取系统目录 (例: C:\Windows\System32)
+func systemDirectory() (string, error) {
+	return windows.GetSystemDirectory()
+}
@@ -19,6 +19,21 @@ type ProgressBar struct {
 	lastUpdate  time.Time
 	isCompleted bool
 	spinnerIdx  int
+	item        string
+	observer    func(ProgressEvent)
+}
+
+// ProgressEvent 进度条或旋转动画的当前状态 (推送给 API 事件流)
+//
+// 旋转动画没有总量，只有 Label 和结束状态。
+type ProgressEvent struct {
+	Label   string  `json:"label"`
+	Item    string  `json:"item,omitempty"` // 正在处理的文件
+	Current int64   `json:"current,omitempty"`
+	Total   int64   `json:"total,omitempty"`
+	Percent float64 `json:"percent,omitempty"`
+	Done    bool    `json:"done,omitempty"`
+	Failed  bool    `json:"failed,omitempty"`
 }
 
 // NewProgressBar 创建新的进度条
@@ -42,6 +57,20 @@ func NewProgressBar(total int64, prefix string) *ProgressBar {
 	}
 }
 
+// Observe 设置进度观察者，每次刷新显示时调用
+func (p *ProgressBar) Observe(fn func(ProgressEvent)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.observer = fn
+}
+
+// SetItem 设置正在处理的文件 (随下一次刷新通知观察者，不改变控制台输出)
+func (p *ProgressBar) SetItem(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.item = name
+}
+
 // Add 增加进度值
 func (p *ProgressBar) Add(n int64) {
 	p.mu.Lock()
@@ -62,6 +91,12 @@ func (p *ProgressBar) Add(n int64) {
 	p.render()
 }
 
+// Write 实现 io.Writer，按写入的字节数增加进度
+func (p *ProgressBar) Write(b []byte) (int, error) {
+	p.Add(int64(len(b)))
+	return len(b), nil
+}
+
 // Set 设置当前进度值
 func (p *ProgressBar) Set(current int64) {
 	p.mu.Lock()
@@ -156,6 +191,17 @@ func (p *ProgressBar) render() {
 
 	// 清除行尾并输出
 	fmt.Print(output)
+
+	if p.observer != nil {
+		p.observer(ProgressEvent{
+			Label:   p.prefix,
+			Item:    p.item,
+			Current: p.current,
+			Total:   p.total,
+			Percent: percent,
+			Done:    p.isCompleted,
+		})
+	}
 }
 
 // getSpinnerFrame 获取旋转动画帧
@@ -216,6 +262,7 @@ type SimpleSpinner struct {
 	done      chan bool
 	mu        sync.Mutex
 	isRunning int32
+	observer  func(ProgressEvent)
 }
 
 // NewSpinner 创建旋转动画
@@ -227,12 +274,31 @@ func NewSpinner(message string) *SimpleSpinner {
 	}
 }
 
+// Observe 设置观察者，在开始、更新消息和停止时调用
+func (s *SimpleSpinner) Observe(fn func(ProgressEvent)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.observer = fn
+}
+
+// notify 通知观察者 (调用时持有锁)
+func (s *SimpleSpinner) notify(e ProgressEvent) {
+	if s.observer != nil {
+		e.Label = s.message
+		s.observer(e)
+	}
+}
+
 // Start 开始动画
 func (s *SimpleSpinner) Start() {
 	if !atomic.CompareAndSwapInt32(&s.isRunning, 0, 1) {
 		return // 已经在运行
 	}
 
+	s.mu.Lock()
+	s.notify(ProgressEvent{})
+	s.mu.Unlock()
+
 	go func() {
 		frames := []string{"⣾", "⣽", "⣻", "⢿", "⡿", "⣟", "⣯", "⣷"}
 		i := 0
@@ -295,6 +361,7 @@ func (s *SimpleSpinner) Stop(success bool) {
 		Colorize(s.message, MikuCyan),
 		strings.Repeat(" ", 20),
 	)
+	s.notify(ProgressEvent{Done: true, Failed: !success})
 }
 
 // UpdateMessage 更新消息
@@ -302,4 +369,7 @@ func (s *SimpleSpinner) UpdateMessage(message string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.message = message
+	if atomic.LoadInt32(&s.isRunning) == 1 {
+		s.notify(ProgressEvent{})
+	}
 }
\ No newline at end of file
@@ -0,0 +1,295 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// CommandResult 一次外部命令执行的结果
+type CommandResult struct {
+	Name     string   `json:"name"`
+	Args     []string `json:"args"`
+	Stdout   string   `json:"stdout"`
+	Stderr   string   `json:"stderr"`
+	ExitCode int      `json:"exitCode"`
+	// Error 命令无法启动时的错误信息 (例: 找不到可执行文件)
+	Error string `json:"error,omitempty"`
+}
+
+// CommandRunner 外部命令执行器接口
+// 所有 dism/reg/takeown/icacls 调用都经由此接口，便于录制和离线回放
+//
+// Run 不接受 context: 取消构建时正在执行的命令不会被中断 (中途终止 DISM 可能损坏挂载的镜像)，
+// 构建流程在命令之间检查取消。
+type CommandRunner interface {
+	Run(name string, args ...string) (*CommandResult, error)
+}
+
+// execRunner RunCommand 使用的真实执行器
+var execRunner CommandRunner = NewExecRunner()
+
+// IsOffline 判断执行器是否不会真正修改系统 (回放或模拟)
+func IsOffline(r CommandRunner) bool {
+	o, ok := r.(interface{ Offline() bool })
+	return ok && o.Offline()
+}
+
+// RunWith 使用指定执行器运行命令，返回值与 RunCommand 一致
+func RunWith(r CommandRunner, name string, args ...string) (string, error) {
+	result, err := r.Run(name, args...)
+	if result == nil {
+		return "", err
+	}
+	if err != nil {
+		if result.Stderr != "" {
+			return result.Stdout, fmt.Errorf("%w: %s", err, result.Stderr)
+		}
+		return result.Stdout, err
+	}
+	return result.Stdout, nil
+}
+
+// ExecRunner 真实的命令执行器
+type ExecRunner struct{}
+
+// NewExecRunner 创建真实的命令执行器
+func NewExecRunner() *ExecRunner {
+	return &ExecRunner{}
+}
+
+// Run 执行命令并捕获输出
+func (r *ExecRunner) Run(name string, args ...string) (*CommandResult, error) {
+	cmd := exec.Command(name, args...)
+	hideWindow(cmd)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+
+	result := &CommandResult{
+		Name:   name,
+		Args:   args,
+		Stdout: TryDecodeGBK(stdout.Bytes()),
+		Stderr: TryDecodeGBK(stderr.Bytes()),
+	}
+
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			result.ExitCode = exitErr.ExitCode()
+		} else {
+			result.ExitCode = -1
+			result.Error = err.Error()
+		}
+	}
+
+	return result, err
+}
+
+// Cassette 命令录制文件
+type Cassette struct {
+	Version int              `json:"version"`
+	Entries []*CommandResult `json:"entries"`
+}
+
+const cassetteVersion = 1
+
+// LoadCassette 读取录制文件
+func LoadCassette(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取录制文件失败: %w", err)
+	}
+
+	var c Cassette
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("解析录制文件失败: %w", err)
+	}
+
+	if c.Version != cassetteVersion {
+		return nil, fmt.Errorf("不支持的录制文件版本: %d", c.Version)
+	}
+
+	return &c, nil
+}
+
+// Save 保存录制文件
+func (c *Cassette) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := EnsureDir(filepath.Dir(path)); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// RecordingRunner 录制执行器，将每条命令及其输出写入录制文件
+type RecordingRunner struct {
+	inner    CommandRunner
+	path     string
+	mu       sync.Mutex
+	cassette *Cassette
+}
+
+// NewRecordingRunner 创建录制执行器
+func NewRecordingRunner(inner CommandRunner, path string) *RecordingRunner {
+	if inner == nil {
+		inner = NewExecRunner()
+	}
+	return &RecordingRunner{
+		inner:    inner,
+		path:     path,
+		cassette: &Cassette{Version: cassetteVersion},
+	}
+}
+
+// Inner 返回被录制的执行器
+func (r *RecordingRunner) Inner() CommandRunner {
+	return r.inner
+}
+
+// Offline 与被录制的执行器一致
+func (r *RecordingRunner) Offline() bool {
+	return IsOffline(r.inner)
+}
+
+// Run 执行命令并记录结果
+func (r *RecordingRunner) Run(name string, args ...string) (*CommandResult, error) {
+	result, err := r.inner.Run(name, args...)
+
+	entry := &CommandResult{Name: name, Args: args}
+	if result != nil {
+		entry.Stdout = result.Stdout
+		entry.Stderr = result.Stderr
+		entry.ExitCode = result.ExitCode
+		entry.Error = result.Error
+	}
+	if err != nil && entry.ExitCode == 0 {
+		entry.ExitCode = -1
+		entry.Error = err.Error()
+	}
+
+	r.mu.Lock()
+	r.cassette.Entries = append(r.cassette.Entries, entry)
+	// 每条命令后立即落盘，构建中途退出也不丢失记录
+	saveErr := r.cassette.Save(r.path)
+	r.mu.Unlock()
+
+	if saveErr != nil {
+		fmt.Printf("警告: 保存录制文件失败: %v\n", saveErr)
+	}
+
+	return result, err
+}
+
+// ReplayRunner 回放执行器，从录制文件返回命令输出而不真正执行
+//
+// 回放只重现命令的输出，不重现命令对文件系统的修改 (挂载、导出等)。
+// 回放整个构建时用 WithEffects 在模拟执行器上同时执行命令。
+type ReplayRunner struct {
+	mu       sync.Mutex
+	cassette *Cassette
+	used     []bool
+	effects  CommandRunner
+}
+
+// NewReplayRunner 从录制文件创建回放执行器
+func NewReplayRunner(path string) (*ReplayRunner, error) {
+	c, err := LoadCassette(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewReplayRunnerFromCassette(c), nil
+}
+
+// NewReplayRunnerFromCassette 从内存中的录制数据创建回放执行器
+func NewReplayRunnerFromCassette(c *Cassette) *ReplayRunner {
+	return &ReplayRunner{
+		cassette: c,
+		used:     make([]bool, len(c.Entries)),
+	}
+}
+
+// WithEffects 匹配到录制的命令后同时在 effects 上执行，以重现命令的副作用
+// (如模拟 DISM 展开挂载目录、写出导出的 WIM)；返回的输出仍取自录制文件。
+// effects 必须是离线执行器。
+func (r *ReplayRunner) WithEffects(effects CommandRunner) *ReplayRunner {
+	r.effects = effects
+	return r
+}
+
+// Inner 返回重现副作用的执行器 (没有时为 nil)
+func (r *ReplayRunner) Inner() CommandRunner {
+	return r.effects
+}
+
+// Offline 回放执行器不会修改真实系统
+func (r *ReplayRunner) Offline() bool {
+	return true
+}
+
+// Run 返回第一条未使用且命令行一致的录制结果
+func (r *ReplayRunner) Run(name string, args ...string) (*CommandResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, entry := range r.cassette.Entries {
+		if r.used[i] || !sameCommand(entry, name, args) {
+			continue
+		}
+		r.used[i] = true
+		if r.effects != nil {
+			// 只需要副作用，结果以录制的为准
+			r.effects.Run(name, args...)
+		}
+
+		result := *entry
+		if entry.Error != "" {
+			return &result, errors.New(entry.Error)
+		}
+		if entry.ExitCode != 0 {
+			return &result, fmt.Errorf("exit status %d", entry.ExitCode)
+		}
+		return &result, nil
+	}
+
+	return nil, fmt.Errorf("录制文件中没有匹配的命令: %s %s", name, strings.Join(args, " "))
+}
+
+// Remaining 返回尚未被回放的录制条目数量
+func (r *ReplayRunner) Remaining() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	count := 0
+	for _, used := range r.used {
+		if !used {
+			count++
+		}
+	}
+	return count
+}
+
+// sameCommand 比较命令行 (命令名不区分大小写)
+func sameCommand(entry *CommandResult, name string, args []string) bool {
+	if !strings.EqualFold(entry.Name, name) || len(entry.Args) != len(args) {
+		return false
+	}
+	for i := range args {
+		if entry.Args[i] != args[i] {
+			return false
+		}
+	}
+	return true
+}
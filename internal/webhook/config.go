@@ -0,0 +1,133 @@
+// Package webhook 在构建任务的生命周期事件发生时向配置的 URL 发送通知
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// 事件
+const (
+	EventQueued        = "job.queued"         // 任务加入队列 (仅 API)
+	EventStarted       = "job.started"        // 开始构建
+	EventStepCompleted = "job.step_completed" // 完成一个构建步骤
+	EventSucceeded     = "job.succeeded"
+	EventFailed        = "job.failed"
+	EventCanceled      = "job.canceled"
+	EventPing          = "ping" // webhook test 发送的测试事件，总是发送
+)
+
+// Events 可订阅的事件
+func Events() []string {
+	return []string{EventQueued, EventStarted, EventStepCompleted, EventSucceeded, EventFailed, EventCanceled}
+}
+
+// 默认的投递参数
+const (
+	DefaultMaxAttempts = 5
+	DefaultTimeout     = 10 * time.Second
+)
+
+// Hook 一个 webhook
+type Hook struct {
+	Name        string            `json:"name"`
+	URL         string            `json:"url"`
+	Secret      string            `json:"secret,omitempty"` // HMAC-SHA256 签名的密钥
+	Events      []string          `json:"events,omitempty"` // 订阅的事件，为空时为全部
+	Headers     map[string]string `json:"headers,omitempty"`
+	MaxAttempts int               `json:"maxAttempts,omitempty"` // 最多尝试次数 (默认 5)
+	Timeout     int               `json:"timeout,omitempty"`     // 每次请求的超时秒数 (默认 10)
+}
+
+// Config webhooks.json
+type Config struct {
+	Webhooks []Hook `json:"webhooks"`
+}
+
+// LoadConfig 读取 webhook 配置，文件不存在时返回空列表
+func LoadConfig(path string) ([]Hook, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取 webhook 配置失败: %w", err)
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("解析 webhook 配置失败 %s: %w", path, err)
+	}
+
+	names := make(map[string]bool)
+	for i := range cfg.Webhooks {
+		h := &cfg.Webhooks[i]
+		if err := h.validate(); err != nil {
+			return nil, fmt.Errorf("webhook 配置 %s 第 %d 项: %w", path, i+1, err)
+		}
+		if names[h.Name] {
+			return nil, fmt.Errorf("webhook 配置 %s: 名称重复: %s", path, h.Name)
+		}
+		names[h.Name] = true
+	}
+	return cfg.Webhooks, nil
+}
+
+// validate 检查配置并补全默认名称
+func (h *Hook) validate() error {
+	u, err := url.Parse(h.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("无效的 URL: %q (应为 http:// 或 https:// 地址)", h.URL)
+	}
+	if h.Name == "" {
+		h.Name = u.Host
+	}
+	for _, e := range h.Events {
+		if !knownEvent(e) {
+			return fmt.Errorf("未知的事件: %s (可选: %s)", e, strings.Join(Events(), ", "))
+		}
+	}
+	if h.MaxAttempts < 0 || h.Timeout < 0 {
+		return fmt.Errorf("maxAttempts 和 timeout 不能为负数")
+	}
+	return nil
+}
+
+func knownEvent(event string) bool {
+	for _, e := range Events() {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Wants 是否订阅了事件
+func (h Hook) Wants(event string) bool {
+	if event == EventPing || len(h.Events) == 0 {
+		return true
+	}
+	for _, e := range h.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+func (h Hook) maxAttempts() int {
+	if h.MaxAttempts > 0 {
+		return h.MaxAttempts
+	}
+	return DefaultMaxAttempts
+}
+
+func (h Hook) timeout() time.Duration {
+	if h.Timeout > 0 {
+		return time.Duration(h.Timeout) * time.Second
+	}
+	return DefaultTimeout
+}
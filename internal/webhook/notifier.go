@@ -0,0 +1,263 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"tiny11-builder/internal/logger"
+	"tiny11-builder/internal/types"
+)
+
+// 重试间隔从 retryBase 开始每次翻倍，最长 retryMax；响应带 Retry-After 时取较大值
+const (
+	retryBase = time.Second
+	retryMax  = 5 * time.Minute
+	queueSize = 256 // 每个 webhook 等待投递的事件数
+)
+
+// Notifier 异步投递事件
+//
+// 每个 webhook 有自己的队列和投递 goroutine，事件按发生的顺序依次投递
+// (包括重试)，一个 webhook 不可用不会延误其他 webhook。
+type Notifier struct {
+	log       *logger.Logger
+	workers   []*worker
+	retryBase time.Duration
+
+	mu     sync.RWMutex
+	closed bool
+	wg     sync.WaitGroup
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+type worker struct {
+	hook   Hook
+	client *http.Client
+	queue  chan delivery
+}
+
+// delivery 一次投递: 重试时请求体和 id 不变
+type delivery struct {
+	id    string
+	event string
+	body  []byte
+}
+
+// NewNotifier 为每个 webhook 启动投递 goroutine；hooks 为空时 Notify 不做任何事
+func NewNotifier(hooks []Hook, log *logger.Logger) *Notifier {
+	n := &Notifier{log: log, retryBase: retryBase}
+	n.ctx, n.cancel = context.WithCancel(context.Background())
+	for _, h := range hooks {
+		w := &worker{hook: h, client: newClient(h), queue: make(chan delivery, queueSize)}
+		n.workers = append(n.workers, w)
+		n.wg.Add(1)
+		go n.run(w)
+	}
+	return n
+}
+
+func newClient(h Hook) *http.Client {
+	return &http.Client{Timeout: h.timeout()}
+}
+
+// Enabled 是否配置了 webhook
+func (n *Notifier) Enabled() bool {
+	return n != nil && len(n.workers) > 0
+}
+
+// Notify 把事件加入订阅它的 webhook 的队列 (不等待投递)
+func (n *Notifier) Notify(event string, job *types.WebhookJob, step *types.WebhookStep) {
+	if !n.Enabled() {
+		return
+	}
+	d, err := newDelivery(event, job, step)
+	if err != nil {
+		n.log.Warn("生成 webhook 事件 %s 失败: %v", event, err)
+		return
+	}
+
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	if n.closed {
+		return
+	}
+	for _, w := range n.workers {
+		if !w.hook.Wants(event) {
+			continue
+		}
+		select {
+		case w.queue <- d:
+		default:
+			n.log.Warn("webhook %s 的队列已满，丢弃事件 %s", w.hook.Name, event)
+		}
+	}
+}
+
+// Close 停止接收事件，等待队列中的事件投递完 (包括重试)
+//
+// 超过 timeout 时放弃未完成的投递并返回 false。
+func (n *Notifier) Close(timeout time.Duration) bool {
+	n.mu.Lock()
+	if !n.closed {
+		n.closed = true
+		for _, w := range n.workers {
+			close(w.queue)
+		}
+	}
+	n.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		n.wg.Wait()
+		close(done)
+	}()
+	defer n.cancel()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func (n *Notifier) run(w *worker) {
+	defer n.wg.Done()
+	for d := range w.queue {
+		if err := n.deliver(w, d); err != nil {
+			n.log.Warn("webhook %s: 事件 %s (%s) 投递失败: %v", w.hook.Name, d.event, d.id, err)
+		}
+	}
+}
+
+// deliver 投递一个事件，失败时按退避间隔重试
+func (n *Notifier) deliver(w *worker, d delivery) error {
+	for attempt := 1; ; attempt++ {
+		retryAfter, err := post(n.ctx, w.client, w.hook, d)
+		if err == nil {
+			return nil
+		}
+		var perm *permanentError
+		if errors.As(err, &perm) || attempt >= w.hook.maxAttempts() || n.ctx.Err() != nil {
+			return fmt.Errorf("已尝试 %d 次: %w", attempt, err)
+		}
+
+		delay := n.backoff(attempt, retryAfter)
+		n.log.Warn("webhook %s: 事件 %s 投递失败 (第 %d 次): %v，%s 后重试", w.hook.Name, d.event, attempt, err, delay)
+		select {
+		case <-time.After(delay):
+		case <-n.ctx.Done():
+			return fmt.Errorf("已尝试 %d 次: %w", attempt, err)
+		}
+	}
+}
+
+// backoff 第 attempt 次失败后的等待时间
+func (n *Notifier) backoff(attempt int, retryAfter time.Duration) time.Duration {
+	delay := n.retryBase
+	for i := 1; i < attempt && delay < retryMax; i++ {
+		delay *= 2
+	}
+	if retryAfter > delay {
+		delay = retryAfter
+	}
+	if delay > retryMax {
+		delay = retryMax
+	}
+	return delay
+}
+
+// Send 立即发送一次事件 (不重试)，用于测试配置
+func Send(ctx context.Context, hook Hook, event string, job *types.WebhookJob, step *types.WebhookStep) error {
+	d, err := newDelivery(event, job, step)
+	if err != nil {
+		return err
+	}
+	_, err = post(ctx, newClient(hook), hook, d)
+	return err
+}
+
+func newDelivery(event string, job *types.WebhookJob, step *types.WebhookStep) (delivery, error) {
+	b := make([]byte, 8)
+	rand.Read(b)
+	d := delivery{id: hex.EncodeToString(b), event: event}
+	body, err := json.Marshal(types.WebhookPayload{
+		Delivery: d.id, Event: event, Time: time.Now(), Job: job, Step: step})
+	if err != nil {
+		return d, err
+	}
+	d.body = body
+	return d, nil
+}
+
+// permanentError 重试也不会成功的错误 (如 400、401、404)
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// post 发送一次请求，返回服务器要求的重试等待时间 (Retry-After)
+func post(ctx context.Context, client *http.Client, hook Hook, d delivery) (time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(d.body))
+	if err != nil {
+		return 0, &permanentError{err}
+	}
+	for k, v := range hook.Headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "tiny11-builder-webhook")
+	req.Header.Set(EventHeader, d.event)
+	req.Header.Set(DeliveryHeader, d.id)
+	if hook.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(hook.Secret, d.body))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return 0, nil
+	}
+
+	err = fmt.Errorf("HTTP %d", resp.StatusCode)
+	if text := strings.TrimSpace(string(msg)); text != "" {
+		err = fmt.Errorf("HTTP %d: %s", resp.StatusCode, text)
+	}
+	switch {
+	case resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode == http.StatusTooManyRequests,
+		resp.StatusCode >= 500:
+		return retryAfter(resp.Header.Get("Retry-After")), err
+	}
+	return 0, &permanentError{err}
+}
+
+// retryAfter 解析 Retry-After (秒数或 HTTP 日期)
+func retryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if sec, err := strconv.Atoi(value); err == nil && sec > 0 {
+		return time.Duration(sec) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
@@ -0,0 +1,71 @@
+package webhook
+
+import (
+	"time"
+
+	"tiny11-builder/internal/config"
+	"tiny11-builder/internal/types"
+)
+
+// FinishEvent 任务结果对应的事件
+func FinishEvent(state types.JobState) string {
+	switch state {
+	case types.JobComplete:
+		return EventSucceeded
+	case types.JobCanceled:
+		return EventCanceled
+	}
+	return EventFailed
+}
+
+// RunningJob 未结束的任务的信息 (加入队列、开始构建和步骤完成的事件)
+func RunningJob(id, source string, cfg *config.Config, mode types.BuildMode, state types.JobState, created time.Time, started *time.Time) *types.WebhookJob {
+	theme := cfg.ThemeName
+	if theme == "default" {
+		theme = ""
+	}
+	return &types.WebhookJob{
+		ID:        id,
+		Source:    source,
+		Mode:      mode,
+		Theme:     theme,
+		State:     state,
+		WorkDir:   cfg.WorkDir,
+		CreatedAt: created,
+		StartedAt: started,
+	}
+}
+
+// RecordJob 由构建记录生成结束事件中的任务信息
+func RecordJob(rec types.BuildRecord) *types.WebhookJob {
+	finished := rec.FinishedAt
+	return &types.WebhookJob{
+		ID:           rec.ID,
+		Source:       rec.Source,
+		Mode:         rec.Mode,
+		Theme:        rec.Theme,
+		State:        rec.State,
+		WorkDir:      rec.WorkDir,
+		CreatedAt:    rec.CreatedAt,
+		StartedAt:    rec.StartedAt,
+		FinishedAt:   &finished,
+		Duration:     rec.Duration,
+		OutputISO:    rec.OutputISO,
+		SHA256:       rec.SHA256,
+		LogFile:      rec.LogFile,
+		Error:        rec.Error,
+		ErrorCode:    rec.ErrorCode,
+		ErrorContext: rec.ErrorContext,
+	}
+}
+
+// Step 完成的步骤，steps 为总步骤数
+func Step(t types.StepTiming, steps int) *types.WebhookStep {
+	return &types.WebhookStep{
+		Step:      t.Step,
+		Steps:     steps,
+		Title:     t.Title,
+		StartedAt: t.StartedAt,
+		Duration:  t.Duration,
+	}
+}
@@ -0,0 +1,79 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"tiny11-builder/internal/utils"
+)
+
+// maxPayloadSize 接收端读取的最大请求体
+const maxPayloadSize = 1 << 20
+
+// Receiver 用于离线测试的 webhook 接收端: 校验签名并打印收到的事件
+type Receiver struct {
+	Secret    string    // 为空时不校验签名
+	FailFirst int       // 前 n 个请求返回 503，用于观察重试
+	Out       io.Writer // 输出收到的事件
+
+	mu    sync.Mutex
+	count int
+	seen  map[string]int // 投递 id -> 收到的次数
+}
+
+func (rc *Receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "仅支持 POST", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxPayloadSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.count++
+	if rc.seen == nil {
+		rc.seen = make(map[string]int)
+	}
+	id := r.Header.Get(DeliveryHeader)
+	rc.seen[id]++
+
+	event := r.Header.Get(EventHeader)
+	header := fmt.Sprintf("[%s] #%d %s %s", time.Now().Format(time.TimeOnly), rc.count, event, id)
+	if n := rc.seen[id]; n > 1 {
+		header += fmt.Sprintf(" (第 %d 次)", n)
+	}
+
+	sigStatus := utils.Colorize("未签名", utils.MikuGray)
+	if rc.Secret != "" {
+		if !Verify(rc.Secret, body, r.Header.Get(SignatureHeader)) {
+			fmt.Fprintln(rc.Out, utils.Colorize(header+" 签名无效，返回 401", utils.MikuRed))
+			http.Error(w, "签名无效", http.StatusUnauthorized)
+			return
+		}
+		sigStatus = utils.Colorize("签名有效", utils.MikuGreen)
+	}
+	if rc.count <= rc.FailFirst {
+		fmt.Fprintf(rc.Out, "%s %s %s\n", utils.Colorize(header, utils.MikuYellow), sigStatus,
+			utils.Colorize(fmt.Sprintf("模拟失败，返回 503 (%d/%d)", rc.count, rc.FailFirst), utils.MikuYellow))
+		http.Error(w, "模拟失败", http.StatusServiceUnavailable)
+		return
+	}
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, body, "  ", "  "); err != nil {
+		fmt.Fprintln(rc.Out, utils.Colorize(header+" 请求体不是有效的 JSON", utils.MikuRed))
+		http.Error(w, "无效的 JSON", http.StatusBadRequest)
+		return
+	}
+	fmt.Fprintf(rc.Out, "%s %s\n  %s\n", utils.Colorize(header, utils.MikuPink), sigStatus, out.String())
+	w.WriteHeader(http.StatusNoContent)
+}
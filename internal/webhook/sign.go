@@ -0,0 +1,37 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// 请求头
+const (
+	EventHeader     = "X-Tiny11-Event"
+	DeliveryHeader  = "X-Tiny11-Delivery"
+	SignatureHeader = "X-Tiny11-Signature-256" // 配置了 secret 时: sha256=<HMAC-SHA256 十六进制>
+)
+
+// Sign 计算请求体的签名 (sha256=<hex>)
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify 校验请求体的签名 (恒定时间比较)
+func Verify(secret string, body []byte, signature string) bool {
+	hexSum, ok := strings.CutPrefix(signature, "sha256=")
+	if !ok {
+		return false
+	}
+	got, err := hex.DecodeString(hexSum)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
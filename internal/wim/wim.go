@@ -0,0 +1,345 @@
+// Package wim 读取 WIM/ESD 文件头和内嵌的 XML 元数据
+//
+// 只解析镜像描述信息 (名称、版本、架构、语言、大小等)，不解压镜像内容，
+// 因此无需挂载镜像，也可在非 Windows 平台上使用。
+package wim
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// HeaderSize WIM 文件头大小
+const HeaderSize = 208
+
+var (
+	magicWIM     = [8]byte{'M', 'S', 'W', 'I', 'M', 0, 0, 0}
+	magicPipable = [8]byte{'W', 'L', 'P', 'W', 'M', 0, 0, 0}
+	errNotWIM    = errors.New("不是有效的WIM文件")
+	maxXMLSize   = int64(64 * 1024 * 1024)
+)
+
+// 文件头标志
+const (
+	FlagCompression = 0x00000002
+	FlagReadOnly    = 0x00000004
+	FlagSpanned     = 0x00000008
+	FlagRPFix       = 0x00000080
+	FlagXPRESS      = 0x00020000
+	FlagLZX         = 0x00040000
+	FlagLZMS        = 0x00080000
+)
+
+// Resource 文件头中的资源描述 (RESHDR_DISK_SHORT)
+type Resource struct {
+	Size         int64
+	Flags        byte
+	Offset       int64
+	OriginalSize int64
+}
+
+// Header WIM 文件头
+type Header struct {
+	Magic       [8]byte
+	Version     uint32
+	Flags       uint32
+	ChunkSize   uint32
+	GUID        [16]byte
+	PartNumber  uint16
+	TotalParts  uint16
+	ImageCount  uint32
+	OffsetTable Resource
+	XMLData     Resource
+	BootData    Resource
+	BootIndex   uint32
+	Integrity   Resource
+}
+
+// Compression 返回压缩格式名称
+func (h *Header) Compression() string {
+	switch {
+	case h.Flags&FlagCompression == 0:
+		return "none"
+	case h.Flags&FlagLZMS != 0:
+		return "lzms"
+	case h.Flags&FlagLZX != 0:
+		return "lzx"
+	case h.Flags&FlagXPRESS != 0:
+		return "xpress"
+	}
+	return "unknown"
+}
+
+// Image WIM 中一个镜像的元数据
+type Image struct {
+	Index           int
+	Name            string
+	Description     string
+	DisplayName     string
+	Flags           string
+	Edition         string
+	Architecture    string
+	ProductType     string
+	Installation    string
+	Languages       []string
+	DefaultLanguage string
+	Version         string
+	Build           string
+	SPBuild         int
+	DirCount        int
+	FileCount       int
+	TotalBytes      int64
+}
+
+// Info WIM 文件的完整元数据
+type Info struct {
+	Header     Header
+	TotalBytes int64
+	Images     []*Image
+}
+
+// Image 按索引获取镜像，不存在返回 nil
+func (i *Info) Image(index int) *Image {
+	for _, img := range i.Images {
+		if img.Index == index {
+			return img
+		}
+	}
+	return nil
+}
+
+// Indices 返回所有镜像索引
+func (i *Info) Indices() []int {
+	indices := make([]int, 0, len(i.Images))
+	for _, img := range i.Images {
+		indices = append(indices, img.Index)
+	}
+	return indices
+}
+
+// Open 读取 WIM/ESD 文件的元数据
+func Open(path string) (*Info, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("读取 %s 失败: %w", path, err)
+	}
+	return info, nil
+}
+
+// Read 从 ReaderAt 读取 WIM 元数据
+func Read(r io.ReaderAt) (*Info, error) {
+	buf := make([]byte, HeaderSize)
+	if _, err := r.ReadAt(buf, 0); err != nil {
+		return nil, fmt.Errorf("读取文件头失败: %w", err)
+	}
+
+	h, err := parseHeader(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	if h.XMLData.Size <= 0 || h.XMLData.Size > maxXMLSize {
+		return nil, fmt.Errorf("无效的XML数据大小: %d", h.XMLData.Size)
+	}
+
+	data := make([]byte, h.XMLData.Size)
+	if _, err := r.ReadAt(data, h.XMLData.Offset); err != nil {
+		return nil, fmt.Errorf("读取XML数据失败: %w", err)
+	}
+
+	info, err := parseXML(data)
+	if err != nil {
+		return nil, err
+	}
+	info.Header = *h
+	return info, nil
+}
+
+func parseHeader(buf []byte) (*Header, error) {
+	h := &Header{}
+	copy(h.Magic[:], buf[0:8])
+	if h.Magic != magicWIM && h.Magic != magicPipable {
+		return nil, errNotWIM
+	}
+
+	le := binary.LittleEndian
+	if size := le.Uint32(buf[8:12]); size != HeaderSize {
+		return nil, fmt.Errorf("不支持的文件头大小: %d", size)
+	}
+
+	h.Version = le.Uint32(buf[12:16])
+	h.Flags = le.Uint32(buf[16:20])
+	h.ChunkSize = le.Uint32(buf[20:24])
+	copy(h.GUID[:], buf[24:40])
+	h.PartNumber = le.Uint16(buf[40:42])
+	h.TotalParts = le.Uint16(buf[42:44])
+	h.ImageCount = le.Uint32(buf[44:48])
+	h.OffsetTable = parseResource(buf[48:72])
+	h.XMLData = parseResource(buf[72:96])
+	h.BootData = parseResource(buf[96:120])
+	h.BootIndex = le.Uint32(buf[120:124])
+	h.Integrity = parseResource(buf[124:148])
+
+	return h, nil
+}
+
+func parseResource(b []byte) Resource {
+	le := binary.LittleEndian
+	sizeAndFlags := le.Uint64(b[0:8])
+	return Resource{
+		Size:         int64(sizeAndFlags & 0x00FFFFFFFFFFFFFF),
+		Flags:        byte(sizeAndFlags >> 56),
+		Offset:       int64(le.Uint64(b[8:16])),
+		OriginalSize: int64(le.Uint64(b[16:24])),
+	}
+}
+
+// xmlWIM WIM XML 元数据结构
+type xmlWIM struct {
+	XMLName    xml.Name   `xml:"WIM"`
+	TotalBytes string     `xml:"TOTALBYTES"`
+	Images     []xmlImage `xml:"IMAGE"`
+}
+
+type xmlImage struct {
+	Index       string      `xml:"INDEX,attr"`
+	DirCount    string      `xml:"DIRCOUNT"`
+	FileCount   string      `xml:"FILECOUNT"`
+	TotalBytes  string      `xml:"TOTALBYTES"`
+	Windows     *xmlWindows `xml:"WINDOWS"`
+	Name        string      `xml:"NAME"`
+	Description string      `xml:"DESCRIPTION"`
+	Flags       string      `xml:"FLAGS"`
+	DisplayName string      `xml:"DISPLAYNAME"`
+}
+
+type xmlWindows struct {
+	Arch             string `xml:"ARCH"`
+	EditionID        string `xml:"EDITIONID"`
+	InstallationType string `xml:"INSTALLATIONTYPE"`
+	ProductType      string `xml:"PRODUCTTYPE"`
+	Languages        struct {
+		Language []string `xml:"LANGUAGE"`
+		Default  string   `xml:"DEFAULT"`
+	} `xml:"LANGUAGES"`
+	Version struct {
+		Major   string `xml:"MAJOR"`
+		Minor   string `xml:"MINOR"`
+		Build   string `xml:"BUILD"`
+		SPBuild string `xml:"SPBUILD"`
+	} `xml:"VERSION"`
+}
+
+// archNames PROCESSOR_ARCHITECTURE 值 -> DISM 显示名称
+var archNames = map[string]string{
+	"0":  "x86",
+	"5":  "arm",
+	"6":  "ia64",
+	"9":  "x64",
+	"12": "arm64",
+}
+
+// decodeUTF16 将带 BOM 的 UTF-16LE 数据转换为字符串
+func decodeUTF16(data []byte) (string, error) {
+	if len(data) >= 2 && data[0] == 0xFF && data[1] == 0xFE {
+		data = data[2:]
+	} else if bytes.HasPrefix(data, []byte("<")) {
+		// 部分工具写入 UTF-8 XML
+		return string(data), nil
+	}
+	if len(data)%2 != 0 {
+		return "", fmt.Errorf("XML数据长度无效")
+	}
+
+	u := make([]uint16, len(data)/2)
+	for i := range u {
+		u[i] = binary.LittleEndian.Uint16(data[i*2:])
+	}
+	return string(utf16.Decode(u)), nil
+}
+
+func parseXML(data []byte) (*Info, error) {
+	text, err := decodeUTF16(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc xmlWIM
+	if err := xml.Unmarshal([]byte(strings.TrimRight(text, "\x00")), &doc); err != nil {
+		return nil, fmt.Errorf("解析XML失败: %w", err)
+	}
+
+	info := &Info{TotalBytes: parseNumber(doc.TotalBytes)}
+
+	for _, x := range doc.Images {
+		index, err := strconv.Atoi(x.Index)
+		if err != nil {
+			return nil, fmt.Errorf("无效的镜像索引: %q", x.Index)
+		}
+
+		img := &Image{
+			Index:       index,
+			Name:        x.Name,
+			Description: x.Description,
+			DisplayName: x.DisplayName,
+			Flags:       x.Flags,
+			DirCount:    int(parseNumber(x.DirCount)),
+			FileCount:   int(parseNumber(x.FileCount)),
+			TotalBytes:  parseNumber(x.TotalBytes),
+		}
+
+		if w := x.Windows; w != nil {
+			img.Architecture = archNames[strings.TrimSpace(w.Arch)]
+			img.Edition = w.EditionID
+			img.ProductType = w.ProductType
+			img.Installation = w.InstallationType
+			img.Languages = w.Languages.Language
+			img.DefaultLanguage = w.Languages.Default
+			img.Build = w.Version.Build
+			img.SPBuild = int(parseNumber(w.Version.SPBuild))
+			if w.Version.Major != "" {
+				img.Version = fmt.Sprintf("%s.%s.%s", w.Version.Major, w.Version.Minor, w.Version.Build)
+			}
+		}
+
+		if img.DefaultLanguage == "" && len(img.Languages) > 0 {
+			img.DefaultLanguage = img.Languages[0]
+		}
+
+		info.Images = append(info.Images, img)
+	}
+
+	return info, nil
+}
+
+// parseNumber 解析十进制或 0x 前缀的十六进制数字
+func parseNumber(s string) int64 {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0
+	}
+	base := 10
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		s, base = s[2:], 16
+	}
+	// 不用 base 0: 前导零的十进制数会被当作八进制
+	n, err := strconv.ParseInt(s, base, 64)
+	if err != nil {
+		return 0
+	}
+	return n
+}
@@ -0,0 +1,107 @@
+package wim
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestOpenSample(t *testing.T) {
+	info, err := Open("testdata/sample.wim")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Header.ImageCount != 2 || info.Header.Compression() != "lzx" {
+		t.Errorf("header: %d images, compression %s", info.Header.ImageCount, info.Header.Compression())
+	}
+	if info.TotalBytes != 32943097024 {
+		t.Errorf("TotalBytes = %d", info.TotalBytes)
+	}
+	if got := info.Indices(); !reflect.DeepEqual(got, []int{1, 2}) {
+		t.Errorf("Indices = %v", got)
+	}
+
+	tests := []struct {
+		index int
+		want  Image
+	}{
+		{1, Image{
+			Index: 1, Name: "Windows 11 家庭版", Description: "Windows 11 家庭版", DisplayName: "Windows 11 家庭版",
+			Flags: "Core", Edition: "Core", Architecture: "x64", ProductType: "WinNT", Installation: "Client",
+			Languages: []string{"zh-CN"}, DefaultLanguage: "zh-CN", Version: "10.0.22631", Build: "22631",
+			SPBuild: 2861, DirCount: 22540, FileCount: 102310, TotalBytes: 16263854181,
+		}},
+		// 前导零的十进制数和 0x 前缀的十六进制数
+		{2, Image{
+			Index: 2, Name: "Windows 11 Pro", Description: "Windows 11 Pro",
+			Flags: "Professional", Edition: "Professional", Architecture: "arm64", ProductType: "WinNT", Installation: "Client",
+			Languages: []string{"en-US", "de-DE"}, DefaultLanguage: "de-DE", Version: "10.0.26100", Build: "26100",
+			SPBuild: 2000, DirCount: 22578, FileCount: 102497, TotalBytes: 16479089025,
+		}},
+	}
+	for _, tt := range tests {
+		img := info.Image(tt.index)
+		if img == nil {
+			t.Fatalf("没有索引 %d", tt.index)
+		}
+		if !reflect.DeepEqual(*img, tt.want) {
+			t.Errorf("Image(%d):\n got %+v\nwant %+v", tt.index, *img, tt.want)
+		}
+	}
+	if info.Image(3) != nil {
+		t.Error("Image(3) 应为 nil")
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	images := []*Image{{
+		Index: 1, Name: "Windows 11 Pro", Description: "Windows 11 Pro", DisplayName: "Windows 11 Pro",
+		Flags: "Professional", Edition: "Professional", Architecture: "x64", ProductType: "WinNT", Installation: "Client",
+		Languages: []string{"en-US"}, DefaultLanguage: "en-US", Version: "10.0.22631", Build: "22631",
+		DirCount: 10, FileCount: 20, TotalBytes: 1 << 34,
+	}}
+	xmlData, err := EncodeXML(images)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, err := NewHeader(len(images), int64(len(xmlData))).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := Read(bytes.NewReader(append(header, xmlData...)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Images) != 1 || !reflect.DeepEqual(info.Images[0], images[0]) {
+		t.Errorf("round trip:\n got %+v\nwant %+v", info.Images[0], images[0])
+	}
+}
+
+func TestReadNotWIM(t *testing.T) {
+	if _, err := Read(bytes.NewReader(make([]byte, HeaderSize))); err != errNotWIM {
+		t.Errorf("err = %v, want %v", err, errNotWIM)
+	}
+}
+
+func TestParseNumber(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+	}{
+		{"", 0},
+		{"12345", 12345},
+		{" 42 ", 42},
+		{"0755", 755},
+		{"022578", 22578},
+		{"0x7D0", 2000},
+		{"0X1f", 31},
+		{"abc", 0},
+	}
+	for _, tt := range tests {
+		if got := parseNumber(tt.in); got != tt.want {
+			t.Errorf("parseNumber(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package wim
+
+import (
+	"encoding/binary"
+	"encoding/xml"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// NewHeader 创建只包含 XML 元数据的 WIM 文件头 (XML 紧跟在文件头之后)
+// 用于生成示例文件和模拟镜像，不描述任何镜像内容资源
+func NewHeader(imageCount int, xmlSize int64) *Header {
+	return &Header{
+		Magic:      magicWIM,
+		Version:    0x10d00,
+		ChunkSize:  32768,
+		PartNumber: 1,
+		TotalParts: 1,
+		ImageCount: uint32(imageCount),
+		XMLData: Resource{
+			Size:         xmlSize,
+			Offset:       HeaderSize,
+			OriginalSize: xmlSize,
+		},
+	}
+}
+
+// MarshalBinary 编码为 208 字节的文件头
+func (h *Header) MarshalBinary() ([]byte, error) {
+	buf := make([]byte, HeaderSize)
+	le := binary.LittleEndian
+
+	copy(buf[0:8], h.Magic[:])
+	le.PutUint32(buf[8:12], HeaderSize)
+	le.PutUint32(buf[12:16], h.Version)
+	le.PutUint32(buf[16:20], h.Flags)
+	le.PutUint32(buf[20:24], h.ChunkSize)
+	copy(buf[24:40], h.GUID[:])
+	le.PutUint16(buf[40:42], h.PartNumber)
+	le.PutUint16(buf[42:44], h.TotalParts)
+	le.PutUint32(buf[44:48], h.ImageCount)
+	putResource(buf[48:72], h.OffsetTable)
+	putResource(buf[72:96], h.XMLData)
+	putResource(buf[96:120], h.BootData)
+	le.PutUint32(buf[120:124], h.BootIndex)
+	putResource(buf[124:148], h.Integrity)
+
+	return buf, nil
+}
+
+func putResource(b []byte, r Resource) {
+	le := binary.LittleEndian
+	le.PutUint64(b[0:8], uint64(r.Size)&0x00FFFFFFFFFFFFFF|uint64(r.Flags)<<56)
+	le.PutUint64(b[8:16], uint64(r.Offset))
+	le.PutUint64(b[16:24], uint64(r.OriginalSize))
+}
+
+// EncodeXML 将镜像元数据编码为带 BOM 的 UTF-16LE XML
+func EncodeXML(images []*Image) ([]byte, error) {
+	doc := xmlWIM{}
+	var total int64
+
+	for _, img := range images {
+		x := xmlImage{
+			Index:       strconv.Itoa(img.Index),
+			DirCount:    strconv.Itoa(img.DirCount),
+			FileCount:   strconv.Itoa(img.FileCount),
+			TotalBytes:  strconv.FormatInt(img.TotalBytes, 10),
+			Name:        img.Name,
+			Description: img.Description,
+			Flags:       img.Flags,
+			DisplayName: img.DisplayName,
+			Windows:     &xmlWindows{},
+		}
+		total += img.TotalBytes
+
+		w := x.Windows
+		for code, name := range archNames {
+			if name == img.Architecture {
+				w.Arch = code
+			}
+		}
+		w.EditionID = img.Edition
+		w.InstallationType = img.Installation
+		w.ProductType = img.ProductType
+		w.Languages.Language = img.Languages
+		w.Languages.Default = img.DefaultLanguage
+
+		parts := strings.SplitN(img.Version, ".", 3)
+		if len(parts) == 3 {
+			w.Version.Major, w.Version.Minor, w.Version.Build = parts[0], parts[1], parts[2]
+		} else {
+			w.Version.Build = img.Build
+		}
+		w.Version.SPBuild = strconv.Itoa(img.SPBuild)
+
+		doc.Images = append(doc.Images, x)
+	}
+	doc.TotalBytes = strconv.FormatInt(total, 10)
+
+	text, err := xml.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	u := utf16.Encode([]rune(string(text)))
+	out := make([]byte, 2+len(u)*2)
+	out[0], out[1] = 0xFF, 0xFE
+	for i, c := range u {
+		binary.LittleEndian.PutUint16(out[2+i*2:], c)
+	}
+	return out, nil
+}
@@ -0,0 +1,332 @@
+// Package client Tiny11 Builder API 的 Go 客户端
+//
+//	c := client.New("https://build01:8443", client.WithToken(os.Getenv("TINY11_TOKEN")))
+//	job, err := c.SubmitJob(ctx, client.BuildRequest{ISODrive: "E:", Mode: client.ModeCore})
+//	if err != nil {
+//		return err
+//	}
+//	job, err = c.Wait(ctx, job.ID, func(e client.JobEvent) error {
+//		if e.Type == client.EventStep {
+//			fmt.Println(e.Event.Message)
+//		}
+//		return nil
+//	})
+//
+// 请求和响应使用与服务器相同的类型 (见 types.go)，接口说明见 GET /api/openapi.json。
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Client API 客户端
+type Client struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+// Option 客户端选项
+type Option func(*Client)
+
+// WithToken 使用 API 令牌 (Authorization: Bearer)
+func WithToken(token string) Option {
+	return func(c *Client) { c.token = token }
+}
+
+// WithHTTPClient 使用自定义的 http.Client (代理、TLS 配置等)
+//
+// 事件流是长连接，不要设置 Timeout，用 context 控制超时。
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.http = hc }
+}
+
+// New 创建客户端，baseURL 如 http://127.0.0.1:8080
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{baseURL: strings.TrimRight(baseURL, "/"), http: http.DefaultClient}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Error API 返回的错误响应
+type Error struct {
+	StatusCode int
+	Message    string
+	Detail     string
+	Fields     []FieldError // 请求校验失败的字段
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("%s (HTTP %d)", e.Message, e.StatusCode)
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	return msg
+}
+
+// SubmitJob 提交构建任务
+func (c *Client) SubmitJob(ctx context.Context, req BuildRequest) (Job, error) {
+	var job Job
+	body, err := json.Marshal(req)
+	if err != nil {
+		return job, err
+	}
+	err = c.do(ctx, http.MethodPost, "/api/jobs", bytes.NewReader(body), "application/json", &job)
+	return job, err
+}
+
+// Jobs 全部任务 (最近提交的在前)
+func (c *Client) Jobs(ctx context.Context) ([]Job, error) {
+	var jobs []Job
+	err := c.do(ctx, http.MethodGet, "/api/jobs", nil, "", &jobs)
+	return jobs, err
+}
+
+// Job 单个任务
+func (c *Client) Job(ctx context.Context, id string) (Job, error) {
+	var job Job
+	err := c.do(ctx, http.MethodGet, "/api/jobs/"+url.PathEscape(id), nil, "", &job)
+	return job, err
+}
+
+// CancelJob 取消任务
+//
+// 运行中的任务返回时状态仍为 running (phase 为 canceling)，停止后变为 canceled，
+// 可用 Wait 等待。
+func (c *Client) CancelJob(ctx context.Context, id string) (Job, error) {
+	var job Job
+	err := c.do(ctx, http.MethodDelete, "/api/jobs/"+url.PathEscape(id), nil, "", &job)
+	return job, err
+}
+
+// Artifacts 已结束任务的产物
+func (c *Client) Artifacts(ctx context.Context, id string) ([]Artifact, error) {
+	var artifacts []Artifact
+	err := c.do(ctx, http.MethodGet, "/api/jobs/"+url.PathEscape(id)+"/artifacts", nil, "", &artifacts)
+	return artifacts, err
+}
+
+// DownloadArtifact 下载产物，offset 大于 0 时从该位置继续下载
+//
+// 调用者负责关闭返回的 io.ReadCloser。
+func (c *Client) DownloadArtifact(ctx context.Context, id, name string, offset int64) (io.ReadCloser, error) {
+	req, err := c.newRequest(ctx, http.MethodGet,
+		"/api/jobs/"+url.PathEscape(id)+"/artifacts/"+url.PathEscape(name), nil, "")
+	if err != nil {
+		return nil, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode >= 400:
+		defer resp.Body.Close()
+		return nil, responseError(resp)
+	case offset > 0 && resp.StatusCode != http.StatusPartialContent:
+		resp.Body.Close()
+		return nil, fmt.Errorf("服务器没有返回从 %d 开始的内容 (HTTP %d)", offset, resp.StatusCode)
+	}
+	return resp.Body, nil
+}
+
+// Themes 已安装的主题
+func (c *Client) Themes(ctx context.Context) ([]ThemeInfo, error) {
+	var themes []ThemeInfo
+	err := c.do(ctx, http.MethodGet, "/api/themes", nil, "", &themes)
+	return themes, err
+}
+
+// UploadTheme 上传 zip 格式的主题，name 为空时使用压缩包中的顶层目录名
+func (c *Client) UploadTheme(ctx context.Context, name string, archive io.Reader, replace bool) (ThemeInfo, error) {
+	var info ThemeInfo
+	fields := map[string]string{"name": name, "replace": strconv.FormatBool(replace)}
+	err := c.upload(ctx, "/api/themes", fields, "theme.zip", archive, &info)
+	return info, err
+}
+
+// Preinstall 预装软件列表
+func (c *Client) Preinstall(ctx context.Context) (PreinstallCatalog, error) {
+	var catalog PreinstallCatalog
+	err := c.do(ctx, http.MethodGet, "/api/preinstall", nil, "", &catalog)
+	return catalog, err
+}
+
+// InstallerUpload 上传安装包时的软件信息
+type InstallerUpload struct {
+	ID          string
+	Name        string
+	Description string
+	Version     string
+	InstallCmd  string // 默认为文件名
+	Silent      bool
+	FileName    string // 保存的文件名
+}
+
+// UploadInstaller 上传安装包并添加到预装软件列表 (id 已存在时替换)
+func (c *Client) UploadInstaller(ctx context.Context, app InstallerUpload, installer io.Reader) (PreinstallApp, error) {
+	var info PreinstallApp
+	if app.FileName == "" {
+		return info, fmt.Errorf("需要指定安装包文件名")
+	}
+	fields := map[string]string{
+		"id":          app.ID,
+		"name":        app.Name,
+		"description": app.Description,
+		"version":     app.Version,
+		"installCmd":  app.InstallCmd,
+		"silent":      strconv.FormatBool(app.Silent),
+	}
+	err := c.upload(ctx, "/api/preinstall", fields, app.FileName, installer, &info)
+	return info, err
+}
+
+// Tweaks 内置的注册表优化
+func (c *Client) Tweaks(ctx context.Context) ([]TweakInfo, error) {
+	var tweaks []TweakInfo
+	err := c.do(ctx, http.MethodGet, "/api/tweaks", nil, "", &tweaks)
+	return tweaks, err
+}
+
+// HistoryQuery 构建历史的筛选条件 (空值表示不限)
+type HistoryQuery struct {
+	Mode  BuildMode
+	Theme string   // none 表示没有应用主题的构建
+	State JobState // complete、failed 或 canceled
+	Since string   // 日期 (2006-01-02)、日期时间、RFC 3339 或相对时间 (如 7d)
+	Until string
+	Limit int
+}
+
+// History 构建历史 (最近的在前)
+func (c *Client) History(ctx context.Context, q HistoryQuery) ([]BuildRecord, error) {
+	params := url.Values{}
+	for k, v := range map[string]string{
+		"mode": string(q.Mode), "theme": q.Theme, "state": string(q.State),
+		"since": q.Since, "until": q.Until,
+	} {
+		if v != "" {
+			params.Set(k, v)
+		}
+	}
+	if q.Limit > 0 {
+		params.Set("limit", strconv.Itoa(q.Limit))
+	}
+	path := "/api/history"
+	if len(params) > 0 {
+		path += "?" + params.Encode()
+	}
+	var records []BuildRecord
+	err := c.do(ctx, http.MethodGet, path, nil, "", &records)
+	return records, err
+}
+
+// HistoryRecord 单条构建记录 (id 与任务 id 相同)
+func (c *Client) HistoryRecord(ctx context.Context, id string) (BuildRecord, error) {
+	var rec BuildRecord
+	err := c.do(ctx, http.MethodGet, "/api/history/"+url.PathEscape(id), nil, "", &rec)
+	return rec, err
+}
+
+// OpenAPI 服务器的 OpenAPI 3 文档
+func (c *Client) OpenAPI(ctx context.Context) (json.RawMessage, error) {
+	var doc json.RawMessage
+	err := c.do(ctx, http.MethodGet, "/api/openapi.json", nil, "", &doc)
+	return doc, err
+}
+
+// upload 以 multipart/form-data 上传文件 (边读边发送，不在内存中缓存)
+func (c *Client) upload(ctx context.Context, path string, fields map[string]string, fileName string, file io.Reader, out interface{}) error {
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		err := func() error {
+			for k, v := range fields {
+				if v == "" {
+					continue
+				}
+				if err := mw.WriteField(k, v); err != nil {
+					return err
+				}
+			}
+			part, err := mw.CreateFormFile("file", fileName)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(part, file); err != nil {
+				return err
+			}
+			return mw.Close()
+		}()
+		pw.CloseWithError(err)
+	}()
+	err := c.do(ctx, http.MethodPost, path, pr, mw.FormDataContentType(), out)
+	pr.Close()
+	return err
+}
+
+func (c *Client) newRequest(ctx context.Context, method, path string, body io.Reader, contentType string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return req, nil
+}
+
+// do 发送请求，把 JSON 响应解析到 out
+func (c *Client) do(ctx context.Context, method, path string, body io.Reader, contentType string, out interface{}) error {
+	req, err := c.newRequest(ctx, method, path, body, contentType)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return responseError(resp)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("解析响应失败: %w", err)
+	}
+	return nil
+}
+
+// responseError 把错误响应转换为 *Error
+func responseError(resp *http.Response) error {
+	e := &Error{StatusCode: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	var body BuildResponse
+	if json.Unmarshal(data, &body) == nil && body.Message != "" {
+		e.Message = body.Message
+		e.Detail = body.Error
+		e.Fields = body.Fields
+	} else {
+		e.Detail = strings.TrimSpace(string(data))
+	}
+	return e
+}
@@ -0,0 +1,160 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 事件流断开后重连的间隔和没有收到任何事件时的最多重连次数
+const (
+	reconnectDelay = time.Second
+	maxReconnects  = 5
+)
+
+// JobEvent 任务事件流中的一条事件
+type JobEvent struct {
+	ID    int
+	Type  string // state、step、progress 或 log
+	Job   *Job   // state 事件: 任务快照
+	Event *Event // step、progress、log 事件
+}
+
+// Events 接收任务的事件，直到任务结束、fn 返回错误或 ctx 取消
+//
+// 先收到已有的事件，再实时接收新事件。连接断开时带上最后的事件 id 重连，
+// 只补收之后的事件。
+func (c *Client) Events(ctx context.Context, id string, fn func(JobEvent) error) error {
+	last := 0
+	failures := 0
+	for {
+		received, done, err := c.readEvents(ctx, id, &last, fn)
+		switch {
+		case done:
+			return err
+		case ctx.Err() != nil:
+			return ctx.Err()
+		}
+
+		if received {
+			failures = 0
+		} else if failures++; failures > maxReconnects {
+			if err == nil {
+				err = fmt.Errorf("事件流意外断开")
+			}
+			return err
+		}
+		select {
+		case <-time.After(reconnectDelay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Wait 等待任务结束并返回最终状态；fn 不为空时同时接收事件
+func (c *Client) Wait(ctx context.Context, id string, fn func(JobEvent) error) (Job, error) {
+	err := c.Events(ctx, id, func(e JobEvent) error {
+		if fn != nil {
+			return fn(e)
+		}
+		return nil
+	})
+	if err != nil {
+		return Job{}, err
+	}
+	return c.Job(ctx, id)
+}
+
+// readEvents 读取一次连接中的事件
+//
+// done 为 true 时不再重连: 任务已结束、fn 返回错误或请求被拒绝 (如任务不存在)。
+func (c *Client) readEvents(ctx context.Context, id string, last *int, fn func(JobEvent) error) (received, done bool, err error) {
+	req, err := c.newRequest(ctx, http.MethodGet, "/api/jobs/"+url.PathEscape(id)+"/events", nil, "")
+	if err != nil {
+		return false, true, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if *last > 0 {
+		req.Header.Set("Last-Event-ID", strconv.Itoa(*last))
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return false, false, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNoContent:
+		return false, true, nil
+	case resp.StatusCode >= 400:
+		return false, true, responseError(resp)
+	}
+
+	var e JobEvent
+	var data strings.Builder
+	finished := false
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64<<10), 4<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			// 空行结束一条事件
+			if data.Len() > 0 {
+				if err := decodeEvent(&e, data.String()); err != nil {
+					return received, true, err
+				}
+				received = true
+				if e.ID > 0 {
+					*last = e.ID
+				}
+				if e.Job != nil && e.Job.Finished() {
+					finished = true
+				}
+				if err := fn(e); err != nil {
+					return received, true, err
+				}
+			}
+			e = JobEvent{}
+			data.Reset()
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "id":
+			e.ID, _ = strconv.Atoi(value)
+		case "event":
+			e.Type = value
+		case "data":
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(value)
+		}
+	}
+	// 服务器在任务结束后关闭连接
+	if finished {
+		return received, true, nil
+	}
+	return received, false, scanner.Err()
+}
+
+// decodeEvent 按事件类型解析数据
+func decodeEvent(e *JobEvent, data string) error {
+	if e.Type == EventState {
+		e.Job = new(Job)
+		return json.Unmarshal([]byte(data), e.Job)
+	}
+	e.Event = new(Event)
+	return json.Unmarshal([]byte(data), e.Event)
+}
@@ -0,0 +1,53 @@
+package client
+
+import (
+	"tiny11-builder/internal/logger"
+	"tiny11-builder/internal/profile"
+	"tiny11-builder/internal/types"
+	"tiny11-builder/internal/utils"
+)
+
+// 与服务器共用的类型 (OpenAPI 文档也由这些类型生成)
+
+type (
+	BuildRequest      = types.BuildRequest
+	BuildMode         = types.BuildMode
+	BuildStatus       = types.BuildStatus
+	BuildResponse     = types.BuildResponse
+	FieldError        = types.FieldError
+	Job               = types.Job
+	JobState          = types.JobState
+	Artifact          = types.Artifact
+	ThemeInfo         = types.ThemeInfo
+	PreinstallCatalog = types.PreinstallCatalog
+	PreinstallApp     = types.PreinstallApp
+	BuildRecord       = types.BuildRecord
+	StepTiming        = types.StepTiming
+	TweakInfo         = profile.TweakInfo
+	Event             = logger.Event
+	ProgressEvent     = utils.ProgressEvent
+)
+
+// 构建模式
+const (
+	ModeStandard = types.ModeStandard
+	ModeCore     = types.ModeCore
+	ModeNano     = types.ModeNano
+)
+
+// 任务状态
+const (
+	JobQueued   = types.JobQueued
+	JobRunning  = types.JobRunning
+	JobComplete = types.JobComplete
+	JobFailed   = types.JobFailed
+	JobCanceled = types.JobCanceled
+)
+
+// 事件流中的事件类型
+const (
+	EventState    = "state"
+	EventStep     = logger.EventStep
+	EventProgress = logger.EventProgress
+	EventLog      = logger.EventLog
+)